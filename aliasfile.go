@@ -5,6 +5,7 @@ package cmd
 
 import (
 	"io/ioutil"
+	"path/filepath"
 	"strings"
 )
 
@@ -46,8 +47,25 @@ func ParseAliasFile(aliasFilename string) map[string][]string {
 			continue
 		}
 
+		args, err := SplitArgs(value)
+		if err != nil {
+			logger.Warningf("line %d bad in alias file: %v: %s", i+1, err, line)
+			continue
+		}
 		logger.Tracef("setting alias %q=%q", name, value)
-		result[name] = strings.Fields(value)
+		result[name] = args
 	}
 	return result
 }
+
+// DefaultAliasFile returns the conventional location of the user alias
+// file for the named program, a file called "aliases" in its ConfigDir,
+// or the empty string if that cannot be determined.
+func DefaultAliasFile(name string) string {
+	dir, err := ConfigDir(name)
+	if err != nil {
+		logger.Debugf("no alias file: %v", err)
+		return ""
+	}
+	return filepath.Join(dir, "aliases")
+}
@@ -56,3 +56,30 @@ key =
 		"flags":  []string{"flags", "--with", "flag"},
 	})
 }
+
+func (*ParseAliasFileSuite) TestParseQuoted(c *gc.C) {
+	filename := filepath.Join(c.MkDir(), "aliases")
+	content := `
+single = add-note 'it''s a "note"'
+double = add-note "say \"hello\"" "back\\slash" "keep\n"
+escaped = add-note two\ words
+empty = add-note ""
+unterminated = add-note "oops
+trailing = add-note oops\
+`
+	err := ioutil.WriteFile(filename, []byte(content), 0644)
+	c.Assert(err, gc.IsNil)
+	aliases := cmd.ParseAliasFile(filename)
+	c.Assert(aliases, gc.DeepEquals, map[string][]string{
+		"single":  []string{"add-note", `its a "note"`},
+		"double":  []string{"add-note", `say "hello"`, `back\slash`, `keep\n`},
+		"escaped": []string{"add-note", "two words"},
+		"empty":   []string{"add-note", ""},
+	})
+}
+
+func (*ParseAliasFileSuite) TestDefaultAliasFile(c *gc.C) {
+	dir := c.MkDir()
+	defer testing.PatchEnvironment("XDG_CONFIG_HOME", dir)()
+	c.Assert(cmd.DefaultAliasFile("mytool"), gc.Equals, filepath.Join(dir, "mytool", "aliases"))
+}
@@ -0,0 +1,96 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// ArgFileReader may be implemented by a Command that takes long lists of
+// positional arguments, such as names of things to remove. When
+// ReadsArgFiles returns true, any positional argument of the form @file
+// is replaced, before Init is called, by the words read from the file,
+// which are separated by spaces or newlines, as in "mytool remove
+// @units.txt". The file "-" stands for Stdin, and an argument that
+// starts with "@@" is passed on with the first "@" removed. Such
+// commands should say so in their Info's Args, for example
+// "<unit>... | @<file>".
+type ArgFileReader interface {
+	ReadsArgFiles() bool
+}
+
+// stdinArgFiles stands for the @- argument files when they claim Stdin.
+type stdinArgFiles struct{}
+
+// readsArgFiles reports whether c expands @file arguments.
+func readsArgFiles(c Command) bool {
+	r, ok := c.(ArgFileReader)
+	return ok && r.ReadsArgFiles()
+}
+
+// expandArgFiles returns args with each @file argument replaced by the
+// words read from the file, relative to ctx.Dir, as described by
+// ArgFileReader. Stdin may only be read from once.
+func expandArgFiles(ctx *Context, args []string) ([]string, error) {
+	var expanded []string
+	readStdin := false
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "@@"):
+			expanded = append(expanded, arg[1:])
+			continue
+		case !strings.HasPrefix(arg, "@") || arg == "@":
+			expanded = append(expanded, arg)
+			continue
+		}
+		name := arg[1:]
+		var data []byte
+		var err error
+		if name == "-" {
+			if readStdin {
+				return nil, fmt.Errorf("cannot read arguments from stdin more than once")
+			}
+			readStdin = true
+			if ctx == nil || ctx.Stdin == nil {
+				return nil, fmt.Errorf("cannot read arguments from stdin: no input")
+			}
+			if previous, ok := ctx.claimStdin(stdinArgFiles{}, "@-"); !ok {
+				return nil, fmt.Errorf("%s and @- cannot both read from stdin", previous)
+			}
+			data, err = ioutil.ReadAll(ctx.Stdin)
+			if err != nil {
+				return nil, fmt.Errorf("cannot read arguments from stdin: %v", err)
+			}
+		} else {
+			path := name
+			if ctx != nil {
+				path = ctx.AbsPath(name)
+			}
+			data, err = ioutil.ReadFile(path)
+			if err != nil {
+				if pathErr, ok := err.(*os.PathError); ok {
+					err = pathErr.Err
+				}
+				return nil, fmt.Errorf("cannot read arguments from %s: %v", name, err)
+			}
+		}
+		expanded = append(expanded, strings.Fields(string(data))...)
+	}
+	return expanded, nil
+}
+
+// initWithArgFiles calls c.Init with args, first expanding any @file
+// arguments if c reads them.
+func initWithArgFiles(ctx *Context, c Command, args []string) error {
+	if readsArgFiles(c) {
+		var err error
+		if args, err = expandArgFiles(ctx, args); err != nil {
+			return err
+		}
+	}
+	return c.Init(args)
+}
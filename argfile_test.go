@@ -0,0 +1,129 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/cmd"
+	"github.com/juju/cmd/cmdtesting"
+)
+
+type ArgFileSuite struct{}
+
+var _ = gc.Suite(&ArgFileSuite{})
+
+// removeCommand prints the units it is given, and reads @file arguments
+// if readArgFiles is set.
+type removeCommand struct {
+	cmd.CommandBase
+	readArgFiles bool
+	units        []string
+}
+
+func (c *removeCommand) Info() *cmd.Info {
+	return &cmd.Info{Name: "remove", Args: "<unit>... | @<file>"}
+}
+
+func (c *removeCommand) ReadsArgFiles() bool {
+	return c.readArgFiles
+}
+
+func (c *removeCommand) Init(args []string) error {
+	c.units = args
+	return nil
+}
+
+func (c *removeCommand) Run(ctx *cmd.Context) error {
+	fmt.Fprintf(ctx.Stdout, "%q\n", c.units)
+	return nil
+}
+
+func (s *ArgFileSuite) TestArgFiles(c *gc.C) {
+	dir := c.MkDir()
+	err := ioutil.WriteFile(filepath.Join(dir, "units.txt"), []byte("unit/1 unit/2\n\nunit/3\n"), 0644)
+	c.Assert(err, gc.IsNil)
+	for i, test := range []struct {
+		args   []string
+		stdin  string
+		stdout string
+		stderr string
+	}{{
+		args:   []string{"unit/0", "@units.txt", "unit/4"},
+		stdout: `["unit/0" "unit/1" "unit/2" "unit/3" "unit/4"]` + "\n",
+	}, {
+		args:   []string{"@" + filepath.Join(dir, "units.txt")},
+		stdout: `["unit/1" "unit/2" "unit/3"]` + "\n",
+	}, {
+		args:   []string{"@-", "unit/9"},
+		stdin:  "unit/7\tunit/8\n",
+		stdout: `["unit/7" "unit/8" "unit/9"]` + "\n",
+	}, {
+		args:   []string{"@@units.txt", "@"},
+		stdout: `["@units.txt" "@"]` + "\n",
+	}, {
+		args:   []string{"@missing.txt"},
+		stderr: "error: cannot read arguments from missing.txt: no such file or directory\n",
+	}, {
+		args:   []string{"@-", "@-"},
+		stderr: "error: cannot read arguments from stdin more than once\n",
+	}} {
+		c.Logf("test %d: %q", i, test.args)
+		for _, super := range []bool{false, true} {
+			var command cmd.Command = &removeCommand{readArgFiles: true}
+			args := test.args
+			if super {
+				jc := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "jujutest"})
+				jc.Register(command)
+				command = jc
+				args = append([]string{"remove"}, args...)
+			}
+			var stdout, stderr bytes.Buffer
+			ctx := &cmd.Context{
+				Dir:    dir,
+				Stdin:  bytes.NewBufferString(test.stdin),
+				Stdout: &stdout,
+				Stderr: &stderr,
+			}
+			code := cmd.Main(command, ctx, args)
+			if test.stderr != "" {
+				c.Check(code, gc.Equals, 2)
+			} else {
+				c.Check(code, gc.Equals, 0)
+			}
+			c.Check(stdout.String(), gc.Equals, test.stdout)
+			c.Check(stderr.String(), gc.Equals, test.stderr)
+		}
+	}
+}
+
+func (s *ArgFileSuite) TestArgFilesNotRead(c *gc.C) {
+	ctx := &cmd.Context{
+		Dir:    c.MkDir(),
+		Stdin:  &bytes.Buffer{},
+		Stdout: &bytes.Buffer{},
+		Stderr: &bytes.Buffer{},
+	}
+	code := cmd.Main(&removeCommand{}, ctx, []string{"@units.txt", "@@x"})
+	c.Check(code, gc.Equals, 0)
+	c.Check(ctx.Stdout.(*bytes.Buffer).String(), gc.Equals, `["@units.txt" "@@x"]`+"\n")
+}
+
+func (s *ArgFileSuite) TestArgFilesSetContext(c *gc.C) {
+	dir := c.MkDir()
+	err := ioutil.WriteFile(filepath.Join(dir, "units.txt"), []byte("unit/1 unit/2\n"), 0644)
+	c.Assert(err, gc.IsNil)
+	remove := &removeCommand{readArgFiles: true}
+	jc := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "jujutest"})
+	jc.Register(remove)
+	jc.SetContext(&cmd.Context{Dir: dir})
+	err = cmdtesting.InitCommand(jc, []string{"remove", "@units.txt"})
+	c.Assert(err, gc.IsNil)
+	c.Check(remove.units, gc.DeepEquals, []string{"unit/1", "unit/2"})
+}
@@ -5,15 +5,18 @@ package cmd
 
 import (
 	"bytes"
-	"errors"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"sort"
 	"strings"
+	"syscall"
 
+	"github.com/juju/errors"
 	"launchpad.net/gnuflag"
 )
 
@@ -29,8 +32,10 @@ func (e *RcPassthroughError) Error() string {
 }
 
 // IsRcPassthroughError returns whether the error is an RcPassthroughError.
+// An RcPassthroughError annotated with the github.com/juju/errors package
+// is still recognised.
 func IsRcPassthroughError(err error) bool {
-	_, ok := err.(*RcPassthroughError)
+	_, ok := errors.Cause(err).(*RcPassthroughError)
 	return ok
 }
 
@@ -41,19 +46,94 @@ func NewRcPassthroughError(code int) error {
 	return &RcPassthroughError{code}
 }
 
+// Exit codes used by Main. Commands that choose their own exit codes with
+// RcError or RcPassthroughError should avoid these, apart from
+// ExitFailure, so that callers can tell them apart.
+const (
+	// ExitSuccess is returned when a command succeeds.
+	ExitSuccess = 0
+
+	// ExitFailure is returned when Run returns an error.
+	ExitFailure = 1
+
+	// ExitUsage is returned when the command line cannot be parsed, or
+	// is rejected by Init.
+	ExitUsage = 2
+
+	// ExitTimeout is returned when a command does not finish before the
+	// timeout given with the --timeout flag, matching timeout(1).
+	ExitTimeout = 124
+
+	// ExitSignal is added to the number of the signal that interrupted
+	// a command, so a command interrupted by SIGINT exits with 130.
+	ExitSignal = 128
+)
+
+// RcError is an error that causes Main to print Err, as it does for other
+// errors, and to exit with Code rather than ExitFailure.
+type RcError struct {
+	Code int
+	Err  error
+}
+
+// Error implements error.
+func (e *RcError) Error() string {
+	return e.Err.Error()
+}
+
+// NewRcError returns an error that causes Main to print err and exit with
+// the given code. The RcError may be annotated with the
+// github.com/juju/errors package and still be recognised.
+func NewRcError(code int, err error) error {
+	return &RcError{Code: code, Err: err}
+}
+
+// causeRcError returns the RcError that caused err, or nil if there is
+// none, along with the error to report for it: the RcError's Err, or err
+// itself when it annotates the RcError, so the annotations are kept.
+func causeRcError(err error) (*RcError, error) {
+	rcErr, ok := errors.Cause(err).(*RcError)
+	if !ok {
+		return nil, err
+	}
+	if err == error(rcErr) {
+		return rcErr, rcErr.Err
+	}
+	return rcErr, err
+}
+
+// UsageError is an error that a Command's Init can return when the
+// command has been used wrongly, to have Main print the command's usage
+// summary after Err, with the "error:" prefix as for other errors, and
+// exit with ExitUsage. Other errors returned by Init are printed on their
+// own, with the same exit code.
+type UsageError struct {
+	Err error
+}
+
+// Error implements error.
+func (e *UsageError) Error() string {
+	return e.Err.Error()
+}
+
+// NewUsageError returns an error that causes Main to print err followed
+// by the command's usage summary.
+func NewUsageError(err error) error {
+	return &UsageError{Err: err}
+}
+
 // ErrSilent can be returned from Run to signal that Main should exit with
-// code 1 without producing error output.
+// code 1 without producing error output, typically because the command has
+// already reported the problem itself. ErrSilent may be annotated with the
+// github.com/juju/errors package and still be recognised.
 var ErrSilent = errors.New("cmd: error out silently")
 
 // IsErrSilent returns whether the error should be logged from cmd.Main.
 func IsErrSilent(err error) bool {
-	if err == ErrSilent {
+	if errors.Cause(err) == ErrSilent {
 		return true
 	}
-	if _, ok := err.(*RcPassthroughError); ok {
-		return true
-	}
-	return false
+	return IsRcPassthroughError(err)
 }
 
 // Command is implemented by types that interpret command-line arguments.
@@ -65,6 +145,12 @@ type Command interface {
 	Info() *Info
 
 	// SetFlags adds command specific flags to the flag set.
+	//
+	// Flags with long names may be given as --name=value or --name value,
+	// and flags with single letter names as -n value or -nvalue. Single
+	// letter boolean flags may be clustered, so -ab is the same as -a -b,
+	// and the last flag in a cluster may take a value, as in -abn value.
+	// Note that -n=value sets the value of -n to "=value".
 	SetFlags(f *gnuflag.FlagSet)
 
 	// Init initializes the Command before running.
@@ -79,6 +165,48 @@ type Command interface {
 	AllowInterspersedFlags() bool
 }
 
+// ArgFlagsSetter may be implemented by a Command whose valid flags depend
+// on its positional arguments, as in "mytool config <app> --<app-flag>".
+//
+// The flags of such a Command are parsed in two phases. First the flags
+// added by SetFlags that come before the first positional argument are
+// parsed. SetArgFlags is then called with the remaining arguments,
+// starting with the first positional one, and may add further flags to f
+// or return an error if the arguments are invalid. Finally the remaining
+// arguments are parsed with all the flags, and those left over are passed
+// to Init as usual. Flags added by SetArgFlags must therefore follow the
+// positional arguments they depend on; given before them, they are
+// reported as not defined.
+type ArgFlagsSetter interface {
+	SetArgFlags(f *gnuflag.FlagSet, args []string) error
+}
+
+// ContextSetter may be implemented by a Command that needs the Context it
+// is to be run in before it is initialized, as SuperCommand does to read
+// @file arguments and show its ProgramName. Main calls SetContext before
+// the command's SetFlags. A Command that wraps another should pass the
+// call on to it.
+type ContextSetter interface {
+	SetContext(ctx *Context)
+}
+
+// parseFlags parses args with f on behalf of c, in two phases if c is an
+// ArgFlagsSetter.
+func parseFlags(c Command, f *gnuflag.FlagSet, args []string) error {
+	setter, ok := c.(ArgFlagsSetter)
+	if !ok {
+		return f.Parse(c.AllowInterspersedFlags(), rewriteNegatedFlags(f, args))
+	}
+	if err := f.Parse(false, rewriteNegatedFlags(f, args)); err != nil {
+		return err
+	}
+	args = f.Args()
+	if err := setter.SetArgFlags(f, args); err != nil {
+		return err
+	}
+	return f.Parse(c.AllowInterspersedFlags(), rewriteNegatedFlags(f, args))
+}
+
 // CommandBase provides the default implementation for SetFlags, Init, and Help.
 type CommandBase struct{}
 
@@ -105,16 +233,99 @@ func (c *CommandBase) AllowInterspersedFlags() bool {
 // should interpret file names relative to Dir (see AbsPath below), and print
 // output and errors to Stdout and Stderr respectively.
 type Context struct {
-	Dir     string
-	Env     map[string]string
-	Stdin   io.Reader
-	Stdout  io.Writer
-	Stderr  io.Writer
-	quiet   bool
-	verbose bool
+	Dir    string
+	Env    map[string]string
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// DryRun is set when the command should report what it would do
+	// without making any changes, as with the --dry-run flag of a
+	// SuperCommand. The framework provides the flag and Confirm never
+	// agrees to go ahead, but it is the responsibility of each command
+	// to check DryRun before doing anything with side effects.
+	DryRun bool
+
+	// AssumeYes is set when Confirm should answer yes to every question
+	// without asking.
+	AssumeYes bool
+
+	// ProgramName, if set, is the name the program was invoked as, which
+	// DefaultContext takes from os.Args[0]. Main uses it in place of the
+	// name of the command it runs in help and usage output, so that a
+	// binary installed under several names, or run through a symlink,
+	// describes itself by the name it was given.
+	ProgramName string
+
+	// Logger, if set, receives the diagnostic messages that commands log
+	// with GetLogger, along with the messages that Infof, Verbosef and
+	// Progressf log instead of writing them to Stderr. A program that
+	// embeds commands can set it to route those messages, or a test to
+	// capture them.
+	Logger Logger
+
+	quiet    bool
+	verbose  bool
+	debug    bool
+	color    ColorMode
+	progress bool
+	noPager  bool
+	ctx      context.Context
+
+	// assumeYesFlag is set when the -y and --assume-yes flags are
+	// available, so that Confirm can suggest them.
+	assumeYesFlag bool
+
+	// stdinOwner is the FileVar, or the @- argument files, that read
+	// from Stdin, if any, and stdinOwnerName describes it for errors.
+	stdinOwner     interface{}
+	stdinOwnerName string
+
+	// errorFormatter, if set, is the machine readable format chosen
+	// with --format, in which errors are reported.
+	errorFormatter Formatter
+
+	// timings, if set, records the phases timed with StartPhase.
+	timings *timings
+
+	// outputBuffer, if set, is holding back what is written to Stdout
+	// until the command has finished.
+	outputBuffer *outputBuffer
+
+	// warnings holds the messages given to Warnf that have not yet
+	// been written.
+	warnings []string
+}
+
+// Context returns the context.Context for the command being run. When
+// the command is run by Main, it is cancelled if the process receives
+// SIGINT or SIGTERM, so long running commands should stop when it is
+// done.
+func (ctx *Context) Context() context.Context {
+	if ctx.ctx == nil {
+		return context.Background()
+	}
+	return ctx.ctx
+}
+
+// Interrupted reports whether the context returned by Context has been
+// cancelled, because the process received SIGINT or SIGTERM, the command
+// timed out, or the context was cancelled by whoever ran the command.
+// A deferred cleanup function can use it to tell whether the command is
+// being abandoned, in which case it may leave partial work in place so
+// that it can be resumed, rather than failing normally.
+//
+// The answer is only a snapshot: a signal may arrive just after
+// Interrupted returns false, so a command should check Interrupted once
+// and act on that answer rather than relying on it staying the same.
+// Once Interrupted has returned true, it keeps doing so until the command
+// has finished.
+func (ctx *Context) Interrupted() bool {
+	return ctx.Context().Err() != nil
 }
 
 func (ctx *Context) write(format string, params ...interface{}) {
+	ctx.ClearProgress()
 	output := fmt.Sprintf(format, params...)
 	if !strings.HasSuffix(output, "\n") {
 		output = output + "\n"
@@ -126,7 +337,7 @@ func (ctx *Context) write(format string, params ...interface{}) {
 // quiet is true the message is logged.
 func (ctx *Context) Infof(format string, params ...interface{}) {
 	if ctx.quiet {
-		logger.Infof(format, params...)
+		ctx.GetLogger().Infof(format, params...)
 	} else {
 		ctx.write(format, params...)
 	}
@@ -138,17 +349,108 @@ func (ctx *Context) Verbosef(format string, params ...interface{}) {
 	if ctx.verbose {
 		ctx.write(format, params...)
 	} else {
-		logger.Infof(format, params...)
+		ctx.GetLogger().Infof(format, params...)
+	}
+}
+
+// Warnf records a warning about a problem that does not stop the command,
+// such as an item that had to be skipped. The warnings are written to
+// Stderr under a "Warnings:" heading once Main has run the command, even
+// if it fails, so that they are neither mixed up with its output nor
+// lost in it. Unlike Infof, Warnf is not silenced by quiet.
+func (ctx *Context) Warnf(format string, params ...interface{}) {
+	ctx.warnings = append(ctx.warnings, strings.TrimRight(fmt.Sprintf(format, params...), "\n"))
+}
+
+// Warnings returns the warnings recorded with Warnf that have not yet been
+// written to Stderr.
+func (ctx *Context) Warnings() []string {
+	return ctx.warnings
+}
+
+// writeWarnings writes the warnings recorded with Warnf to Stderr, and
+// forgets them.
+func (ctx *Context) writeWarnings() {
+	if len(ctx.warnings) == 0 {
+		return
+	}
+	ctx.ClearProgress()
+	fmt.Fprintln(ctx.Stderr, ctx.colorize(ansiYellow, "Warnings:"))
+	for _, warning := range ctx.warnings {
+		fmt.Fprintf(ctx.Stderr, "  %s\n", strings.Replace(warning, "\n", "\n  ", -1))
+	}
+	ctx.warnings = nil
+}
+
+// Progressf writes the formatted string to Stderr as a progress message
+// if quiet is false, but if quiet is true the message is logged. When
+// Stderr is a terminal the message is transient: it is overwritten by the
+// next progress message, and cleared before any other output is written
+// through the Context.
+func (ctx *Context) Progressf(format string, params ...interface{}) {
+	if ctx.quiet {
+		ctx.GetLogger().Infof(format, params...)
+		return
+	}
+	if !isTerminalWriter(ctx.Stderr) {
+		ctx.write(format, params...)
+		return
 	}
+	output := strings.TrimRight(fmt.Sprintf(format, params...), "\n")
+	fmt.Fprintf(ctx.Stderr, "\r%s%s", output, ansiClearLine)
+	ctx.progress = true
+}
+
+// ClearProgress removes any transient progress message written to a
+// terminal by Progressf.
+func (ctx *Context) ClearProgress() {
+	if ctx.progress {
+		fmt.Fprint(ctx.Stderr, "\r"+ansiClearLine)
+		ctx.progress = false
+	}
+}
+
+// Quiet reports whether informational output is suppressed.
+func (ctx *Context) Quiet() bool {
+	return ctx.quiet
+}
+
+// Verbose reports whether verbose output is shown.
+func (ctx *Context) Verbose() bool {
+	return ctx.verbose
 }
 
 // Getenv looks up an environment variable in the context. It mirrors
-// os.Getenv. An empty string is returned if the key is not set.
+// os.Getenv. An empty string is returned if the key is not set. The
+// context returned by DefaultContext starts with the environment of the
+// process, so commands that read their environment with Getenv rather
+// than os.Getenv can be tested without changing the process environment.
 func (ctx *Context) Getenv(key string) string {
 	value, _ := ctx.Env[key]
 	return value
 }
 
+// lookupEnv returns the value of the environment variable key in Env, or
+// in the process environment if Env is nil, so that a Context whose Env
+// is set does not depend on the environment of the process. Like
+// os.LookupEnv, it also reports whether the variable is set. All of the
+// environment that the package reads on behalf of a Context is read
+// with lookupEnv or getenv.
+func (ctx *Context) lookupEnv(key string) (string, bool) {
+	if ctx == nil || ctx.Env == nil {
+		return os.LookupEnv(key)
+	}
+	value, ok := ctx.Env[key]
+	return value, ok
+}
+
+// getenv returns the value of the environment variable key as found by
+// lookupEnv, or an empty string if it is not set.
+func (ctx *Context) getenv(key string) string {
+	value, _ := ctx.lookupEnv(key)
+	return value
+}
+
 // Setenv sets an environment variable in the context. It mirrors os.Setenv.
 func (ctx *Context) Setenv(key, value string) error {
 	if ctx.Env == nil {
@@ -167,11 +469,51 @@ func (ctx *Context) AbsPath(path string) string {
 	return filepath.Join(ctx.Dir, path)
 }
 
+// Logger is implemented by loggers that receive diagnostic messages, as
+// opposed to output meant for the user. It is implemented by
+// loggo.Logger.
+type Logger interface {
+	Debugf(format string, params ...interface{})
+	Infof(format string, params ...interface{})
+	Warningf(format string, params ...interface{})
+	Errorf(format string, params ...interface{})
+}
+
+// GetLogger returns the Logger that commands should log diagnostic
+// messages with, rather than writing them to Stderr. It is the Context's
+// Logger if that is set, or else the "cmd" loggo logger, whose messages
+// are written as configured by the Log of the SuperCommand being run.
+func (ctx *Context) GetLogger() Logger {
+	if ctx.Logger != nil {
+		return ctx.Logger
+	}
+	return logger
+}
+
 // GetStdin satisfies environs.BootstrapContext
 func (ctx *Context) GetStdin() io.Reader {
 	return ctx.Stdin
 }
 
+// ReadStdin reads all of Stdin, returning an error if it holds more than
+// maxBytes bytes.
+func (ctx *Context) ReadStdin(maxBytes int64) ([]byte, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(ctx.Stdin, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, fmt.Errorf("stdin exceeds the maximum size of %d bytes", maxBytes)
+	}
+	return data, nil
+}
+
+// StdinIsTerminal reports whether Stdin refers to a terminal, so that
+// commands can refuse to wait for input that a user is unlikely to type.
+func (ctx *Context) StdinIsTerminal() bool {
+	return isTerminalReader(ctx.Stdin)
+}
+
 // GetStdout satisfies environs.BootstrapContext
 func (ctx *Context) GetStdout() io.Writer {
 	return ctx.Stdout
@@ -208,34 +550,95 @@ type Info struct {
 
 	// Aliases are other names for the Command.
 	Aliases []string
+
+	// Category, if set, is the heading under which the Command is listed
+	// in the help of its SuperCommand. It does not affect how the
+	// Command is run.
+	Category string
+
+	// Deprecated, if set, marks the Command as deprecated in favour of
+	// the named command. A warning is shown when the Command is run.
+	Deprecated string
+
+	// DeprecatedAliases are other names for the Command that show a
+	// warning recommending the Command's name when they are used.
+	DeprecatedAliases []string
+
+	// Examples holds examples of how the Command is used, which are
+	// shown after the Doc in the Command's help.
+	Examples []Example
+
+	// ExitCodes, if set, documents what the exit codes of the Command
+	// mean, by code, so that scripts can tell its failures apart. They
+	// are listed under "Exit status:" in the Command's help. The codes
+	// are those of the RcErrors returned by Run, and ExitSuccess and
+	// friends where they apply.
+	ExitCodes map[int]string
+}
+
+// Example describes an example invocation of a Command.
+type Example struct {
+	// Description says what the example does.
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+
+	// Command holds the example command line, such as
+	// "mytool deploy wordpress --to 0".
+	Command string `json:"command" yaml:"command"`
 }
 
 // Help renders i's content, along with documentation for any
 // flags defined in f. It calls f.SetOutput(ioutil.Discard).
+// The text is wrapped to 80 columns.
 func (i *Info) Help(f *gnuflag.FlagSet) []byte {
+	return i.help(f, defaultTerminalWidth)
+}
+
+// help renders i's content like Help, wrapping the summary and details,
+// and the usage text of the flags, to width columns.
+func (i *Info) help(f *gnuflag.FlagSet, width int) []byte {
 	buf := &bytes.Buffer{}
-	fmt.Fprintf(buf, "Usage: %s", i.Name)
+	buf.WriteString(i.usage(f))
 	hasOptions := false
 	f.VisitAll(func(f *gnuflag.Flag) { hasOptions = true })
-	if hasOptions {
-		fmt.Fprintf(buf, " [options]")
-	}
-	if i.Args != "" {
-		fmt.Fprintf(buf, " %s", i.Args)
-	}
-	fmt.Fprintf(buf, "\n")
 	if i.Purpose != "" {
-		fmt.Fprintf(buf, "\nSummary:\n%s\n", strings.TrimSpace(i.Purpose))
+		fmt.Fprintf(buf, "\nSummary:\n%s\n", wrapText(strings.TrimSpace(i.Purpose), width))
 	}
 	if hasOptions {
 		fmt.Fprintf(buf, "\nOptions:\n")
-		f.SetOutput(buf)
-		f.PrintDefaults()
+		var options bytes.Buffer
+		printDefaults(f, &options)
+		fmt.Fprint(buf, wrapIndented(options.String(), "    ", width))
 	}
 	f.SetOutput(ioutil.Discard)
 	if i.Doc != "" {
 		fmt.Fprintf(buf, "\nDetails:\n")
-		fmt.Fprintf(buf, "%s\n", strings.TrimSpace(i.Doc))
+		fmt.Fprintf(buf, "%s\n", wrapText(strings.TrimSpace(i.Doc), width))
+	}
+	if len(i.Examples) > 0 {
+		fmt.Fprintf(buf, "\nExamples:\n")
+		for j, example := range i.Examples {
+			if j > 0 {
+				fmt.Fprintf(buf, "\n")
+			}
+			if description := strings.TrimSpace(example.Description); description != "" {
+				fmt.Fprintf(buf, "%s\n", wrapIndented("    "+description, "    ", width))
+			}
+			fmt.Fprintf(buf, "        %s\n", strings.TrimSpace(example.Command))
+		}
+	}
+	if len(i.ExitCodes) > 0 {
+		fmt.Fprintf(buf, "\nExit status:\n")
+		codes := i.exitCodes()
+		codeWidth := len(fmt.Sprint(codes[len(codes)-1]))
+		for _, code := range codes {
+			prefix := fmt.Sprintf("    %*d  ", codeWidth, code)
+			for j, line := range wrapWords(strings.TrimSpace(i.ExitCodes[code]), "", width-len(prefix)) {
+				if j > 0 {
+					prefix = strings.Repeat(" ", len(prefix))
+				}
+				fmt.Fprintf(buf, "%s%s\n", prefix, line)
+			}
+		}
 	}
 	if len(i.Aliases) > 0 {
 		fmt.Fprintf(buf, "\nAliases: %s\n", strings.Join(i.Aliases, ", "))
@@ -243,54 +646,263 @@ func (i *Info) Help(f *gnuflag.FlagSet) []byte {
 	return buf.Bytes()
 }
 
+// exitCodes returns the codes documented in i.ExitCodes, in order.
+func (i *Info) exitCodes() []int {
+	codes := make([]int, 0, len(i.ExitCodes))
+	for code := range i.ExitCodes {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	return codes
+}
+
+// usage returns the first line of the help rendered by Help, which
+// summarises how the command is invoked.
+func (i *Info) usage(f *gnuflag.FlagSet) string {
+	return "Usage: " + i.usageLine(f) + "\n"
+}
+
+// usageLine returns the command's name followed by the options and
+// arguments it takes, as in "remote [options] <name>".
+func (i *Info) usageLine(f *gnuflag.FlagSet) string {
+	usage := i.Name
+	hasOptions := false
+	f.VisitAll(func(f *gnuflag.Flag) { hasOptions = true })
+	if hasOptions {
+		usage += " [options]"
+	}
+	if i.Args != "" {
+		usage += " " + i.Args
+	}
+	return usage
+}
+
+// flagError holds an error from parsing the flags of a command, for which
+// Main shows the command's usage along with the error.
+type flagError struct {
+	err error
+}
+
+func (e *flagError) Error() string {
+	return e.err.Error()
+}
+
+// newFlagError returns err, marked as an error from parsing flags unless
+// it is nil or gnuflag.ErrHelp.
+func newFlagError(err error) error {
+	if err == nil || err == gnuflag.ErrHelp {
+		return err
+	}
+	return &flagError{err}
+}
+
 // Errors from commands can be ErrSilent (don't print an error message),
 // ErrHelp (show the help) or some other error related to needed flags
 // missing, or needed positional args missing, in which case we should
 // print the error and return a non-zero return code.
 func handleCommandError(c Command, ctx *Context, err error, f *gnuflag.FlagSet) (rc int, done bool) {
-	switch err {
+	switch errors.Cause(err) {
 	case nil:
 		return 0, false
 	case gnuflag.ErrHelp:
-		ctx.Stdout.Write(c.Info().Help(f))
-		return 0, true
+		ctx.Stdout.Write(ctx.commandInfo(c).help(f, ctx.TerminalWidth()))
+		return ExitSuccess, true
 	case ErrSilent:
-		return 2, true
-	default:
-		fmt.Fprintf(ctx.Stderr, "error: %v\n", err)
-		return 2, true
+		return ExitUsage, true
+	}
+	var usageErr error
+	switch e := errors.Cause(err).(type) {
+	case *flagError:
+		usageErr = e.err
+	case *UsageError:
+		usageErr = err
+	}
+	if usageErr != nil {
+		// Help is written to Stdout when asked for, but usage is
+		// written to Stderr with the error that calls for it.
+		ctx.writeError(usageErr, ExitUsage)
+		if ctx.errorFormatter == nil {
+			fmt.Fprint(ctx.Stderr, ctx.commandInfo(c).usage(f))
+		}
+		return ExitUsage, true
+	}
+	if argsErr, ok := err.(*unrecognizedArgsError); ok {
+		err = &unrecognizedArgsError{
+			args:  argsErr.args,
+			usage: ctx.commandInfo(c).usageLine(f),
+		}
+	}
+	ctx.writeError(err, ExitUsage)
+	return ExitUsage, true
+}
+
+// commandInfo returns the Info of the command run by Main, named after
+// ctx.ProgramName if that is set. The Info of a SuperCommand already
+// includes the name of its selected subcommand, so the SuperCommand is
+// given ctx with SetContext and renames itself instead.
+func (ctx *Context) commandInfo(c Command) *Info {
+	info := c.Info()
+	if ctx.ProgramName == "" || c.IsSuperCommand() {
+		return info
 	}
+	renamed := *info
+	renamed.Name = ctx.ProgramName
+	return &renamed
 }
 
 // Main runs the given Command in the supplied Context with the given
 // arguments, which should not include the command name. It returns a code
-// suitable for passing to os.Exit.
+// suitable for passing to os.Exit; see ExitSuccess and friends for the
+// codes it uses. If ctx is nil, the Context returned by DefaultContext
+// is used.
+//
+// Errors are written to ctx.Stderr with an "error:" prefix, unless a
+// machine readable output format such as json or yaml has been chosen
+// with the command's --format flag. Errors found once the command line
+// has been parsed are then written to ctx.Stderr in that format instead,
+// as an object with "error" and "code" fields holding the error message
+// and the exit code, so that programs can tell them from the output.
+//
+// Main also accepts --cpuprofile and --memprofile flags for any command,
+// which are not listed in help. They name files that CPU and memory
+// profiles of the command are written to, in the format read by
+// "go tool pprof".
 func Main(c Command, ctx *Context, args []string) int {
-	f := gnuflag.NewFlagSet(c.Info().Name, gnuflag.ContinueOnError)
+	if ctx == nil {
+		var err error
+		if ctx, err = DefaultContext(); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return ExitFailure
+		}
+	}
+	profile, args, err := splitProfileFlags(args)
+	if err != nil {
+		fmt.Fprintf(ctx.Stderr, "error: %v\n", err)
+		return ExitUsage
+	}
+	if profile != (profileFlags{}) {
+		stop, err := profile.start(ctx)
+		if err != nil {
+			fmt.Fprintf(ctx.Stderr, "error: %v\n", err)
+			return ExitFailure
+		}
+		defer stop()
+	}
+	if setter, ok := c.(ContextSetter); ok {
+		setter.SetContext(ctx)
+	}
+	f := gnuflag.NewFlagSet(ctx.commandInfo(c).Name, gnuflag.ContinueOnError)
 	f.SetOutput(ioutil.Discard)
 	c.SetFlags(f)
-	if rc, done := handleCommandError(c, ctx, f.Parse(c.AllowInterspersedFlags(), args), f); done {
+	versioner, ok := c.(Versioner)
+	showVersion := false
+	if ok && !c.IsSuperCommand() {
+		addVersionFlag(f, &showVersion)
+	}
+	args = splitPassthroughArgs(c, args)
+	if rc, done := handleCommandError(c, ctx, newFlagError(parseFlags(c, f, args)), f); done {
+		return rc
+	}
+	if showVersion {
+		return runError(ctx, printVersion(ctx, versioner.Version()))
+	}
+	resolveEnvDefaults(ctx, f)
+	if rc, done := handleCommandError(c, ctx, checkStdinFlags(ctx, f), f); done {
 		return rc
 	}
+	ctx.errorFormatter = machineFormatter(f)
 	// Since SuperCommands can also return gnuflag.ErrHelp errors, we need to
 	// handle both those types of errors as well as "real" errors.
-	if rc, done := handleCommandError(c, ctx, c.Init(f.Args()), f); done {
+	if rc, done := handleCommandError(c, ctx, initWithArgFiles(ctx, c, f.Args()), f); done {
+		return rc
+	}
+	if rc, done := handleCommandError(c, ctx, checkExistingFiles(ctx, f), f); done {
 		return rc
 	}
-	if err := c.Run(ctx); err != nil {
-		if IsRcPassthroughError(err) {
-			return err.(*RcPassthroughError).Code
+	warnDeprecatedFlags(ctx, f)
+	if err := promptSecrets(ctx, f); err != nil {
+		return runError(ctx, err)
+	}
+	if handlesSignals(c) {
+		err := c.Run(ctx)
+		ctx.ClearProgress()
+		ctx.writeWarnings()
+		ctx.writeTimings()
+		return runError(ctx, err)
+	}
+	stop := ctx.cancelOnInterrupt()
+	err = c.Run(ctx)
+	ctx.ClearProgress()
+	ctx.writeWarnings()
+	ctx.writeTimings()
+	if sig := stop(); sig != nil {
+		// The command was interrupted, so there is no need to
+		// report that its context was cancelled.
+		if err != nil && errors.Cause(err) != ErrSilent && errors.Cause(err) != context.Canceled {
+			ctx.writeError(err, signalExitCode(sig))
 		}
-		if err != ErrSilent {
-			fmt.Fprintf(ctx.Stderr, "error: %v\n", err)
+		return signalExitCode(sig)
+	}
+	return runError(ctx, err)
+}
+
+// runError reports any error returned by a command's Run method and
+// returns the exit code for it. Failing to write to Stdout because the
+// program reading the output has gone away, as when it is piped to head,
+// is not an error.
+func runError(ctx *Context, err error) int {
+	if ctx.isBrokenStdout(err) {
+		return ExitSuccess
+	}
+	if err != nil {
+		if passErr, ok := errors.Cause(err).(*RcPassthroughError); ok {
+			return passErr.Code
+		}
+		if rcErr, report := causeRcError(err); rcErr != nil {
+			ctx.writeError(report, rcErr.Code)
+			return rcErr.Code
+		}
+		if flagErr, ok := err.(*flagError); ok {
+			ctx.writeError(flagErr.err, ExitUsage)
+			return ExitUsage
+		}
+		if errors.Cause(err) != ErrSilent {
+			ctx.writeError(err, ExitFailure)
 		}
-		return 1
+		return ExitFailure
 	}
-	return 0
+	return ExitSuccess
+}
+
+// isBrokenStdout reports whether err was caused by writing to Stdout, when
+// it is a pipe, after the reading end was closed. A Go program that writes
+// to its own broken standard output is killed by SIGPIPE unless it handles
+// that signal, so this applies to programs that do, and to contexts whose
+// Stdout is some other pipe.
+func (ctx *Context) isBrokenStdout(err error) bool {
+	if err == nil {
+		return false
+	}
+	f, ok := ctx.Stdout.(*os.File)
+	if !ok {
+		return false
+	}
+	pathErr, ok := errors.Cause(err).(*os.PathError)
+	return ok && pathErr.Op == "write" && pathErr.Path == f.Name() && pathErr.Err == syscall.EPIPE
 }
 
 // DefaultContext returns a Context suitable for use in non-hosted situations.
+// It reads from and writes to the standard streams of the process, and
+// Dir is the current working directory.
 func DefaultContext() (*Context, error) {
+	return NewContext(os.Stdin, os.Stdout, os.Stderr)
+}
+
+// NewContext returns a Context like the one returned by DefaultContext,
+// but using the given streams, which is convenient for tests. It returns
+// an error if the current working directory cannot be determined, as
+// AbsPath would not work without it.
+func NewContext(stdin io.Reader, stdout, stderr io.Writer) (*Context, error) {
 	dir, err := os.Getwd()
 	if err != nil {
 		return nil, err
@@ -300,30 +912,96 @@ func DefaultContext() (*Context, error) {
 		return nil, err
 	}
 	return &Context{
-		Dir:    abs,
-		Stdin:  os.Stdin,
-		Stdout: os.Stdout,
-		Stderr: os.Stderr,
+		Dir:         abs,
+		Stdin:       stdin,
+		Stdout:      stdout,
+		Stderr:      stderr,
+		ProgramName: programName(os.Args[0]),
+		Env:         environMap(os.Environ()),
 	}, nil
 }
 
+// environMap converts a list of "key=value" strings, as returned by
+// os.Environ, into a map suitable for Context.Env.
+func environMap(environ []string) map[string]string {
+	env := make(map[string]string, len(environ))
+	for _, kv := range environ {
+		if i := strings.Index(kv, "="); i > 0 {
+			env[kv[:i]] = kv[i+1:]
+		}
+	}
+	return env
+}
+
+// programName returns the name a program was invoked as, given the first
+// element of its command line.
+func programName(arg0 string) string {
+	name := filepath.Base(arg0)
+	if strings.EqualFold(filepath.Ext(name), ".exe") {
+		name = name[:len(name)-len(".exe")]
+	}
+	return name
+}
+
 // CheckEmpty is a utility function that returns an error if args is not empty.
+// When the error is returned from Init, Main adds the command's usage to
+// it, as in `unrecognized args: ["toastie"]; usage: remote [options]`.
 func CheckEmpty(args []string) error {
 	if len(args) != 0 {
-		return fmt.Errorf("unrecognized args: %q", args)
+		return &unrecognizedArgsError{args: args}
 	}
 	return nil
 }
 
+// unrecognizedArgsError is the error returned by CheckEmpty.
+type unrecognizedArgsError struct {
+	args []string
+	// usage holds the usage line of the command given the args, if
+	// known.
+	usage string
+}
+
+func (e *unrecognizedArgsError) Error() string {
+	msg := fmt.Sprintf("unrecognized args: %q", e.args)
+	if e.usage != "" {
+		msg += "; usage: " + e.usage
+	}
+	return msg
+}
+
 // ZeroOrOneArgs checks to see that there are zero or one args, and returns
 // the value of the arg if provided, or the empty string if not.
 func ZeroOrOneArgs(args []string) (string, error) {
-	var result string
-	if len(args) > 0 {
-		result, args = args[0], args[1:]
+	switch len(args) {
+	case 0:
+		return "", nil
+	case 1:
+		return args[0], nil
 	}
-	if err := CheckEmpty(args); err != nil {
+	return "", fmt.Errorf("expected at most 1 argument, got %d", len(args))
+}
+
+// OneArg checks that there is exactly one arg, and returns its value.
+func OneArg(args []string) (string, error) {
+	args, err := ExactArgs(1, args)
+	if err != nil {
 		return "", err
 	}
-	return result, nil
+	return args[0], nil
+}
+
+// ExactArgs checks that there are exactly n args, and returns them.
+func ExactArgs(n int, args []string) ([]string, error) {
+	if len(args) != n {
+		return nil, fmt.Errorf("expected %s, got %d", plural(n, "argument"), len(args))
+	}
+	return args, nil
+}
+
+// plural returns n followed by noun, which is pluralised if n is not 1.
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
 }
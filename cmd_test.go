@@ -8,7 +8,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/juju/errors"
+	"github.com/juju/loggo"
 	"launchpad.net/gnuflag"
 
 	gc "gopkg.in/check.v1"
@@ -80,7 +83,8 @@ func (s *CmdSuite) TestMainInitError(c *gc.C) {
 		result := cmd.Main(t.c, ctx, []string{"--unknown"})
 		c.Assert(result, gc.Equals, 2)
 		c.Assert(bufferString(ctx.Stdout), gc.Equals, "")
-		expected := "error: flag provided but not defined: --unknown\n"
+		usage := strings.SplitAfter(t.help, "\n")[0]
+		expected := "error: flag provided but not defined: --unknown\n" + usage
 		c.Assert(bufferString(ctx.Stderr), gc.Equals, expected)
 	}
 }
@@ -93,6 +97,106 @@ func (s *CmdSuite) TestMainRunError(c *gc.C) {
 	c.Assert(bufferString(ctx.Stderr), gc.Equals, "error: BAM!\n")
 }
 
+func (s *CmdSuite) TestMainUnrecognizedArgs(c *gc.C) {
+	ctx := cmdtesting.Context(c)
+	result := cmd.Main(&TestCommand{Name: "verb"}, ctx, []string{"toastie"})
+	c.Assert(result, gc.Equals, 2)
+	c.Assert(bufferString(ctx.Stderr), gc.Equals, "error: unrecognized args: [\"toastie\"]; usage: verb [options] <something>\n")
+
+	ctx = cmdtesting.Context(c)
+	result = cmd.Main(&TestCommand{Name: "verb", Minimal: true}, ctx, []string{"toastie"})
+	c.Assert(result, gc.Equals, 2)
+	c.Assert(bufferString(ctx.Stderr), gc.Equals, "error: unrecognized args: [\"toastie\"]; usage: verb\n")
+}
+
+// usageCommand is a command whose Init rejects its arguments, asking for
+// its usage to be shown if showUsage is set.
+type usageCommand struct {
+	cmd.CommandBase
+	showUsage bool
+}
+
+func (c *usageCommand) Info() *cmd.Info {
+	return &cmd.Info{Name: "attach", Args: "<unit> <resource>"}
+}
+
+func (c *usageCommand) Init(args []string) error {
+	err := fmt.Errorf("expected 2 arguments, got %d", len(args))
+	if c.showUsage {
+		return cmd.NewUsageError(err)
+	}
+	return err
+}
+
+func (c *usageCommand) Run(ctx *cmd.Context) error {
+	return nil
+}
+
+func (s *CmdSuite) TestMainUsageError(c *gc.C) {
+	ctx := cmdtesting.Context(c)
+	result := cmd.Main(&usageCommand{showUsage: true}, ctx, []string{"unit/0"})
+	c.Assert(result, gc.Equals, 2)
+	c.Assert(bufferString(ctx.Stderr), gc.Equals, ""+
+		"error: expected 2 arguments, got 1\n"+
+		"Usage: attach <unit> <resource>\n")
+
+	ctx = cmdtesting.Context(c)
+	result = cmd.Main(&usageCommand{}, ctx, []string{"unit/0"})
+	c.Assert(result, gc.Equals, 2)
+	c.Assert(bufferString(ctx.Stderr), gc.Equals, "error: expected 2 arguments, got 1\n")
+}
+
+func (s *CmdSuite) TestMainUsageErrorAnnotated(c *gc.C) {
+	jc := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "jujutest"})
+	jc.Register(&usageCommand{showUsage: true})
+	ctx := cmdtesting.Context(c)
+	result := cmd.Main(jc, ctx, []string{"attach", "unit/0"})
+	c.Assert(result, gc.Equals, 2)
+	c.Assert(bufferString(ctx.Stderr), gc.Equals, ""+
+		"error: expected 2 arguments, got 1\n"+
+		"Usage: jujutest attach [options] <unit> <resource>\n")
+
+	err := errors.Annotate(cmd.NewUsageError(fmt.Errorf("no unit")), "attach")
+	ctx = cmdtesting.Context(c)
+	result = cmd.Main(&errorInitCommand{err: err}, ctx, nil)
+	c.Assert(result, gc.Equals, 2)
+	c.Assert(bufferString(ctx.Stderr), gc.Equals, "error: attach: no unit\nUsage: fail\n")
+}
+
+// errorInitCommand is a command whose Init returns err.
+type errorInitCommand struct {
+	cmd.CommandBase
+	err error
+}
+
+func (c *errorInitCommand) Info() *cmd.Info {
+	return &cmd.Info{Name: "fail"}
+}
+
+func (c *errorInitCommand) Init(args []string) error {
+	return c.err
+}
+
+func (c *errorInitCommand) Run(ctx *cmd.Context) error {
+	return nil
+}
+
+func (s *CmdSuite) TestMainRunRcError(c *gc.C) {
+	ctx := cmdtesting.Context(c)
+	result := cmd.Main(&TestCommand{Name: "verb"}, ctx, []string{"--option", "rc-error"})
+	c.Assert(result, gc.Equals, 3)
+	c.Assert(bufferString(ctx.Stdout), gc.Equals, "")
+	c.Assert(bufferString(ctx.Stderr), gc.Equals, "error: not found\n")
+}
+
+func (s *CmdSuite) TestMainRunAnnotatedRcError(c *gc.C) {
+	ctx := cmdtesting.Context(c)
+	result := cmd.Main(&TestCommand{Name: "verb"}, ctx, []string{"--option", "annotated-rc-error"})
+	c.Assert(result, gc.Equals, 3)
+	c.Assert(bufferString(ctx.Stdout), gc.Equals, "")
+	c.Assert(bufferString(ctx.Stderr), gc.Equals, "error: lookup: not found\n")
+}
+
 func (s *CmdSuite) TestMainRunSilentError(c *gc.C) {
 	ctx := cmdtesting.Context(c)
 	result := cmd.Main(&TestCommand{Name: "verb"}, ctx, []string{"--option", "silent-error"})
@@ -101,6 +205,14 @@ func (s *CmdSuite) TestMainRunSilentError(c *gc.C) {
 	c.Assert(bufferString(ctx.Stderr), gc.Equals, "")
 }
 
+func (s *CmdSuite) TestMainRunAnnotatedSilentError(c *gc.C) {
+	ctx := cmdtesting.Context(c)
+	result := cmd.Main(&TestCommand{Name: "verb"}, ctx, []string{"--option", "annotated-silent-error"})
+	c.Assert(result, gc.Equals, 1)
+	c.Assert(bufferString(ctx.Stdout), gc.Equals, "")
+	c.Assert(bufferString(ctx.Stderr), gc.Equals, "")
+}
+
 func (s *CmdSuite) TestMainSuccess(c *gc.C) {
 	ctx := cmdtesting.Context(c)
 	result := cmd.Main(&TestCommand{Name: "verb"}, ctx, []string{"--option", "success!"})
@@ -119,6 +231,34 @@ func (s *CmdSuite) TestStdin(c *gc.C) {
 	c.Assert(bufferString(ctx.Stderr), gc.Equals, "")
 }
 
+func (s *CmdSuite) TestReadStdin(c *gc.C) {
+	ctx := cmdtesting.Context(c)
+	ctx.Stdin = bytes.NewBufferString("hello")
+	data, err := ctx.ReadStdin(5)
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, "hello")
+}
+
+func (s *CmdSuite) TestReadStdinTooLarge(c *gc.C) {
+	ctx := cmdtesting.Context(c)
+	ctx.Stdin = bytes.NewBufferString("hello world")
+	data, err := ctx.ReadStdin(5)
+	c.Assert(err, gc.ErrorMatches, "stdin exceeds the maximum size of 5 bytes")
+	c.Assert(data, gc.IsNil)
+}
+
+func (s *CmdSuite) TestStdinIsTerminal(c *gc.C) {
+	ctx := cmdtesting.Context(c)
+	c.Assert(ctx.StdinIsTerminal(), gc.Equals, false)
+
+	r, w, err := os.Pipe()
+	c.Assert(err, gc.IsNil)
+	defer r.Close()
+	defer w.Close()
+	ctx.Stdin = r
+	c.Assert(ctx.StdinIsTerminal(), gc.Equals, false)
+}
+
 func (s *CmdSuite) TestMainHelp(c *gc.C) {
 	for _, arg := range []string{"-h", "--help"} {
 		ctx := cmdtesting.Context(c)
@@ -129,6 +269,71 @@ func (s *CmdSuite) TestMainHelp(c *gc.C) {
 	}
 }
 
+func (s *CmdSuite) TestRunCommandOutput(c *gc.C) {
+	stdout, stderr, err := cmdtesting.RunCommandOutput(c, &TestCommand{Name: "verb"}, "--option", "success!")
+	c.Assert(err, gc.IsNil)
+	c.Assert(stdout, gc.Equals, "success!\n")
+	c.Assert(stderr, gc.Equals, "")
+
+	stdout, stderr, err = cmdtesting.RunCommandOutput(c, &TestCommand{Name: "verb"}, "--option", "error")
+	c.Assert(err, gc.ErrorMatches, "BAM!")
+	c.Assert(stdout, gc.Equals, "")
+	c.Assert(stderr, gc.Equals, "")
+
+	_, _, err = cmdtesting.RunCommandOutput(c, &TestCommand{Name: "verb"}, "--unknown")
+	c.Assert(err, gc.ErrorMatches, "flag provided but not defined: --unknown")
+}
+
+func (s *CmdSuite) TestMainProgramName(c *gc.C) {
+	ctx := cmdtesting.Context(c)
+	ctx.ProgramName = "noun"
+	result := cmd.Main(&TestCommand{Name: "verb"}, ctx, []string{"--help"})
+	c.Assert(result, gc.Equals, 0)
+	c.Assert(bufferString(ctx.Stdout), gc.Equals, strings.Replace(fullHelp, "Usage: verb", "Usage: noun", 1))
+
+	ctx = cmdtesting.Context(c)
+	ctx.ProgramName = "noun"
+	result = cmd.Main(&TestCommand{Name: "verb"}, ctx, []string{"--unknown"})
+	c.Assert(result, gc.Equals, 2)
+	c.Assert(bufferString(ctx.Stderr), gc.Equals, ""+
+		"error: flag provided but not defined: --unknown\n"+
+		"Usage: noun [options] <something>\n")
+}
+
+func (s *CmdSuite) TestDefaultContextProgramName(c *gc.C) {
+	ctx, err := cmd.DefaultContext()
+	c.Assert(err, gc.IsNil)
+	c.Assert(ctx.ProgramName, gc.Equals, strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe"))
+}
+
+func (s *CmdSuite) TestDefaultContextEnv(c *gc.C) {
+	err := os.Setenv("JUJU_CONTEXT_ID", "ctx-id=1")
+	c.Assert(err, gc.IsNil)
+	defer os.Unsetenv("JUJU_CONTEXT_ID")
+	ctx, err := cmd.DefaultContext()
+	c.Assert(err, gc.IsNil)
+	c.Assert(ctx.Getenv("JUJU_CONTEXT_ID"), gc.Equals, "ctx-id=1")
+	ctx.Setenv("JUJU_CONTEXT_ID", "ctx-id=2")
+	c.Assert(ctx.Getenv("JUJU_CONTEXT_ID"), gc.Equals, "ctx-id=2")
+	c.Assert(os.Getenv("JUJU_CONTEXT_ID"), gc.Equals, "ctx-id=1")
+}
+
+func (s *CmdSuite) TestNewContext(c *gc.C) {
+	var stdout, stderr bytes.Buffer
+	stdin := bytes.NewBufferString("input")
+	ctx, err := cmd.NewContext(stdin, &stdout, &stderr)
+	c.Assert(err, gc.IsNil)
+	wd, err := os.Getwd()
+	c.Assert(err, gc.IsNil)
+	c.Assert(ctx.Dir, gc.Equals, wd)
+	c.Assert(ctx.Stdin, gc.Equals, stdin)
+	c.Assert(ctx.AbsPath("foo"), gc.Equals, filepath.Join(wd, "foo"))
+	result := cmd.Main(&TestCommand{Name: "verb"}, ctx, []string{"--option", "echo"})
+	c.Assert(result, gc.Equals, 0)
+	c.Assert(stdout.String(), gc.Equals, "input")
+	c.Assert(stderr.String(), gc.Equals, "")
+}
+
 func (s *CmdSuite) TestDefaultContextReturnsErrorInDeletedDirectory(c *gc.C) {
 	ctx := cmdtesting.Context(c)
 	wd, err := os.Getwd()
@@ -144,6 +349,52 @@ func (s *CmdSuite) TestDefaultContextReturnsErrorInDeletedDirectory(c *gc.C) {
 	ctx, err = cmd.DefaultContext()
 	c.Assert(err, gc.ErrorMatches, `getwd: no such file or directory`)
 	c.Assert(ctx, gc.IsNil)
+	ctx, err = cmd.NewContext(&bytes.Buffer{}, &bytes.Buffer{}, &bytes.Buffer{})
+	c.Assert(err, gc.ErrorMatches, `getwd: no such file or directory`)
+	c.Assert(ctx, gc.IsNil)
+}
+
+// recordingLogger is a cmd.Logger that records the messages it is given.
+type recordingLogger struct {
+	messages []string
+}
+
+func (l *recordingLogger) logf(level, format string, params ...interface{}) {
+	l.messages = append(l.messages, level+" "+fmt.Sprintf(format, params...))
+}
+
+func (l *recordingLogger) Debugf(format string, params ...interface{}) {
+	l.logf("DEBUG", format, params...)
+}
+
+func (l *recordingLogger) Infof(format string, params ...interface{}) {
+	l.logf("INFO", format, params...)
+}
+
+func (l *recordingLogger) Warningf(format string, params ...interface{}) {
+	l.logf("WARNING", format, params...)
+}
+
+func (l *recordingLogger) Errorf(format string, params ...interface{}) {
+	l.logf("ERROR", format, params...)
+}
+
+func (s *CmdSuite) TestContextLogger(c *gc.C) {
+	ctx := cmdtesting.Context(c)
+	c.Check(ctx.GetLogger(), gc.Equals, loggo.GetLogger("cmd"))
+
+	var recorder recordingLogger
+	ctx.Logger = &recorder
+	ctx.GetLogger().Debugf("connecting to %s", "api.example.com")
+	ctx.GetLogger().Warningf("retrying")
+	// Messages that are not verbose enough to write are logged.
+	ctx.Verbosef("connected")
+	c.Check(recorder.messages, gc.DeepEquals, []string{
+		"DEBUG connecting to api.example.com",
+		"WARNING retrying",
+		"INFO connected",
+	})
+	c.Check(bufferString(ctx.Stderr), gc.Equals, "")
 }
 
 func (s *CmdSuite) TestCheckEmpty(c *gc.C) {
@@ -165,15 +416,101 @@ func (s *CmdSuite) TestZeroOrOneArgs(c *gc.C) {
 
 	arg, err := cmd.ZeroOrOneArgs([]string{"foo", "bar"})
 	c.Assert(arg, gc.Equals, "")
-	c.Assert(err, gc.ErrorMatches, `unrecognized args: \["bar"\]`)
+	c.Assert(err, gc.ErrorMatches, `expected at most 1 argument, got 2`)
+}
+
+func (s *CmdSuite) TestOneArg(c *gc.C) {
+	arg, err := cmd.OneArg([]string{"foo"})
+	c.Assert(err, gc.IsNil)
+	c.Assert(arg, gc.Equals, "foo")
+
+	_, err = cmd.OneArg(nil)
+	c.Assert(err, gc.ErrorMatches, `expected 1 argument, got 0`)
+	_, err = cmd.OneArg([]string{"foo", "bar"})
+	c.Assert(err, gc.ErrorMatches, `expected 1 argument, got 2`)
+}
+
+func (s *CmdSuite) TestExactArgs(c *gc.C) {
+	args, err := cmd.ExactArgs(2, []string{"foo", "bar"})
+	c.Assert(err, gc.IsNil)
+	c.Assert(args, gc.DeepEquals, []string{"foo", "bar"})
+	args, err = cmd.ExactArgs(0, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(args, gc.HasLen, 0)
+
+	_, err = cmd.ExactArgs(2, []string{"foo"})
+	c.Assert(err, gc.ErrorMatches, `expected 2 arguments, got 1`)
+	_, err = cmd.ExactArgs(0, []string{"foo"})
+	c.Assert(err, gc.ErrorMatches, `expected 0 arguments, got 1`)
 }
 
 func (s *CmdSuite) TestIsErrSilent(c *gc.C) {
 	c.Assert(cmd.IsErrSilent(cmd.ErrSilent), gc.Equals, true)
 	c.Assert(cmd.IsErrSilent(cmd.NewRcPassthroughError(99)), gc.Equals, true)
+	c.Assert(cmd.IsErrSilent(errors.Annotate(cmd.ErrSilent, "reported")), gc.Equals, true)
+	c.Assert(cmd.IsErrSilent(errors.Annotate(cmd.NewRcPassthroughError(99), "plugin")), gc.Equals, true)
 	c.Assert(cmd.IsErrSilent(fmt.Errorf("noisy")), gc.Equals, false)
 }
 
+func (s *CmdSuite) TestInfoHelpExamples(c *gc.C) {
+	i := cmd.Info{
+		Name:    "deploy",
+		Args:    "<charm>",
+		Purpose: "deploy a charm",
+		Doc:     "deploy-doc",
+		Examples: []cmd.Example{{
+			Description: "Deploy wordpress to machine 0:",
+			Command:     "mytool deploy wordpress --to 0",
+		}, {
+			Command: "mytool deploy mysql",
+		}},
+		Aliases: []string{"dep"},
+	}
+	fs := gnuflag.NewFlagSet("", gnuflag.ContinueOnError)
+	c.Check(string(i.Help(fs)), gc.Equals, `
+Usage: deploy <charm>
+
+Summary:
+deploy a charm
+
+Details:
+deploy-doc
+
+Examples:
+    Deploy wordpress to machine 0:
+        mytool deploy wordpress --to 0
+
+        mytool deploy mysql
+
+Aliases: dep
+`[1:])
+}
+
+func (s *CmdSuite) TestInfoHelpExitCodes(c *gc.C) {
+	i := cmd.Info{
+		Name:    "deploy",
+		Purpose: "deploy a charm",
+		ExitCodes: map[int]string{
+			cmd.ExitSuccess: "the charm was deployed",
+			cmd.ExitTimeout: "the charm was not deployed in time; it may still be deployed later, so check its status before trying again",
+			3:               "no such charm",
+		},
+	}
+	fs := gnuflag.NewFlagSet("", gnuflag.ContinueOnError)
+	c.Check(string(i.Help(fs)), gc.Equals, `
+Usage: deploy
+
+Summary:
+deploy a charm
+
+Exit status:
+      0  the charm was deployed
+      3  no such charm
+    124  the charm was not deployed in time; it may still be deployed later, so
+         check its status before trying again
+`[1:])
+}
+
 func (s *CmdSuite) TestInfoHelp(c *gc.C) {
 	// Test that white space is trimmed consistently from cmd.Info.Purpose
 	// (Help Summary) and cmd.Info.Doc (Help Details)
@@ -211,3 +548,333 @@ func (s *CmdSuite) TestInfoHelp(c *gc.C) {
 		c.Check(got, gc.Equals, want)
 	}
 }
+
+// flagSyntaxCommand has flags with long and single letter names for
+// TestFlagSyntax.
+type flagSyntaxCommand struct {
+	cmd.CommandBase
+	all     bool
+	brief   bool
+	file    string
+	verbose bool
+}
+
+func (c *flagSyntaxCommand) Info() *cmd.Info {
+	return &cmd.Info{Name: "verb"}
+}
+
+func (c *flagSyntaxCommand) SetFlags(f *gnuflag.FlagSet) {
+	f.BoolVar(&c.all, "a", false, "")
+	f.BoolVar(&c.brief, "b", false, "")
+	f.StringVar(&c.file, "f", "", "")
+	f.StringVar(&c.file, "file", "", "")
+	f.BoolVar(&c.verbose, "verbose", false, "")
+}
+
+func (c *flagSyntaxCommand) Run(ctx *cmd.Context) error {
+	return nil
+}
+
+func (s *CmdSuite) TestFlagSyntax(c *gc.C) {
+	for _, test := range []struct {
+		args    []string
+		all     bool
+		brief   bool
+		file    string
+		verbose bool
+		err     string
+	}{{
+		args: []string{"--file=foo"},
+		file: "foo",
+	}, {
+		args: []string{"--file", "foo"},
+		file: "foo",
+	}, {
+		args: []string{"--file="},
+		file: "",
+	}, {
+		args: []string{"--file=a=b"},
+		file: "a=b",
+	}, {
+		args: []string{"-f", "foo"},
+		file: "foo",
+	}, {
+		args: []string{"-ffoo"},
+		file: "foo",
+	}, {
+		// The value of a single letter flag is everything after the
+		// letter, including any "=".
+		args: []string{"-f=foo"},
+		file: "=foo",
+	}, {
+		args:    []string{"--verbose=true"},
+		verbose: true,
+	}, {
+		args:    []string{"--verbose=false"},
+		verbose: false,
+	}, {
+		args:  []string{"-ab"},
+		all:   true,
+		brief: true,
+	}, {
+		args:  []string{"-baf", "foo"},
+		all:   true,
+		brief: true,
+		file:  "foo",
+	}, {
+		args:  []string{"-abffoo"},
+		all:   true,
+		brief: true,
+		file:  "foo",
+	}, {
+		args: []string{"-ax"},
+		err:  "flag provided but not defined: -x",
+	}, {
+		args: []string{"-af"},
+		err:  "flag needs an argument: -f",
+	}, {
+		args: []string{"--file"},
+		err:  "flag needs an argument: --file",
+	}} {
+		c.Logf("args %q", test.args)
+		com := &flagSyntaxCommand{}
+		err := cmdtesting.InitCommand(com, test.args)
+		if test.err != "" {
+			c.Check(err, gc.ErrorMatches, test.err)
+			continue
+		}
+		c.Assert(err, gc.IsNil)
+		c.Check(com.all, gc.Equals, test.all)
+		c.Check(com.brief, gc.Equals, test.brief)
+		c.Check(com.file, gc.Equals, test.file)
+		c.Check(com.verbose, gc.Equals, test.verbose)
+	}
+}
+
+func (s *CmdSuite) TestFlagSyntaxSuperCommand(c *gc.C) {
+	for _, args := range [][]string{
+		{"blah", "--option=success!"},
+		{"blah", "--option", "success!"},
+	} {
+		c.Logf("args %q", args)
+		sc := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "jujutest"})
+		sc.Register(&TestCommand{Name: "blah"})
+		ctx := cmdtesting.Context(c)
+		code := cmd.Main(sc, ctx, args)
+		c.Check(code, gc.Equals, 0)
+		c.Check(bufferString(ctx.Stdout), gc.Equals, "success!\n")
+	}
+}
+
+// configCommand has flags that depend on the application it is given,
+// to test ArgFlagsSetter.
+type configCommand struct {
+	cmd.CommandBase
+	model string
+	app   string
+	title string
+	port  int
+}
+
+func (c *configCommand) Info() *cmd.Info {
+	return &cmd.Info{Name: "config", Args: "<app>"}
+}
+
+func (c *configCommand) SetFlags(f *gnuflag.FlagSet) {
+	f.StringVar(&c.model, "model", "", "")
+}
+
+func (c *configCommand) SetArgFlags(f *gnuflag.FlagSet, args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	switch args[0] {
+	case "wordpress":
+		f.StringVar(&c.title, "title", "", "the blog title")
+	case "mysql":
+		f.IntVar(&c.port, "port", 3306, "the port to listen on")
+	default:
+		return fmt.Errorf("unknown application %q", args[0])
+	}
+	return nil
+}
+
+func (c *configCommand) Init(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("no application specified")
+	}
+	c.app = args[0]
+	return cmd.CheckEmpty(args[1:])
+}
+
+func (c *configCommand) Run(ctx *cmd.Context) error {
+	fmt.Fprintf(ctx.Stdout, "%q %s %q %d\n", c.model, c.app, c.title, c.port)
+	return nil
+}
+
+func (s *CmdSuite) TestArgFlags(c *gc.C) {
+	for _, test := range []struct {
+		args   []string
+		code   int
+		stdout string
+		stderr string
+	}{{
+		args:   []string{"wordpress", "--title", "My Blog"},
+		stdout: "\"\" wordpress \"My Blog\" 0\n",
+	}, {
+		args:   []string{"--model", "prod", "wordpress", "--title=My Blog"},
+		stdout: "\"prod\" wordpress \"My Blog\" 0\n",
+	}, {
+		args:   []string{"mysql", "--model", "prod"},
+		stdout: "\"prod\" mysql \"\" 3306\n",
+	}, {
+		args:   []string{"mysql", "--port", "5432"},
+		stdout: "\"\" mysql \"\" 5432\n",
+	}, {
+		args:   []string{"--title", "My Blog", "wordpress"},
+		code:   2,
+		stderr: "error: flag provided but not defined: --title\nUsage: config [options] <app>\n",
+	}, {
+		args:   []string{"mysql", "--title", "My Blog"},
+		code:   2,
+		stderr: "error: flag provided but not defined: --title\nUsage: config [options] <app>\n",
+	}, {
+		args:   []string{"postgresql"},
+		code:   2,
+		stderr: "error: unknown application \"postgresql\"\nUsage: config [options] <app>\n",
+	}, {
+		args:   []string{"--model", "prod"},
+		code:   2,
+		stderr: "error: no application specified\n",
+	}} {
+		c.Logf("args %q", test.args)
+		ctx := cmdtesting.Context(c)
+		code := cmd.Main(&configCommand{}, ctx, test.args)
+		c.Check(code, gc.Equals, test.code)
+		cmdtesting.CheckOutput(c, ctx, test.stdout, test.stderr)
+	}
+}
+
+func (s *CmdSuite) TestArgFlagsHelp(c *gc.C) {
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(&configCommand{}, ctx, []string{"wordpress", "--help"})
+	c.Check(code, gc.Equals, 0)
+	c.Check(cmdtesting.Stdout(ctx), gc.Matches, `(?s).*--title \(= ""\)\n    the blog title\n.*`)
+}
+
+func (s *CmdSuite) TestArgFlagsSuperCommand(c *gc.C) {
+	sc := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "mytool"})
+	sc.Register(&configCommand{})
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(sc, ctx, []string{"config", "mysql", "--port", "5432"})
+	c.Check(code, gc.Equals, 0)
+	c.Check(cmdtesting.Stdout(ctx), gc.Equals, "\"\" mysql \"\" 5432\n")
+}
+
+// warningCommand records a warning for each of its arguments, and fails
+// if the last one is "fail".
+type warningCommand struct {
+	cmd.CommandBase
+	args []string
+}
+
+func (c *warningCommand) Info() *cmd.Info {
+	return &cmd.Info{Name: "warn"}
+}
+
+func (c *warningCommand) Init(args []string) error {
+	c.args = args
+	return nil
+}
+
+func (c *warningCommand) Run(ctx *cmd.Context) error {
+	for _, arg := range c.args {
+		ctx.Warnf("skipped %s", arg)
+	}
+	fmt.Fprintln(ctx.Stdout, "done")
+	if len(c.args) > 0 && c.args[len(c.args)-1] == "fail" {
+		return fmt.Errorf("failed")
+	}
+	return nil
+}
+
+func (s *CmdSuite) TestWarnings(c *gc.C) {
+	for _, test := range []struct {
+		args   []string
+		code   int
+		stderr string
+	}{{
+		args: nil,
+	}, {
+		args:   []string{"a", "b"},
+		stderr: "Warnings:\n  skipped a\n  skipped b\n",
+	}, {
+		args:   []string{"a", "fail"},
+		code:   1,
+		stderr: "Warnings:\n  skipped a\n  skipped fail\nerror: failed\n",
+	}} {
+		c.Logf("args %q", test.args)
+		ctx := cmdtesting.Context(c)
+		code := cmd.Main(&warningCommand{}, ctx, test.args)
+		c.Check(code, gc.Equals, test.code)
+		cmdtesting.CheckOutput(c, ctx, "done\n", test.stderr)
+		c.Check(ctx.Warnings(), gc.HasLen, 0)
+	}
+}
+
+func (s *CmdSuite) TestWarningsNotWrittenByRun(c *gc.C) {
+	ctx, err := cmdtesting.RunCommand(c, &warningCommand{}, "a")
+	c.Assert(err, gc.IsNil)
+	c.Check(cmdtesting.Stderr(ctx), gc.Equals, "")
+	c.Check(ctx.Warnings(), gc.DeepEquals, []string{"skipped a"})
+}
+
+// writeCommand writes lines to Stdout until writing fails.
+type writeCommand struct {
+	cmd.CommandBase
+}
+
+func (c *writeCommand) Info() *cmd.Info {
+	return &cmd.Info{Name: "write"}
+}
+
+func (c *writeCommand) Run(ctx *cmd.Context) error {
+	for {
+		if _, err := fmt.Fprintln(ctx.Stdout, "line"); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *CmdSuite) TestMainBrokenPipe(c *gc.C) {
+	reader, writer, err := os.Pipe()
+	c.Assert(err, gc.IsNil)
+	defer writer.Close()
+	reader.Close()
+	ctx := cmdtesting.Context(c)
+	ctx.Stdout = writer
+	code := cmd.Main(&writeCommand{}, ctx, nil)
+	c.Check(code, gc.Equals, 0)
+	c.Check(cmdtesting.Stderr(ctx), gc.Equals, "")
+
+	ctx = cmdtesting.Context(c)
+	ctx.Stdout = writer
+	sc := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "mytool"})
+	sc.Register(&writeCommand{})
+	code = cmd.Main(sc, ctx, []string{"write"})
+	c.Check(code, gc.Equals, 0)
+	c.Check(cmdtesting.Stderr(ctx), gc.Equals, "")
+}
+
+func (s *CmdSuite) TestMainOtherWriteErrors(c *gc.C) {
+	// Writing to a file opened only for reading fails, but not because
+	// of a broken pipe.
+	f, err := os.Open(c.MkDir())
+	c.Assert(err, gc.IsNil)
+	defer f.Close()
+	ctx := cmdtesting.Context(c)
+	ctx.Stdout = f
+	code := cmd.Main(&writeCommand{}, ctx, nil)
+	c.Check(code, gc.Equals, 1)
+	c.Check(cmdtesting.Stderr(ctx), gc.Matches, "error: write .*\n")
+}
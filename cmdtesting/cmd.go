@@ -54,6 +54,22 @@ func ContextForDir(c *gc.C, dir string) *cmd.Context {
 	}
 }
 
+// ContextWithStdin works like Context, but the returned context's Stdin
+// reads the given content.
+func ContextWithStdin(c *gc.C, stdin string) *cmd.Context {
+	ctx := Context(c)
+	ctx.Stdin = bytes.NewBufferString(stdin)
+	return ctx
+}
+
+// ContextForDirWithStdin works like ContextForDir, but the returned
+// context's Stdin reads the given content.
+func ContextForDirWithStdin(c *gc.C, dir, stdin string) *cmd.Context {
+	ctx := ContextForDir(c, dir)
+	ctx.Stdin = bytes.NewBufferString(stdin)
+	return ctx
+}
+
 // Stdout takes a command Context that we assume has been created in this
 // package, and gets the content of the Stdout buffer as a string.
 func Stdout(ctx *cmd.Context) string {
@@ -66,6 +82,14 @@ func Stderr(ctx *cmd.Context) string {
 	return ctx.Stderr.(*bytes.Buffer).String()
 }
 
+// CheckOutput checks that a command Context created in this package has
+// had exactly the given content written to its Stdout and Stderr, so
+// that tests can tell output meant for machines from diagnostics.
+func CheckOutput(c *gc.C, ctx *cmd.Context, stdout, stderr string) {
+	c.Check(Stdout(ctx), gc.Equals, stdout, gc.Commentf("stdout"))
+	c.Check(Stderr(ctx), gc.Equals, stderr, gc.Commentf("stderr"))
+}
+
 // RunCommand runs a command with the specified args.  The returned error
 // may come from either the parsing of the args, the command initialisation, or
 // the actual running of the command.  Access to the resulting output streams
@@ -87,6 +111,18 @@ func RunCommandInDir(c *gc.C, com cmd.Command, args []string, dir string) (*cmd.
 	return context, com.Run(context)
 }
 
+// RunCommandOutput works like RunCommand, but returns what the command
+// wrote to its Stdout and Stderr rather than its context. The output is
+// empty if the args could not be parsed or the command failed to
+// initialise.
+func RunCommandOutput(c *gc.C, com cmd.Command, args ...string) (stdout, stderr string, err error) {
+	ctx, err := RunCommand(c, com, args...)
+	if ctx == nil {
+		return "", "", err
+	}
+	return Stdout(ctx), Stderr(ctx), err
+}
+
 // TestInit checks that a command initialises correctly with the given set of
 // arguments.
 func TestInit(c *gc.C, com cmd.Command, args []string, errPat string) {
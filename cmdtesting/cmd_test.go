@@ -0,0 +1,56 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmdtesting_test
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/cmd"
+	"github.com/juju/cmd/cmdtesting"
+)
+
+type CmdTestingSuite struct{}
+
+var _ = gc.Suite(&CmdTestingSuite{})
+
+// echoCommand copies Stdin to Stdout, and writes the directory it is run
+// in to Stderr.
+type echoCommand struct {
+	cmd.CommandBase
+}
+
+func (c *echoCommand) Info() *cmd.Info {
+	return &cmd.Info{Name: "echo"}
+}
+
+func (c *echoCommand) Run(ctx *cmd.Context) error {
+	data, err := ioutil.ReadAll(ctx.Stdin)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(ctx.Stdout, "%s", data)
+	fmt.Fprintf(ctx.Stderr, "in %s", ctx.Dir)
+	return nil
+}
+
+func (s *CmdTestingSuite) TestContextWithStdin(c *gc.C) {
+	ctx := cmdtesting.ContextWithStdin(c, "hello")
+	c.Assert(ctx.Dir, gc.Not(gc.Equals), "")
+	code := cmd.Main(&echoCommand{}, ctx, nil)
+	c.Assert(code, gc.Equals, 0)
+	cmdtesting.CheckOutput(c, ctx, "hello", "in "+ctx.Dir)
+}
+
+func (s *CmdTestingSuite) TestContextForDirWithStdin(c *gc.C) {
+	dir := c.MkDir()
+	ctx := cmdtesting.ContextForDirWithStdin(c, dir, "hello")
+	c.Assert(ctx.Dir, gc.Equals, dir)
+	code := cmd.Main(&echoCommand{}, ctx, nil)
+	c.Assert(code, gc.Equals, 0)
+	c.Check(cmdtesting.Stdout(ctx), gc.Equals, "hello")
+	c.Check(cmdtesting.Stderr(ctx), gc.Equals, "in "+dir)
+}
@@ -0,0 +1,178 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/juju/errors"
+	"launchpad.net/gnuflag"
+)
+
+// ColorMode determines whether the error and warning prefixes written to
+// Context.Stderr are colored.
+type ColorMode int
+
+const (
+	// ColorAuto colors output according to the FORCE_COLOR,
+	// CLICOLOR_FORCE and NO_COLOR environment variables, or when Stderr
+	// is a terminal if none of them is set. See ResolveColor.
+	ColorAuto ColorMode = iota
+
+	// ColorAlways always colors output.
+	ColorAlways
+
+	// ColorNever never colors output.
+	ColorNever
+)
+
+var colorModeNames = map[ColorMode]string{
+	ColorAuto:   "auto",
+	ColorAlways: "always",
+	ColorNever:  "never",
+}
+
+var _ gnuflag.Value = (*ColorMode)(nil)
+
+// Set implements gnuflag.Value.Set.
+func (m *ColorMode) Set(s string) error {
+	for mode, name := range colorModeNames {
+		if s == name {
+			*m = mode
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid color mode %q, expected one of (auto|always|never)", s)
+}
+
+// String implements gnuflag.Value.String.
+func (m *ColorMode) String() string {
+	return colorModeNames[*m]
+}
+
+const (
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+	ansiCyan   = "\x1b[36m"
+	ansiReset  = "\x1b[0m"
+
+	// ansiClearLine clears from the cursor to the end of the line.
+	ansiClearLine = "\x1b[K"
+)
+
+// SetColorMode sets whether the context's error and warning output
+// is colored.
+func (ctx *Context) SetColorMode(mode ColorMode) {
+	ctx.color = mode
+}
+
+// ColorEnabled reports whether output written to Stderr should be
+// colored.
+func (ctx *Context) ColorEnabled() bool {
+	return ctx.colorEnabled(ctx.Stderr)
+}
+
+// colorEnabled reports whether output written to w should be colored,
+// according to the context's color mode.
+func (ctx *Context) colorEnabled(w io.Writer) bool {
+	return ResolveColor(ctx.color, ctx.getenv, func() bool {
+		return isTerminalWriter(w)
+	})
+}
+
+// ResolveColor reports whether output should be colored in the given
+// mode. An explicit ColorAlways or ColorNever takes precedence; otherwise
+// a FORCE_COLOR or CLICOLOR_FORCE environment variable enables color, a
+// NO_COLOR environment variable disables it, and if none of those is set
+// output is colored when isTerminal returns true. The variables are read
+// with getenv, and FORCE_COLOR and CLICOLOR_FORCE are ignored when their
+// value is "0".
+func ResolveColor(mode ColorMode, getenv func(string) string, isTerminal func() bool) bool {
+	switch mode {
+	case ColorAlways:
+		return true
+	case ColorNever:
+		return false
+	}
+	for _, key := range []string{"FORCE_COLOR", "CLICOLOR_FORCE"} {
+		if value := getenv(key); value != "" && value != "0" {
+			return true
+		}
+	}
+	if getenv("NO_COLOR") != "" {
+		return false
+	}
+	return isTerminal()
+}
+
+// isTerminalWriter reports whether w is a file that refers to a terminal.
+// It is a variable so that tests can pretend to write to a terminal.
+var isTerminalWriter = func(w io.Writer) bool {
+	f, ok := underlyingWriter(w).(*os.File)
+	return ok && isTerminal(f)
+}
+
+// isTerminalReader reports whether r is a file that refers to a terminal.
+// It is a variable so that tests can pretend to read from a terminal.
+var isTerminalReader = func(r io.Reader) bool {
+	f, ok := underlyingReader(r).(*os.File)
+	return ok && isTerminal(f)
+}
+
+// colorize returns s wrapped in the given ANSI color if the context's
+// output is colored.
+func (ctx *Context) colorize(color, s string) string {
+	if !ctx.ColorEnabled() {
+		return s
+	}
+	return color + s + ansiReset
+}
+
+// writeError writes err to Stderr with an "error:" prefix, or as a
+// structured error with the given exit code when a machine readable
+// output format has been chosen.
+func (ctx *Context) writeError(err error, code int) {
+	ctx.ClearProgress()
+	if ctx.errorFormatter != nil && writeStructuredError(ctx.Stderr, ctx.errorFormatter, err, code) {
+		return
+	}
+	fmt.Fprintf(ctx.Stderr, "%s %v\n", ctx.colorize(ansiRed, "error:"), err)
+	if ctx.debug {
+		ctx.writeErrorDetails(err)
+	}
+}
+
+// writeErrorDetails writes the details of err given by errorDetails to
+// Stderr, if there are any. It is used when debugging, so that a failure
+// can be tracked down from a user's report.
+func (ctx *Context) writeErrorDetails(err error) {
+	details := errorDetails(err)
+	if len(details) == 0 {
+		return
+	}
+	fmt.Fprintln(ctx.Stderr, "error details:")
+	for _, line := range details {
+		fmt.Fprintf(ctx.Stderr, "  %s\n", line)
+	}
+}
+
+// errorDetails returns the locations and messages recorded by the errors
+// package as err was traced and annotated, innermost first. For an error
+// without such a record it returns the messages of the errors it wraps,
+// outermost first. It returns nothing when there is no more to say than
+// err's own message.
+func errorDetails(err error) []string {
+	if stack := errors.ErrorStack(err); stack != err.Error() {
+		return strings.Split(stack, "\n")
+	}
+	var causes []string
+	for cause := errors.Unwrap(err); cause != nil; cause = errors.Unwrap(cause) {
+		causes = append(causes, "caused by: "+cause.Error())
+	}
+	return causes
+}
@@ -0,0 +1,151 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/juju/loggo"
+	gitjujutesting "github.com/juju/testing"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/cmd"
+	"github.com/juju/cmd/cmdtesting"
+)
+
+type ColorSuite struct {
+	gitjujutesting.IsolationSuite
+}
+
+var _ = gc.Suite(&ColorSuite{})
+
+func (s *ColorSuite) TestColorModeSet(c *gc.C) {
+	for _, name := range []string{"auto", "always", "never"} {
+		var mode cmd.ColorMode
+		c.Assert(mode.Set(name), gc.IsNil)
+		c.Check(mode.String(), gc.Equals, name)
+	}
+	var mode cmd.ColorMode
+	c.Check(mode.String(), gc.Equals, "auto")
+	err := mode.Set("sometimes")
+	c.Assert(err, gc.ErrorMatches, `invalid color mode "sometimes", expected one of \(auto\|always\|never\)`)
+}
+
+func (s *ColorSuite) TestColorEnabled(c *gc.C) {
+	ctx := cmdtesting.Context(c)
+	c.Check(ctx.ColorEnabled(), gc.Equals, false)
+	ctx.SetColorMode(cmd.ColorAlways)
+	c.Check(ctx.ColorEnabled(), gc.Equals, true)
+	ctx.SetColorMode(cmd.ColorNever)
+	c.Check(ctx.ColorEnabled(), gc.Equals, false)
+}
+
+func (s *ColorSuite) TestColorEnabledNotTerminal(c *gc.C) {
+	f, err := os.Create(filepath.Join(c.MkDir(), "stderr"))
+	c.Assert(err, gc.IsNil)
+	defer f.Close()
+	ctx := cmdtesting.Context(c)
+	ctx.Stderr = f
+	c.Check(ctx.ColorEnabled(), gc.Equals, false)
+}
+
+func (s *ColorSuite) TestColorAlwaysIgnoresNoColor(c *gc.C) {
+	s.PatchEnvironment("NO_COLOR", "1")
+	ctx := cmdtesting.Context(c)
+	ctx.SetColorMode(cmd.ColorAlways)
+	c.Check(ctx.ColorEnabled(), gc.Equals, true)
+}
+
+func (s *ColorSuite) TestResolveColor(c *gc.C) {
+	for i, test := range []struct {
+		mode     cmd.ColorMode
+		env      map[string]string
+		terminal bool
+		expect   bool
+	}{
+		{mode: cmd.ColorAuto, expect: false},
+		{mode: cmd.ColorAuto, terminal: true, expect: true},
+		{mode: cmd.ColorAlways, expect: true},
+		{mode: cmd.ColorNever, terminal: true, expect: false},
+		{mode: cmd.ColorAuto, env: map[string]string{"NO_COLOR": "1"}, terminal: true, expect: false},
+		{mode: cmd.ColorAuto, env: map[string]string{"FORCE_COLOR": "1"}, expect: true},
+		{mode: cmd.ColorAuto, env: map[string]string{"CLICOLOR_FORCE": "1"}, expect: true},
+		{mode: cmd.ColorAuto, env: map[string]string{"FORCE_COLOR": "0"}, expect: false},
+		{mode: cmd.ColorAuto, env: map[string]string{"FORCE_COLOR": "0"}, terminal: true, expect: true},
+		{mode: cmd.ColorAuto, env: map[string]string{"FORCE_COLOR": "1", "NO_COLOR": "1"}, expect: true},
+		{mode: cmd.ColorNever, env: map[string]string{"FORCE_COLOR": "1"}, expect: false},
+		{mode: cmd.ColorAlways, env: map[string]string{"NO_COLOR": "1"}, expect: true},
+	} {
+		c.Logf("test %d: %v %v", i, test.mode, test.env)
+		getenv := func(key string) string { return test.env[key] }
+		isTerminal := func() bool { return test.terminal }
+		c.Check(cmd.ResolveColor(test.mode, getenv, isTerminal), gc.Equals, test.expect)
+	}
+}
+
+func (s *ColorSuite) TestColorEnabledForceColor(c *gc.C) {
+	s.PatchEnvironment("NO_COLOR", "1")
+	ctx := cmdtesting.Context(c)
+	c.Check(ctx.ColorEnabled(), gc.Equals, false)
+	ctx.Setenv("FORCE_COLOR", "1")
+	c.Check(ctx.ColorEnabled(), gc.Equals, true)
+}
+
+func (s *ColorSuite) TestColorEnabledContextEnv(c *gc.C) {
+	s.PatchEnvironment("FORCE_COLOR", "1")
+	ctx := cmdtesting.Context(c)
+	c.Check(ctx.ColorEnabled(), gc.Equals, true)
+	ctx.Env = map[string]string{}
+	c.Check(ctx.ColorEnabled(), gc.Equals, false)
+}
+
+func (s *ColorSuite) TestMainColorsError(c *gc.C) {
+	ctx := cmdtesting.Context(c)
+	ctx.SetColorMode(cmd.ColorAlways)
+	result := cmd.Main(&TestCommand{Name: "verb"}, ctx, []string{"--option", "error"})
+	c.Assert(result, gc.Equals, 1)
+	c.Assert(bufferString(ctx.Stderr), gc.Equals, "\x1b[31merror:\x1b[0m BAM!\n")
+}
+
+func (s *ColorSuite) TestMainNoColor(c *gc.C) {
+	ctx := cmdtesting.Context(c)
+	result := cmd.Main(&TestCommand{Name: "verb"}, ctx, []string{"--option", "error"})
+	c.Assert(result, gc.Equals, 1)
+	c.Assert(bufferString(ctx.Stderr), gc.Equals, "error: BAM!\n")
+}
+
+func (s *ColorSuite) TestColorFlag(c *gc.C) {
+	s.AddCleanup(func(*gc.C) { loggo.ResetWriters() })
+	callback := func(ctx *cmd.Context, subcommand string, args []string) error {
+		return errors.New("command not found")
+	}
+	for _, test := range []struct {
+		args   []string
+		stderr string
+	}{{
+		args:   []string{"foo"},
+		stderr: "ERROR command not found\n",
+	}, {
+		args:   []string{"--color=always", "foo"},
+		stderr: "\x1b[31mERROR\x1b[0m command not found\n",
+	}, {
+		args:   []string{"--color", "never", "foo"},
+		stderr: "ERROR command not found\n",
+	}} {
+		loggo.ResetWriters()
+		ctx := cmdtesting.Context(c)
+		code := cmd.Main(NewSuperWithCallback(callback), ctx, test.args)
+		c.Check(code, gc.Equals, 1)
+		c.Check(cmdtesting.Stderr(ctx), gc.Equals, test.stderr)
+	}
+}
+
+func (s *ColorSuite) TestColorFlagInvalid(c *gc.C) {
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(NewSuperWithCallback(nil), ctx, []string{"--color=sometimes", "foo"})
+	c.Check(code, gc.Equals, 2)
+	c.Check(cmdtesting.Stderr(ctx), gc.Matches, `error: invalid value "sometimes" for flag --color: .*\nUsage: jujutest .*\n`)
+}
@@ -0,0 +1,240 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+
+	"launchpad.net/gnuflag"
+)
+
+// BashCompletion returns a bash script that completes the names of the
+// SuperCommand's subcommands as the first argument, and the long flag
+// names accepted by the chosen subcommand after that.
+func (c *SuperCommand) BashCompletion() string {
+	commonFlags := longFlagNames(c.SetCommonFlags)
+	names := c.listedNames()
+	buf := &bytes.Buffer{}
+	funcName := completionFuncName(c.name())
+	fmt.Fprintf(buf, "# bash completion for %s\n\n", c.name())
+	fmt.Fprintf(buf, "%s()\n{\n", funcName)
+	fmt.Fprintf(buf, "    local cur=\"${COMP_WORDS[COMP_CWORD]}\"\n")
+	fmt.Fprintf(buf, "    if [ \"$COMP_CWORD\" -eq 1 ]; then\n")
+	fmt.Fprintf(buf, "        COMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(names, " "))
+	fmt.Fprintf(buf, "        return 0\n")
+	fmt.Fprintf(buf, "    fi\n")
+	fmt.Fprintf(buf, "    case \"${COMP_WORDS[1]}\" in\n")
+	for _, name := range names {
+		flags := append(longFlagNames(c.subcmds[name].command.SetFlags), commonFlags...)
+		sort.Strings(flags)
+		fmt.Fprintf(buf, "    %s)\n", name)
+		fmt.Fprintf(buf, "        COMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(flags, " "))
+		fmt.Fprintf(buf, "        ;;\n")
+	}
+	fmt.Fprintf(buf, "    esac\n")
+	fmt.Fprintf(buf, "    return 0\n")
+	fmt.Fprintf(buf, "}\n\n")
+	fmt.Fprintf(buf, "complete -F %s %s\n", funcName, c.name())
+	return buf.String()
+}
+
+// listedNames returns the sorted names of the subcommands and aliases that
+// are listed in help output.
+func (c *SuperCommand) listedNames() []string {
+	var names []string
+	for name, action := range c.subcmds {
+		if action.listed() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// longFlagNames returns the sorted long names, including the leading
+// "--", of the flags added by setFlags.
+func longFlagNames(setFlags func(*gnuflag.FlagSet)) []string {
+	var names []string
+	for _, flag := range longFlags(setFlags) {
+		names = append(names, "--"+flag.Name)
+	}
+	return names
+}
+
+// longFlags returns the flags with long names added by setFlags, sorted by
+// name. Flags that share a value with another flag are often registered
+// without usage text, so the returned flags have their Usage set from any
+// flag with the same value.
+func longFlags(setFlags func(*gnuflag.FlagSet)) []*gnuflag.Flag {
+	f := gnuflag.NewFlagSet("", gnuflag.ContinueOnError)
+	f.SetOutput(ioutil.Discard)
+	setFlags(f)
+	usage := make(map[gnuflag.Value]string)
+	f.VisitAll(func(flag *gnuflag.Flag) {
+		if usage[flag.Value] == "" {
+			usage[flag.Value] = flag.Usage
+		}
+	})
+	var flags []*gnuflag.Flag
+	f.VisitAll(func(flag *gnuflag.Flag) {
+		if len(flag.Name) > 1 {
+			longFlag := *flag
+			longFlag.Usage = usage[flag.Value]
+			flags = append(flags, &longFlag)
+		}
+	})
+	return flags
+}
+
+var invalidFuncChars = regexp.MustCompile("[^a-zA-Z0-9_]")
+
+// completionFuncName returns the name of the shell function that completes
+// the named command.
+func completionFuncName(name string) string {
+	return "_" + invalidFuncChars.ReplaceAllString(name, "_")
+}
+
+// bashCompletionCommand is a hidden cmd.Command that prints the bash
+// completion script for its SuperCommand.
+type bashCompletionCommand struct {
+	CommandBase
+	super *SuperCommand
+}
+
+func (c *bashCompletionCommand) Info() *Info {
+	return &Info{
+		Name:    "bash-completion",
+		Purpose: "print a bash completion script",
+	}
+}
+
+func (c *bashCompletionCommand) Run(ctx *Context) error {
+	_, err := fmt.Fprint(ctx.Stdout, c.super.BashCompletion())
+	return err
+}
+
+// ZshCompletion returns a zsh script that completes the names of the
+// SuperCommand's subcommands, described by their purpose, followed by the
+// flags accepted by the chosen subcommand, described by their usage text.
+// Subcommands that are themselves SuperCommands are completed in turn.
+func (c *SuperCommand) ZshCompletion() string {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "# zsh completion for %s\n", c.name())
+	funcName := completionFuncName(c.name())
+	c.writeZshFunction(buf, funcName, longFlags(c.SetCommonFlags))
+	fmt.Fprintf(buf, "\ncompdef %s %s\n", funcName, c.name())
+	return buf.String()
+}
+
+// writeZshFunction writes a zsh completion function called funcName for
+// the SuperCommand's subcommands, followed by the functions for any nested
+// SuperCommands. The commonFlags are accepted by every subcommand that is
+// not itself a SuperCommand.
+func (c *SuperCommand) writeZshFunction(buf *bytes.Buffer, funcName string, commonFlags []*gnuflag.Flag) {
+	names := c.listedNames()
+	nested := make(map[string]*SuperCommand)
+	fmt.Fprintf(buf, "\n%s() {\n", funcName)
+	fmt.Fprintf(buf, "    local -a commands\n")
+	fmt.Fprintf(buf, "    commands=(\n")
+	for _, name := range names {
+		action := c.subcmds[name]
+		purpose := action.command.Info().Purpose
+		if action.alias != "" {
+			purpose = "alias for '" + action.alias + "'"
+		}
+		entry := strings.Replace(name, ":", "\\:", -1) + ":" + firstLine(purpose)
+		fmt.Fprintf(buf, "        %s\n", zshQuote(entry))
+	}
+	fmt.Fprintf(buf, "    )\n")
+	fmt.Fprintf(buf, "    if (( CURRENT == 2 )); then\n")
+	fmt.Fprintf(buf, "        _describe -t commands %s commands\n", zshQuote(c.name()+" command"))
+	fmt.Fprintf(buf, "        return\n")
+	fmt.Fprintf(buf, "    fi\n")
+	fmt.Fprintf(buf, "    local cmd=\"${words[2]}\"\n")
+	fmt.Fprintf(buf, "    shift words\n")
+	fmt.Fprintf(buf, "    (( CURRENT-- ))\n")
+	fmt.Fprintf(buf, "    case \"$cmd\" in\n")
+	for _, name := range names {
+		command := c.subcmds[name].command
+		fmt.Fprintf(buf, "    %s)\n", name)
+		if super, ok := command.(*SuperCommand); ok {
+			if nested[super.Name] == nil {
+				nested[super.Name] = super
+			}
+			fmt.Fprintf(buf, "        %s\n", funcName+completionFuncName(super.Name))
+		} else {
+			flags := append(longFlags(command.SetFlags), commonFlags...)
+			sort.Sort(flagsByName(flags))
+			fmt.Fprintf(buf, "        _arguments \\\n")
+			for _, flag := range flags {
+				spec := "--" + flag.Name + "[" + zshEscapeDescription(firstLine(flag.Usage)) + "]"
+				fmt.Fprintf(buf, "            %s \\\n", zshQuote(spec))
+			}
+			fmt.Fprintf(buf, "            %s\n", zshQuote("*: :_default"))
+		}
+		fmt.Fprintf(buf, "        ;;\n")
+	}
+	fmt.Fprintf(buf, "    esac\n")
+	fmt.Fprintf(buf, "}\n")
+
+	var nestedNames []string
+	for name := range nested {
+		nestedNames = append(nestedNames, name)
+	}
+	sort.Strings(nestedNames)
+	for _, name := range nestedNames {
+		super := nested[name]
+		super.writeZshFunction(buf, funcName+completionFuncName(name), longFlags(super.SetCommonFlags))
+	}
+}
+
+type flagsByName []*gnuflag.Flag
+
+func (f flagsByName) Len() int           { return len(f) }
+func (f flagsByName) Less(i, j int) bool { return f[i].Name < f[j].Name }
+func (f flagsByName) Swap(i, j int)      { f[i], f[j] = f[j], f[i] }
+
+// firstLine returns the first line of s, without surrounding white space.
+func firstLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.Index(s, "\n"); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	return s
+}
+
+// zshQuote returns s quoted for use as a single word in a zsh script.
+func zshQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// zshEscapeDescription escapes the characters that _arguments treats
+// specially in the description of an option.
+func zshEscapeDescription(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`, ":", `\:`).Replace(s)
+}
+
+// zshCompletionCommand is a hidden cmd.Command that prints the zsh
+// completion script for its SuperCommand.
+type zshCompletionCommand struct {
+	CommandBase
+	super *SuperCommand
+}
+
+func (c *zshCompletionCommand) Info() *Info {
+	return &Info{
+		Name:    "zsh-completion",
+		Purpose: "print a zsh completion script",
+	}
+}
+
+func (c *zshCompletionCommand) Run(ctx *Context) error {
+	_, err := fmt.Fprint(ctx.Stdout, c.super.ZshCompletion())
+	return err
+}
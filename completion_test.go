@@ -0,0 +1,163 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd_test
+
+import (
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/cmd"
+	"github.com/juju/cmd/cmdtesting"
+)
+
+type CompletionSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&CompletionSuite{})
+
+func (s *CompletionSuite) TestBashCompletion(c *gc.C) {
+	super := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name: "juju-test",
+		Log:  &cmd.Log{},
+	})
+	super.Register(&TestCommand{Name: "deploy", Aliases: []string{"dep"}})
+	super.Register(&TestCommand{Name: "status", Minimal: true})
+	super.RegisterHidden(&TestCommand{Name: "secret"})
+
+	c.Assert(super.BashCompletion(), gc.Equals, `# bash completion for juju-test
+
+_juju_test()
+{
+    local cur="${COMP_WORDS[COMP_CWORD]}"
+    if [ "$COMP_CWORD" -eq 1 ]; then
+        COMPREPLY=($(compgen -W "dep deploy help status" -- "$cur"))
+        return 0
+    fi
+    case "${COMP_WORDS[1]}" in
+    dep)
+        COMPREPLY=($(compgen -W "--color --debug --description --help --log-file --log-format --log-level --log-max-backups --log-max-size --logging-config --option --quiet --show-log --syslog --syslog-facility --syslog-tag --verbose" -- "$cur"))
+        ;;
+    deploy)
+        COMPREPLY=($(compgen -W "--color --debug --description --help --log-file --log-format --log-level --log-max-backups --log-max-size --logging-config --option --quiet --show-log --syslog --syslog-facility --syslog-tag --verbose" -- "$cur"))
+        ;;
+    help)
+        COMPREPLY=($(compgen -W "--color --debug --description --format --help --log-file --log-format --log-level --log-max-backups --log-max-size --logging-config --quiet --show-log --syslog --syslog-facility --syslog-tag --verbose" -- "$cur"))
+        ;;
+    status)
+        COMPREPLY=($(compgen -W "--color --debug --description --help --log-file --log-format --log-level --log-max-backups --log-max-size --logging-config --quiet --show-log --syslog --syslog-facility --syslog-tag --verbose" -- "$cur"))
+        ;;
+    esac
+    return 0
+}
+
+complete -F _juju_test juju-test
+`)
+}
+
+func (s *CompletionSuite) TestBashCompletionCommand(c *gc.C) {
+	super := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "jujutest"})
+	super.Register(&TestCommand{Name: "deploy"})
+
+	ctx, err := cmdtesting.RunCommand(c, super, "bash-completion")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(ctx), gc.Equals, super.BashCompletion())
+	c.Assert(super.Info().Doc, gc.Not(jc.Contains), "bash-completion")
+}
+
+func (s *CompletionSuite) TestZshCompletion(c *gc.C) {
+	super := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "juju-test"})
+	super.Register(&TestCommand{Name: "deploy"})
+	sub := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name:    "model",
+		Purpose: "manage: models",
+	})
+	sub.Register(&simple{name: "create"})
+	super.Register(sub)
+
+	c.Assert(super.ZshCompletion(), gc.Equals, `# zsh completion for juju-test
+
+_juju_test() {
+    local -a commands
+    commands=(
+        'deploy:deploy the juju'
+        'help:show help on a command or other topic'
+        'model:manage: models'
+    )
+    if (( CURRENT == 2 )); then
+        _describe -t commands 'juju-test command' commands
+        return
+    fi
+    local cmd="${words[2]}"
+    shift words
+    (( CURRENT-- ))
+    case "$cmd" in
+    deploy)
+        _arguments \
+            '--color[colorize error and warning output (auto|always|never)]' \
+            '--description[]' \
+            '--help[show help on a command or other topic]' \
+            '--option[option-doc]' \
+            '*: :_default'
+        ;;
+    help)
+        _arguments \
+            '--color[colorize error and warning output (auto|always|never)]' \
+            '--description[]' \
+            '--format[show command help in a structured format (json|yaml)]' \
+            '--help[show help on a command or other topic]' \
+            '*: :_default'
+        ;;
+    model)
+        _juju_test_model
+        ;;
+    esac
+}
+
+_juju_test_model() {
+    local -a commands
+    commands=(
+        'create:to be simple'
+        'help:show help on a command or other topic'
+    )
+    if (( CURRENT == 2 )); then
+        _describe -t commands 'model command' commands
+        return
+    fi
+    local cmd="${words[2]}"
+    shift words
+    (( CURRENT-- ))
+    case "$cmd" in
+    create)
+        _arguments \
+            '--color[colorize error and warning output (auto|always|never)]' \
+            '--description[]' \
+            '--help[show help on a command or other topic]' \
+            '*: :_default'
+        ;;
+    help)
+        _arguments \
+            '--color[colorize error and warning output (auto|always|never)]' \
+            '--description[]' \
+            '--format[show command help in a structured format (json|yaml)]' \
+            '--help[show help on a command or other topic]' \
+            '*: :_default'
+        ;;
+    esac
+}
+
+compdef _juju_test juju-test
+`)
+}
+
+func (s *CompletionSuite) TestZshCompletionCommand(c *gc.C) {
+	super := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "jujutest"})
+	super.Register(&TestCommand{Name: "deploy"})
+
+	ctx, err := cmdtesting.RunCommand(c, super, "zsh-completion")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(ctx), gc.Equals, super.ZshCompletion())
+	c.Assert(super.Info().Doc, gc.Not(jc.Contains), "zsh-completion")
+}
@@ -0,0 +1,87 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Confirm asks the user the given question on Stderr and reads their
+// answer from Stdin, returning whether they answered "y" or "yes", in any
+// case. Any other answer, including an empty one, is taken as no.
+//
+// When DryRun is set, it writes "would: " followed by the question to
+// Stderr instead, and returns false without reading anything. Otherwise,
+// when AssumeYes is set, it returns true without asking. As nobody is
+// likely to answer, it returns an error rather than asking when Stdin is
+// not a terminal, suggesting the --assume-yes flag if it is available.
+func (ctx *Context) Confirm(question string) (bool, error) {
+	ctx.ClearProgress()
+	if ctx.DryRun {
+		fmt.Fprintf(ctx.Stderr, "would: %s\n", question)
+		return false, nil
+	}
+	if ctx.AssumeYes {
+		return true, nil
+	}
+	if !ctx.StdinIsTerminal() {
+		if ctx.assumeYesFlag {
+			return false, fmt.Errorf("cannot ask %q: stdin is not a terminal; use --assume-yes to answer yes without asking", question)
+		}
+		return false, fmt.Errorf("cannot ask %q: stdin is not a terminal", question)
+	}
+	fmt.Fprintf(ctx.Stderr, "%s [y/N]: ", question)
+	answer, err := readLine(ctx.Stdin)
+	if err != nil {
+		return false, err
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
+
+// readLine reads a line from r, without its line ending. It reads a byte
+// at a time so that nothing after the line is consumed. A final line
+// without a line ending is returned without error.
+func readLine(r io.Reader) (string, error) {
+	line, err := readRawLine(r)
+	if err != nil {
+		return "", err
+	}
+	return trimLineEnding(line), nil
+}
+
+// trimLineEnding returns line without its "\n" or "\r\n" line ending.
+func trimLineEnding(line []byte) string {
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	return strings.TrimSuffix(string(line), "\r")
+}
+
+// readRawLine reads from r, a byte at a time, up to and including the
+// next newline or until the end of the input, returning what it read. If
+// reading fails, what was read before the error is returned with it.
+func readRawLine(r io.Reader) ([]byte, error) {
+	var line []byte
+	buf := make([]byte, 1)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			line = append(line, buf[0])
+			if buf[0] == '\n' {
+				return line, nil
+			}
+		}
+		if err == io.EOF {
+			return line, nil
+		}
+		if err != nil {
+			return line, err
+		}
+	}
+}
@@ -0,0 +1,270 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/juju/loggo"
+	gc "gopkg.in/check.v1"
+	"launchpad.net/gnuflag"
+)
+
+type ConfirmSuite struct{}
+
+var _ = gc.Suite(&ConfirmSuite{})
+
+func (s *ConfirmSuite) patchTerminal(terminal bool) func() {
+	old := isTerminalReader
+	isTerminalReader = func(io.Reader) bool { return terminal }
+	return func() { isTerminalReader = old }
+}
+
+func (s *ConfirmSuite) context(input string) (*Context, *bytes.Buffer) {
+	var stderr bytes.Buffer
+	return &Context{
+		Stdin:  bytes.NewBufferString(input),
+		Stdout: &bytes.Buffer{},
+		Stderr: &stderr,
+	}, &stderr
+}
+
+func (s *ConfirmSuite) TestConfirm(c *gc.C) {
+	defer s.patchTerminal(true)()
+	for i, test := range []struct {
+		input  string
+		expect bool
+	}{
+		{"y\n", true},
+		{"YES\n", true},
+		{" yes \r\n", true},
+		{"yes", true},
+		{"\n", false},
+		{"n\n", false},
+		{"yeah\n", false},
+		{"", false},
+	} {
+		c.Logf("test %d: %q", i, test.input)
+		ctx, stderr := s.context(test.input)
+		ok, err := ctx.Confirm("destroy everything?")
+		c.Check(err, gc.IsNil)
+		c.Check(ok, gc.Equals, test.expect)
+		c.Check(stderr.String(), gc.Equals, "destroy everything? [y/N]: ")
+	}
+}
+
+func (s *ConfirmSuite) TestConfirmReadsOneLine(c *gc.C) {
+	defer s.patchTerminal(true)()
+	ctx, _ := s.context("y\nrest of input")
+	ok, err := ctx.Confirm("continue?")
+	c.Assert(err, gc.IsNil)
+	c.Assert(ok, gc.Equals, true)
+	c.Assert(ctx.Stdin.(*bytes.Buffer).String(), gc.Equals, "rest of input")
+}
+
+func (s *ConfirmSuite) TestConfirmNotTerminal(c *gc.C) {
+	defer s.patchTerminal(false)()
+	ctx, stderr := s.context("y\n")
+	ok, err := ctx.Confirm("destroy everything?")
+	c.Assert(err, gc.ErrorMatches, `cannot ask "destroy everything\?": stdin is not a terminal`)
+	c.Assert(ok, gc.Equals, false)
+	c.Assert(stderr.String(), gc.Equals, "")
+}
+
+func (s *ConfirmSuite) TestConfirmAssumeYes(c *gc.C) {
+	for _, terminal := range []bool{false, true} {
+		c.Logf("terminal: %v", terminal)
+		restore := s.patchTerminal(terminal)
+		ctx, stderr := s.context("n\n")
+		ctx.AssumeYes = true
+		ok, err := ctx.Confirm("destroy everything?")
+		restore()
+		c.Check(err, gc.IsNil)
+		c.Check(ok, gc.Equals, true)
+		c.Check(stderr.String(), gc.Equals, "")
+		c.Check(ctx.Stdin.(*bytes.Buffer).String(), gc.Equals, "n\n")
+	}
+}
+
+func (s *ConfirmSuite) TestConfirmDryRun(c *gc.C) {
+	defer s.patchTerminal(true)()
+	ctx, stderr := s.context("y\n")
+	ctx.DryRun = true
+	ctx.AssumeYes = true
+	ok, err := ctx.Confirm("destroy machine 0")
+	c.Assert(err, gc.IsNil)
+	c.Assert(ok, gc.Equals, false)
+	c.Assert(stderr.String(), gc.Equals, "would: destroy machine 0\n")
+	c.Assert(ctx.Stdin.(*bytes.Buffer).String(), gc.Equals, "y\n")
+}
+
+// confirmCommand is a command that asks for confirmation before doing
+// anything.
+type confirmCommand struct {
+	CommandBase
+}
+
+func (c *confirmCommand) Info() *Info {
+	return &Info{Name: "confirm"}
+}
+
+func (c *confirmCommand) Run(ctx *Context) error {
+	ok, err := ctx.Confirm("destroy everything?")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(ctx.Stdout, "confirmed: %v\n", ok)
+	return nil
+}
+
+func (s *ConfirmSuite) TestConfirmDevNull(c *gc.C) {
+	for i, test := range []struct {
+		args   []string
+		code   int
+		stdout string
+		stderr string
+	}{{
+		args:   []string{"confirm"},
+		code:   1,
+		stderr: `ERROR cannot ask "destroy everything?": stdin is not a terminal; use --assume-yes to answer yes without asking` + "\n",
+	}, {
+		args:   []string{"confirm", "--assume-yes"},
+		stdout: "confirmed: true\n",
+	}} {
+		c.Logf("test %d: %q", i, test.args)
+		stdin, err := os.Open(os.DevNull)
+		c.Assert(err, gc.IsNil)
+		jc := NewSuperCommand(SuperCommandParams{
+			Name:          "jujutest",
+			Log:           &Log{},
+			AssumeYesFlag: true,
+		})
+		jc.Register(&confirmCommand{})
+		ctx, stderr := s.context("")
+		ctx.Stdin = stdin
+		code := Main(jc, ctx, test.args)
+		stdin.Close()
+		loggo.ResetWriters()
+		c.Check(code, gc.Equals, test.code)
+		c.Check(ctx.Stdout.(*bytes.Buffer).String(), gc.Equals, test.stdout)
+		c.Check(stderr.String(), gc.Equals, test.stderr)
+	}
+}
+
+// destroyCommand is a command that reports whether it is a dry run, and
+// whether it has been told to assume yes.
+type destroyCommand struct {
+	CommandBase
+}
+
+func (c *destroyCommand) Info() *Info {
+	return &Info{Name: "destroy"}
+}
+
+func (c *destroyCommand) Run(ctx *Context) error {
+	fmt.Fprintf(ctx.Stdout, "dry run: %v, assume yes: %v\n", ctx.DryRun, ctx.AssumeYes)
+	return nil
+}
+
+func (s *ConfirmSuite) TestDryRunFlag(c *gc.C) {
+	for i, test := range []struct {
+		args   []string
+		stdout string
+	}{
+		{[]string{"destroy"}, "dry run: false, assume yes: false\n"},
+		{[]string{"destroy", "--dry-run"}, "dry run: true, assume yes: false\n"},
+		{[]string{"--dry-run", "destroy"}, "dry run: true, assume yes: false\n"},
+	} {
+		c.Logf("test %d: %q", i, test.args)
+		jc := NewSuperCommand(SuperCommandParams{
+			Name:       "jujutest",
+			DryRunFlag: true,
+		})
+		jc.Register(&destroyCommand{})
+		ctx, _ := s.context("")
+		code := Main(jc, ctx, test.args)
+		c.Check(code, gc.Equals, 0)
+		c.Check(ctx.Stdout.(*bytes.Buffer).String(), gc.Equals, test.stdout)
+	}
+}
+
+func (s *ConfirmSuite) TestDryRunFlagNotEnabled(c *gc.C) {
+	jc := NewSuperCommand(SuperCommandParams{Name: "jujutest"})
+	jc.Register(&destroyCommand{})
+	ctx, stderr := s.context("")
+	code := Main(jc, ctx, []string{"destroy", "--dry-run"})
+	c.Check(code, gc.Equals, 2)
+	c.Check(stderr.String(), gc.Matches, "(?s)error: flag provided but not defined: --dry-run\n.*")
+}
+
+func (s *ConfirmSuite) TestAssumeYesFlag(c *gc.C) {
+	for i, test := range []struct {
+		args   []string
+		stdout string
+	}{
+		{[]string{"destroy"}, "dry run: false, assume yes: false\n"},
+		{[]string{"destroy", "-y"}, "dry run: false, assume yes: true\n"},
+		{[]string{"--assume-yes", "destroy"}, "dry run: false, assume yes: true\n"},
+		{[]string{"nested", "destroy", "--assume-yes"}, "dry run: false, assume yes: true\n"},
+		{[]string{"nested", "destroy", "--dry-run", "-y"}, "dry run: true, assume yes: true\n"},
+		{[]string{"-y", "nested", "destroy"}, "dry run: false, assume yes: true\n"},
+	} {
+		c.Logf("test %d: %q", i, test.args)
+		jc := NewSuperCommand(SuperCommandParams{
+			Name:          "jujutest",
+			DryRunFlag:    true,
+			AssumeYesFlag: true,
+		})
+		jc.Register(&destroyCommand{})
+		nested := NewSuperCommand(SuperCommandParams{
+			Name:        "nested",
+			UsagePrefix: "jujutest",
+		})
+		nested.Register(&destroyCommand{})
+		jc.Register(nested)
+		ctx, stderr := s.context("")
+		code := Main(jc, ctx, test.args)
+		c.Check(code, gc.Equals, 0)
+		c.Check(stderr.String(), gc.Equals, "")
+		c.Check(ctx.Stdout.(*bytes.Buffer).String(), gc.Equals, test.stdout)
+	}
+}
+
+func (s *ConfirmSuite) TestAssumeYesHelp(c *gc.C) {
+	jc := NewSuperCommand(SuperCommandParams{
+		Name:          "jujutest",
+		AssumeYesFlag: true,
+	})
+	jc.Register(&destroyCommand{})
+	ctx, _ := s.context("")
+	code := Main(jc, ctx, []string{"--help"})
+	c.Check(code, gc.Equals, 0)
+	c.Check(ctx.Stdout.(*bytes.Buffer).String(), gc.Matches, "(?s).*-y, --assume-yes \\(= false\\)\n"+
+		"    answer yes to all confirmation prompts; take care, as this skips the checks\n"+
+		"    that guard against destructive mistakes\n.*")
+}
+
+func (s *ConfirmSuite) TestGlobalFlags(c *gc.C) {
+	var zone string
+	jc := NewSuperCommand(SuperCommandParams{
+		Name: "jujutest",
+		GlobalFlags: func(f *gnuflag.FlagSet) {
+			f.StringVar(&zone, "zone", "", "the zone to use")
+		},
+	})
+	nested := NewSuperCommand(SuperCommandParams{
+		Name:        "nested",
+		UsagePrefix: "jujutest",
+	})
+	nested.Register(&destroyCommand{})
+	jc.Register(nested)
+	ctx, stderr := s.context("")
+	code := Main(jc, ctx, []string{"nested", "destroy", "--zone", "eu"})
+	c.Check(code, gc.Equals, 0)
+	c.Check(stderr.String(), gc.Equals, "")
+	c.Check(zone, gc.Equals, "eu")
+}
@@ -0,0 +1,88 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"fmt"
+	"sync"
+
+	"launchpad.net/gnuflag"
+)
+
+// replacedBy is a DeprecationCheck for a command that is deprecated in
+// favour of the named command, but is not obsolete.
+type replacedBy string
+
+// Deprecated implements DeprecationCheck.Deprecated.
+func (r replacedBy) Deprecated() (bool, string) {
+	return true, string(r)
+}
+
+// Obsolete implements DeprecationCheck.Obsolete.
+func (r replacedBy) Obsolete() bool {
+	return false
+}
+
+// deprecatedBy returns a DeprecationCheck for a command that is deprecated
+// in favour of replacement, or nil if replacement is empty.
+func deprecatedBy(replacement string) DeprecationCheck {
+	if replacement == "" {
+		return nil
+	}
+	return replacedBy(replacement)
+}
+
+// deprecatedFlags maps the deprecated flags marked by DeprecateFlag to
+// their replacements. The flags are recorded here rather than by wrapping
+// their values because gnuflag only treats its own boolean values as
+// boolean flags.
+var deprecatedFlags = struct {
+	sync.Mutex
+	replacements map[*gnuflag.Flag]string
+}{
+	replacements: make(map[*gnuflag.Flag]string),
+}
+
+// DeprecateFlag marks the named flag, which must already be defined in f,
+// as deprecated in favour of the flag named by replacement, which may be
+// empty. When the flag is used, a warning is shown once before the command
+// is run. It is intended to be called from a Command's SetFlags method.
+func DeprecateFlag(f *gnuflag.FlagSet, name, replacement string) {
+	flag := f.Lookup(name)
+	if flag == nil {
+		panic(fmt.Sprintf("flag %q not defined", name))
+	}
+	deprecatedFlags.Lock()
+	defer deprecatedFlags.Unlock()
+	deprecatedFlags.replacements[flag] = replacement
+}
+
+// warnDeprecatedFlags shows a warning for each deprecated flag that was
+// set when f was parsed.
+func warnDeprecatedFlags(ctx *Context, f *gnuflag.FlagSet) {
+	if f == nil {
+		return
+	}
+	deprecatedFlags.Lock()
+	defer deprecatedFlags.Unlock()
+	f.Visit(func(flag *gnuflag.Flag) {
+		replacement, ok := deprecatedFlags.replacements[flag]
+		if !ok {
+			return
+		}
+		if replacement == "" {
+			ctx.Infof("%s %s is deprecated", ctx.colorize(ansiYellow, "WARNING:"), flagName(flag.Name))
+		} else {
+			ctx.Infof("%s %s is deprecated, please use %s", ctx.colorize(ansiYellow, "WARNING:"), flagName(flag.Name), flagName(replacement))
+		}
+	})
+}
+
+// flagName returns name as it is given on the command line.
+func flagName(name string) string {
+	if len(name) == 1 {
+		return "-" + name
+	}
+	return "--" + name
+}
@@ -0,0 +1,148 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd_test
+
+import (
+	"fmt"
+
+	gitjujutesting "github.com/juju/testing"
+	gc "gopkg.in/check.v1"
+	"launchpad.net/gnuflag"
+
+	"github.com/juju/cmd"
+	"github.com/juju/cmd/cmdtesting"
+)
+
+type DeprecationSuite struct {
+	gitjujutesting.IsolationSuite
+}
+
+var _ = gc.Suite(&DeprecationSuite{})
+
+// renamedCommand is a TestCommand whose Info marks it or some of its
+// names deprecated.
+type renamedCommand struct {
+	TestCommand
+	deprecated        string
+	deprecatedAliases []string
+}
+
+func (c *renamedCommand) Info() *cmd.Info {
+	info := c.TestCommand.Info()
+	info.Deprecated = c.deprecated
+	info.DeprecatedAliases = c.deprecatedAliases
+	return info
+}
+
+func (s *DeprecationSuite) TestDeprecatedCommand(c *gc.C) {
+	super := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "jujutest"})
+	super.Register(&renamedCommand{
+		TestCommand: TestCommand{Name: "old"},
+		deprecated:  "new",
+	})
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(super, ctx, []string{"old", "--option", "value"})
+	c.Assert(code, gc.Equals, 0)
+	c.Assert(cmdtesting.Stdout(ctx), gc.Equals, "value\n")
+	c.Assert(cmdtesting.Stderr(ctx), gc.Equals, "WARNING: \"old\" is deprecated, please use \"new\"\n")
+}
+
+func (s *DeprecationSuite) TestDeprecatedAliases(c *gc.C) {
+	super := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "jujutest"})
+	super.Register(&renamedCommand{
+		TestCommand:       TestCommand{Name: "new"},
+		deprecatedAliases: []string{"old"},
+	})
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(super, ctx, []string{"old", "--option", "value"})
+	c.Assert(code, gc.Equals, 0)
+	c.Assert(cmdtesting.Stdout(ctx), gc.Equals, "value\n")
+	c.Assert(cmdtesting.Stderr(ctx), gc.Equals, "WARNING: \"old\" is deprecated, please use \"new\"\n")
+
+	ctx = cmdtesting.Context(c)
+	code = cmd.Main(super, ctx, []string{"new"})
+	c.Assert(code, gc.Equals, 0)
+	c.Assert(cmdtesting.Stderr(ctx), gc.Equals, "")
+}
+
+func (s *DeprecationSuite) TestDeprecatedAliasesNotListed(c *gc.C) {
+	super := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "jujutest"})
+	super.Register(&renamedCommand{
+		TestCommand:       TestCommand{Name: "new"},
+		deprecatedAliases: []string{"old"},
+	})
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(super, ctx, []string{"help", "commands"})
+	c.Assert(code, gc.Equals, 0)
+	c.Assert(cmdtesting.Stdout(ctx), gc.Equals, ""+
+		"help  show help on a command or other topic\n"+
+		"new   new the juju\n")
+}
+
+// flagsCommand has deprecated flags.
+type flagsCommand struct {
+	cmd.CommandBase
+	option string
+	force  bool
+}
+
+func (c *flagsCommand) Info() *cmd.Info {
+	return &cmd.Info{Name: "flags"}
+}
+
+func (c *flagsCommand) SetFlags(f *gnuflag.FlagSet) {
+	f.StringVar(&c.option, "option", "", "")
+	f.StringVar(&c.option, "old-option", "", "")
+	f.BoolVar(&c.force, "force", false, "")
+	f.BoolVar(&c.force, "f", false, "")
+	cmd.DeprecateFlag(f, "old-option", "option")
+	cmd.DeprecateFlag(f, "f", "")
+}
+
+func (c *flagsCommand) Run(ctx *cmd.Context) error {
+	fmt.Fprintf(ctx.Stdout, "%s %v\n", c.option, c.force)
+	return nil
+}
+
+func (s *DeprecationSuite) TestDeprecatedFlags(c *gc.C) {
+	for _, test := range []struct {
+		args   []string
+		stdout string
+		stderr string
+	}{{
+		args:   []string{"--option", "value", "--force"},
+		stdout: "value true\n",
+	}, {
+		args:   []string{"--old-option", "value"},
+		stdout: "value false\n",
+		stderr: "WARNING: --old-option is deprecated, please use --option\n",
+	}, {
+		args:   []string{"-f", "--old-option", "value", "--old-option", "again"},
+		stdout: "again true\n",
+		stderr: "WARNING: -f is deprecated\n" +
+			"WARNING: --old-option is deprecated, please use --option\n",
+	}} {
+		c.Logf("args: %q", test.args)
+		ctx := cmdtesting.Context(c)
+		code := cmd.Main(&flagsCommand{}, ctx, test.args)
+		c.Check(code, gc.Equals, 0)
+		c.Check(cmdtesting.Stdout(ctx), gc.Equals, test.stdout)
+		c.Check(cmdtesting.Stderr(ctx), gc.Equals, test.stderr)
+	}
+}
+
+func (s *DeprecationSuite) TestDeprecatedFlagsInSuperCommand(c *gc.C) {
+	super := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "jujutest"})
+	super.Register(&flagsCommand{})
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(super, ctx, []string{"flags", "--old-option", "value"})
+	c.Assert(code, gc.Equals, 0)
+	c.Assert(cmdtesting.Stdout(ctx), gc.Equals, "value false\n")
+	c.Assert(cmdtesting.Stderr(ctx), gc.Equals, "WARNING: --old-option is deprecated, please use --option\n")
+}
+
+func (s *DeprecationSuite) TestDeprecateUnknownFlag(c *gc.C) {
+	f := cmdtesting.NewFlagSet()
+	c.Assert(func() { cmd.DeprecateFlag(f, "missing", "") }, gc.PanicMatches, `flag "missing" not defined`)
+}
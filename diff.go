@@ -0,0 +1,191 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// diffContext holds the number of unchanged lines shown around each
+// change by WriteDiff.
+const diffContext = 3
+
+// diffOp is a line of a diff between two texts.
+type diffOp struct {
+	// kind is ' ' for a line in both texts, '-' for a line only in the
+	// first and '+' for a line only in the second.
+	kind byte
+	line string
+}
+
+// WriteDiff writes a unified diff from the current to the proposed value
+// of something a command would change to Stdout, and reports whether they
+// differ, writing nothing when they do not. It lets a command that
+// changes configuration show exactly what it would change when DryRun is
+// set, as in
+//
+//	if ctx.DryRun {
+//		_, err := ctx.WriteDiff(current, proposed, nil)
+//		return err
+//	}
+//
+// Both values are converted to text with formatter, which is told whether
+// Stdout is a terminal. When formatter is nil, FormatYamlSorted is used,
+// so that each key of a map or field of a struct is on its own line,
+// nested keys are indented below it, and keys and fields are in the same
+// order in both values: the diff then shows which keys are added, removed
+// or changed. Lines only in the current value are prefixed with "-" and
+// lines only in the proposed value with "+", and they are colored red and
+// green when color is enabled for Stdout, in the same way as it is for
+// Stderr.
+func (ctx *Context) WriteDiff(current, proposed interface{}, formatter Formatter) (changed bool, err error) {
+	if formatter == nil {
+		formatter = IgnoreTerminal(FormatYamlSorted)
+	}
+	isTerminal := isTerminalWriter(ctx.Stdout)
+	before, err := formatter(current, isTerminal)
+	if err != nil {
+		return false, fmt.Errorf("cannot format current value: %v", err)
+	}
+	after, err := formatter(proposed, isTerminal)
+	if err != nil {
+		return false, fmt.Errorf("cannot format proposed value: %v", err)
+	}
+	if bytes.Equal(before, after) {
+		return false, nil
+	}
+	ops := diffLines(splitLines(before), splitLines(after))
+	_, err = ctx.Stdout.Write(unifiedDiff(ops, ctx.colorEnabled(ctx.Stdout)))
+	return true, err
+}
+
+// splitLines returns the lines of text, without their line endings.
+func splitLines(text []byte) []string {
+	s := strings.TrimSuffix(string(text), "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// diffLines returns the shortest sequence of lines that turns a into b,
+// found from the longest common subsequence of their lines.
+func diffLines(a, b []string) []diffOp {
+	// common[i][j] holds the length of the longest common subsequence
+	// of a[i:] and b[j:].
+	common := make([][]int, len(a)+1)
+	for i := range common {
+		common[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else if common[i+1][j] >= common[i][j+1] {
+				common[i][j] = common[i+1][j]
+			} else {
+				common[i][j] = common[i][j+1]
+			}
+		}
+	}
+	var ops []diffOp
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case j == len(b) || i < len(a) && common[i+1][j] >= common[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	return ops
+}
+
+// unifiedDiff returns ops laid out as the hunks of a unified diff, each
+// with up to diffContext unchanged lines around its changes, colored if
+// color is set.
+func unifiedDiff(ops []diffOp, color bool) []byte {
+	paint := func(ansi, s string) string {
+		if !color {
+			return s
+		}
+		return ansi + s + ansiReset
+	}
+	var buf bytes.Buffer
+	// line holds the line numbers in the current and proposed values at
+	// which each op starts, counting from one.
+	line := make([][2]int, len(ops)+1)
+	line[0] = [2]int{1, 1}
+	for i, op := range ops {
+		line[i+1] = line[i]
+		if op.kind != '+' {
+			line[i+1][0]++
+		}
+		if op.kind != '-' {
+			line[i+1][1]++
+		}
+	}
+	for start := 0; start < len(ops); {
+		// Find the next change, and the end of the hunk around it,
+		// which ends when there are more than twice diffContext
+		// unchanged lines before the following change.
+		first := start
+		for first < len(ops) && ops[first].kind == ' ' {
+			first++
+		}
+		if first == len(ops) {
+			break
+		}
+		last, unchanged := first, 0
+		for i := first; i < len(ops) && unchanged <= 2*diffContext; i++ {
+			if ops[i].kind == ' ' {
+				unchanged++
+			} else {
+				last, unchanged = i, 0
+			}
+		}
+		from, to := first-diffContext, last+1+diffContext
+		if from < start {
+			from = start
+		}
+		if to > len(ops) {
+			to = len(ops)
+		}
+		header := fmt.Sprintf("@@ -%s +%s @@", hunkRange(line[from][0], line[to][0]-line[from][0]), hunkRange(line[from][1], line[to][1]-line[from][1]))
+		fmt.Fprintln(&buf, paint(ansiCyan, header))
+		for _, op := range ops[from:to] {
+			text := string(op.kind) + op.line
+			switch op.kind {
+			case '-':
+				text = paint(ansiRed, text)
+			case '+':
+				text = paint(ansiGreen, text)
+			}
+			fmt.Fprintln(&buf, text)
+		}
+		start = to
+	}
+	return buf.Bytes()
+}
+
+// hunkRange returns the range of count lines starting at line start, as
+// shown in the header of a hunk of a unified diff.
+func hunkRange(start, count int) string {
+	switch count {
+	case 0:
+		// An empty range is given by the line before it.
+		return fmt.Sprintf("%d,0", start-1)
+	case 1:
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
@@ -0,0 +1,123 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	gitjujutesting "github.com/juju/testing"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/cmd"
+	"github.com/juju/cmd/cmdtesting"
+)
+
+type DiffSuite struct {
+	gitjujutesting.IsolationSuite
+}
+
+var _ = gc.Suite(&DiffSuite{})
+
+func (s *DiffSuite) TestWriteDiff(c *gc.C) {
+	ctx := cmdtesting.Context(c)
+	current := map[string]interface{}{
+		"name":    "wordpress",
+		"units":   1,
+		"exposed": true,
+		"config":  map[string]string{"port": "80"},
+	}
+	proposed := map[string]interface{}{
+		"name":   "wordpress",
+		"units":  3,
+		"series": "trusty",
+		"config": map[string]string{"port": "8080"},
+	}
+	changed, err := ctx.WriteDiff(current, proposed, nil)
+	c.Assert(err, gc.IsNil)
+	c.Check(changed, gc.Equals, true)
+	c.Check(cmdtesting.Stdout(ctx), gc.Equals, ""+
+		"@@ -1,5 +1,5 @@\n"+
+		" config:\n"+
+		"-  port: \"80\"\n"+
+		"-exposed: true\n"+
+		"+  port: \"8080\"\n"+
+		" name: wordpress\n"+
+		"-units: 1\n"+
+		"+series: trusty\n"+
+		"+units: 3\n")
+}
+
+func (s *DiffSuite) TestWriteDiffUnchanged(c *gc.C) {
+	ctx := cmdtesting.Context(c)
+	changed, err := ctx.WriteDiff(map[string]int{"units": 1}, map[string]int{"units": 1}, nil)
+	c.Assert(err, gc.IsNil)
+	c.Check(changed, gc.Equals, false)
+	c.Check(cmdtesting.Stdout(ctx), gc.Equals, "")
+}
+
+func (s *DiffSuite) TestWriteDiffHunks(c *gc.C) {
+	var current, proposed []string
+	for i := 0; i < 20; i++ {
+		current = append(current, fmt.Sprintf("line %d", i))
+	}
+	proposed = append(proposed, current...)
+	proposed[1] = "changed 1"
+	proposed = append(proposed[:15], proposed[16:]...)
+	formatter := func(value interface{}, _ bool) ([]byte, error) {
+		return []byte(strings.Join(value.([]string), "\n")), nil
+	}
+	ctx := cmdtesting.Context(c)
+	changed, err := ctx.WriteDiff(current, proposed, formatter)
+	c.Assert(err, gc.IsNil)
+	c.Check(changed, gc.Equals, true)
+	c.Check(cmdtesting.Stdout(ctx), gc.Equals, ""+
+		"@@ -1,5 +1,5 @@\n"+
+		" line 0\n"+
+		"-line 1\n"+
+		"+changed 1\n"+
+		" line 2\n"+
+		" line 3\n"+
+		" line 4\n"+
+		"@@ -13,7 +13,6 @@\n"+
+		" line 12\n"+
+		" line 13\n"+
+		" line 14\n"+
+		"-line 15\n"+
+		" line 16\n"+
+		" line 17\n"+
+		" line 18\n")
+}
+
+func (s *DiffSuite) TestWriteDiffFromNothing(c *gc.C) {
+	ctx := cmdtesting.Context(c)
+	changed, err := ctx.WriteDiff(nil, map[string]int{"units": 1}, nil)
+	c.Assert(err, gc.IsNil)
+	c.Check(changed, gc.Equals, true)
+	c.Check(cmdtesting.Stdout(ctx), gc.Equals, "@@ -0,0 +1 @@\n+units: 1\n")
+}
+
+func (s *DiffSuite) TestWriteDiffColor(c *gc.C) {
+	ctx := cmdtesting.Context(c)
+	ctx.SetColorMode(cmd.ColorAlways)
+	_, err := ctx.WriteDiff(map[string]int{"units": 1}, map[string]int{"units": 2}, nil)
+	c.Assert(err, gc.IsNil)
+	c.Check(cmdtesting.Stdout(ctx), gc.Equals, ""+
+		"\x1b[36m@@ -1 +1 @@\x1b[0m\n"+
+		"\x1b[31m-units: 1\x1b[0m\n"+
+		"\x1b[32m+units: 2\x1b[0m\n")
+}
+
+func (s *DiffSuite) TestWriteDiffFormatError(c *gc.C) {
+	formatter := func(value interface{}, _ bool) ([]byte, error) {
+		if value == nil {
+			return nil, errors.New("boom")
+		}
+		return nil, nil
+	}
+	ctx := cmdtesting.Context(c)
+	_, err := ctx.WriteDiff(1, nil, formatter)
+	c.Check(err, gc.ErrorMatches, "cannot format proposed value: boom")
+}
@@ -0,0 +1,75 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// ConfigDir returns the directory in which the named program should keep
+// its user configuration, following the XDG Base Directory specification:
+// $XDG_CONFIG_HOME/name, or $HOME/.config/name if $XDG_CONFIG_HOME is not
+// set to an absolute path. On Windows it is %APPDATA%\name. The directory
+// is not created.
+func ConfigDir(name string) (string, error) {
+	return userDir(name, os.Getenv, runtime.GOOS, configDirSpec)
+}
+
+// CacheDir returns the directory in which the named program should keep
+// cached data for the user, following the XDG Base Directory
+// specification: $XDG_CACHE_HOME/name, or $HOME/.cache/name if
+// $XDG_CACHE_HOME is not set to an absolute path. On Windows it is
+// %LOCALAPPDATA%\name. The directory is not created.
+func CacheDir(name string) (string, error) {
+	return userDir(name, os.Getenv, runtime.GOOS, cacheDirSpec)
+}
+
+// ConfigDir works like the ConfigDir function, but reads the environment
+// from Env, or from that of the process if Env is nil, so that tests can
+// choose the directory.
+func (ctx *Context) ConfigDir(name string) (string, error) {
+	return userDir(name, ctx.getenv, runtime.GOOS, configDirSpec)
+}
+
+// CacheDir works like the CacheDir function, but reads the environment
+// like Context.ConfigDir.
+func (ctx *Context) CacheDir(name string) (string, error) {
+	return userDir(name, ctx.getenv, runtime.GOOS, cacheDirSpec)
+}
+
+// userDirSpec describes where a kind of user directory is found.
+type userDirSpec struct {
+	kind       string
+	xdgKey     string
+	homeSubdir string
+	windowsKey string
+}
+
+var (
+	configDirSpec = userDirSpec{"config", "XDG_CONFIG_HOME", ".config", "APPDATA"}
+	cacheDirSpec  = userDirSpec{"cache", "XDG_CACHE_HOME", ".cache", "LOCALAPPDATA"}
+)
+
+// userDir returns the directory described by spec for the named program
+// on the operating system goos, reading the environment with getenv.
+func userDir(name string, getenv func(string) string, goos string, spec userDirSpec) (string, error) {
+	if goos == "windows" {
+		base := getenv(spec.windowsKey)
+		if base == "" {
+			return "", fmt.Errorf("cannot determine %s directory: %%%s%% is not set", spec.kind, spec.windowsKey)
+		}
+		return filepath.Join(base, name), nil
+	}
+	if base := getenv(spec.xdgKey); filepath.IsAbs(base) {
+		return filepath.Join(base, name), nil
+	}
+	home := getenv("HOME")
+	if home == "" {
+		return "", fmt.Errorf("cannot determine %s directory: $HOME is not set", spec.kind)
+	}
+	return filepath.Join(home, spec.homeSubdir, name), nil
+}
@@ -0,0 +1,109 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"path/filepath"
+	"runtime"
+
+	gitjujutesting "github.com/juju/testing"
+	gc "gopkg.in/check.v1"
+)
+
+type DirsSuite struct {
+	gitjujutesting.IsolationSuite
+}
+
+var _ = gc.Suite(&DirsSuite{})
+
+var userDirTests = []struct {
+	goos   string
+	env    map[string]string
+	config string
+	cache  string
+	err    string
+}{{
+	goos:   "linux",
+	env:    map[string]string{"HOME": "/home/user"},
+	config: "/home/user/.config/mytool",
+	cache:  "/home/user/.cache/mytool",
+}, {
+	goos: "linux",
+	env: map[string]string{
+		"HOME":            "/home/user",
+		"XDG_CONFIG_HOME": "/xdg/config",
+		"XDG_CACHE_HOME":  "/xdg/cache",
+	},
+	config: "/xdg/config/mytool",
+	cache:  "/xdg/cache/mytool",
+}, {
+	// Relative paths are ignored, as the specification requires.
+	goos: "darwin",
+	env: map[string]string{
+		"HOME":            "/Users/user",
+		"XDG_CONFIG_HOME": "config",
+		"XDG_CACHE_HOME":  "cache",
+	},
+	config: "/Users/user/.config/mytool",
+	cache:  "/Users/user/.cache/mytool",
+}, {
+	goos: "linux",
+	env:  map[string]string{},
+	err:  `cannot determine (config|cache) directory: \$HOME is not set`,
+}, {
+	goos: "windows",
+	env: map[string]string{
+		"APPDATA":         `/Users/user/AppData/Roaming`,
+		"LOCALAPPDATA":    `/Users/user/AppData/Local`,
+		"XDG_CONFIG_HOME": "/xdg/config",
+	},
+	config: "/Users/user/AppData/Roaming/mytool",
+	cache:  "/Users/user/AppData/Local/mytool",
+}, {
+	goos: "windows",
+	env:  map[string]string{"HOME": "/home/user"},
+	err:  `cannot determine (config|cache) directory: %(APPDATA|LOCALAPPDATA)% is not set`,
+}}
+
+func (s *DirsSuite) TestUserDir(c *gc.C) {
+	for i, test := range userDirTests {
+		c.Logf("test %d: %s %v", i, test.goos, test.env)
+		getenv := func(key string) string { return test.env[key] }
+		config, err := userDir("mytool", getenv, test.goos, configDirSpec)
+		cache, cacheErr := userDir("mytool", getenv, test.goos, cacheDirSpec)
+		if test.err != "" {
+			c.Check(err, gc.ErrorMatches, test.err)
+			c.Check(cacheErr, gc.ErrorMatches, test.err)
+			continue
+		}
+		c.Check(err, gc.IsNil)
+		c.Check(cacheErr, gc.IsNil)
+		c.Check(config, gc.Equals, filepath.FromSlash(test.config))
+		c.Check(cache, gc.Equals, filepath.FromSlash(test.cache))
+	}
+}
+
+func (s *DirsSuite) TestContextDirs(c *gc.C) {
+	if runtime.GOOS == "windows" {
+		c.Skip("the directories come from %APPDATA% and %LOCALAPPDATA% on windows")
+	}
+	s.PatchEnvironment("HOME", "/home/process")
+	s.PatchEnvironment("XDG_CACHE_HOME", "/xdg/cache")
+	ctx := &Context{Env: map[string]string{"HOME": "/home/context"}}
+	dir, err := ctx.ConfigDir("mytool")
+	c.Assert(err, gc.IsNil)
+	c.Assert(dir, gc.Equals, filepath.FromSlash("/home/context/.config/mytool"))
+	dir, err = ctx.CacheDir("mytool")
+	c.Assert(err, gc.IsNil)
+	c.Assert(dir, gc.Equals, filepath.FromSlash("/home/context/.cache/mytool"))
+
+	ctx = &Context{}
+	dir, err = ctx.CacheDir("mytool")
+	c.Assert(err, gc.IsNil)
+	c.Assert(dir, gc.Equals, filepath.FromSlash("/xdg/cache/mytool"))
+
+	dir, err = ConfigDir("mytool")
+	c.Assert(err, gc.IsNil)
+	c.Assert(dir, gc.Equals, filepath.FromSlash("/home/process/.config/mytool"))
+}
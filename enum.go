@@ -0,0 +1,75 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"launchpad.net/gnuflag"
+)
+
+// EnumValue implements gnuflag.Value for a string flag that must be one of
+// a fixed set of values.
+type EnumValue struct {
+	target  *string
+	allowed []string
+
+	// IgnoreCase, if set, makes Set accept the allowed values in any
+	// case. The value stored is the allowed value as it was given.
+	IgnoreCase bool
+}
+
+var _ gnuflag.Value = (*EnumValue)(nil)
+
+// NewEnumValue is used to create the type passed into the gnuflag.FlagSet Var function.
+// The default value is not checked, so it may be empty to tell whether the
+// flag was given.
+// f.Var(cmd.NewEnumValue("medium", []string{"low", "medium", "high"}, &someMember), "name", "help")
+func NewEnumValue(defaultValue string, allowed []string, target *string) *EnumValue {
+	*target = defaultValue
+	return &EnumValue{
+		target:  target,
+		allowed: allowed,
+	}
+}
+
+// EnumVar defines a flag with the specified name, default value and usage
+// on f that accepts only the allowed values. The allowed values are added
+// to the usage text, as in "Set the level (low|medium|high)".
+func EnumVar(f *gnuflag.FlagSet, p *string, name, value string, allowed []string, usage string) *EnumValue {
+	v := NewEnumValue(value, allowed, p)
+	f.Var(v, name, enumUsage(usage, allowed))
+	return v
+}
+
+// Implements gnuflag.Value Set.
+func (v *EnumValue) Set(s string) error {
+	for _, allowed := range v.allowed {
+		if s == allowed || v.IgnoreCase && strings.EqualFold(s, allowed) {
+			*v.target = allowed
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown value %q, expected one of %s", s, enumChoices(v.allowed))
+}
+
+// Implements gnuflag.Value String.
+func (v *EnumValue) String() string {
+	return *v.target
+}
+
+// enumChoices returns the given choices joined with "|" in parentheses,
+// as shown in usage text and errors.
+func enumChoices(choices []string) string {
+	return "(" + strings.Join(choices, "|") + ")"
+}
+
+// enumUsage returns usage followed by the allowed choices.
+func enumUsage(usage string, choices []string) string {
+	if usage == "" {
+		return enumChoices(choices)
+	}
+	return usage + " " + enumChoices(choices)
+}
@@ -0,0 +1,65 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd_test
+
+import (
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/cmd"
+	"github.com/juju/cmd/cmdtesting"
+)
+
+type EnumSuite struct{}
+
+var _ = gc.Suite(&EnumSuite{})
+
+var levels = []string{"low", "medium", "high"}
+
+func (s *EnumSuite) TestEnumVar(c *gc.C) {
+	for _, test := range []struct {
+		arg        string
+		ignoreCase bool
+		expected   string
+		err        string
+	}{{
+		arg:      "high",
+		expected: "high",
+	}, {
+		arg: "HIGH",
+		err: `invalid value "HIGH" for flag --level: unknown value "HIGH", expected one of \(low\|medium\|high\)`,
+	}, {
+		arg:        "HIGH",
+		ignoreCase: true,
+		expected:   "high",
+	}, {
+		arg:        "extreme",
+		ignoreCase: true,
+		err:        `invalid value "extreme" for flag --level: unknown value "extreme", expected one of \(low\|medium\|high\)`,
+	}} {
+		c.Logf("arg %q, ignore case %v", test.arg, test.ignoreCase)
+		var level string
+		f := cmdtesting.NewFlagSet()
+		v := cmd.EnumVar(f, &level, "level", "medium", levels, "Set the level")
+		v.IgnoreCase = test.ignoreCase
+		c.Check(level, gc.Equals, "medium")
+		err := f.Parse(false, []string{"--level", test.arg})
+		if test.err != "" {
+			c.Check(err, gc.ErrorMatches, test.err)
+			continue
+		}
+		c.Assert(err, gc.IsNil)
+		c.Check(level, gc.Equals, test.expected)
+		c.Check(v.String(), gc.Equals, test.expected)
+	}
+}
+
+func (s *EnumSuite) TestEnumVarUsage(c *gc.C) {
+	var level, other string
+	f := cmdtesting.NewFlagSet()
+	cmd.EnumVar(f, &level, "level", "", levels, "Set the level")
+	cmd.EnumVar(f, &other, "other", "", levels, "")
+	c.Check(f.Lookup("level").Usage, gc.Equals, "Set the level (low|medium|high)")
+	c.Check(f.Lookup("other").Usage, gc.Equals, "(low|medium|high)")
+	c.Check(level, gc.Equals, "")
+}
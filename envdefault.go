@@ -0,0 +1,160 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"launchpad.net/gnuflag"
+)
+
+// ValueSource describes where the value of a flag came from.
+type ValueSource int
+
+const (
+	// SourceFallback means that the flag holds its fallback value.
+	SourceFallback ValueSource = iota
+
+	// SourceEnv means that the flag value was read from an environment
+	// variable.
+	SourceEnv
+
+	// SourceFlag means that the flag was specified on the command line.
+	SourceFlag
+
+	// SourceConfig means that the value was read from a flag config
+	// file. See SetFlagsFromConfig.
+	SourceConfig
+)
+
+// EnvDefault implements gnuflag.Value for a string flag that, when not
+// specified on the command line, takes its value from an environment
+// variable, or from a fallback value if that variable is not set.
+type EnvDefault struct {
+	name     string
+	envKey   string
+	fallback string
+	target   *string
+	source   ValueSource
+}
+
+var _ gnuflag.Value = (*EnvDefault)(nil)
+
+// NewEnvDefault is used to create the type passed into the gnuflag.FlagSet
+// Var function. The environment is read when NewEnvDefault is called, so
+// it should be called from SetFlags. When the command is run by Main, the
+// value is read again, once the command line has been parsed, from the
+// Env of the Context, unless Env is nil or the flag was given.
+// f.Var(cmd.NewEnvDefault("model", "JUJU_MODEL", "", &someMember), "model", cmd.EnvUsage("help", "JUJU_MODEL"))
+func NewEnvDefault(name, envKey, fallback string, target *string) *EnvDefault {
+	v := &EnvDefault{
+		name:     name,
+		envKey:   envKey,
+		fallback: fallback,
+		target:   target,
+	}
+	if value := os.Getenv(envKey); value != "" {
+		*target = value
+		v.source = SourceEnv
+	} else {
+		*target = fallback
+		v.source = SourceFallback
+	}
+	return v
+}
+
+// EnvStringVar defines a string flag with the specified name and usage on
+// f, whose default value is read from the envKey environment variable or
+// is fallback if that is not set. The usage text is annotated with the
+// name of the environment variable.
+func EnvStringVar(f *gnuflag.FlagSet, p *string, name, envKey, fallback, usage string) *EnvDefault {
+	v := NewEnvDefault(name, envKey, fallback, p)
+	f.Var(v, name, EnvUsage(usage, envKey))
+	return v
+}
+
+// EnvUsage returns usage annotated to say that the flag is read from the
+// envKey environment variable when it is not specified.
+func EnvUsage(usage, envKey string) string {
+	note := fmt.Sprintf("(defaults to $%s if set)", envKey)
+	if usage == "" {
+		return note
+	}
+	return usage + " " + note
+}
+
+// resolve reads the value from the environment of ctx, as described by
+// Context.lookupEnv, unless it was given on the command line or in a flag
+// config file.
+func (v *EnvDefault) resolve(ctx *Context) {
+	if v.source == SourceFlag || v.source == SourceConfig {
+		return
+	}
+	if value := ctx.getenv(v.envKey); value != "" {
+		*v.target = value
+		v.source = SourceEnv
+	} else {
+		*v.target = v.fallback
+		v.source = SourceFallback
+	}
+}
+
+// resolveEnvDefaults reads the value of each EnvDefault flag in f that
+// was not given on the command line from the environment of ctx. It does
+// nothing if ctx is nil, leaving the values read by NewEnvDefault.
+func resolveEnvDefaults(ctx *Context, f *gnuflag.FlagSet) {
+	if ctx == nil {
+		return
+	}
+	f.VisitAll(func(flag *gnuflag.Flag) {
+		if v, ok := flag.Value.(*EnvDefault); ok {
+			v.resolve(ctx)
+		}
+	})
+}
+
+// setFromConfig sets the value as read from a flag config file, unless
+// it was given on the command line.
+func (v *EnvDefault) setFromConfig(s string) {
+	if v.source == SourceFlag {
+		return
+	}
+	*v.target = s
+	v.source = SourceConfig
+}
+
+// Implements gnuflag.Value Set.
+func (v *EnvDefault) Set(s string) error {
+	*v.target = s
+	v.source = SourceFlag
+	return nil
+}
+
+// Implements gnuflag.Value String.
+func (v *EnvDefault) String() string {
+	return *v.target
+}
+
+// Source returns where the current value came from.
+func (v *EnvDefault) Source() ValueSource {
+	return v.source
+}
+
+// Describe returns a description of where the current value came from,
+// suitable for use in error messages.
+func (v *EnvDefault) Describe() string {
+	switch v.source {
+	case SourceFlag:
+		if len(v.name) == 1 {
+			return fmt.Sprintf("-%s flag", v.name)
+		}
+		return fmt.Sprintf("--%s flag", v.name)
+	case SourceEnv:
+		return fmt.Sprintf("$%s environment variable", v.envKey)
+	case SourceConfig:
+		return fmt.Sprintf("%s in flag config file", v.name)
+	}
+	return "default value"
+}
@@ -0,0 +1,139 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd_test
+
+import (
+	"fmt"
+
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"launchpad.net/gnuflag"
+
+	"github.com/juju/cmd"
+	"github.com/juju/cmd/cmdtesting"
+)
+
+type EnvDefaultSuite struct {
+	testing.IsolationSuite
+}
+
+var _ = gc.Suite(&EnvDefaultSuite{})
+
+func (s *EnvDefaultSuite) TestSources(c *gc.C) {
+	for i, test := range []struct {
+		message        string
+		env            string
+		args           []string
+		expectedValue  string
+		expectedSource cmd.ValueSource
+		description    string
+	}{{
+		message:        "fallback",
+		expectedValue:  "fallback",
+		expectedSource: cmd.SourceFallback,
+		description:    "default value",
+	}, {
+		message:        "environment",
+		env:            "from-env",
+		expectedValue:  "from-env",
+		expectedSource: cmd.SourceEnv,
+		description:    "$TEST_MODEL environment variable",
+	}, {
+		message:        "flag overrides environment",
+		env:            "from-env",
+		args:           []string{"--model", "from-flag"},
+		expectedValue:  "from-flag",
+		expectedSource: cmd.SourceFlag,
+		description:    "--model flag",
+	}} {
+		c.Logf("%d: %s", i, test.message)
+		s.PatchEnvironment("TEST_MODEL", test.env)
+		f := cmdtesting.NewFlagSet()
+		var model string
+		v := cmd.EnvStringVar(f, &model, "model", "TEST_MODEL", "fallback", "the model")
+		err := f.Parse(true, test.args)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(model, gc.Equals, test.expectedValue)
+		c.Check(v.Source(), gc.Equals, test.expectedSource)
+		c.Check(v.Describe(), gc.Equals, test.description)
+	}
+}
+
+func (s *EnvDefaultSuite) TestHelp(c *gc.C) {
+	s.PatchEnvironment("TEST_MODEL", "from-env")
+	f := cmdtesting.NewFlagSet()
+	var model string
+	cmd.EnvStringVar(f, &model, "model", "TEST_MODEL", "", "the model")
+	help := (&cmd.Info{Name: "verb"}).Help(f)
+	c.Assert(string(help), gc.Equals, `Usage: verb [options]
+
+Options:
+--model (= from-env)
+    the model (defaults to $TEST_MODEL if set)
+`)
+}
+
+func (s *EnvDefaultSuite) TestEnvUsage(c *gc.C) {
+	c.Check(cmd.EnvUsage("", "FOO"), gc.Equals, "(defaults to $FOO if set)")
+	c.Check(cmd.EnvUsage("the foo", "FOO"), gc.Equals, "the foo (defaults to $FOO if set)")
+}
+
+// envDefaultCommand prints the model it is given and where it came from.
+type envDefaultCommand struct {
+	cmd.CommandBase
+	model string
+	v     *cmd.EnvDefault
+}
+
+func (c *envDefaultCommand) Info() *cmd.Info {
+	return &cmd.Info{Name: "verb"}
+}
+
+func (c *envDefaultCommand) SetFlags(f *gnuflag.FlagSet) {
+	c.v = cmd.EnvStringVar(f, &c.model, "model", "TEST_MODEL", "fallback", "the model")
+}
+
+func (c *envDefaultCommand) Run(ctx *cmd.Context) error {
+	fmt.Fprintf(ctx.Stdout, "%s from %s\n", c.model, c.v.Describe())
+	return nil
+}
+
+func (s *EnvDefaultSuite) TestContextEnv(c *gc.C) {
+	s.PatchEnvironment("TEST_MODEL", "from-process")
+	for i, test := range []struct {
+		env    map[string]string
+		args   []string
+		stdout string
+	}{{
+		stdout: "from-process from $TEST_MODEL environment variable\n",
+	}, {
+		env:    map[string]string{},
+		stdout: "fallback from default value\n",
+	}, {
+		env:    map[string]string{"TEST_MODEL": "from-env"},
+		stdout: "from-env from $TEST_MODEL environment variable\n",
+	}, {
+		env:    map[string]string{"TEST_MODEL": "from-env"},
+		args:   []string{"--model", "from-flag"},
+		stdout: "from-flag from --model flag\n",
+	}} {
+		for _, super := range []bool{false, true} {
+			c.Logf("%d: %v %q, super %v", i, test.env, test.args, super)
+			var command cmd.Command = &envDefaultCommand{}
+			args := test.args
+			if super {
+				jc := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "jujutest"})
+				jc.Register(command)
+				command = jc
+				args = append([]string{"verb"}, args...)
+			}
+			ctx := cmdtesting.Context(c)
+			ctx.Env = test.env
+			code := cmd.Main(command, ctx, args)
+			c.Check(code, gc.Equals, 0)
+			c.Check(cmdtesting.Stdout(ctx), gc.Equals, test.stdout)
+		}
+	}
+}
@@ -5,11 +5,14 @@ package cmd
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 
 	"github.com/juju/utils"
+	"launchpad.net/gnuflag"
 )
 
 // FileVar represents a path to a file.
@@ -24,6 +27,10 @@ type FileVar struct {
 
 var ErrNoPath = errors.New("path not set")
 
+// ErrStdinInUse is returned when a FileVar reads from stdin after another
+// FileVar has already done so in the same Context.
+var ErrStdinInUse = errors.New("stdin requested by more than one flag")
+
 // Set stores the chosen path name in f.Path.
 func (f *FileVar) Set(v string) error {
 	f.Path = v
@@ -55,6 +62,9 @@ func (f *FileVar) Open(ctx *Context) (io.ReadCloser, error) {
 		return nil, ErrNoPath
 	}
 	if f.IsStdin() {
+		if _, ok := ctx.claimStdin(f, ""); !ok {
+			return nil, ErrStdinInUse
+		}
 		return ioutil.NopCloser(ctx.Stdin), nil
 	}
 
@@ -71,6 +81,9 @@ func (f *FileVar) Read(ctx *Context) ([]byte, error) {
 		return nil, ErrNoPath
 	}
 	if f.IsStdin() {
+		if _, ok := ctx.claimStdin(f, ""); !ok {
+			return nil, ErrStdinInUse
+		}
 		return ioutil.ReadAll(ctx.Stdin)
 	}
 
@@ -85,3 +98,140 @@ func (f *FileVar) Read(ctx *Context) ([]byte, error) {
 func (f *FileVar) String() string {
 	return f.Path
 }
+
+// claimStdin records that owner, described as name, reads from the
+// context's Stdin. If something else has already claimed it, claimStdin
+// returns false and the description of what did.
+func (ctx *Context) claimStdin(owner interface{}, name string) (string, bool) {
+	if ctx.stdinOwner != nil && ctx.stdinOwner != owner {
+		return ctx.stdinOwnerName, false
+	}
+	ctx.stdinOwner = owner
+	if name != "" {
+		ctx.stdinOwnerName = name
+	}
+	return "", true
+}
+
+// stdinFlagValue returns the FileVar of value, if it is a FileVar or
+// ExistingFileVar that has been set to read from stdin.
+func stdinFlagValue(value gnuflag.Value) *FileVar {
+	var f *FileVar
+	switch value := value.(type) {
+	case *FileVar:
+		f = value
+	case *ExistingFileVar:
+		f = &value.FileVar
+	}
+	if f == nil || !f.IsStdin() {
+		return nil
+	}
+	return f
+}
+
+// checkStdinFlags claims the context's Stdin for each FileVar flag set in
+// f to read from it, so that two flags given "-", or a flag and an @-
+// argument file, are reported as a flagError when the command line is
+// parsed, before either of them has read anything. If ctx is nil, only
+// the flags in f are checked against each other.
+func checkStdinFlags(ctx *Context, f *gnuflag.FlagSet) error {
+	if f == nil {
+		return nil
+	}
+	if ctx == nil {
+		ctx = &Context{}
+	}
+	var err error
+	f.Visit(func(flag *gnuflag.Flag) {
+		v := stdinFlagValue(flag.Value)
+		if v == nil || err != nil {
+			return
+		}
+		name := flagName(flag.Name)
+		if previous, ok := ctx.claimStdin(v, name); !ok {
+			err = &flagError{fmt.Errorf("%s and %s cannot both read from stdin", previous, name)}
+		}
+	})
+	return err
+}
+
+// ExistingFileVar is a FileVar whose path must refer to an existing,
+// readable file, so that a bad path is reported before the command starts
+// work. Absolute paths are checked when the flag is set. Relative paths
+// are interpreted relative to the Context's Dir, so they are checked by
+// Main, before the command is run. A path that is one of the StdinMarkers
+// is not checked, so SetStdin must be called before the flag is parsed.
+type ExistingFileVar struct {
+	FileVar
+}
+
+// Set stores v in f.Path, checking that it refers to a readable file if
+// it is an absolute path.
+func (f *ExistingFileVar) Set(v string) error {
+	f.Path = v
+	if f.IsStdin() {
+		return nil
+	}
+	path, err := utils.NormalizePath(v)
+	if err != nil {
+		return err
+	}
+	if !filepath.IsAbs(path) {
+		return nil
+	}
+	return checkReadable(path, v)
+}
+
+// Check checks that f.Path refers to a readable file, interpreting
+// relative paths relative to the Context's Dir.
+func (f *ExistingFileVar) Check(ctx *Context) error {
+	if f.IsStdin() {
+		return nil
+	}
+	path, err := utils.NormalizePath(f.Path)
+	if err != nil {
+		return err
+	}
+	return checkReadable(ctx.AbsPath(path), f.Path)
+}
+
+// checkExistingFiles checks the path of each ExistingFileVar flag that
+// was set in f, returning a flagError for the first that does not refer
+// to a readable file.
+func checkExistingFiles(ctx *Context, f *gnuflag.FlagSet) error {
+	if f == nil {
+		return nil
+	}
+	var err error
+	f.Visit(func(flag *gnuflag.Flag) {
+		if v, ok := flag.Value.(*ExistingFileVar); ok && err == nil {
+			if checkErr := v.Check(ctx); checkErr != nil {
+				err = &flagError{fmt.Errorf("invalid value %q for flag %s: %v", v.Path, flagName(flag.Name), checkErr)}
+			}
+		}
+	})
+	return err
+}
+
+// checkReadable checks that the file at path is readable, describing it
+// as name in any error.
+func checkReadable(path, name string) error {
+	info, err := os.Stat(path)
+	switch {
+	case os.IsNotExist(err):
+		return fmt.Errorf("no such file: %s", name)
+	case os.IsPermission(err):
+		return fmt.Errorf("permission denied: %s", name)
+	case err != nil:
+		return err
+	case info.IsDir():
+		return fmt.Errorf("%s is a directory", name)
+	}
+	file, err := os.Open(path)
+	if os.IsPermission(err) {
+		return fmt.Errorf("permission denied: %s", name)
+	} else if err != nil {
+		return err
+	}
+	return file.Close()
+}
@@ -9,6 +9,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
 
 	gitjujutesting "github.com/juju/testing"
 	jc "github.com/juju/testing/checkers"
@@ -116,6 +117,102 @@ func (s *FileVarSuite) TestOpenStdin(c *gc.C) {
 	s.checkOpen(c, file, "abc")
 }
 
+func (s *FileVarSuite) TestStdinUsedTwice(c *gc.C) {
+	s.ctx.Stdin = bytes.NewBufferString("abc")
+
+	var config, other cmd.FileVar
+	config.SetStdin()
+	config.Set("-")
+	other.SetStdin()
+	other.Set("-")
+	file, err := config.Read(s.ctx)
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(file), gc.Equals, "abc")
+	_, err = other.Read(s.ctx)
+	c.Assert(err, gc.Equals, cmd.ErrStdinInUse)
+	_, err = other.Open(s.ctx)
+	c.Assert(err, gc.Equals, cmd.ErrStdinInUse)
+
+	// The same FileVar may read stdin again.
+	_, err = config.Open(s.ctx)
+	c.Assert(err, gc.IsNil)
+}
+
+// stdinFlagsCommand has two FileVar flags that may read from stdin, and
+// reads @file arguments.
+type stdinFlagsCommand struct {
+	cmd.CommandBase
+	config, other cmd.FileVar
+	ran           bool
+}
+
+func (c *stdinFlagsCommand) Info() *cmd.Info {
+	return &cmd.Info{Name: "deploy", Args: "[@<file>]"}
+}
+
+func (c *stdinFlagsCommand) SetFlags(f *gnuflag.FlagSet) {
+	c.config.SetStdin()
+	c.other.SetStdin()
+	f.Var(&c.config, "config", "the config")
+	f.Var(&c.other, "other", "the other config")
+}
+
+func (c *stdinFlagsCommand) ReadsArgFiles() bool {
+	return true
+}
+
+func (c *stdinFlagsCommand) Init(args []string) error {
+	return nil
+}
+
+func (c *stdinFlagsCommand) Run(ctx *cmd.Context) error {
+	c.ran = true
+	return nil
+}
+
+func (s *FileVarSuite) TestStdinClaimedTwiceOnCommandLine(c *gc.C) {
+	for i, test := range []struct {
+		args   []string
+		stderr string
+	}{{
+		args:   []string{"--config", "-", "--other", "-"},
+		stderr: "error: --config and --other cannot both read from stdin\nUsage: .*\n",
+	}, {
+		args:   []string{"--config", "-", "@-"},
+		stderr: "error: --config and @- cannot both read from stdin\n",
+	}} {
+		for _, super := range []bool{false, true} {
+			c.Logf("test %d: %q, super %v", i, test.args, super)
+			command := &stdinFlagsCommand{}
+			var run cmd.Command = command
+			args := test.args
+			if super {
+				jc := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "jujutest"})
+				jc.Register(command)
+				run = jc
+				args = append([]string{"deploy"}, args...)
+			}
+			ctx := cmdtesting.ContextWithStdin(c, "abc")
+			code := cmd.Main(run, ctx, args)
+			c.Check(code, gc.Equals, 2)
+			c.Check(cmdtesting.Stderr(ctx), gc.Matches, test.stderr)
+			c.Check(command.ran, gc.Equals, false)
+			c.Check(ctx.Stdin.(*bytes.Buffer).String(), gc.Equals, "abc")
+		}
+	}
+}
+
+func (s *FileVarSuite) TestStdinClaimedOnceOnCommandLine(c *gc.C) {
+	command := &stdinFlagsCommand{}
+	ctx := cmdtesting.ContextWithStdin(c, "abc")
+	code := cmd.Main(command, ctx, []string{"--config", "-", "--other", "other.yaml"})
+	c.Check(code, gc.Equals, 0)
+	c.Check(command.ran, gc.Equals, true)
+	data, err := command.config.Read(ctx)
+	c.Assert(err, gc.IsNil)
+	c.Check(string(data), gc.Equals, "abc")
+}
+
 func (s *FileVarSuite) TestOpenNotStdin(c *gc.C) {
 	var config cmd.FileVar
 	config.Set("-")
@@ -189,6 +286,111 @@ func (s *FileVarSuite) TestReadInvalid(c *gc.C) {
 	c.Assert(err, gc.ErrorMatches, "*permission denied")
 }
 
+func (s *FileVarSuite) TestExistingFileVarValid(c *gc.C) {
+	var config cmd.ExistingFileVar
+	fs := cmdtesting.NewFlagSet()
+	fs.Var(&config, "config", "the config")
+	err := fs.Parse(false, []string{"--config", s.ValidPath})
+	c.Assert(err, gc.IsNil)
+	c.Assert(config.Path, gc.Equals, s.ValidPath)
+	_, err = config.Read(s.ctx)
+	c.Assert(err, gc.IsNil)
+}
+
+func (s *FileVarSuite) TestExistingFileVarMissing(c *gc.C) {
+	var config cmd.ExistingFileVar
+	path := s.ctx.AbsPath("missing.yaml")
+	err := config.Set(path)
+	c.Assert(err, gc.ErrorMatches, "no such file: "+regexp.QuoteMeta(path))
+}
+
+func (s *FileVarSuite) TestExistingFileVarDirectory(c *gc.C) {
+	var config cmd.ExistingFileVar
+	err := config.Set(s.ctx.Dir)
+	c.Assert(err, gc.ErrorMatches, regexp.QuoteMeta(s.ctx.Dir)+" is a directory")
+}
+
+func (s *FileVarSuite) TestExistingFileVarUnreadable(c *gc.C) {
+	if os.Geteuid() == 0 {
+		c.Skip("root can read any file")
+	}
+	var config cmd.ExistingFileVar
+	err := config.Set(s.InvalidPath)
+	c.Assert(err, gc.ErrorMatches, "permission denied: "+regexp.QuoteMeta(s.InvalidPath))
+}
+
+func (s *FileVarSuite) TestExistingFileVarStdin(c *gc.C) {
+	s.ctx.Stdin = bytes.NewBufferString("abc")
+
+	var config cmd.ExistingFileVar
+	config.SetStdin()
+	err := config.Set("-")
+	c.Assert(err, gc.IsNil)
+	file, err := config.Read(s.ctx)
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(file), gc.Equals, "abc")
+}
+
+func (s *FileVarSuite) TestExistingFileVarRelative(c *gc.C) {
+	var config cmd.ExistingFileVar
+	err := config.Set("valid.yaml")
+	c.Assert(err, gc.IsNil)
+	c.Assert(config.Check(s.ctx), gc.IsNil)
+
+	err = config.Set("missing.yaml")
+	c.Assert(err, gc.IsNil)
+	c.Assert(config.Check(s.ctx), gc.ErrorMatches, "no such file: missing.yaml")
+}
+
+// existingFileCommand is a command that prints the file named by its
+// --config flag.
+type existingFileCommand struct {
+	cmd.CommandBase
+	config cmd.ExistingFileVar
+}
+
+func (c *existingFileCommand) Info() *cmd.Info {
+	return &cmd.Info{Name: "show"}
+}
+
+func (c *existingFileCommand) SetFlags(f *gnuflag.FlagSet) {
+	f.Var(&c.config, "config", "the config")
+}
+
+func (c *existingFileCommand) Run(ctx *cmd.Context) error {
+	data, err := c.config.Read(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = ctx.Stdout.Write(data)
+	return err
+}
+
+func (s *FileVarSuite) TestExistingFileVarRelativeToContextDir(c *gc.C) {
+	err := ioutil.WriteFile(s.ctx.AbsPath("content.yaml"), []byte("content"), 0644)
+	c.Assert(err, gc.IsNil)
+	for i, super := range []bool{false, true} {
+		c.Logf("test %d: super command %v", i, super)
+		var command cmd.Command = &existingFileCommand{}
+		args := []string{"--config", "content.yaml"}
+		if super {
+			jc := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "jujutest"})
+			jc.Register(command)
+			command, args = jc, append([]string{"show"}, args...)
+		}
+		ctx := cmdtesting.ContextForDir(c, s.ctx.Dir)
+		code := cmd.Main(command, ctx, args)
+		c.Check(code, gc.Equals, 0)
+		c.Check(cmdtesting.Stdout(ctx), gc.Equals, "content")
+
+		args[len(args)-1] = "missing.yaml"
+		ctx = cmdtesting.ContextForDir(c, s.ctx.Dir)
+		code = cmd.Main(command, ctx, args)
+		c.Check(code, gc.Equals, 2)
+		c.Check(cmdtesting.Stderr(ctx), gc.Matches, `(?s)error: invalid value "missing.yaml" for flag --config: no such file: missing.yaml\n.*`)
+	}
+}
+
 func fs() (*gnuflag.FlagSet, *cmd.FileVar) {
 	var config cmd.FileVar
 	fs := cmdtesting.NewFlagSet()
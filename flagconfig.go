@@ -0,0 +1,86 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	goyaml "gopkg.in/yaml.v2"
+	"launchpad.net/gnuflag"
+)
+
+// SetFlagsFromConfig reads the YAML file at path, which holds a map of flag
+// names to values, and sets each flag in f that was not already set on the
+// command line to the value for its name. A list value sets the flag once
+// for each element, for flags that accumulate values. It should be called
+// after f has been parsed, so that command line flags take precedence.
+func SetFlagsFromConfig(f *gnuflag.FlagSet, path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read flag config: %v", err)
+	}
+	var config map[string]interface{}
+	if err := goyaml.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("cannot parse flag config %q: %v", path, err)
+	}
+	set := make(map[string]bool)
+	f.Visit(func(flag *gnuflag.Flag) {
+		set[flag.Name] = true
+	})
+	// Flags that share a value, such as -v and --verbose, are set on the
+	// command line if any of them is.
+	values := make(map[gnuflag.Value]bool)
+	f.VisitAll(func(flag *gnuflag.Flag) {
+		if set[flag.Name] {
+			values[flag.Value] = true
+		}
+	})
+	var names []string
+	for name := range config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		flag := f.Lookup(name)
+		if flag == nil {
+			return fmt.Errorf("unknown flag %q in flag config %q", name, path)
+		}
+		if values[flag.Value] {
+			continue
+		}
+		if err := setFlagFromConfig(f, name, config[name]); err != nil {
+			return fmt.Errorf("invalid value for flag %q in flag config %q: %v", name, path, err)
+		}
+	}
+	return nil
+}
+
+// setFlagFromConfig sets the named flag to value, which was read from a
+// flag config file.
+func setFlagFromConfig(f *gnuflag.FlagSet, name string, value interface{}) error {
+	switch value := value.(type) {
+	case nil:
+		return fmt.Errorf("no value given")
+	case []interface{}:
+		for _, v := range value {
+			if err := setFlagFromConfig(f, name, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	case map[interface{}]interface{}:
+		return fmt.Errorf("expected a scalar or a list, got a map")
+	}
+	switch v := f.Lookup(name).Value.(type) {
+	case *inheritedValue:
+		v.setFromConfig(fmt.Sprint(value))
+		return nil
+	case *EnvDefault:
+		v.setFromConfig(fmt.Sprint(value))
+		return nil
+	}
+	return f.Set(name, fmt.Sprint(value))
+}
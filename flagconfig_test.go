@@ -0,0 +1,173 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	gitjujutesting "github.com/juju/testing"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/cmd"
+	"github.com/juju/cmd/cmdtesting"
+)
+
+type FlagConfigSuite struct {
+	gitjujutesting.IsolationSuite
+}
+
+var _ = gc.Suite(&FlagConfigSuite{})
+
+func (s *FlagConfigSuite) writeConfig(c *gc.C, content string) string {
+	path := filepath.Join(c.MkDir(), "flags.yaml")
+	err := ioutil.WriteFile(path, []byte(content), 0644)
+	c.Assert(err, gc.IsNil)
+	return path
+}
+
+type flagConfigValues struct {
+	name    string
+	count   int
+	verbose bool
+	tags    []string
+}
+
+// tagsValue is a gnuflag.Value that accumulates values.
+type tagsValue struct {
+	tags *[]string
+}
+
+func (v tagsValue) Set(s string) error {
+	*v.tags = append(*v.tags, s)
+	return nil
+}
+
+func (v tagsValue) String() string {
+	return ""
+}
+
+func (s *FlagConfigSuite) parse(c *gc.C, config string, args ...string) (*flagConfigValues, error) {
+	var values flagConfigValues
+	f := cmdtesting.NewFlagSet()
+	f.StringVar(&values.name, "name", "", "")
+	f.IntVar(&values.count, "count", 0, "")
+	f.BoolVar(&values.verbose, "v", false, "")
+	f.BoolVar(&values.verbose, "verbose", false, "")
+	f.Var(tagsValue{&values.tags}, "tag", "")
+	c.Assert(f.Parse(true, args), gc.IsNil)
+	return &values, cmd.SetFlagsFromConfig(f, s.writeConfig(c, config))
+}
+
+func (s *FlagConfigSuite) TestSetFlags(c *gc.C) {
+	values, err := s.parse(c, "name: foo\ncount: 3\nverbose: true\ntag: [a, b]\n")
+	c.Assert(err, gc.IsNil)
+	c.Assert(*values, gc.DeepEquals, flagConfigValues{
+		name:    "foo",
+		count:   3,
+		verbose: true,
+		tags:    []string{"a", "b"},
+	})
+}
+
+func (s *FlagConfigSuite) TestCommandLineTakesPrecedence(c *gc.C) {
+	values, err := s.parse(c, "name: foo\ncount: 3\nverbose: false\n", "--name", "bar", "-v")
+	c.Assert(err, gc.IsNil)
+	c.Assert(values.name, gc.Equals, "bar")
+	c.Assert(values.count, gc.Equals, 3)
+	c.Assert(values.verbose, gc.Equals, true)
+}
+
+func (s *FlagConfigSuite) TestUnknownKey(c *gc.C) {
+	_, err := s.parse(c, "name: foo\ncolour: red\n")
+	c.Assert(err, gc.ErrorMatches, `unknown flag "colour" in flag config ".*flags.yaml"`)
+}
+
+func (s *FlagConfigSuite) TestInvalidValue(c *gc.C) {
+	_, err := s.parse(c, "count: many\n")
+	c.Assert(err, gc.ErrorMatches, `invalid value for flag "count" in flag config ".*flags.yaml": .*`)
+	_, err = s.parse(c, "name: {a: b}\n")
+	c.Assert(err, gc.ErrorMatches, `invalid value for flag "name" in flag config ".*flags.yaml": expected a scalar or a list, got a map`)
+}
+
+func (s *FlagConfigSuite) TestInvalidYAML(c *gc.C) {
+	_, err := s.parse(c, "- name\n")
+	c.Assert(err, gc.ErrorMatches, `(?s)cannot parse flag config ".*flags.yaml": .*`)
+}
+
+func (s *FlagConfigSuite) TestMissingFile(c *gc.C) {
+	f := cmdtesting.NewFlagSet()
+	err := cmd.SetFlagsFromConfig(f, filepath.Join(c.MkDir(), "missing.yaml"))
+	c.Assert(err, gc.ErrorMatches, `cannot read flag config: .*`)
+}
+
+func (s *FlagConfigSuite) TestSuperCommandConfigFlag(c *gc.C) {
+	path := s.writeConfig(c, "option: from-config\n")
+	for _, test := range []struct {
+		args   []string
+		stdout string
+	}{{
+		args:   []string{"verb"},
+		stdout: "\n",
+	}, {
+		args:   []string{"verb", "--config", path},
+		stdout: "from-config\n",
+	}, {
+		args:   []string{"verb", "--config", path, "--option", "from-flag"},
+		stdout: "from-flag\n",
+	}} {
+		super := cmd.NewSuperCommand(cmd.SuperCommandParams{
+			Name:       "jujutest",
+			ConfigFlag: "config",
+		})
+		super.Register(&TestCommand{Name: "verb"})
+		ctx := cmdtesting.Context(c)
+		code := cmd.Main(super, ctx, test.args)
+		c.Check(code, gc.Equals, 0)
+		c.Check(cmdtesting.Stdout(ctx), gc.Equals, test.stdout)
+	}
+}
+
+func (s *FlagConfigSuite) TestSuperCommandConfigFlagRelative(c *gc.C) {
+	super := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name:       "jujutest",
+		ConfigFlag: "config",
+	})
+	super.Register(&TestCommand{Name: "verb"})
+	ctx := cmdtesting.Context(c)
+	err := ioutil.WriteFile(filepath.Join(ctx.Dir, "flags.yaml"), []byte("option: from-config\n"), 0644)
+	c.Assert(err, gc.IsNil)
+	code := cmd.Main(super, ctx, []string{"verb", "--config", "flags.yaml"})
+	c.Check(code, gc.Equals, 0)
+	c.Check(cmdtesting.Stdout(ctx), gc.Equals, "from-config\n")
+}
+
+func (s *FlagConfigSuite) TestSuperCommandConfigEnvDefault(c *gc.C) {
+	path := s.writeConfig(c, "model: from-config\n")
+	for i, test := range []struct {
+		args   []string
+		stdout string
+	}{{
+		args:   []string{"verb"},
+		stdout: "from-env from $TEST_MODEL environment variable\n",
+	}, {
+		args:   []string{"verb", "--config", path},
+		stdout: "from-config from model in flag config file\n",
+	}, {
+		args:   []string{"verb", "--config", path, "--model", "from-flag"},
+		stdout: "from-flag from --model flag\n",
+	}} {
+		c.Logf("test %d: %q", i, test.args)
+		super := cmd.NewSuperCommand(cmd.SuperCommandParams{
+			Name:       "jujutest",
+			ConfigFlag: "config",
+		})
+		super.Register(&envDefaultCommand{})
+		ctx := cmdtesting.Context(c)
+		ctx.Env = map[string]string{"TEST_MODEL": "from-env"}
+		code := cmd.Main(super, ctx, test.args)
+		c.Check(code, gc.Equals, 0)
+		c.Check(cmdtesting.Stdout(ctx), gc.Equals, test.stdout)
+	}
+}
@@ -6,6 +6,8 @@ package cmd
 import (
 	"bytes"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"sort"
 	"strings"
 
@@ -21,6 +23,14 @@ type helpCommand struct {
 
 	target      *commandReference
 	targetSuper *SuperCommand
+	format      string
+}
+
+// helpFormatters holds the formatters for the structured help output
+// selected with the help command's --format flag.
+var helpFormatters = map[string]FormatterFunc{
+	"json": FormatJson,
+	"yaml": FormatYaml,
 }
 
 func (c *helpCommand) init() {
@@ -68,8 +78,7 @@ command.
 
 	f := gnuflag.NewFlagSet("", gnuflag.ContinueOnError)
 	c.super.SetCommonFlags(f)
-	f.SetOutput(buf)
-	f.PrintDefaults()
+	printDefaults(f, buf)
 	return buf.String()
 }
 
@@ -104,7 +113,14 @@ See also: topics
 	}
 }
 
+func (c *helpCommand) SetFlags(f *gnuflag.FlagSet) {
+	f.StringVar(&c.format, "format", "", "show command help in a structured format (json|yaml)")
+}
+
 func (c *helpCommand) Init(args []string) error {
+	if _, ok := helpFormatters[c.format]; c.format != "" && !ok {
+		return fmt.Errorf("unknown help format %q, expected one of (json|yaml)", c.format)
+	}
 	if c.super.notifyHelp != nil {
 		c.super.notifyHelp(args)
 	}
@@ -121,7 +137,7 @@ func (c *helpCommand) Init(args []string) error {
 	// Before we start walking down the subcommand list, we want to check
 	// to see if the first part is there.
 	if _, ok := c.super.subcmds[args[0]]; !ok {
-		if c.super.missingCallback == nil && len(args) > 1 {
+		if c.super.missingCallback == nil && c.super.pluginPrefix == "" && len(args) > 1 {
 			return fmt.Errorf("extra arguments to command help: %q", args[1:])
 		}
 		logger.Tracef("help not found, setting topic")
@@ -141,6 +157,7 @@ func (c *helpCommand) Init(args []string) error {
 		// error out.
 		logger.Tracef("target name: %s", c.target.name)
 		if super, ok := c.target.command.(*SuperCommand); ok {
+			c.targetSuper.adopt(super)
 			c.targetSuper = super
 		} else if len(args) > 0 {
 			return fmt.Errorf("extra arguments to command help: %q", args)
@@ -149,26 +166,133 @@ func (c *helpCommand) Init(args []string) error {
 	return nil
 }
 
-func (c *helpCommand) getCommandHelp(super *SuperCommand, command Command, alias string) []byte {
-	info := command.Info()
+func (c *helpCommand) getCommandHelp(super *SuperCommand, command Command, alias string, width int) []byte {
+	info, f := c.getCommandInfo(super, command, alias)
+	help := info.help(f, width)
+	if command == super || command.IsSuperCommand() {
+		return help
+	}
+	return append(help, super.globalFlagsHelp(width)...)
+}
+
+// globalFlagsHelp returns the documentation of the global flags of c,
+// which are accepted by all of its subcommands, or nothing if there are
+// none.
+func (c *SuperCommand) globalFlagsHelp(width int) []byte {
+	if c.globalflags == nil {
+		return nil
+	}
+	hasFlags := false
+	c.globalflags.VisitAll(func(*gnuflag.Flag) { hasFlags = true })
+	if !hasFlags {
+		return nil
+	}
+	var options bytes.Buffer
+	printDefaults(c.globalflags, &options)
+	c.globalflags.SetOutput(ioutil.Discard)
+	return []byte("\nGlobal options:\n" + wrapIndented(options.String(), "    ", width))
+}
+
+// getCommandInfo returns the Info and flags of the command as they are
+// shown in its help: the name is qualified with the names of its super
+// commands and the aliases include those registered with super.
+func (c *helpCommand) getCommandInfo(super *SuperCommand, command Command, alias string) (*Info, *gnuflag.FlagSet) {
+	info := *command.Info()
 
 	if command != super {
 		logger.Tracef("command not super")
+		// Show the aliases registered with the super command, which
+		// include those from the command's own Info.
+		name := info.Name
+		if alias != "" {
+			name = alias
+		}
+		if _, found := super.subcmds[name]; found {
+			info.Aliases = super.aliasesFor(name)
+		}
 		// If the alias is to a subcommand of another super command
 		// the alias string holds the "super sub" name.
 		if alias == "" {
-			info.Name = fmt.Sprintf("%s %s", super.Name, info.Name)
+			info.Name = fmt.Sprintf("%s %s", super.name(), info.Name)
 		} else {
-			info.Name = fmt.Sprintf("%s %s", super.Name, alias)
+			info.Name = fmt.Sprintf("%s %s", super.name(), alias)
 		}
 	}
-	if super.usagePrefix != "" {
+	if prefix := super.namePrefix(); prefix != "" {
 		logger.Tracef("adding super prefix")
-		info.Name = fmt.Sprintf("%s %s", super.usagePrefix, info.Name)
+		info.Name = fmt.Sprintf("%s %s", prefix, info.Name)
 	}
 	f := gnuflag.NewFlagSet(info.Name, gnuflag.ContinueOnError)
 	command.SetFlags(f)
-	return info.Help(f)
+	return &info, f
+}
+
+// commandHelp is the structured form of a command's help.
+type commandHelp struct {
+	Name      string         `json:"name" yaml:"name"`
+	Args      string         `json:"args,omitempty" yaml:"args,omitempty"`
+	Purpose   string         `json:"purpose,omitempty" yaml:"purpose,omitempty"`
+	Doc       string         `json:"doc,omitempty" yaml:"doc,omitempty"`
+	Aliases   []string       `json:"aliases,omitempty" yaml:"aliases,omitempty"`
+	Flags     []flagHelp     `json:"flags,omitempty" yaml:"flags,omitempty"`
+	Examples  []Example      `json:"examples,omitempty" yaml:"examples,omitempty"`
+	ExitCodes []exitCodeHelp `json:"exit-codes,omitempty" yaml:"exit-codes,omitempty"`
+}
+
+// exitCodeHelp describes one of the exit codes in a commandHelp.
+type exitCodeHelp struct {
+	Code    int    `json:"code" yaml:"code"`
+	Meaning string `json:"meaning" yaml:"meaning"`
+}
+
+// flagHelp describes a flag in a commandHelp. Flags that share a value,
+// such as -h and --help, are described together.
+type flagHelp struct {
+	Names   []string `json:"names" yaml:"names"`
+	Default string   `json:"default,omitempty" yaml:"default,omitempty"`
+	Usage   string   `json:"usage,omitempty" yaml:"usage,omitempty"`
+}
+
+// writeFormattedHelp writes the help for the command in the format chosen
+// with the --format flag.
+func (c *helpCommand) writeFormattedHelp(ctx *Context, super *SuperCommand, command Command, alias string) error {
+	info, f := c.getCommandInfo(super, command, alias)
+	help := commandHelp{
+		Name:     info.Name,
+		Args:     info.Args,
+		Purpose:  strings.TrimSpace(info.Purpose),
+		Doc:      strings.TrimSpace(info.Doc),
+		Aliases:  info.Aliases,
+		Examples: info.Examples,
+	}
+	for _, code := range info.exitCodes() {
+		help.ExitCodes = append(help.ExitCodes, exitCodeHelp{
+			Code:    code,
+			Meaning: strings.TrimSpace(info.ExitCodes[code]),
+		})
+	}
+	byValue := make(map[gnuflag.Value]int)
+	f.VisitAll(func(flag *gnuflag.Flag) {
+		if i, ok := byValue[flag.Value]; ok {
+			help.Flags[i].Names = append(help.Flags[i].Names, flag.Name)
+			if help.Flags[i].Usage == "" {
+				help.Flags[i].Usage = flag.Usage
+			}
+			return
+		}
+		byValue[flag.Value] = len(help.Flags)
+		help.Flags = append(help.Flags, flagHelp{
+			Names:   []string{flag.Name},
+			Default: flag.DefValue,
+			Usage:   flag.Usage,
+		})
+	})
+	data, err := helpFormatters[c.format](help)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(ctx.Stdout, "%s\n", data)
+	return nil
 }
 
 func (c *helpCommand) Run(ctx *Context) error {
@@ -181,7 +305,10 @@ func (c *helpCommand) Run(ctx *Context) error {
 
 	// If the topic is a registered subcommand, then run the help command with it
 	if c.target != nil {
-		ctx.Stdout.Write(c.getCommandHelp(c.targetSuper, c.target.command, c.target.alias))
+		if c.format != "" {
+			return c.writeFormattedHelp(ctx, c.targetSuper, c.target.command, c.target.alias)
+		}
+		ctx.writePaged(c.getCommandHelp(c.targetSuper, c.target.command, c.target.alias, ctx.TerminalWidth()))
 		return nil
 	}
 
@@ -191,16 +318,31 @@ func (c *helpCommand) Run(ctx *Context) error {
 		// current action, but we want the info to be printed
 		// as if there was nothing selected.
 		c.super.action.command = nil
-		ctx.Stdout.Write(c.getCommandHelp(c.super, c.super, ""))
+		if c.format != "" {
+			return c.writeFormattedHelp(ctx, c.super, c.super, "")
+		}
+		ctx.writePaged(c.getCommandHelp(c.super, c.super, "", ctx.TerminalWidth()))
 		return nil
 	}
+	if c.format != "" {
+		return fmt.Errorf("--format is only supported for help on commands")
+	}
 
 	// Look to see if the topic is a registered topic.
 	topic, ok := c.topics[c.topic]
 	if ok {
-		fmt.Fprintf(ctx.Stdout, "%s\n", strings.TrimSpace(topic.long()))
+		ctx.writePaged([]byte(strings.TrimSpace(topic.long()) + "\n"))
 		return nil
 	}
+	// If the topic is a plugin, run that with --help.
+	if path, ok := findPlugin(c.super.pluginPrefix, c.topic); ok {
+		command := &pluginCommand{
+			name: c.topic,
+			path: path,
+			args: append([]string{"--help"}, c.topicArgs...),
+		}
+		return command.Run(ctx)
+	}
 	// If we have a missing callback, call that with --help
 	if c.super.missingCallback != nil {
 		helpArgs := []string{"--help"}
@@ -209,7 +351,7 @@ func (c *helpCommand) Run(ctx *Context) error {
 		}
 		command := &missingCommand{
 			callback:  c.super.missingCallback,
-			superName: c.super.Name,
+			superName: c.super.name(),
 			name:      c.topic,
 			args:      helpArgs,
 		}
@@ -221,3 +363,33 @@ func (c *helpCommand) Run(ctx *Context) error {
 	}
 	return fmt.Errorf("unknown command or topic for %s", c.topic)
 }
+
+// writeAllHelp writes the help for c and, recursively, for each of its
+// subcommands to w. The help for each command is preceded by a line
+// holding its fully qualified name, for which the name of c is given.
+// Aliases are omitted, as are hidden and deprecated commands unless
+// includeHidden is true. The help is wrapped to width columns.
+func (c *SuperCommand) writeAllHelp(w io.Writer, name string, includeHidden bool, width int) {
+	fmt.Fprintf(w, "=== %s ===\n", name)
+	w.Write(c.help.getCommandHelp(c, c, "", width))
+	var names []string
+	for subName := range c.subcmds {
+		names = append(names, subName)
+	}
+	sort.Strings(names)
+	for _, subName := range names {
+		action := c.subcmds[subName]
+		if action.alias != "" || !(action.listed() || includeHidden) {
+			continue
+		}
+		fullName := name + " " + subName
+		if super, ok := action.command.(*SuperCommand); ok {
+			c.adopt(super)
+			fmt.Fprintf(w, "\n")
+			super.writeAllHelp(w, fullName, includeHidden, width)
+			continue
+		}
+		fmt.Fprintf(w, "\n=== %s ===\n", fullName)
+		w.Write(c.help.getCommandHelp(c, action.command, "", width))
+	}
+}
@@ -10,6 +10,7 @@ import (
 	gitjujutesting "github.com/juju/testing"
 	jc "github.com/juju/testing/checkers"
 	gc "gopkg.in/check.v1"
+	"launchpad.net/gnuflag"
 
 	"github.com/juju/cmd"
 	"github.com/juju/cmd/cmdtesting"
@@ -177,3 +178,299 @@ func (s *HelpCommandSuite) TestNotifyHelp(c *gc.C) {
 
 	c.Assert(called, jc.DeepEquals, [][]string{{"blah"}})
 }
+
+func (s *HelpCommandSuite) TestRegisteredAliases(c *gc.C) {
+	newSuper := func() *cmd.SuperCommand {
+		super := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "super"})
+		super.Register(&TestCommand{Name: "blah", Aliases: []string{"alias"}})
+		super.RegisterAlias("other", "blah", nil)
+		super.RegisterAlias("legacy", "blah", deprecate{replacement: "blah"})
+		return super
+	}
+	for _, name := range []string{"blah", "alias", "other", "legacy"} {
+		c.Logf("help for %q", name)
+		ctx, err := cmdtesting.RunCommand(c, newSuper(), "help", name)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Assert(cmdtesting.Stdout(ctx), jc.HasSuffix, "\nAliases: alias, other\n")
+	}
+
+	ctx, err := cmdtesting.RunCommand(c, newSuper(), "help", "commands")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(ctx), gc.Equals, ""+
+		"blah (alias, other)  blah the juju\n"+
+		"help                 show help on a command or other topic\n")
+}
+
+func (s *HelpCommandSuite) newHelpAllSuper() *cmd.SuperCommand {
+	super := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name: "jujutest",
+	})
+	super.Register(&TestCommand{Name: "blah", Aliases: []string{"bl"}})
+	super.RegisterHidden(&TestCommand{Name: "secret"})
+	storage := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name:        "storage",
+		UsagePrefix: "jujutest",
+		Purpose:     "manage storage",
+	})
+	storage.Register(&TestCommand{Name: "add"})
+	super.Register(storage)
+	return super
+}
+
+func (s *HelpCommandSuite) helpAllHeadings(c *gc.C, args ...string) []string {
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(s.newHelpAllSuper(), ctx, args)
+	c.Assert(code, gc.Equals, 0)
+	var headings []string
+	for _, line := range strings.Split(cmdtesting.Stdout(ctx), "\n") {
+		if strings.HasPrefix(line, "=== ") {
+			headings = append(headings, line)
+		}
+	}
+	return headings
+}
+
+func (s *HelpCommandSuite) TestHelpAll(c *gc.C) {
+	c.Assert(s.helpAllHeadings(c, "--help-all"), jc.DeepEquals, []string{
+		"=== jujutest ===",
+		"=== jujutest blah ===",
+		"=== jujutest help ===",
+		"=== jujutest storage ===",
+		"=== jujutest storage add ===",
+		"=== jujutest storage help ===",
+	})
+}
+
+func (s *HelpCommandSuite) TestHelpAllIncludeHidden(c *gc.C) {
+	c.Assert(s.helpAllHeadings(c, "--help-all", "--include-hidden"), jc.DeepEquals, []string{
+		"=== jujutest ===",
+		"=== jujutest bash-completion ===",
+		"=== jujutest blah ===",
+		"=== jujutest help ===",
+		"=== jujutest secret ===",
+		"=== jujutest storage ===",
+		"=== jujutest storage add ===",
+		"=== jujutest storage bash-completion ===",
+		"=== jujutest storage help ===",
+		"=== jujutest storage zsh-completion ===",
+		"=== jujutest zsh-completion ===",
+	})
+}
+
+func (s *HelpCommandSuite) TestHelpAllCommandHelp(c *gc.C) {
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(s.newHelpAllSuper(), ctx, []string{"--help-all"})
+	c.Assert(code, gc.Equals, 0)
+	c.Assert(cmdtesting.Stdout(ctx), jc.Contains, `
+=== jujutest storage add ===
+Usage: jujutest storage add [options] <something>
+
+Summary:
+add the juju
+
+Options:
+--option (= "")
+    option-doc
+
+Details:
+add-doc
+`)
+}
+
+// newNestedHelpSuper returns a SuperCommand with a global flag and a
+// nested SuperCommand that has no UsagePrefix of its own.
+func newNestedHelpSuper() *cmd.SuperCommand {
+	var model string
+	super := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name: "jujutest",
+		GlobalFlags: func(f *gnuflag.FlagSet) {
+			f.StringVar(&model, "model", "", "the model")
+		},
+	})
+	storage := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name:    "storage",
+		Purpose: "manage storage",
+	})
+	storage.Register(&TestCommand{Name: "add"})
+	super.Register(storage)
+	return super
+}
+
+func (s *HelpCommandSuite) TestHelpAllNestedSuper(c *gc.C) {
+	// The help in the dump is the same as that shown by the help
+	// command, with the global flags inherited by the nested
+	// SuperCommand.
+	var help []string
+	for _, args := range [][]string{{"help", "storage"}, {"help", "storage", "add"}} {
+		ctx := cmdtesting.Context(c)
+		code := cmd.Main(newNestedHelpSuper(), ctx, args)
+		c.Assert(code, gc.Equals, 0)
+		help = append(help, cmdtesting.Stdout(ctx))
+	}
+	c.Assert(help[0], jc.Contains, "--model")
+
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(newNestedHelpSuper(), ctx, []string{"--help-all"})
+	c.Assert(code, gc.Equals, 0)
+	c.Assert(cmdtesting.Stdout(ctx), jc.Contains, "\n=== jujutest storage ===\n"+help[0])
+	c.Assert(cmdtesting.Stdout(ctx), jc.Contains, "\n=== jujutest storage add ===\n"+help[1])
+}
+
+func (s *HelpCommandSuite) TestHelpAllExtraArgs(c *gc.C) {
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(s.newHelpAllSuper(), ctx, []string{"--help-all", "blah"})
+	c.Assert(code, gc.Equals, 2)
+	c.Assert(cmdtesting.Stderr(ctx), gc.Equals, "error: unrecognized args: [\"blah\"]; usage: jujutest [options] <command> ...\n")
+}
+
+func (s *HelpCommandSuite) TestHelpFormatJSON(c *gc.C) {
+	super := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name: "jujutest",
+	})
+	super.Register(&TestCommand{Name: "blah", Aliases: []string{"bl"}})
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(super, ctx, []string{"help", "--format", "json", "blah"})
+	c.Assert(code, gc.Equals, 0)
+	c.Assert(cmdtesting.Stdout(ctx), gc.Equals, `{"name":"jujutest blah","args":"<something>","purpose":"blah the juju","doc":"blah-doc","aliases":["bl"],"flags":[{"names":["option"],"usage":"option-doc"}]}`+"\n")
+}
+
+func (s *HelpCommandSuite) TestHelpFormatYAML(c *gc.C) {
+	super := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name: "jujutest",
+	})
+	super.Register(&TestCommand{Name: "blah"})
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(super, ctx, []string{"help", "--format=yaml", "blah"})
+	c.Assert(code, gc.Equals, 0)
+	c.Assert(cmdtesting.Stdout(ctx), gc.Equals, `
+name: jujutest blah
+args: <something>
+purpose: blah the juju
+doc: blah-doc
+flags:
+- names:
+  - option
+  usage: option-doc
+`[1:])
+}
+
+// examplesCommand is a TestCommand with examples in its Info.
+type examplesCommand struct {
+	TestCommand
+}
+
+func (c *examplesCommand) Info() *cmd.Info {
+	info := c.TestCommand.Info()
+	info.Examples = []cmd.Example{{
+		Description: "Blah the juju:",
+		Command:     "jujutest blah",
+	}, {
+		Command: "jujutest blah --option error",
+	}}
+	return info
+}
+
+func (s *HelpCommandSuite) TestHelpExamples(c *gc.C) {
+	super := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name: "jujutest",
+	})
+	super.Register(&examplesCommand{TestCommand{Name: "blah"}})
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(super, ctx, []string{"help", "blah"})
+	c.Assert(code, gc.Equals, 0)
+	c.Assert(cmdtesting.Stdout(ctx), jc.HasSuffix, `
+Details:
+blah-doc
+
+Examples:
+    Blah the juju:
+        jujutest blah
+
+        jujutest blah --option error
+`)
+}
+
+func (s *HelpCommandSuite) TestHelpFormatExamples(c *gc.C) {
+	super := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name: "jujutest",
+	})
+	super.Register(&examplesCommand{TestCommand{Name: "blah"}})
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(super, ctx, []string{"help", "--format", "json", "blah"})
+	c.Assert(code, gc.Equals, 0)
+	c.Assert(cmdtesting.Stdout(ctx), jc.Contains, `"examples":[{"description":"Blah the juju:","command":"jujutest blah"},{"command":"jujutest blah --option error"}]`)
+}
+
+// exitCodesCommand is a command that documents its exit codes.
+type exitCodesCommand struct {
+	TestCommand
+}
+
+func (c *exitCodesCommand) Info() *cmd.Info {
+	info := c.TestCommand.Info()
+	info.ExitCodes = map[int]string{
+		cmd.ExitFailure: "the juju could not be blahed",
+		cmd.ExitSuccess: "the juju was blahed",
+	}
+	return info
+}
+
+func (s *HelpCommandSuite) TestHelpExitCodes(c *gc.C) {
+	super := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name: "jujutest",
+	})
+	super.Register(&exitCodesCommand{TestCommand{Name: "blah"}})
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(super, ctx, []string{"help", "blah"})
+	c.Assert(code, gc.Equals, 0)
+	c.Assert(cmdtesting.Stdout(ctx), jc.HasSuffix, `
+Details:
+blah-doc
+
+Exit status:
+    0  the juju was blahed
+    1  the juju could not be blahed
+`)
+
+	ctx = cmdtesting.Context(c)
+	code = cmd.Main(super, ctx, []string{"help", "--format", "json", "blah"})
+	c.Assert(code, gc.Equals, 0)
+	c.Assert(cmdtesting.Stdout(ctx), jc.Contains, `"exit-codes":[{"code":0,"meaning":"the juju was blahed"},{"code":1,"meaning":"the juju could not be blahed"}]`)
+}
+
+func (s *HelpCommandSuite) TestHelpFormatSharedFlags(c *gc.C) {
+	super := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name:    "jujutest",
+		Purpose: "to be tested",
+	})
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(super, ctx, []string{"help", "--format", "yaml"})
+	c.Assert(code, gc.Equals, 0)
+	c.Assert(cmdtesting.Stdout(ctx), jc.Contains, `
+- names:
+  - h
+  - help
+  default: "false"
+  usage: show help on a command or other topic
+`)
+}
+
+func (s *HelpCommandSuite) TestHelpFormatUnknown(c *gc.C) {
+	super := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name: "jujutest",
+	})
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(super, ctx, []string{"help", "--format", "xml", "help"})
+	c.Assert(code, gc.Equals, 2)
+	c.Assert(cmdtesting.Stderr(ctx), gc.Equals, "error: unknown help format \"xml\", expected one of (json|yaml)\n")
+}
+
+func (s *HelpCommandSuite) TestHelpFormatTopic(c *gc.C) {
+	super := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name: "jujutest",
+	})
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(super, ctx, []string{"help", "--format", "json", "topics"})
+	c.Assert(code, gc.Equals, 1)
+	c.Assert(c.GetTestLog(), jc.Contains, "--format is only supported for help on commands")
+}
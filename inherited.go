@@ -0,0 +1,140 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"fmt"
+
+	"launchpad.net/gnuflag"
+)
+
+// InheritedValue describes a value, such as the name of the environment
+// to work in, that a SuperCommand created with it resolves once on behalf
+// of all the commands below it, including the subcommands of nested
+// SuperCommands. The value is given to each of those commands that
+// implements ValueInheritor and names it, so that "mytool --environment
+// foo deploy bar", "mytool deploy --environment foo bar" and "mytool
+// deploy bar" with the environment variable set all work without the
+// deploy command reading any of them itself.
+//
+// The value is taken from the first of these that sets it:
+//
+//   - the global flag of the same name, given on the command line;
+//   - the file named with the ConfigFlag of the SuperCommand, if any,
+//     under the key of the same name (see SetFlagsFromConfig);
+//   - the EnvKey environment variable, if it is set and not empty, in
+//     the Env of the Context that Main runs the command in, or in the
+//     environment of the process if Env is nil;
+//   - Default.
+type InheritedValue struct {
+	// Name is the name of the value, and of the global flag that sets
+	// it.
+	Name string
+
+	// EnvKey, if set, is the name of the environment variable that the
+	// value is read from when it is not given in any other way.
+	EnvKey string
+
+	// Default is the value used when it is not given in any other way.
+	Default string
+
+	// Usage is the usage text of the flag, which is annotated with the
+	// name of the environment variable, if any.
+	Usage string
+}
+
+// ValueInheritor may be implemented by a Command registered, directly or
+// through nested SuperCommands, with a SuperCommand created with
+// InheritedValues. InheritedValues returns the names of the values that
+// the command wants, and SetInheritedValue is called with each of them,
+// and where it came from, once the command line has been parsed and before
+// the command's Init is called, so that Init may check it. A command
+// should not define flags of its own with the same names as the values.
+type ValueInheritor interface {
+	InheritedValues() []string
+	SetInheritedValue(name, value string, source ValueSource) error
+}
+
+// inheritedValue implements gnuflag.Value for the flag of an
+// InheritedValue, and holds the value once it has been resolved.
+type inheritedValue struct {
+	InheritedValue
+	value  string
+	source ValueSource
+}
+
+var _ gnuflag.Value = (*inheritedValue)(nil)
+
+// Implements gnuflag.Value Set.
+func (v *inheritedValue) Set(s string) error {
+	v.value = s
+	v.source = SourceFlag
+	return nil
+}
+
+// Implements gnuflag.Value String.
+func (v *inheritedValue) String() string {
+	if v.source == SourceFallback {
+		return v.Default
+	}
+	return v.value
+}
+
+// setFromConfig sets the value as read from a flag config file, unless
+// it was given on the command line.
+func (v *inheritedValue) setFromConfig(s string) {
+	if v.source == SourceFlag {
+		return
+	}
+	v.value = s
+	v.source = SourceConfig
+}
+
+// resolve returns the value and where it came from, reading it from the
+// environment of ctx, as described by Context.lookupEnv, if it was not
+// given on the command line or in a config file.
+func (v *inheritedValue) resolve(ctx *Context) (string, ValueSource) {
+	if v.source == SourceFallback && v.EnvKey != "" {
+		if value := ctx.getenv(v.EnvKey); value != "" {
+			v.value = value
+			v.source = SourceEnv
+		}
+	}
+	return v.String(), v.source
+}
+
+// addFlag adds the flag that sets the value to f.
+func (v *inheritedValue) addFlag(f *gnuflag.FlagSet) {
+	usage := v.Usage
+	if v.EnvKey != "" {
+		usage = EnvUsage(usage, v.EnvKey)
+	}
+	f.Var(v, v.Name, usage)
+}
+
+// setInheritedValues gives command each of the values it wants from
+// values, which are resolved in ctx if they have not already been.
+func setInheritedValues(ctx *Context, command Command, values []*inheritedValue) error {
+	inheritor, ok := command.(ValueInheritor)
+	if !ok {
+		return nil
+	}
+	for _, name := range inheritor.InheritedValues() {
+		var found *inheritedValue
+		for _, v := range values {
+			if v.Name == name {
+				found = v
+				break
+			}
+		}
+		if found == nil {
+			return fmt.Errorf("command wants inherited value %q, which is not provided", name)
+		}
+		value, source := found.resolve(ctx)
+		if err := inheritor.SetInheritedValue(name, value, source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd_test
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	gitjujutesting "github.com/juju/testing"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/cmd"
+	"github.com/juju/cmd/cmdtesting"
+)
+
+type InheritedValueSuite struct {
+	gitjujutesting.IsolationSuite
+}
+
+var _ = gc.Suite(&InheritedValueSuite{})
+
+// deployCommand prints the environment it was given by the SuperCommand.
+type deployCommand struct {
+	cmd.CommandBase
+	environment string
+	source      cmd.ValueSource
+	initValue   string
+	reject      bool
+}
+
+func (c *deployCommand) Info() *cmd.Info {
+	return &cmd.Info{Name: "deploy", Args: "<charm>", Purpose: "deploy a charm"}
+}
+
+func (c *deployCommand) InheritedValues() []string {
+	return []string{"environment"}
+}
+
+func (c *deployCommand) SetInheritedValue(name, value string, source cmd.ValueSource) error {
+	if c.reject {
+		return errors.New("no environment allowed")
+	}
+	c.environment, c.source = value, source
+	return nil
+}
+
+func (c *deployCommand) Init(args []string) error {
+	c.initValue = c.environment
+	return nil
+}
+
+func (c *deployCommand) Run(ctx *cmd.Context) error {
+	fmt.Fprintf(ctx.Stdout, "%s %d\n", c.environment, c.source)
+	return nil
+}
+
+var environmentValue = cmd.InheritedValue{
+	Name:    "environment",
+	EnvKey:  "TEST_ENVIRONMENT",
+	Default: "default-env",
+	Usage:   "the environment to work in",
+}
+
+func newInheritedValueCommand(deploy cmd.Command) *cmd.SuperCommand {
+	super := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name:            "mytool",
+		ConfigFlag:      "config",
+		InheritedValues: []cmd.InheritedValue{environmentValue},
+	})
+	super.Register(deploy)
+	return super
+}
+
+func (s *InheritedValueSuite) writeConfig(c *gc.C, content string) string {
+	path := filepath.Join(c.MkDir(), "flags.yaml")
+	err := ioutil.WriteFile(path, []byte(content), 0644)
+	c.Assert(err, gc.IsNil)
+	return path
+}
+
+func (s *InheritedValueSuite) TestPrecedence(c *gc.C) {
+	config := s.writeConfig(c, "environment: from-config\n")
+	for i, test := range []struct {
+		message string
+		env     string
+		args    []string
+		value   string
+		source  cmd.ValueSource
+	}{{
+		message: "default",
+		args:    []string{"deploy", "bar"},
+		value:   "default-env",
+		source:  cmd.SourceFallback,
+	}, {
+		message: "environment variable",
+		env:     "from-env",
+		args:    []string{"deploy", "bar"},
+		value:   "from-env",
+		source:  cmd.SourceEnv,
+	}, {
+		message: "config file overrides environment variable",
+		env:     "from-env",
+		args:    []string{"--config", config, "deploy", "bar"},
+		value:   "from-config",
+		source:  cmd.SourceConfig,
+	}, {
+		message: "flag before subcommand overrides everything",
+		env:     "from-env",
+		args:    []string{"--config", config, "--environment", "from-flag", "deploy", "bar"},
+		value:   "from-flag",
+		source:  cmd.SourceFlag,
+	}, {
+		message: "flag after subcommand overrides everything",
+		env:     "from-env",
+		args:    []string{"deploy", "--environment", "from-flag", "--config", config, "bar"},
+		value:   "from-flag",
+		source:  cmd.SourceFlag,
+	}} {
+		c.Logf("%d: %s", i, test.message)
+		deploy := &deployCommand{}
+		ctx := cmdtesting.Context(c)
+		ctx.Env = map[string]string{"TEST_ENVIRONMENT": test.env}
+		code := cmd.Main(newInheritedValueCommand(deploy), ctx, test.args)
+		c.Check(code, gc.Equals, 0)
+		c.Check(cmdtesting.Stderr(ctx), gc.Equals, "")
+		c.Check(cmdtesting.Stdout(ctx), gc.Equals, fmt.Sprintf("%s %d\n", test.value, test.source))
+		// The value is given to the command before Init.
+		c.Check(deploy.initValue, gc.Equals, test.value)
+	}
+}
+
+func (s *InheritedValueSuite) TestProcessEnvironment(c *gc.C) {
+	s.PatchEnvironment("TEST_ENVIRONMENT", "from-process")
+	for i, test := range []struct {
+		env   map[string]string
+		value string
+	}{
+		{nil, "from-process"},
+		{map[string]string{}, "default-env"},
+		{map[string]string{"TEST_ENVIRONMENT": "from-env"}, "from-env"},
+	} {
+		c.Logf("test %d: %v", i, test.env)
+		ctx := cmdtesting.Context(c)
+		ctx.Env = test.env
+		code := cmd.Main(newInheritedValueCommand(&deployCommand{}), ctx, []string{"deploy", "bar"})
+		c.Check(code, gc.Equals, 0)
+		c.Check(cmdtesting.Stdout(ctx), gc.Matches, test.value+" .*\n")
+	}
+}
+
+func (s *InheritedValueSuite) TestNestedSuperCommand(c *gc.C) {
+	for i, args := range [][]string{
+		{"--environment", "foo", "charms", "deploy", "bar"},
+		{"charms", "--environment", "foo", "deploy", "bar"},
+		{"charms", "deploy", "--environment", "foo", "bar"},
+	} {
+		c.Logf("%d: %q", i, args)
+		nested := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "charms"})
+		nested.Register(&deployCommand{})
+		super := newInheritedValueCommand(nested)
+		ctx := cmdtesting.Context(c)
+		ctx.Env = map[string]string{"TEST_ENVIRONMENT": "from-env"}
+		code := cmd.Main(super, ctx, args)
+		c.Check(code, gc.Equals, 0)
+		c.Check(cmdtesting.Stdout(ctx), gc.Equals, fmt.Sprintf("foo %d\n", cmd.SourceFlag))
+	}
+}
+
+func (s *InheritedValueSuite) TestCommandWithoutInterest(c *gc.C) {
+	super := newInheritedValueCommand(&TestCommand{Name: "verb"})
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(super, ctx, []string{"verb", "--environment", "foo"})
+	c.Check(code, gc.Equals, 0)
+	c.Check(cmdtesting.Stdout(ctx), gc.Equals, "\n")
+}
+
+func (s *InheritedValueSuite) TestValueNotProvided(c *gc.C) {
+	super := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "mytool"})
+	super.Register(&deployCommand{})
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(super, ctx, []string{"deploy", "bar"})
+	c.Check(code, gc.Equals, 2)
+	c.Check(cmdtesting.Stderr(ctx), gc.Equals, `error: command wants inherited value "environment", which is not provided`+"\n")
+}
+
+func (s *InheritedValueSuite) TestSetInheritedValueError(c *gc.C) {
+	super := newInheritedValueCommand(&deployCommand{reject: true})
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(super, ctx, []string{"deploy", "bar"})
+	c.Check(code, gc.Equals, 2)
+	c.Check(cmdtesting.Stderr(ctx), gc.Equals, "error: no environment allowed\n")
+}
+
+func (s *InheritedValueSuite) TestHelp(c *gc.C) {
+	super := newInheritedValueCommand(&deployCommand{})
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(super, ctx, []string{"deploy", "--help"})
+	c.Check(code, gc.Equals, 0)
+	c.Check(cmdtesting.Stdout(ctx), gc.Matches, `(?s).*--environment \(= default-env\)
+    the environment to work in \(defaults to \$TEST_ENVIRONMENT if set\)
+.*`)
+}
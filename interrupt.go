@@ -0,0 +1,122 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// SignalHandler may be implemented by a Command that handles SIGINT and
+// SIGTERM itself. When HandlesSignals returns true, Main does not catch
+// those signals while the command runs, and the command's context is
+// never cancelled.
+type SignalHandler interface {
+	HandlesSignals() bool
+}
+
+// handlesSignals reports whether c handles SIGINT and SIGTERM itself.
+func handlesSignals(c Command) bool {
+	h, ok := c.(SignalHandler)
+	return ok && h.HandlesSignals()
+}
+
+// interruptGracePeriod is how long Main waits for a command to finish
+// after cancelling its context because of a signal, before exiting the
+// process anyway. A second signal exits the process immediately.
+var interruptGracePeriod = 5 * time.Second
+
+// exit is used to exit the process when a command outlives the
+// interruptGracePeriod.
+var exit = os.Exit
+
+// cancelOnInterrupt arranges for the context returned by ctx.Context to be
+// cancelled when the process receives SIGINT or SIGTERM. The returned stop
+// function must be called once the command has finished; it returns the
+// signal that cancelled the context, or nil if there was none.
+func (ctx *Context) cancelOnInterrupt() (stop func() os.Signal) {
+	original := ctx.ctx
+	runCtx, cancel := context.WithCancel(ctx.Context())
+	ctx.ctx = runCtx
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	var received os.Signal
+	go func() {
+		defer close(finished)
+		select {
+		case received = <-signals:
+		case <-done:
+			return
+		}
+		cancel()
+		select {
+		case sig := <-signals:
+			exit(signalExitCode(sig))
+		case <-time.After(interruptGracePeriod):
+			exit(signalExitCode(received))
+		case <-done:
+		}
+	}()
+	return func() os.Signal {
+		signal.Stop(signals)
+		close(done)
+		<-finished
+		cancel()
+		ctx.ctx = original
+		return received
+	}
+}
+
+// cancelAfter arranges for the context returned by ctx.Context to be
+// cancelled once timeout has passed. If the command has not finished
+// within interruptGracePeriod after that, the process exits with
+// ExitTimeout. The returned stop function must be called once the command
+// has finished; it reports whether the timeout expired.
+func (ctx *Context) cancelAfter(timeout time.Duration) (stop func() bool) {
+	original := ctx.ctx
+	runCtx, cancel := context.WithTimeout(ctx.Context(), timeout)
+	ctx.ctx = runCtx
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		select {
+		case <-runCtx.Done():
+		case <-done:
+			return
+		}
+		if runCtx.Err() != context.DeadlineExceeded {
+			// The context was cancelled for some other reason, such
+			// as a signal, which is handled elsewhere.
+			return
+		}
+		select {
+		case <-time.After(interruptGracePeriod):
+			exit(ExitTimeout)
+		case <-done:
+		}
+	}()
+	return func() bool {
+		close(done)
+		<-finished
+		timedOut := runCtx.Err() == context.DeadlineExceeded
+		cancel()
+		ctx.ctx = original
+		return timedOut
+	}
+}
+
+// signalExitCode returns the conventional exit code for a process
+// terminated by sig, which is ExitSignal plus the signal number.
+func signalExitCode(sig os.Signal) int {
+	if s, ok := sig.(syscall.Signal); ok {
+		return ExitSignal + int(s)
+	}
+	return ExitFailure
+}
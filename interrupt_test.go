@@ -0,0 +1,350 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/juju/loggo"
+	gc "gopkg.in/check.v1"
+)
+
+type InterruptSuite struct{}
+
+var _ = gc.Suite(&InterruptSuite{})
+
+func (s *InterruptSuite) TearDownTest(c *gc.C) {
+	loggo.ResetWriters()
+}
+
+// interruptCommand sends SIGINT to the current process when run, and
+// then waits for its context to be done. If released is set, it waits
+// for that to be closed instead; if signalTwice is also set it sends
+// a second SIGINT once its context is done.
+type interruptCommand struct {
+	CommandBase
+	signalTwice bool
+	released    chan struct{}
+}
+
+func (c *interruptCommand) Info() *Info {
+	return &Info{Name: "interrupt"}
+}
+
+func (c *interruptCommand) Run(ctx *Context) error {
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		return err
+	}
+	if err := p.Signal(os.Interrupt); err != nil {
+		return err
+	}
+	if c.released != nil && !c.signalTwice {
+		<-c.released
+		return nil
+	}
+	select {
+	case <-ctx.Context().Done():
+	case <-time.After(10 * time.Second):
+		return errors.New("context not cancelled")
+	}
+	if c.signalTwice {
+		if err := p.Signal(os.Interrupt); err != nil {
+			return err
+		}
+		<-c.released
+	}
+	return errors.New("interrupted")
+}
+
+// selfHandlingCommand handles SIGINT itself.
+type selfHandlingCommand struct {
+	CommandBase
+}
+
+func (c *selfHandlingCommand) Info() *Info {
+	return &Info{Name: "self-handling"}
+}
+
+func (c *selfHandlingCommand) HandlesSignals() bool {
+	return true
+}
+
+func (c *selfHandlingCommand) Run(ctx *Context) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	defer signal.Stop(signals)
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		return err
+	}
+	if err := p.Signal(os.Interrupt); err != nil {
+		return err
+	}
+	select {
+	case <-signals:
+	case <-time.After(10 * time.Second):
+		return errors.New("signal not received")
+	}
+	if err := ctx.Context().Err(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *InterruptSuite) patch(gracePeriod time.Duration, exitFunc func(int)) func() {
+	oldGracePeriod, oldExit := interruptGracePeriod, exit
+	interruptGracePeriod, exit = gracePeriod, exitFunc
+	return func() {
+		interruptGracePeriod, exit = oldGracePeriod, oldExit
+	}
+}
+
+func (s *InterruptSuite) TestContextDefault(c *gc.C) {
+	ctx := &Context{}
+	c.Assert(ctx.Context(), gc.NotNil)
+	c.Assert(ctx.Context().Err(), gc.IsNil)
+}
+
+func (s *InterruptSuite) TestMainCancelsContext(c *gc.C) {
+	defer s.patch(10*time.Second, func(int) {
+		c.Error("unexpected exit")
+	})()
+	var stdout, stderr bytes.Buffer
+	ctx := &Context{Stdout: &stdout, Stderr: &stderr}
+	code := Main(&interruptCommand{}, ctx, nil)
+	c.Check(code, gc.Equals, 130)
+	c.Check(stderr.String(), gc.Equals, "error: interrupted\n")
+	c.Check(ctx.Context().Err(), gc.IsNil)
+}
+
+// cleanupCommand records whether its context had been interrupted when
+// its deferred cleanup ran. If interrupt is set, it sends SIGINT to the
+// current process and waits for its context to be done first.
+type cleanupCommand struct {
+	CommandBase
+	interrupt   bool
+	interrupted bool
+}
+
+func (c *cleanupCommand) Info() *Info {
+	return &Info{Name: "cleanup"}
+}
+
+func (c *cleanupCommand) Run(ctx *Context) error {
+	defer func() {
+		c.interrupted = ctx.Interrupted()
+	}()
+	if !c.interrupt {
+		return errors.New("failed")
+	}
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		return err
+	}
+	if err := p.Signal(os.Interrupt); err != nil {
+		return err
+	}
+	select {
+	case <-ctx.Context().Done():
+	case <-time.After(10 * time.Second):
+		return errors.New("context not cancelled")
+	}
+	return ctx.Context().Err()
+}
+
+func (s *InterruptSuite) TestInterrupted(c *gc.C) {
+	defer s.patch(10*time.Second, func(int) {
+		c.Error("unexpected exit")
+	})()
+	var stdout, stderr bytes.Buffer
+	ctx := &Context{Stdout: &stdout, Stderr: &stderr}
+	command := &cleanupCommand{interrupt: true}
+	code := Main(command, ctx, nil)
+	c.Check(code, gc.Equals, 130)
+	c.Check(command.interrupted, gc.Equals, true)
+	c.Check(ctx.Interrupted(), gc.Equals, false)
+
+	command = &cleanupCommand{}
+	code = Main(command, ctx, nil)
+	c.Check(code, gc.Equals, 1)
+	c.Check(command.interrupted, gc.Equals, false)
+}
+
+func (s *InterruptSuite) TestMainExitsAfterGracePeriod(c *gc.C) {
+	released := make(chan struct{})
+	exited := make(chan int, 1)
+	defer s.patch(10*time.Millisecond, func(code int) {
+		exited <- code
+		close(released)
+	})()
+	var stdout, stderr bytes.Buffer
+	ctx := &Context{Stdout: &stdout, Stderr: &stderr}
+	code := Main(&interruptCommand{released: released}, ctx, nil)
+	c.Check(code, gc.Equals, 130)
+	select {
+	case code := <-exited:
+		c.Check(code, gc.Equals, 130)
+	default:
+		c.Fatalf("process not exited")
+	}
+}
+
+func (s *InterruptSuite) TestMainExitsOnSecondSignal(c *gc.C) {
+	released := make(chan struct{})
+	exited := make(chan int, 1)
+	defer s.patch(10*time.Second, func(code int) {
+		exited <- code
+		close(released)
+	})()
+	var stdout, stderr bytes.Buffer
+	ctx := &Context{Stdout: &stdout, Stderr: &stderr}
+	code := Main(&interruptCommand{signalTwice: true, released: released}, ctx, nil)
+	c.Check(code, gc.Equals, 130)
+	select {
+	case code := <-exited:
+		c.Check(code, gc.Equals, 130)
+	default:
+		c.Fatalf("process not exited")
+	}
+}
+
+func (s *InterruptSuite) TestMainIgnoresCancelledContextError(c *gc.C) {
+	defer s.patch(10*time.Second, func(int) {
+		c.Error("unexpected exit")
+	})()
+	var stdout, stderr bytes.Buffer
+	ctx := &Context{Stdout: &stdout, Stderr: &stderr}
+	code := Main(&cancelledCommand{}, ctx, nil)
+	c.Check(code, gc.Equals, 130)
+	c.Check(stderr.String(), gc.Equals, "")
+}
+
+func (s *InterruptSuite) TestCommandHandlesSignals(c *gc.C) {
+	defer s.patch(10*time.Millisecond, func(int) {
+		c.Error("unexpected exit")
+	})()
+	var stdout, stderr bytes.Buffer
+	ctx := &Context{Stdout: &stdout, Stderr: &stderr}
+	code := Main(&selfHandlingCommand{}, ctx, nil)
+	c.Check(code, gc.Equals, 0)
+	c.Check(stderr.String(), gc.Equals, "")
+}
+
+func (s *InterruptSuite) TestSuperCommandHandlesSignals(c *gc.C) {
+	defer s.patch(10*time.Millisecond, func(int) {
+		c.Error("unexpected exit")
+	})()
+	super := NewSuperCommand(SuperCommandParams{Name: "jujutest"})
+	super.Register(&selfHandlingCommand{})
+	var stdout, stderr bytes.Buffer
+	ctx := &Context{Stdout: &stdout, Stderr: &stderr}
+	code := Main(super, ctx, []string{"self-handling"})
+	c.Check(code, gc.Equals, 0)
+	c.Check(stderr.String(), gc.Equals, "")
+}
+
+// cancelledCommand interrupts itself and returns the error from its
+// cancelled context.
+type cancelledCommand struct {
+	interruptCommand
+}
+
+func (c *cancelledCommand) Run(ctx *Context) error {
+	c.interruptCommand.Run(ctx)
+	return ctx.Context().Err()
+}
+
+// timeoutCommand waits for its context to be done, or for released to be
+// closed if it is set, and records whether its context has a deadline.
+type timeoutCommand struct {
+	CommandBase
+	released    chan struct{}
+	hasDeadline bool
+}
+
+func (c *timeoutCommand) Info() *Info {
+	return &Info{Name: "wait"}
+}
+
+func (c *timeoutCommand) Run(ctx *Context) error {
+	_, c.hasDeadline = ctx.Context().Deadline()
+	if c.released != nil {
+		<-c.released
+		return nil
+	}
+	select {
+	case <-ctx.Context().Done():
+		return ctx.Context().Err()
+	case <-time.After(10 * time.Second):
+		return errors.New("context not cancelled")
+	}
+}
+
+func newTimeoutSuper(command Command) *SuperCommand {
+	super := NewSuperCommand(SuperCommandParams{
+		Name:        "jujutest",
+		Log:         &Log{},
+		TimeoutFlag: true,
+	})
+	super.Register(command)
+	return super
+}
+
+func (s *InterruptSuite) TestTimeoutCancelsContext(c *gc.C) {
+	defer s.patch(10*time.Second, func(int) {
+		c.Error("unexpected exit")
+	})()
+	var stdout, stderr bytes.Buffer
+	ctx := &Context{Stdout: &stdout, Stderr: &stderr}
+	command := &timeoutCommand{}
+	code := Main(newTimeoutSuper(command), ctx, []string{"wait", "--timeout", "10ms"})
+	c.Check(code, gc.Equals, ExitTimeout)
+	c.Check(command.hasDeadline, gc.Equals, true)
+	c.Check(stderr.String(), gc.Equals, "ERROR command timed out after 10ms\n")
+	c.Check(ctx.Context().Err(), gc.IsNil)
+}
+
+func (s *InterruptSuite) TestTimeoutExitsAfterGracePeriod(c *gc.C) {
+	released := make(chan struct{})
+	exited := make(chan int, 1)
+	defer s.patch(10*time.Millisecond, func(code int) {
+		exited <- code
+		close(released)
+	})()
+	var stdout, stderr bytes.Buffer
+	ctx := &Context{Stdout: &stdout, Stderr: &stderr}
+	command := &timeoutCommand{released: released}
+	code := Main(newTimeoutSuper(command), ctx, []string{"wait", "--timeout=10ms"})
+	c.Check(code, gc.Equals, ExitTimeout)
+	select {
+	case code := <-exited:
+		c.Check(code, gc.Equals, ExitTimeout)
+	default:
+		c.Fatalf("process not exited")
+	}
+}
+
+func (s *InterruptSuite) TestNoTimeout(c *gc.C) {
+	released := make(chan struct{})
+	close(released)
+	var stdout, stderr bytes.Buffer
+	ctx := &Context{Stdout: &stdout, Stderr: &stderr}
+	command := &timeoutCommand{released: released}
+	code := Main(newTimeoutSuper(command), ctx, []string{"wait"})
+	c.Check(code, gc.Equals, 0)
+	c.Check(command.hasDeadline, gc.Equals, false)
+}
+
+func (s *InterruptSuite) TestTimeoutInvalid(c *gc.C) {
+	var stdout, stderr bytes.Buffer
+	ctx := &Context{Stdout: &stdout, Stderr: &stderr}
+	code := Main(newTimeoutSuper(&timeoutCommand{}), ctx, []string{"wait", "--timeout", "soon"})
+	c.Check(code, gc.Equals, ExitUsage)
+	c.Check(stderr.String(), gc.Matches, `error: invalid value "soon" for flag --timeout: .*\n(?s).*`)
+}
@@ -4,9 +4,12 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/juju/loggo"
@@ -26,6 +29,40 @@ type Log struct {
 	ShowLog       bool
 	Config        string
 
+	// Level, if set, holds a default log level optionally followed by
+	// levels for particular modules, separated by semicolons, as in
+	// "INFO;juju.worker=DEBUG;juju.rpc=TRACE". It is applied after
+	// Config, so it takes precedence.
+	Level string
+
+	// Format is the format of log entries, either "text" or
+	// "json". If it is empty, text is used.
+	Format string
+
+	// MaxSize, if not zero, is the size in bytes that the log file
+	// may grow to. When another entry would make it larger, the file
+	// is renamed by adding ".1" to its name, and a new one is started.
+	MaxSize uint64
+
+	// MaxBackups is the number of log files renamed because of
+	// MaxSize that are kept, as ".1", ".2" and so on, with ".1" the
+	// most recent. Older files are removed.
+	MaxBackups int
+
+	// Syslog, if set, sends log entries to the local syslog daemon
+	// too, as well as to the log file and Stderr as usual. It is not
+	// available on all platforms.
+	Syslog bool
+
+	// SyslogFacility names the syslog facility that entries are
+	// logged with, such as "daemon" or "local0". If it is empty,
+	// "user" is used.
+	SyslogFacility string
+
+	// SyslogTag is the tag that syslog entries are logged with. If it
+	// is empty, the name of the program is used.
+	SyslogTag string
+
 	// NewWriter creates a new logging writer for a specified target.
 	NewWriter func(target io.Writer) loggo.Writer
 }
@@ -35,6 +72,9 @@ func (l *Log) GetLogWriter(target io.Writer) loggo.Writer {
 	if l.NewWriter != nil {
 		return l.NewWriter(target)
 	}
+	if l.Format == "json" {
+		return loggo.NewSimpleWriter(target, &jsonFormatter{})
+	}
 	return loggo.NewSimpleWriter(target, &loggo.DefaultFormatter{})
 }
 
@@ -47,7 +87,14 @@ func (l *Log) AddFlags(f *gnuflag.FlagSet) {
 	f.BoolVar(&l.Quiet, "quiet", false, "show no informational output")
 	f.BoolVar(&l.Debug, "debug", false, "equivalent to --show-log --log-config=<root>=DEBUG")
 	f.StringVar(&l.Config, "logging-config", l.DefaultConfig, "specify log levels for modules")
+	f.StringVar(&l.Level, "log-level", "", "specify the default log level and levels for modules, such as INFO;juju.worker=DEBUG")
 	f.BoolVar(&l.ShowLog, "show-log", false, "if set, write the log file to stderr")
+	f.StringVar(&l.Format, "log-format", "text", "format of log entries (text|json)")
+	ByteSizeVar(f, &l.MaxSize, "log-max-size", 0, "rotate the log file when it would grow larger than this, such as 10MB (0 for no limit)")
+	f.IntVar(&l.MaxBackups, "log-max-backups", 0, "number of rotated log files to keep")
+	f.BoolVar(&l.Syslog, "syslog", false, "also write the log to the local syslog daemon")
+	f.StringVar(&l.SyslogFacility, "syslog-facility", "user", "syslog facility to log with, such as daemon or local0")
+	f.StringVar(&l.SyslogTag, "syslog-tag", "", "syslog tag to log with (defaults to the program name)")
 }
 
 // Start starts logging using the given Context.
@@ -55,11 +102,28 @@ func (log *Log) Start(ctx *Context) error {
 	if log.Verbose && log.Quiet {
 		return fmt.Errorf(`"verbose" and "quiet" flags clash, please use one or the other, not both`)
 	}
+	switch log.Format {
+	case "", "text", "json":
+	default:
+		return fmt.Errorf("unknown log format %q, expected one of (text|json)", log.Format)
+	}
+	levelConfig, err := parseLogLevel(log.Level)
+	if err != nil {
+		return fmt.Errorf("invalid log level %q: %v", log.Level, err)
+	}
+	if log.MaxBackups < 0 {
+		return fmt.Errorf("invalid number of log backups %d, must not be negative", log.MaxBackups)
+	}
 	ctx.quiet = log.Quiet
 	ctx.verbose = log.Verbose
 	if log.Path != "" {
 		path := ctx.AbsPath(log.Path)
-		target, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		var target io.Writer
+		if log.MaxSize > 0 {
+			target, err = openRotatingFile(path, log.MaxSize, log.MaxBackups)
+		} else {
+			target, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		}
 		if err != nil {
 			return err
 		}
@@ -69,6 +133,19 @@ func (log *Log) Start(ctx *Context) error {
 			return err
 		}
 	}
+	if log.Syslog {
+		facility := log.SyslogFacility
+		if facility == "" {
+			facility = "user"
+		}
+		writer, err := newSyslogWriter(facility, log.SyslogTag)
+		if err != nil {
+			return err
+		}
+		if err := loggo.RegisterWriter("syslog", writer, loggo.TRACE); err != nil {
+			return err
+		}
+	}
 	level := loggo.WARNING
 	if log.ShowLog {
 		level = loggo.INFO
@@ -80,6 +157,8 @@ func (log *Log) Start(ctx *Context) error {
 		// to the log file.
 		ctx.quiet = true
 		ctx.verbose = false
+		// Show where errors came from as well as what they were.
+		ctx.debug = true
 	}
 
 	if log.ShowLog {
@@ -93,7 +172,11 @@ func (log *Log) Start(ctx *Context) error {
 		loggo.RemoveWriter("default")
 		// Create a simple writer that doesn't show filenames, or timestamps,
 		// and only shows warning or above.
-		writer := loggo.NewSimpleWriter(ctx.Stderr, &warningFormatter{})
+		var formatter loggo.Formatter = &warningFormatter{color: ctx.ColorEnabled()}
+		if log.Format == "json" {
+			formatter = &jsonFormatter{}
+		}
+		writer := loggo.NewSimpleWriter(ctx.Stderr, formatter)
 		err := loggo.RegisterWriter("warning", writer, loggo.WARNING)
 		if err != nil {
 			return err
@@ -104,15 +187,95 @@ func (log *Log) Start(ctx *Context) error {
 	root.SetLogLevel(level)
 	// Override the logging config with specified logging config.
 	loggo.ConfigureLoggers(log.Config)
+	for _, level := range levelConfig {
+		loggo.GetLogger(level.module).SetLogLevel(level.level)
+	}
 	return nil
 }
 
+// moduleLevel holds the log level for a module, given in a --log-level
+// specification.
+type moduleLevel struct {
+	module string
+	level  loggo.Level
+}
+
+var validModuleName = regexp.MustCompile(`^[a-zA-Z0-9_-]+(\.[a-zA-Z0-9_-]+)*$`)
+
+// parseLogLevel parses a specification as described by Log.Level. The
+// default level, which may also be given as "<root>=LEVEL", applies to the
+// root module, whose name is empty.
+func parseLogLevel(spec string) ([]moduleLevel, error) {
+	var levels []moduleLevel
+	for i, item := range strings.Split(spec, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		module, levelName := "", item
+		if parts := strings.SplitN(item, "=", 2); len(parts) == 2 {
+			module, levelName = strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+			switch {
+			case module == "<root>":
+				module = ""
+			case !validModuleName.MatchString(module):
+				return nil, fmt.Errorf("invalid module name %q", module)
+			}
+		} else if i > 0 {
+			return nil, fmt.Errorf("expected module=LEVEL, found %q", item)
+		}
+		level, ok := loggo.ParseLevel(levelName)
+		if !ok || level == loggo.UNSPECIFIED {
+			return nil, fmt.Errorf("unknown level %q, expected one of (TRACE|DEBUG|INFO|WARNING|ERROR|CRITICAL)", levelName)
+		}
+		levels = append(levels, moduleLevel{module, level})
+	}
+	return levels, nil
+}
+
 // warningFormatter is a simple loggo formatter that produces something like:
 //   WARNING The message...
-type warningFormatter struct{}
+// The level is colored if color is set.
+type warningFormatter struct {
+	color bool
+}
+
+func (f *warningFormatter) Format(level loggo.Level, _, _ string, _ int, _ time.Time, message string) string {
+	prefix := level.String()
+	if f.color {
+		color := ansiYellow
+		if level >= loggo.ERROR {
+			color = ansiRed
+		}
+		prefix = color + prefix + ansiReset
+	}
+	return fmt.Sprintf("%s %s", prefix, message)
+}
+
+// jsonFormatter is a loggo formatter that produces each log entry as a
+// single JSON object, for consumption by log aggregators.
+type jsonFormatter struct{}
 
-func (*warningFormatter) Format(level loggo.Level, _, _ string, _ int, _ time.Time, message string) string {
-	return fmt.Sprintf("%s %s", level, message)
+// jsonEntry holds the fields of a log entry written by jsonFormatter.
+type jsonEntry struct {
+	Timestamp string `json:"timestamp"`
+	Level     string `json:"level"`
+	Module    string `json:"module"`
+	Message   string `json:"message"`
+}
+
+func (*jsonFormatter) Format(level loggo.Level, module, _ string, _ int, timestamp time.Time, message string) string {
+	data, err := json.Marshal(jsonEntry{
+		Timestamp: timestamp.UTC().Format(time.RFC3339Nano),
+		Level:     level.String(),
+		Module:    module,
+		Message:   message,
+	})
+	if err != nil {
+		// A struct of strings always marshals.
+		panic(err)
+	}
+	return string(data)
 }
 
 // NewCommandLogWriter creates a loggo writer for registration
@@ -4,8 +4,13 @@
 package cmd_test
 
 import (
+	"encoding/json"
 	"io/ioutil"
+	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/juju/cmd/cmdtesting"
 	"github.com/juju/loggo"
@@ -49,6 +54,7 @@ func (s *LogSuite) TestNoFlags(c *gc.C) {
 	c.Assert(log.Verbose, gc.Equals, false)
 	c.Assert(log.Debug, gc.Equals, false)
 	c.Assert(log.Config, gc.Equals, "")
+	c.Assert(log.Format, gc.Equals, "text")
 }
 
 func (s *LogSuite) TestFlags(c *gc.C) {
@@ -60,6 +66,49 @@ func (s *LogSuite) TestFlags(c *gc.C) {
 	c.Assert(log.Config, gc.Equals, "juju.cmd=INFO;juju.worker.deployer=DEBUG")
 }
 
+func (s *LogSuite) TestLogFormatFlag(c *gc.C) {
+	log := newLogWithFlags(c, "", "--log-format", "json")
+	c.Assert(log.Format, gc.Equals, "json")
+}
+
+func (s *LogSuite) TestUnknownLogFormat(c *gc.C) {
+	l := &cmd.Log{Format: "xml"}
+	ctx := cmdtesting.Context(c)
+	err := l.Start(ctx)
+	c.Assert(err, gc.ErrorMatches, `unknown log format "xml", expected one of \(text\|json\)`)
+}
+
+func (s *LogSuite) TestJSONStderr(c *gc.C) {
+	l := &cmd.Log{ShowLog: true, Config: "<root>=INFO", Format: "json"}
+	ctx := cmdtesting.Context(c)
+	err := l.Start(ctx)
+	c.Assert(err, gc.IsNil)
+	logger.Infof("hello")
+	var entry map[string]string
+	err = json.Unmarshal([]byte(cmdtesting.Stderr(ctx)), &entry)
+	c.Assert(err, gc.IsNil)
+	c.Assert(entry["level"], gc.Equals, "INFO")
+	c.Assert(entry["module"], gc.Equals, "juju.test")
+	c.Assert(entry["message"], gc.Equals, "hello")
+	_, err = time.Parse(time.RFC3339Nano, entry["timestamp"])
+	c.Assert(err, gc.IsNil)
+	c.Assert(entry, gc.HasLen, 4)
+}
+
+func (s *LogSuite) TestJSONLogFile(c *gc.C) {
+	l := &cmd.Log{Path: "foo.log", Config: "<root>=INFO", Format: "json"}
+	ctx := cmdtesting.Context(c)
+	err := l.Start(ctx)
+	c.Assert(err, gc.IsNil)
+	logger.Infof("hello")
+	logger.Warningf("a warning")
+	content, err := ioutil.ReadFile(filepath.Join(ctx.Dir, "foo.log"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(content), gc.Matches, `{"timestamp":"[^"]+","level":"INFO","module":"juju.test","message":"hello"}\n`+
+		`{"timestamp":"[^"]+","level":"WARNING","module":"juju.test","message":"a warning"}\n`)
+	c.Assert(cmdtesting.Stderr(ctx), gc.Matches, `{"timestamp":"[^"]+","level":"WARNING","module":"juju.test","message":"a warning"}\n`)
+}
+
 func (s *LogSuite) TestLogConfigFromDefault(c *gc.C) {
 	config := "juju.cmd=INFO;juju.worker.deployer=DEBUG"
 	log := newLogWithFlags(c, config)
@@ -127,6 +176,115 @@ func (s *LogSuite) TestAbsPathLog(c *gc.C) {
 	c.Assert(string(content), gc.Matches, `^.* INFO .* hello\n`)
 }
 
+func (s *LogSuite) TestLogRotationFlags(c *gc.C) {
+	log := newLogWithFlags(c, "", "--log-max-size", "10MB", "--log-max-backups", "3")
+	c.Assert(log.MaxSize, gc.Equals, uint64(10e6))
+	c.Assert(log.MaxBackups, gc.Equals, 3)
+
+	log = newLogWithFlags(c, "")
+	c.Assert(log.MaxSize, gc.Equals, uint64(0))
+	c.Assert(log.MaxBackups, gc.Equals, 0)
+}
+
+func (s *LogSuite) TestLogRotation(c *gc.C) {
+	path := filepath.Join(c.MkDir(), "foo.log")
+	l := &cmd.Log{Path: path, Config: "<root>=INFO", MaxSize: 200, MaxBackups: 2}
+	ctx := cmdtesting.Context(c)
+	err := l.Start(ctx)
+	c.Assert(err, gc.IsNil)
+	for i := 0; i < 20; i++ {
+		logger.Infof("message %d", i)
+	}
+	content, err := ioutil.ReadFile(path)
+	c.Assert(err, gc.IsNil)
+	c.Check(string(content), gc.Matches, `(?s).* message 19\n`)
+	c.Check(len(content) <= 200, gc.Equals, true)
+	for _, name := range []string{path + ".1", path + ".2"} {
+		content, err := ioutil.ReadFile(name)
+		c.Assert(err, gc.IsNil)
+		c.Check(len(content) > 0 && len(content) <= 200, gc.Equals, true)
+	}
+	_, err = os.Stat(path + ".3")
+	c.Check(os.IsNotExist(err), gc.Equals, true)
+}
+
+func (s *LogSuite) TestLogRotationConcurrent(c *gc.C) {
+	path := filepath.Join(c.MkDir(), "foo.log")
+	l := &cmd.Log{Path: path, Config: "<root>=INFO", MaxSize: 500, MaxBackups: 1000}
+	ctx := cmdtesting.Context(c)
+	err := l.Start(ctx)
+	c.Assert(err, gc.IsNil)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				logger.Infof("goroutine %d message %d", i, j)
+			}
+		}(i)
+	}
+	wg.Wait()
+	names, err := filepath.Glob(path + "*")
+	c.Assert(err, gc.IsNil)
+	lines := 0
+	for _, name := range names {
+		content, err := ioutil.ReadFile(name)
+		c.Assert(err, gc.IsNil)
+		c.Check(len(content) <= 500, gc.Equals, true)
+		for _, line := range strings.Split(strings.TrimSuffix(string(content), "\n"), "\n") {
+			c.Check(line, gc.Matches, `.* goroutine \d+ message \d+`)
+			lines++
+		}
+	}
+	c.Check(lines, gc.Equals, 200)
+}
+
+func (s *LogSuite) TestLogLevel(c *gc.C) {
+	log := newLogWithFlags(c, "", "--logging-config", "juju.worker=ERROR;juju.api=ERROR",
+		"--log-level", "INFO; juju.worker=DEBUG;juju.rpc=trace")
+	c.Assert(log.Level, gc.Equals, "INFO; juju.worker=DEBUG;juju.rpc=trace")
+	err := log.Start(cmdtesting.Context(c))
+	c.Assert(err, gc.IsNil)
+	c.Check(loggo.GetLogger("").LogLevel(), gc.Equals, loggo.INFO)
+	c.Check(loggo.GetLogger("juju.worker").LogLevel(), gc.Equals, loggo.DEBUG)
+	c.Check(loggo.GetLogger("juju.rpc").LogLevel(), gc.Equals, loggo.TRACE)
+	c.Check(loggo.GetLogger("juju.api").LogLevel(), gc.Equals, loggo.ERROR)
+}
+
+func (s *LogSuite) TestLogLevelInvalid(c *gc.C) {
+	for _, test := range []struct {
+		spec string
+		err  string
+	}{{
+		spec: "LOUD",
+		err:  `invalid log level "LOUD": unknown level "LOUD", expected one of \(TRACE\|DEBUG\|INFO\|WARNING\|ERROR\|CRITICAL\)`,
+	}, {
+		spec: "INFO;juju.worker=",
+		err:  `invalid log level "INFO;juju.worker=": unknown level "", .*`,
+	}, {
+		spec: "INFO;juju worker=DEBUG",
+		err:  `invalid log level "INFO;juju worker=DEBUG": invalid module name "juju worker"`,
+	}, {
+		spec: "=DEBUG",
+		err:  `invalid log level "=DEBUG": invalid module name ""`,
+	}, {
+		spec: "juju.worker=DEBUG;INFO",
+		err:  `invalid log level "juju.worker=DEBUG;INFO": expected module=LEVEL, found "INFO"`,
+	}} {
+		c.Logf("spec %q", test.spec)
+		l := &cmd.Log{Level: test.spec}
+		err := l.Start(cmdtesting.Context(c))
+		c.Check(err, gc.ErrorMatches, test.err)
+	}
+}
+
+func (s *LogSuite) TestNegativeLogBackups(c *gc.C) {
+	l := &cmd.Log{MaxBackups: -1}
+	err := l.Start(cmdtesting.Context(c))
+	c.Assert(err, gc.ErrorMatches, "invalid number of log backups -1, must not be negative")
+}
+
 func (s *LogSuite) TestLoggingToFileAndStderr(c *gc.C) {
 	l := &cmd.Log{Path: "foo.log", Config: "<root>=INFO", ShowLog: true}
 	ctx := cmdtesting.Context(c)
@@ -0,0 +1,116 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// rotatingFile is an io.Writer that appends to the file at path until
+// writing to it would make it larger than maxSize, at which point the file
+// is renamed to path.1, any path.1 to path.2 and so on, keeping at most
+// maxBackups of them, and a new file is started. It is safe to use from
+// several goroutines at once.
+type rotatingFile struct {
+	path       string
+	maxSize    uint64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size uint64
+}
+
+// openRotatingFile opens the file at path for appending, creating it if
+// necessary, as described by rotatingFile.
+func openRotatingFile(path string, maxSize uint64, maxBackups int) (*rotatingFile, error) {
+	r := &rotatingFile{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// open opens the file at r.path and records its current size.
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.file, r.size = f, uint64(info.Size())
+	return nil
+}
+
+// Write implements io.Writer. A single write is never split across files,
+// so a log entry larger than maxSize is written to a file of its own.
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return 0, fmt.Errorf("cannot write to %s: file is closed", r.path)
+	}
+	if r.size > 0 && r.size+uint64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += uint64(n)
+	return n, err
+}
+
+// rotate closes the current file, shifts it and its backups along, and
+// opens a new file in its place.
+func (r *rotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	r.file = nil
+	if r.maxBackups <= 0 {
+		if err := os.Remove(r.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return r.open()
+	}
+	if err := os.Remove(backupName(r.path, r.maxBackups)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i := r.maxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(backupName(r.path, i), backupName(r.path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(r.path, backupName(r.path, 1)); err != nil {
+		return err
+	}
+	return r.open()
+}
+
+// Close closes the current file.
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// backupName returns the name of the nth backup of the file at path.
+func backupName(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
@@ -0,0 +1,131 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"launchpad.net/gnuflag"
+)
+
+// NegatableBoolVar defines a boolean flag with the specified name, default
+// value and usage on f, along with its "no-" counterpart, so that both
+// --verbose and --no-verbose can be given, the last one given winning.
+// This lets a flag that defaults to true be turned off without writing
+// --verbose=false. The two flags are shown together in help as
+// --[no-]verbose.
+func NegatableBoolVar(f *gnuflag.FlagSet, p *bool, name string, value bool, usage string) {
+	f.BoolVar(p, name, value, usage)
+	f.Var(&negatedBoolValue{target: p, name: name}, "no-"+name, "")
+}
+
+// negatedBoolValue implements gnuflag.Value for the "no-" counterpart of
+// a flag defined with NegatableBoolVar, storing the opposite of the value
+// it is given. Flags of this kind are rewritten by parseFlags to set the
+// flag they negate, because gnuflag only lets its own boolean flags be
+// given without a value.
+type negatedBoolValue struct {
+	target *bool
+	// name holds the name of the flag that is negated.
+	name string
+}
+
+// Implements gnuflag.Value Set.
+func (v *negatedBoolValue) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	*v.target = !b
+	return nil
+}
+
+// Implements gnuflag.Value String.
+func (v *negatedBoolValue) String() string {
+	return strconv.FormatBool(!*v.target)
+}
+
+// negatedFlag returns the flag in f named by arg, if arg is --no-name
+// or --no-name=value for a flag defined with NegatableBoolVar, along with
+// the value it was given.
+func negatedFlag(f *gnuflag.FlagSet, arg string) (v *negatedBoolValue, value string, hasValue bool) {
+	if !strings.HasPrefix(arg, "--no-") {
+		return nil, "", false
+	}
+	name := arg[len("--"):]
+	if i := strings.Index(name, "="); i >= 0 {
+		name, value, hasValue = name[:i], name[i+1:], true
+	}
+	flag := f.Lookup(name)
+	if flag == nil {
+		return nil, "", false
+	}
+	v, ok := flag.Value.(*negatedBoolValue)
+	if !ok || f.Lookup(v.name) == nil {
+		return nil, "", false
+	}
+	return v, value, hasValue
+}
+
+// rewriteNegatedFlags returns args with each flag defined in f with
+// NegatableBoolVar as --no-name replaced by the equivalent --name=false,
+// and --no-name=value by --name=!value, so that the flags can be given
+// without a value and the last one given wins. Arguments after a bare
+// "--" are left alone, as are values that are not valid booleans, which
+// gnuflag then reports.
+func rewriteNegatedFlags(f *gnuflag.FlagSet, args []string) []string {
+	var rewritten []string
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		v, value, hasValue := negatedFlag(f, arg)
+		if v == nil {
+			continue
+		}
+		b := false
+		if hasValue {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				continue
+			}
+			b = !parsed
+		}
+		if rewritten == nil {
+			rewritten = append([]string(nil), args...)
+		}
+		rewritten[i] = fmt.Sprintf("--%s=%v", v.name, b)
+	}
+	if rewritten == nil {
+		return args
+	}
+	return rewritten
+}
+
+// printDefaults writes the documentation of the flags in f to w, as
+// gnuflag.FlagSet.PrintDefaults does, showing each flag defined with
+// NegatableBoolVar together with its counterpart as --[no-]name. It
+// leaves the output of f set to w.
+func printDefaults(f *gnuflag.FlagSet, w io.Writer) {
+	var buf bytes.Buffer
+	f.SetOutput(&buf)
+	f.PrintDefaults()
+	f.SetOutput(w)
+	text := buf.String()
+	f.VisitAll(func(flag *gnuflag.Flag) {
+		v, ok := flag.Value.(*negatedBoolValue)
+		if !ok || f.Lookup(v.name) == nil {
+			return
+		}
+		text = strings.Replace(text, fmt.Sprintf("--%s (= %s)\n    %s\n", flag.Name, flag.DefValue, flag.Usage), "", 1)
+		header := regexp.MustCompile(`(?m)(^|, )--` + regexp.QuoteMeta(v.name) + ` \(= `)
+		text = header.ReplaceAllString(text, "${1}--[no-]"+v.name+" (= ")
+	})
+	io.WriteString(w, text)
+}
@@ -0,0 +1,88 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd_test
+
+import (
+	"fmt"
+
+	gc "gopkg.in/check.v1"
+	"launchpad.net/gnuflag"
+
+	"github.com/juju/cmd"
+	"github.com/juju/cmd/cmdtesting"
+)
+
+type NegatableSuite struct{}
+
+var _ = gc.Suite(&NegatableSuite{})
+
+// colorsCommand is a command with a negatable flag that defaults to true.
+type colorsCommand struct {
+	cmd.CommandBase
+	colors bool
+}
+
+func (c *colorsCommand) Info() *cmd.Info {
+	return &cmd.Info{Name: "show"}
+}
+
+func (c *colorsCommand) SetFlags(f *gnuflag.FlagSet) {
+	cmd.NegatableBoolVar(f, &c.colors, "colors", true, "use colors in the output")
+}
+
+func (c *colorsCommand) Run(ctx *cmd.Context) error {
+	fmt.Fprintf(ctx.Stdout, "colors: %v\n", c.colors)
+	return nil
+}
+
+func (s *NegatableSuite) TestNegatableBoolVar(c *gc.C) {
+	for i, test := range []struct {
+		args   []string
+		stdout string
+	}{
+		{nil, "colors: true\n"},
+		{[]string{"--no-colors"}, "colors: false\n"},
+		{[]string{"--colors=false"}, "colors: false\n"},
+		{[]string{"--no-colors", "--colors"}, "colors: true\n"},
+		{[]string{"--colors", "--no-colors"}, "colors: false\n"},
+		{[]string{"--no-colors=false"}, "colors: true\n"},
+		{[]string{"--no-colors=true"}, "colors: false\n"},
+	} {
+		c.Logf("test %d: %q", i, test.args)
+		for _, super := range []bool{false, true} {
+			var command cmd.Command = &colorsCommand{}
+			args := test.args
+			if super {
+				jc := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "jujutest"})
+				jc.Register(command)
+				command = jc
+				args = append([]string{"show"}, args...)
+			}
+			ctx := cmdtesting.Context(c)
+			code := cmd.Main(command, ctx, args)
+			c.Check(code, gc.Equals, 0)
+			c.Check(cmdtesting.Stdout(ctx), gc.Equals, test.stdout)
+		}
+	}
+}
+
+func (s *NegatableSuite) TestNegatableBoolVarInvalid(c *gc.C) {
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(&colorsCommand{}, ctx, []string{"--no-colors=maybe"})
+	c.Check(code, gc.Equals, 2)
+	c.Check(cmdtesting.Stderr(ctx), gc.Matches, `(?s)error: invalid value "maybe" for flag --no-colors: .*`)
+}
+
+func (s *NegatableSuite) TestNegatableBoolVarHelp(c *gc.C) {
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(&colorsCommand{}, ctx, []string{"--help"})
+	c.Check(code, gc.Equals, 0)
+	c.Check(cmdtesting.Stdout(ctx), gc.Equals, `
+Usage: show [options]
+
+Options:
+--[no-]colors (= true)
+    use colors in the output
+`[1:])
+}
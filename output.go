@@ -4,7 +4,10 @@
 package cmd
 
 import (
+	"bytes"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -12,13 +15,31 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"text/tabwriter"
+	"text/template"
 
 	goyaml "gopkg.in/yaml.v2"
 	"launchpad.net/gnuflag"
 )
 
-// Formatter converts an arbitrary object into a []byte.
-type Formatter func(value interface{}) ([]byte, error)
+// Formatter converts an arbitrary object into a []byte. The isTerminal
+// hint reports whether the result will be written to a terminal, so that
+// a formatter can lay it out for people there and keep it plain when it is
+// piped to another program or written to a file.
+type Formatter func(value interface{}, isTerminal bool) ([]byte, error)
+
+// FormatterFunc converts an arbitrary object into a []byte in the same way
+// wherever the result is written. Use IgnoreTerminal to turn it into a
+// Formatter.
+type FormatterFunc func(value interface{}) ([]byte, error)
+
+// IgnoreTerminal returns a Formatter that calls f, ignoring the isTerminal
+// hint.
+func IgnoreTerminal(f FormatterFunc) Formatter {
+	return func(value interface{}, _ bool) ([]byte, error) {
+		return f(value)
+	}
+}
 
 // FormatYaml marshals value to a yaml-formatted []byte, unless value is nil.
 func FormatYaml(value interface{}) ([]byte, error) {
@@ -38,8 +59,224 @@ func FormatYaml(value interface{}) ([]byte, error) {
 	return result, nil
 }
 
-// FormatJson marshals value to a json-formatted []byte.
-var FormatJson = json.Marshal
+// FormatYamlSorted marshals value to a yaml-formatted []byte like
+// FormatYaml, but with the keys of all maps, including those nested in
+// other maps and in slices, and the fields of all structs, sorted
+// alphabetically. This makes the output stable whatever the type of
+// value, so that it can be compared across versions.
+func FormatYamlSorted(value interface{}) ([]byte, error) {
+	if value == nil {
+		return nil, nil
+	}
+	data, err := goyaml.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	if err := goyaml.Unmarshal(data, &generic); err != nil {
+		return nil, err
+	}
+	return FormatYaml(sortedYaml(generic))
+}
+
+// sortedYaml returns value, as unmarshalled from yaml, with every map
+// replaced by a goyaml.MapSlice whose items are sorted by key.
+func sortedYaml(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[interface{}]interface{}:
+		items := make(goyaml.MapSlice, 0, len(value))
+		for k, v := range value {
+			items = append(items, goyaml.MapItem{Key: k, Value: sortedYaml(v)})
+		}
+		sort.Sort(mapItemsByKey(items))
+		return items
+	case []interface{}:
+		for i, v := range value {
+			value[i] = sortedYaml(v)
+		}
+	}
+	return value
+}
+
+// compactYaml returns value, as unmarshalled from yaml by compactValue,
+// without the map items whose values are null, empty strings, zero
+// numbers, false, or lists or maps that are empty once compacted
+// themselves, and reports whether the result is itself empty in that
+// sense. The original value that value was marshalled from is walked
+// alongside it, so that struct fields tagged `compact:"keep"` are kept
+// even when they are empty, as for a count whose zero means something.
+func compactYaml(value interface{}, original reflect.Value) (interface{}, bool) {
+	original = indirect(original)
+	switch value := value.(type) {
+	case nil:
+		return nil, true
+	case string:
+		return value, value == ""
+	case bool:
+		return value, !value
+	case int:
+		return value, value == 0
+	case int64:
+		return value, value == 0
+	case uint64:
+		return value, value == 0
+	case float64:
+		return value, value == 0
+	case goyaml.MapSlice:
+		var fields map[string]compactField
+		if original.Kind() == reflect.Struct {
+			fields = compactFields(original)
+		}
+		items := make(goyaml.MapSlice, 0, len(value))
+		for _, item := range value {
+			var sub reflect.Value
+			keep := false
+			switch original.Kind() {
+			case reflect.Struct:
+				field := fields[fmt.Sprint(item.Key)]
+				sub, keep = field.value, field.keep
+			case reflect.Map:
+				sub = mapIndex(original, item.Key)
+			}
+			if v, empty := compactYaml(item.Value, sub); !empty || keep {
+				items = append(items, goyaml.MapItem{Key: item.Key, Value: v})
+			}
+		}
+		return items, len(items) == 0
+	case []interface{}:
+		for i, v := range value {
+			var sub reflect.Value
+			if (original.Kind() == reflect.Slice || original.Kind() == reflect.Array) && i < original.Len() {
+				sub = original.Index(i)
+			}
+			value[i], _ = compactYaml(v, sub)
+		}
+		return value, len(value) == 0
+	}
+	return value, false
+}
+
+// compactField holds a struct field marshalled to yaml, and whether it is
+// tagged to be kept in compact output when it is empty.
+type compactField struct {
+	value reflect.Value
+	keep  bool
+}
+
+// compactFields returns the fields of the struct v by the keys they are
+// marshalled to yaml under, including those of inlined structs.
+func compactFields(v reflect.Value) map[string]compactField {
+	fields := make(map[string]compactField)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		tag := field.Tag.Get("yaml")
+		if tag == "-" {
+			continue
+		}
+		name, options := tag, ""
+		if j := strings.Index(tag, ","); j >= 0 {
+			name, options = tag[:j], tag[j:]
+		}
+		if strings.Contains(options, ",inline") {
+			if inner := indirect(v.Field(i)); inner.Kind() == reflect.Struct {
+				for key, f := range compactFields(inner) {
+					fields[key] = f
+				}
+			}
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		fields[name] = compactField{
+			value: v.Field(i),
+			keep:  field.Tag.Get("compact") == "keep",
+		}
+	}
+	return fields
+}
+
+// mapIndex returns the value of the map m for key, as unmarshalled from
+// yaml, or the zero Value if it cannot be found.
+func mapIndex(m reflect.Value, key interface{}) reflect.Value {
+	k := reflect.ValueOf(key)
+	if !k.IsValid() {
+		return reflect.Value{}
+	}
+	keyType := m.Type().Key()
+	if !k.Type().ConvertibleTo(keyType) {
+		return reflect.Value{}
+	}
+	return m.MapIndex(k.Convert(keyType))
+}
+
+// compactValue returns value, if it is a map, struct or list of anything
+// other than strings, marshalled to yaml and back with its empty values
+// removed, as by compactYaml. The order of struct fields is kept. Other
+// values are returned as they are.
+func compactValue(value interface{}) (interface{}, error) {
+	v := reflect.Indirect(reflect.ValueOf(value))
+	switch v.Kind() {
+	case reflect.Map, reflect.Struct:
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.String {
+			return value, nil
+		}
+	default:
+		return value, nil
+	}
+	// Only maps can be unmarshalled as a goyaml.MapSlice, so the value
+	// is wrapped in one.
+	data, err := goyaml.Marshal(goyaml.MapSlice{{Key: "value", Value: value}})
+	if err != nil {
+		return nil, err
+	}
+	var wrapped goyaml.MapSlice
+	if err := goyaml.Unmarshal(data, &wrapped); err != nil {
+		return nil, err
+	}
+	compacted, _ := compactYaml(wrapped[0].Value, v)
+	return compacted, nil
+}
+
+type mapItemsByKey goyaml.MapSlice
+
+func (m mapItemsByKey) Len() int           { return len(m) }
+func (m mapItemsByKey) Less(i, j int) bool { return fmt.Sprint(m[i].Key) < fmt.Sprint(m[j].Key) }
+func (m mapItemsByKey) Swap(i, j int)      { m[i], m[j] = m[j], m[i] }
+
+// FormatJson marshals value to a compact json-formatted []byte. Unlike
+// json.Marshal, it does not escape the characters <, > and &, so that
+// URLs and templates in the value are written as they are.
+var FormatJson = NewJsonFormatter("")
+
+// FormatJsonIndent marshals value to a json-formatted []byte like
+// FormatJson, with each element on its own line, indented by two spaces
+// for each level of nesting.
+var FormatJsonIndent = NewJsonFormatter("  ")
+
+// NewJsonFormatter returns a FormatterFunc that behaves like FormatJson,
+// but indents the output with the given string when it is not empty.
+func NewJsonFormatter(indent string) FormatterFunc {
+	return func(value interface{}) ([]byte, error) {
+		var buf bytes.Buffer
+		encoder := json.NewEncoder(&buf)
+		encoder.SetEscapeHTML(false)
+		if indent != "" {
+			encoder.SetIndent("", indent)
+		}
+		if err := encoder.Encode(value); err != nil {
+			return nil, err
+		}
+		// Encode follows each value with a newline, which Output
+		// adds itself.
+		return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+	}
+}
 
 // FormatSmart marshals value into a []byte according to the following rules:
 //   * string:        untouched
@@ -47,10 +284,21 @@ var FormatJson = json.Marshal
 //   * int or float:  converted to sensible strings
 //   * []string:      joined by `\n`s into a single string
 //   * anything else: delegate to FormatYaml
-func FormatSmart(value interface{}) ([]byte, error) {
+//
+// FormatYaml shows nested maps and structs as indented "key: value" blocks
+// and nested slices as lists of "- " items, to any depth. When the result
+// is written to a terminal, a slice or array of structs or of maps is shown
+// as a table instead, as by FormatTable, as long as none of its cells holds
+// a nested value, which would not fit in a table.
+func FormatSmart(value interface{}, isTerminal bool) ([]byte, error) {
 	if value == nil {
 		return nil, nil
 	}
+	if isTerminal && !hasNestedCells(value) {
+		if _, _, err := tabulate(value); err == nil {
+			return FormatTable(value)
+		}
+	}
 	v := reflect.ValueOf(value)
 	switch kind := v.Kind(); kind {
 	case reflect.String:
@@ -82,34 +330,324 @@ func FormatSmart(value interface{}) ([]byte, error) {
 	return FormatYaml(value)
 }
 
+// FormatTable marshals value into a []byte holding a table of aligned
+// columns. The value must be a slice or array of structs or of maps:
+//   * structs: one column for each exported field, in declaration order
+//   * maps:    one column for each key found in any of the maps, sorted;
+//              cells for keys missing from a given map are left blank
+// Columns are padded with spaces so that the output stays aligned when
+// written to a file.
+func FormatTable(value interface{}) ([]byte, error) {
+	if value == nil {
+		return nil, nil
+	}
+	headers, rows, err := tabulate(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	var buf bytes.Buffer
+	tw := tabwriter.NewWriter(&buf, 0, 1, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(headers, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	if err := tw.Flush(); err != nil {
+		return nil, err
+	}
+	// Blank cells at the end of a row still get padded, so trim them.
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " ")
+	}
+	return []byte(strings.Join(lines, "\n")), nil
+}
+
+// FormatCsv marshals value into a []byte of comma separated values, with a
+// header line naming the columns. The value is interpreted in the same way
+// as for FormatTable, and fields are quoted as described in RFC 4180.
+var FormatCsv = NewCsvFormatter(',')
+
+// NewCsvFormatter returns a FormatterFunc that behaves like FormatCsv, but
+// separates fields with the given delimiter; for instance, '\t' produces
+// tab separated values.
+func NewCsvFormatter(delimiter rune) FormatterFunc {
+	return func(value interface{}) ([]byte, error) {
+		if value == nil {
+			return nil, nil
+		}
+		headers, rows, err := tabulate(value)
+		if err != nil {
+			return nil, err
+		}
+		if len(rows) == 0 {
+			return nil, nil
+		}
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		w.Comma = delimiter
+		w.Write(headers)
+		w.WriteAll(rows)
+		if err := w.Error(); err != nil {
+			return nil, err
+		}
+		return bytes.TrimRight(buf.Bytes(), "\n"), nil
+	}
+}
+
+// tabulate converts value, which must be a slice or array of structs or of
+// maps, into a list of column headers and rows of cells.
+func tabulate(value interface{}) (headers []string, rows [][]string, err error) {
+	v := reflect.ValueOf(value)
+	if kind := v.Kind(); kind != reflect.Slice && kind != reflect.Array {
+		return nil, nil, fmt.Errorf("cannot tabulate %#v", value)
+	}
+	items := make([]reflect.Value, v.Len())
+	for i := range items {
+		items[i] = indirect(v.Index(i))
+	}
+	if len(items) == 0 {
+		return nil, nil, nil
+	}
+	switch items[0].Kind() {
+	case reflect.Struct:
+		t := items[0].Type()
+		var fields []int
+		for i := 0; i < t.NumField(); i++ {
+			if field := t.Field(i); field.PkgPath == "" {
+				fields = append(fields, i)
+				headers = append(headers, field.Name)
+			}
+		}
+		for _, item := range items {
+			if !item.IsValid() || item.Type() != t {
+				return nil, nil, fmt.Errorf("cannot tabulate %#v", value)
+			}
+			row := make([]string, len(fields))
+			for i, field := range fields {
+				row[i] = cell(item.Field(field))
+			}
+			rows = append(rows, row)
+		}
+	case reflect.Map:
+		keys := map[string]bool{}
+		for _, item := range items {
+			if item.Kind() != reflect.Map {
+				return nil, nil, fmt.Errorf("cannot tabulate %#v", value)
+			}
+			for _, key := range item.MapKeys() {
+				keys[fmt.Sprint(key.Interface())] = true
+			}
+		}
+		for key := range keys {
+			headers = append(headers, key)
+		}
+		sort.Strings(headers)
+		column := make(map[string]int, len(headers))
+		for i, header := range headers {
+			column[header] = i
+		}
+		for _, item := range items {
+			row := make([]string, len(headers))
+			for _, key := range item.MapKeys() {
+				row[column[fmt.Sprint(key.Interface())]] = cell(item.MapIndex(key))
+			}
+			rows = append(rows, row)
+		}
+	default:
+		return nil, nil, fmt.Errorf("cannot tabulate %#v", value)
+	}
+	return headers, rows, nil
+}
+
+// hasNestedCells reports whether value is a slice or array of structs or of
+// maps with a field or item that holds a map, slice, array or struct.
+func hasNestedCells(value interface{}) bool {
+	v := reflect.ValueOf(value)
+	if kind := v.Kind(); kind != reflect.Slice && kind != reflect.Array {
+		return false
+	}
+	for i := 0; i < v.Len(); i++ {
+		item := indirect(v.Index(i))
+		switch item.Kind() {
+		case reflect.Struct:
+			for j := 0; j < item.NumField(); j++ {
+				if item.Type().Field(j).PkgPath == "" && isNested(item.Field(j)) {
+					return true
+				}
+			}
+		case reflect.Map:
+			for _, key := range item.MapKeys() {
+				if isNested(item.MapIndex(key)) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// isNested reports whether v holds a map, slice, array or struct.
+func isNested(v reflect.Value) bool {
+	switch indirect(v).Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array, reflect.Struct:
+		return true
+	}
+	return false
+}
+
+// indirect follows pointers and interfaces until it reaches a concrete value.
+func indirect(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// cell returns the text used to display v in a table.
+func cell(v reflect.Value) string {
+	v = indirect(v)
+	if !v.IsValid() {
+		return ""
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// templateFuncs holds the functions available to templates given with
+// --format template=<text>.
+var templateFuncs = template.FuncMap{
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+}
+
+// NewTemplateFormatter returns a FormatterFunc that renders values with the
+// given text/template, which may use the functions join and upper from
+// the strings package.
+func NewTemplateFormatter(text string) (FormatterFunc, error) {
+	tmpl, err := template.New("format").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid format template: %v", err)
+	}
+	return func(value interface{}) ([]byte, error) {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, value); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}, nil
+}
+
+// FormatTemplate marks a set of formatters as accepting --format
+// template=<text>, which renders values with the text/template given in
+// the flag. Used directly, it returns an error.
+func FormatTemplate(value interface{}) ([]byte, error) {
+	return nil, errNoTemplate
+}
+
+var errNoTemplate = errors.New("template format requires a template, for example template='{{.Name}}'")
+
+// formatYaml, formatJson and formatJsonIndent are the yaml and json
+// formatters in DefaultFormatters. They are functions rather than
+// closures made with IgnoreTerminal so that Output.Stream and Main can
+// recognise them, whatever names they are given, to stream their output
+// and to report errors in the same format.
+func formatYaml(value interface{}, _ bool) ([]byte, error) {
+	return FormatYaml(value)
+}
+
+func formatJson(value interface{}, _ bool) ([]byte, error) {
+	return FormatJson(value)
+}
+
+func formatJsonIndent(value interface{}, _ bool) ([]byte, error) {
+	return FormatJsonIndent(value)
+}
+
+func formatXml(value interface{}, _ bool) ([]byte, error) {
+	return FormatXml(value)
+}
+
+// isFormatter reports whether formatter is the function f.
+func isFormatter(formatter, f Formatter) bool {
+	return formatter != nil && reflect.ValueOf(formatter).Pointer() == reflect.ValueOf(f).Pointer()
+}
+
 // DefaultFormatters holds the formatters that can be
 // specified with the --format flag.
 var DefaultFormatters = map[string]Formatter{
-	"smart": FormatSmart,
-	"yaml":  FormatYaml,
-	"json":  FormatJson,
+	"smart":       FormatSmart,
+	"yaml":        formatYaml,
+	"json":        formatJson,
+	"json-indent": formatJsonIndent,
+	"table":       IgnoreTerminal(FormatTable),
+	"csv":         IgnoreTerminal(FormatCsv),
+	"tsv":         IgnoreTerminal(NewCsvFormatter('\t')),
+	"template":    IgnoreTerminal(FormatTemplate),
+	"xml":         formatXml,
 }
 
 // formatterValue implements gnuflag.Value for the --format flag.
 type formatterValue struct {
 	name       string
 	formatters map[string]Formatter
+	// template holds the formatter for the template given with
+	// --format template=<text>.
+	template FormatterFunc
+	// compact is set when the format was given with a ":compact"
+	// suffix, as in --format smart:compact.
+	compact bool
+}
+
+// compactFormats holds the names of the formats that may be given with
+// a ":compact" suffix, to leave out empty values.
+var compactFormats = map[string]bool{
+	"smart": true,
+	"yaml":  true,
 }
 
 // newFormatterValue returns a new formatterValue. The initial Formatter name
 // must be present in formatters.
-func newFormatterValue(initial string, formatters map[string]Formatter) *formatterValue {
+func newFormatterValue(initial string, formatters map[string]Formatter) (*formatterValue, error) {
 	v := &formatterValue{formatters: formatters}
 	if err := v.Set(initial); err != nil {
-		panic(err)
+		return nil, fmt.Errorf("default format %q is not one of %s", initial, v.choices())
 	}
-	return v
+	return v, nil
 }
 
-// Set stores the chosen formatter name in v.name.
+// Set stores the chosen formatter name in v.name. The smart and yaml
+// formats may be given with a ":compact" suffix, as in "smart:compact",
+// which leaves out map keys and struct fields whose values are empty or
+// zero, as described by compactYaml, for a tighter view of values with
+// many optional fields. Struct fields tagged `compact:"keep"` are shown
+// even when they are empty. Compact values are shown as yaml even on a
+// terminal.
 func (v *formatterValue) Set(value string) error {
+	v.compact = false
+	if name := strings.TrimSuffix(value, ":compact"); name != value && compactFormats[name] && v.formatters[name] != nil {
+		v.name, v.compact = name, true
+		return nil
+	}
+	if v.formatters["template"] != nil {
+		if value == "template" {
+			return errNoTemplate
+		}
+		if strings.HasPrefix(value, "template=") {
+			formatter, err := NewTemplateFormatter(strings.TrimPrefix(value, "template="))
+			if err != nil {
+				return err
+			}
+			v.name, v.template = "template", formatter
+			return nil
+		}
+	}
 	if v.formatters[value] == nil {
-		return fmt.Errorf("unknown format %q", value)
+		return fmt.Errorf("unknown format %q, expected one of %s", value, v.choices())
 	}
 	v.name = value
 	return nil
@@ -117,24 +655,46 @@ func (v *formatterValue) Set(value string) error {
 
 // String returns the chosen formatter name.
 func (v *formatterValue) String() string {
+	if v.compact {
+		return v.name + ":compact"
+	}
 	return v.name
 }
 
-// doc returns documentation for the --format flag.
-func (v *formatterValue) doc() string {
-	choices := make([]string, len(v.formatters))
-	i := 0
+// names returns the available formatter names, sorted.
+func (v *formatterValue) names() []string {
+	names := make([]string, 0, len(v.formatters))
 	for name := range v.formatters {
-		choices[i] = name
-		i++
+		names = append(names, name)
 	}
-	sort.Strings(choices)
-	return "Specify output format (" + strings.Join(choices, "|") + ")"
+	sort.Strings(names)
+	return names
+}
+
+// choices returns the available formatter names, sorted and joined
+// with "|".
+func (v *formatterValue) choices() string {
+	return enumChoices(v.names())
+}
+
+// doc returns documentation for the --format flag.
+func (v *formatterValue) doc() string {
+	return enumUsage("Specify output format", v.names())
 }
 
-// format runs the chosen formatter on value.
-func (v *formatterValue) format(value interface{}) ([]byte, error) {
-	return v.formatters[v.name](value)
+// format runs the chosen formatter on value, passing it the isTerminal
+// hint.
+func (v *formatterValue) format(value interface{}, isTerminal bool) ([]byte, error) {
+	if v.name == "template" && v.template != nil {
+		return v.template(value)
+	}
+	if v.compact {
+		var err error
+		if value, err = compactValue(value); err != nil {
+			return nil, err
+		}
+	}
+	return v.formatters[v.name](value, isTerminal)
 }
 
 // Output is responsible for interpreting output-related command line flags
@@ -142,32 +702,70 @@ func (v *formatterValue) format(value interface{}) ([]byte, error) {
 type Output struct {
 	formatter *formatterValue
 	outPath   string
+	// extra holds the formatters added with AddFormatter.
+	extra map[string]Formatter
+}
+
+// AddFormatter makes the named formatter available with the --format
+// flag, in addition to the formatters given to AddFlags, so that a command
+// can offer its own rendering of its output. It must be called before
+// AddFlags, and replaces any formatter with the same name.
+func (c *Output) AddFormatter(name string, formatter Formatter) {
+	if c.extra == nil {
+		c.extra = make(map[string]Formatter)
+	}
+	c.extra[name] = formatter
 }
 
 // AddFlags injects the --format and --output command line flags into f.
+// The --format flag defaults to defaultFormatter, which must be one of
+// formatters; AddFlags panics if it is not. Use AddFlagsWithDefault when
+// the default is not known to be valid.
 func (c *Output) AddFlags(f *gnuflag.FlagSet, defaultFormatter string, formatters map[string]Formatter) {
-	c.formatter = newFormatterValue(defaultFormatter, formatters)
+	if err := c.AddFlagsWithDefault(f, defaultFormatter, formatters); err != nil {
+		panic(err)
+	}
+}
+
+// AddFlagsWithDefault injects the --format and --output command line
+// flags into f, as AddFlags does, but returns an error without adding any
+// flags if defaultFormatter is not one of formatters.
+func (c *Output) AddFlagsWithDefault(f *gnuflag.FlagSet, defaultFormatter string, formatters map[string]Formatter) error {
+	if len(c.extra) > 0 {
+		// Copy the formatters, which are often DefaultFormatters,
+		// so that other commands are not affected.
+		merged := make(map[string]Formatter, len(formatters)+len(c.extra))
+		for name, formatter := range formatters {
+			merged[name] = formatter
+		}
+		for name, formatter := range c.extra {
+			merged[name] = formatter
+		}
+		formatters = merged
+	}
+	formatter, err := newFormatterValue(defaultFormatter, formatters)
+	if err != nil {
+		return err
+	}
+	c.formatter = formatter
 	f.Var(c.formatter, "format", c.formatter.doc())
-	f.StringVar(&c.outPath, "o", "", "Specify an output file")
+	f.StringVar(&c.outPath, "o", "", "Specify an output file, or - for stdout")
 	f.StringVar(&c.outPath, "output", "", "")
+	return nil
 }
 
 // Write formats and outputs the value as directed by the --format and
-// --output command line flags.
+// --output command line flags. The formatter is told whether the value is
+// being written to a terminal.
 func (c *Output) Write(ctx *Context, value interface{}) (err error) {
-	var target io.Writer
-	if c.outPath == "" {
-		target = ctx.Stdout
-	} else {
-		path := ctx.AbsPath(c.outPath)
-		var f *os.File
-		if f, err = os.Create(path); err != nil {
-			return
-		}
+	target, f, err := c.target(ctx)
+	if err != nil {
+		return
+	}
+	if f != nil {
 		defer f.Close()
-		target = f
 	}
-	bytes, err := c.formatter.format(value)
+	bytes, err := c.formatter.format(value, f == nil && isTerminalWriter(target))
 	if err != nil {
 		return
 	}
@@ -180,6 +778,72 @@ func (c *Output) Write(ctx *Context, value interface{}) (err error) {
 	return
 }
 
+// target returns the writer that output should be written to, as
+// directed by the --output flag, and the file that must be closed once
+// it has been written, if any. An existing file is truncated; the path
+// "-" stands for Stdout.
+func (c *Output) target(ctx *Context) (io.Writer, *os.File, error) {
+	if c.outPath == "" || c.outPath == "-" {
+		return ctx.Stdout, nil, nil
+	}
+	f, err := os.Create(ctx.AbsPath(c.outPath))
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot create output file: %v", err)
+	}
+	return f, f, nil
+}
+
 func (c *Output) Name() string {
 	return c.formatter.name
 }
+
+// machineFormatters holds the formatters of DefaultFormatters whose
+// output is meant to be read by other programs. When one of them is
+// chosen with the --format flag, by whatever name, Main reports errors in
+// that format too.
+var machineFormatters = []Formatter{formatJson, formatJsonIndent, formatYaml, formatXml}
+
+// machineFormatter returns the Formatter chosen with the --format flag in
+// f, if that is a machine readable format.
+func machineFormatter(f *gnuflag.FlagSet) Formatter {
+	if f == nil {
+		return nil
+	}
+	flag := f.Lookup("format")
+	if flag == nil {
+		return nil
+	}
+	v, ok := flag.Value.(*formatterValue)
+	if !ok {
+		return nil
+	}
+	formatter := v.formatters[v.name]
+	for _, machine := range machineFormatters {
+		if isFormatter(formatter, machine) {
+			return formatter
+		}
+	}
+	return nil
+}
+
+// structuredError is the form in which errors are reported when a machine
+// readable output format is chosen.
+type structuredError struct {
+	Error string `json:"error" yaml:"error" xml:"error"`
+	Code  int    `json:"code" yaml:"code" xml:"code"`
+}
+
+// writeStructuredError writes err and the exit code it causes to w in the
+// given format. It reports whether it succeeded, so that the caller can
+// fall back to the plain form.
+func writeStructuredError(w io.Writer, formatter Formatter, err error, code int) bool {
+	data, fmtErr := formatter(structuredError{Error: err.Error(), Code: code}, false)
+	if fmtErr != nil {
+		return false
+	}
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		data = append(data, '\n')
+	}
+	w.Write(data)
+	return true
+}
@@ -4,6 +4,13 @@
 package cmd_test
 
 import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/juju/loggo"
 	gc "gopkg.in/check.v1"
 	"launchpad.net/gnuflag"
 
@@ -45,6 +52,25 @@ var defaultValue = struct {
 	Puppet bool
 }{1, false}
 
+// compactValue has fields that are empty in several ways, for testing
+// the compact formats.
+var compactValue = struct {
+	Name      string              `yaml:"name"`
+	Units     int                 `yaml:"units"`
+	Count     int                 `yaml:"count" compact:"keep"`
+	Exposed   bool                `yaml:"exposed"`
+	Series    string              `yaml:"series"`
+	Channel   *string             `yaml:"channel"`
+	Labels    map[string]string   `yaml:"labels"`
+	Machines  []map[string]string `yaml:"machines"`
+	Relations map[string][]string `yaml:"relations"`
+}{
+	Name:      "wordpress",
+	Labels:    map[string]string{"tier": "web", "owner": ""},
+	Machines:  []map[string]string{{"id": ""}, {"id": "1"}},
+	Relations: map[string][]string{"db": {}},
+}
+
 var outputTests = map[string][]struct {
 	value  interface{}
 	output string
@@ -95,6 +121,46 @@ var outputTests = map[string][]struct {
 		{[]string{}, `[]` + "\n"},
 		{[]string{"blam", "dink"}, `["blam","dink"]` + "\n"},
 		{defaultValue, `{"Juju":1,"Puppet":false}` + "\n"},
+		{"<a href=\"x?y&z\">", `"<a href=\"x?y&z\">"` + "\n"},
+	},
+	"json-indent": {
+		{nil, "null\n"},
+		{[]string{}, `[]` + "\n"},
+		{[]string{"blam", "dink"}, "[\n  \"blam\",\n  \"dink\"\n]\n"},
+		{defaultValue, "{\n  \"Juju\": 1,\n  \"Puppet\": false\n}\n"},
+		{"<&>", `"<&>"` + "\n"},
+	},
+	"xml": {
+		{nil, ""},
+		{"", "<result></result>\n"},
+		{1, "<result>1</result>\n"},
+		{true, "<result>true</result>\n"},
+		{"<a & b>", "<result>&lt;a &amp; b&gt;</result>\n"},
+		{[]string{"blam", "dink"}, "<result>\n  <item>blam</item>\n  <item>dink</item>\n</result>\n"},
+		{defaultValue, "<result>\n  <Juju>1</Juju>\n  <Puppet>false</Puppet>\n</result>\n"},
+		{
+			map[string]interface{}{"foo": "bar", "baz": []int{1}},
+			"<result>\n" +
+				"  <entry key=\"baz\">\n" +
+				"    <item>1</item>\n" +
+				"  </entry>\n" +
+				"  <entry key=\"foo\">bar</entry>\n" +
+				"</result>\n",
+		},
+		{
+			struct {
+				Name    string            `xml:"name,attr"`
+				Units   []string          `xml:"unit"`
+				Config  map[string]string `xml:"config,omitempty"`
+				Exposed *bool             `xml:"exposed,omitempty"`
+				Ignored string            `xml:"-"`
+			}{Name: "mysql", Units: []string{"mysql/0"}, Ignored: "x"},
+			"<result name=\"mysql\">\n" +
+				"  <unit>\n" +
+				"    <item>mysql/0</item>\n" +
+				"  </unit>\n" +
+				"</result>\n",
+		},
 	},
 	"yaml": {
 		{nil, ""},
@@ -111,6 +177,44 @@ var outputTests = map[string][]struct {
 		{[]string{"blam", "dink"}, "- blam\n- dink\n"},
 		{defaultValue, "juju: 1\npuppet: false\n"},
 	},
+	"yaml:compact": {
+		{nil, ""},
+		{"", `""` + "\n"},
+		{0, "0\n"},
+		{[]string{"blam", ""}, "- blam\n- \"\"\n"},
+		{defaultValue, "juju: 1\n"},
+		{compactValue, "name: wordpress\ncount: 0\nlabels:\n  tier: web\nmachines:\n- {}\n- id: \"1\"\n"},
+	},
+	"smart:compact": {
+		{"", ""},
+		{true, "True\n"},
+		{[]string{"blam", "dink"}, "blam\ndink\n"},
+		{compactValue, "name: wordpress\ncount: 0\nlabels:\n  tier: web\nmachines:\n- {}\n- id: \"1\"\n"},
+		{map[string]interface{}{"a": nil, "b": []int{}, "c": map[string]string{}, "d": 0, "e": 0.0, "f": false}, "{}\n"},
+		{map[string]interface{}{"a": 0, "b": []int{0}}, "b:\n- 0\n"},
+	},
+	"table": {
+		{nil, ""},
+		{[]interface{}{}, ""},
+		{
+			[]struct {
+				Name   string
+				Status string
+			}{{"mysql", "started"}, {"wordpress", "pending"}},
+			"Name       Status\n" +
+				"mysql      started\n" +
+				"wordpress  pending\n",
+		},
+		{
+			[]map[string]interface{}{
+				{"name": "mysql", "units": 3},
+				{"name": "wordpress", "exposed": true},
+			},
+			"exposed  name       units\n" +
+				"         mysql      3\n" +
+				"true     wordpress\n",
+		},
+	},
 }
 
 func (s *CmdSuite) TestOutputFormat(c *gc.C) {
@@ -131,12 +235,276 @@ func (s *CmdSuite) TestOutputFormat(c *gc.C) {
 	}
 }
 
+func (s *CmdSuite) TestCompactOutputFormatUnsupported(c *gc.C) {
+	ctx := cmdtesting.Context(c)
+	result := cmd.Main(&OutputCommand{}, ctx, []string{"--format", "json:compact"})
+	c.Check(result, gc.Equals, 2)
+	c.Check(bufferString(ctx.Stderr), gc.Matches, ".*: unknown format \"json:compact\", expected one of .*\n(?s).*")
+}
+
 func (s *CmdSuite) TestUnknownOutputFormat(c *gc.C) {
 	ctx := cmdtesting.Context(c)
 	result := cmd.Main(&OutputCommand{}, ctx, []string{"--format", "cuneiform"})
 	c.Check(result, gc.Equals, 2)
 	c.Check(bufferString(ctx.Stdout), gc.Equals, "")
-	c.Check(bufferString(ctx.Stderr), gc.Matches, ".*: unknown format \"cuneiform\"\n")
+	c.Check(bufferString(ctx.Stderr), gc.Matches, ".*: unknown format \"cuneiform\", expected one of \\(csv\\|json\\|.*\\|yaml\\)\nUsage: output .*\n")
+}
+
+var csvTests = []struct {
+	value interface{}
+	csv   string
+	tsv   string
+}{{
+	value: []struct {
+		Name  string
+		Units int
+	}{{"mysql", 3}, {"wordpress", 1}},
+	csv: "Name,Units\nmysql,3\nwordpress,1\n",
+	tsv: "Name\tUnits\nmysql\t3\nwordpress\t1\n",
+}, {
+	value: []map[string]string{
+		{"name": "mysql", "message": `says "hello", world`},
+		{"name": "wordpress", "exposed": "true", "message": "line one\nline two"},
+	},
+	csv: "exposed,message,name\n" +
+		`,"says ""hello"", world",mysql` + "\n" +
+		`true,"line one` + "\n" + `line two",wordpress` + "\n",
+	tsv: "exposed\tmessage\tname\n" +
+		`	"says ""hello"", world"	mysql` + "\n" +
+		`true	"line one` + "\n" + `line two"	wordpress` + "\n",
+}}
+
+func (s *CmdSuite) TestFormatCsv(c *gc.C) {
+	for i, t := range csvTests {
+		c.Logf("test %d", i)
+		for format, output := range map[string]string{"csv": t.csv, "tsv": t.tsv} {
+			ctx := cmdtesting.Context(c)
+			result := cmd.Main(&OutputCommand{value: t.value}, ctx, []string{"--format", format})
+			c.Check(result, gc.Equals, 0)
+			c.Check(bufferString(ctx.Stdout), gc.Equals, output)
+			c.Check(bufferString(ctx.Stderr), gc.Equals, "")
+		}
+	}
+}
+
+func (s *CmdSuite) TestTabularFormatUnsupported(c *gc.C) {
+	for i, value := range []interface{}{
+		"hello",
+		[]string{"blam", "dink"},
+		[]interface{}{defaultValue, map[string]int{"juju": 1}},
+	} {
+		c.Logf("test %d", i)
+		_, err := cmd.FormatTable(value)
+		c.Check(err, gc.ErrorMatches, "cannot tabulate .*")
+		_, err = cmd.FormatCsv(value)
+		c.Check(err, gc.ErrorMatches, "cannot tabulate .*")
+	}
+}
+
+func (s *CmdSuite) TestFormatSmartTerminal(c *gc.C) {
+	value := []struct {
+		Name   string
+		Status string
+	}{{"mysql", "started"}, {"wordpress", "pending"}}
+	result, err := cmd.FormatSmart(value, true)
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(result), gc.Equals, `
+Name       Status
+mysql      started
+wordpress  pending`[1:])
+
+	// Elsewhere the output is unchanged, so that scripts can rely on it.
+	result, err = cmd.FormatSmart(value, false)
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(result), gc.Equals, `
+- name: mysql
+  status: started
+- name: wordpress
+  status: pending`[1:])
+
+	// Values that cannot be shown as a table are formatted as usual.
+	result, err = cmd.FormatSmart([]string{"blam", "dink"}, true)
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(result), gc.Equals, "blam\ndink")
+}
+
+func (s *CmdSuite) TestFormatSmartNested(c *gc.C) {
+	value := map[string]interface{}{
+		"name": "wordpress",
+		"charm": map[string]interface{}{
+			"revision": 3,
+			"source":   "store",
+		},
+		"units": []interface{}{
+			map[string]interface{}{"name": "wordpress/0", "ports": []int{80, 443}},
+			"wordpress/1",
+		},
+		"nested": [][]string{{"a", "b"}, {}},
+	}
+	for _, isTerminal := range []bool{false, true} {
+		result, err := cmd.FormatSmart(value, isTerminal)
+		c.Assert(err, gc.IsNil)
+		c.Check(string(result), gc.Equals, `
+charm:
+  revision: 3
+  source: store
+name: wordpress
+nested:
+- - a
+  - b
+- []
+units:
+- name: wordpress/0
+  ports:
+  - 80
+  - 443
+- wordpress/1`[1:])
+	}
+
+	// A table cannot show nested values, so they are not tabulated on
+	// a terminal either.
+	units := []struct {
+		Name  string
+		Ports []int
+	}{{"mysql/0", []int{3306}}}
+	result, err := cmd.FormatSmart(units, true)
+	c.Assert(err, gc.IsNil)
+	c.Check(string(result), gc.Equals, `
+- name: mysql/0
+  ports:
+  - 3306`[1:])
+
+	// Scalars are shown bare.
+	result, err = cmd.FormatSmart(42, true)
+	c.Assert(err, gc.IsNil)
+	c.Check(string(result), gc.Equals, "42")
+}
+
+func (s *CmdSuite) TestIgnoreTerminal(c *gc.C) {
+	formatter := cmd.IgnoreTerminal(cmd.FormatJson)
+	for _, isTerminal := range []bool{false, true} {
+		result, err := formatter([]string{"blam"}, isTerminal)
+		c.Assert(err, gc.IsNil)
+		c.Assert(string(result), gc.Equals, `["blam"]`)
+	}
+}
+
+func (s *CmdSuite) TestFormatYamlSorted(c *gc.C) {
+	value := struct {
+		Zebra    int
+		Units    []map[string]interface{}
+		Aardvark map[string]interface{}
+	}{
+		Zebra: 1,
+		Units: []map[string]interface{}{
+			{"name": "mysql/0", "exposed": true, "machine": "0"},
+		},
+		Aardvark: map[string]interface{}{
+			"b10": 1,
+			"b2":  2,
+			"a": map[interface{}]interface{}{
+				"z": "last",
+				"m": "middle",
+			},
+		},
+	}
+	result, err := cmd.FormatYamlSorted(value)
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(result), gc.Equals, `
+aardvark:
+  a:
+    m: middle
+    z: last
+  b10: 1
+  b2: 2
+units:
+- exposed: true
+  machine: "0"
+  name: mysql/0
+zebra: 1`[1:])
+
+	result, err = cmd.FormatYamlSorted(nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(result, gc.IsNil)
+}
+
+func (s *CmdSuite) TestAddFlagsDefaultFormat(c *gc.C) {
+	var out cmd.Output
+	f := cmdtesting.NewFlagSet()
+	err := out.AddFlagsWithDefault(f, "json", cmd.DefaultFormatters)
+	c.Assert(err, gc.IsNil)
+	c.Assert(out.Name(), gc.Equals, "json")
+	c.Assert(f.Lookup("format").DefValue, gc.Equals, "json")
+
+	help := (&cmd.Info{Name: "output"}).Help(f)
+	c.Assert(string(help), gc.Matches, `(?s).*--format \(= json\)\n    Specify output format\s+\(csv\|json\|json-indent\|smart\|table\|template\|tsv\|xml\|yaml\)\n.*`)
+}
+
+func (s *CmdSuite) TestAddFlagsUnknownDefaultFormat(c *gc.C) {
+	var out cmd.Output
+	f := cmdtesting.NewFlagSet()
+	formatters := map[string]cmd.Formatter{
+		"json": cmd.IgnoreTerminal(cmd.FormatJson),
+		"yaml": cmd.IgnoreTerminal(cmd.FormatYaml),
+	}
+	err := out.AddFlagsWithDefault(f, "cuneiform", formatters)
+	c.Assert(err, gc.ErrorMatches, `default format "cuneiform" is not one of \(json\|yaml\)`)
+	c.Assert(f.Lookup("format"), gc.IsNil)
+
+	c.Assert(func() { out.AddFlags(f, "cuneiform", formatters) }, gc.PanicMatches, `default format "cuneiform" is not one of \(json\|yaml\)`)
+}
+
+func (s *CmdSuite) TestFormatTemplate(c *gc.C) {
+	value := []struct {
+		Name   string
+		Status string
+		Units  []string
+	}{{"mysql", "started", []string{"mysql/0"}}, {"wordpress", "pending", []string{"wordpress/0", "wordpress/1"}}}
+	ctx := cmdtesting.Context(c)
+	result := cmd.Main(&OutputCommand{value: value}, ctx, []string{
+		"--format", `template={{range .}}{{.Name}} {{upper .Status}} {{join .Units ","}}` + "\n" + `{{end}}`,
+	})
+	c.Check(result, gc.Equals, 0)
+	c.Check(bufferString(ctx.Stdout), gc.Equals, "mysql STARTED mysql/0\nwordpress PENDING wordpress/0,wordpress/1\n\n")
+	c.Check(bufferString(ctx.Stderr), gc.Equals, "")
+}
+
+func (s *CmdSuite) TestFormatTemplateExecError(c *gc.C) {
+	ctx := cmdtesting.Context(c)
+	result := cmd.Main(&OutputCommand{value: defaultValue}, ctx, []string{"--format", "template={{.Missing}}"})
+	c.Check(result, gc.Equals, 1)
+	c.Check(bufferString(ctx.Stdout), gc.Equals, "")
+	c.Check(bufferString(ctx.Stderr), gc.Matches, "error: .*can't evaluate field Missing.*\n")
+}
+
+func (s *CmdSuite) TestFormatTemplateInvalid(c *gc.C) {
+	for i, t := range []struct {
+		format string
+		err    string
+	}{{
+		format: "template",
+		err:    `.*: template format requires a template, for example template='{{.Name}}'\nUsage: output .*\n`,
+	}, {
+		format: "template={{.Name",
+		err:    `.*: invalid format template: .*\nUsage: output .*\n`,
+	}} {
+		c.Logf("test %d", i)
+		ctx := cmdtesting.Context(c)
+		result := cmd.Main(&OutputCommand{}, ctx, []string{"--format", t.format})
+		c.Check(result, gc.Equals, 2)
+		c.Check(bufferString(ctx.Stdout), gc.Equals, "")
+		c.Check(bufferString(ctx.Stderr), gc.Matches, t.err)
+	}
+}
+
+func (s *CmdSuite) TestFormatTemplateNotOffered(c *gc.C) {
+	var out cmd.Output
+	f := cmdtesting.NewFlagSet()
+	out.AddFlags(f, "json", map[string]cmd.Formatter{
+		"json": cmd.IgnoreTerminal(cmd.FormatJson),
+	})
+	err := f.Parse(false, []string{"--format", "template={{.}}"})
+	c.Assert(err, gc.ErrorMatches, `.*unknown format "template={{.}}", expected one of \(json\)`)
 }
 
 // Py juju allowed both --format json and --format=json. This test verifies that juju is
@@ -149,3 +517,308 @@ func (s *CmdSuite) TestFormatAlternativeSyntax(c *gc.C) {
 	c.Assert(result, gc.Equals, 0)
 	c.Assert(bufferString(ctx.Stdout), gc.Equals, "null\n")
 }
+
+// StreamCommand writes its items to an OutputStream one at a time.
+type StreamCommand struct {
+	OutputCommand
+	items []interface{}
+}
+
+func (c *StreamCommand) Run(ctx *cmd.Context) error {
+	stream, err := c.out.Stream(ctx)
+	if err != nil {
+		return err
+	}
+	for _, item := range c.items {
+		if err := stream.Write(item); err != nil {
+			stream.Close()
+			return err
+		}
+	}
+	return stream.Close()
+}
+
+func (s *CmdSuite) TestOutputStream(c *gc.C) {
+	items := []interface{}{"a<b", defaultValue, []string{"x"}}
+	for i, test := range []struct {
+		format string
+		items  []interface{}
+		output string
+	}{{
+		format: "json",
+		items:  items,
+		output: `["a<b",{"Juju":1,"Puppet":false},["x"]]` + "\n",
+	}, {
+		format: "json",
+		output: "[]\n",
+	}, {
+		format: "json-indent",
+		items:  items,
+		output: "[\n" +
+			"  \"a<b\",\n" +
+			"  {\n" +
+			"    \"Juju\": 1,\n" +
+			"    \"Puppet\": false\n" +
+			"  },\n" +
+			"  [\n" +
+			"    \"x\"\n" +
+			"  ]\n" +
+			"]\n",
+	}, {
+		format: "json-indent",
+		output: "[]\n",
+	}, {
+		format: "yaml",
+		items:  items,
+		output: "---\na<b\n---\njuju: 1\npuppet: false\n---\n- x\n",
+	}, {
+		format: "yaml",
+		output: "",
+	}, {
+		format: "smart",
+		items:  []interface{}{"a", "b"},
+		output: "- a\n- b\n",
+	}, {
+		format: "csv",
+		items:  []interface{}{defaultValue},
+		output: "Juju,Puppet\n1,false\n",
+	}, {
+		format: "csv",
+		output: "",
+	}} {
+		c.Logf("test %d: %s", i, test.format)
+		ctx := cmdtesting.Context(c)
+		result := cmd.Main(&StreamCommand{items: test.items}, ctx, []string{"--format", test.format})
+		c.Check(result, gc.Equals, 0)
+		cmdtesting.CheckOutput(c, ctx, test.output, "")
+	}
+}
+
+func (s *CmdSuite) TestOutputStreamMatchesWrite(c *gc.C) {
+	items := []interface{}{"a", defaultValue, map[string]int{"b": 2}}
+	for _, format := range []string{"json", "json-indent"} {
+		c.Logf("format %s", format)
+		ctx := cmdtesting.Context(c)
+		result := cmd.Main(&OutputCommand{value: items}, ctx, []string{"--format", format})
+		c.Assert(result, gc.Equals, 0)
+		streamCtx := cmdtesting.Context(c)
+		result = cmd.Main(&StreamCommand{items: items}, streamCtx, []string{"--format", format})
+		c.Assert(result, gc.Equals, 0)
+		c.Check(bufferString(streamCtx.Stdout), gc.Equals, bufferString(ctx.Stdout))
+	}
+}
+
+// replacedJsonCommand streams its items with its own json formatter in
+// place of the default one, and the default one under another name.
+type replacedJsonCommand struct {
+	StreamCommand
+}
+
+func (c *replacedJsonCommand) SetFlags(f *gnuflag.FlagSet) {
+	c.out.AddFormatter("json", cmd.IgnoreTerminal(func(value interface{}) ([]byte, error) {
+		return []byte(fmt.Sprintf("custom %v", value)), nil
+	}))
+	c.out.AddFormatter("plain-json", cmd.DefaultFormatters["json"])
+	c.out.AddFlags(f, "smart", cmd.DefaultFormatters)
+}
+
+func (s *CmdSuite) TestOutputStreamReplacedFormatter(c *gc.C) {
+	for i, test := range []struct {
+		format string
+		output string
+	}{
+		{"json", "custom [1 2]\n"},
+		{"plain-json", "[1,2]\n"},
+	} {
+		c.Logf("test %d: %s", i, test.format)
+		ctx := cmdtesting.Context(c)
+		command := &replacedJsonCommand{StreamCommand{items: []interface{}{1, 2}}}
+		result := cmd.Main(command, ctx, []string{"--format", test.format})
+		c.Check(result, gc.Equals, 0)
+		cmdtesting.CheckOutput(c, ctx, test.output, "")
+	}
+}
+
+func (s *CmdSuite) TestOutputStreamRenamedDefaultFormatter(c *gc.C) {
+	// The json formatter is still streamed under another name, so the
+	// first item has been written when the second fails to be encoded,
+	// and StreamCommand closes the array.
+	ctx := cmdtesting.Context(c)
+	command := &replacedJsonCommand{StreamCommand{items: []interface{}{1, make(chan int)}}}
+	result := cmd.Main(command, ctx, []string{"--format", "plain-json"})
+	c.Check(result, gc.Equals, 1)
+	c.Check(bufferString(ctx.Stdout), gc.Equals, "[1]\n")
+}
+
+func (s *CmdSuite) TestOutputStreamToFile(c *gc.C) {
+	ctx := cmdtesting.Context(c)
+	result := cmd.Main(&StreamCommand{items: []interface{}{1, 2}}, ctx, []string{"--format", "json", "-o", "out.json"})
+	c.Assert(result, gc.Equals, 0)
+	cmdtesting.CheckOutput(c, ctx, "", "")
+	data, err := ioutil.ReadFile(filepath.Join(ctx.Dir, "out.json"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, "[1,2]\n")
+}
+
+func (s *CmdSuite) TestOutputFile(c *gc.C) {
+	ctx := cmdtesting.Context(c)
+	path := filepath.Join(ctx.Dir, "out.yaml")
+	err := ioutil.WriteFile(path, []byte("some much longer existing content\n"), 0644)
+	c.Assert(err, gc.IsNil)
+	result := cmd.Main(&OutputCommand{value: "hello"}, ctx, []string{"--output", "out.yaml"})
+	c.Assert(result, gc.Equals, 0)
+	cmdtesting.CheckOutput(c, ctx, "", "")
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, gc.IsNil)
+	c.Assert(string(data), gc.Equals, "hello\n")
+}
+
+func (s *CmdSuite) TestOutputFileStdout(c *gc.C) {
+	ctx := cmdtesting.Context(c)
+	result := cmd.Main(&OutputCommand{value: "hello"}, ctx, []string{"-o", "-"})
+	c.Assert(result, gc.Equals, 0)
+	cmdtesting.CheckOutput(c, ctx, "hello\n", "")
+	_, err := os.Stat(filepath.Join(ctx.Dir, "-"))
+	c.Assert(os.IsNotExist(err), gc.Equals, true)
+}
+
+func (s *CmdSuite) TestOutputFileCannotCreate(c *gc.C) {
+	ctx := cmdtesting.Context(c)
+	result := cmd.Main(&OutputCommand{value: "hello"}, ctx, []string{"-o", "missing/out.yaml"})
+	c.Assert(result, gc.Equals, 1)
+	c.Assert(bufferString(ctx.Stdout), gc.Equals, "")
+	c.Assert(bufferString(ctx.Stderr), gc.Matches, "error: cannot create output file: open .*missing/out.yaml: no such file or directory\n")
+}
+
+// TreeCommand offers its own "tree" format as well as the default ones.
+type TreeCommand struct {
+	OutputCommand
+}
+
+func (c *TreeCommand) SetFlags(f *gnuflag.FlagSet) {
+	c.out.AddFormatter("tree", cmd.IgnoreTerminal(func(value interface{}) ([]byte, error) {
+		return []byte(fmt.Sprintf("`-- %v", value)), nil
+	}))
+	c.out.AddFlags(f, "tree", cmd.DefaultFormatters)
+}
+
+func (s *CmdSuite) TestAddFormatter(c *gc.C) {
+	ctx := cmdtesting.Context(c)
+	result := cmd.Main(&TreeCommand{OutputCommand{value: "root"}}, ctx, nil)
+	c.Assert(result, gc.Equals, 0)
+	cmdtesting.CheckOutput(c, ctx, "`-- root\n", "")
+
+	ctx = cmdtesting.Context(c)
+	result = cmd.Main(&TreeCommand{OutputCommand{value: "root"}}, ctx, []string{"--format", "yaml"})
+	c.Assert(result, gc.Equals, 0)
+	cmdtesting.CheckOutput(c, ctx, "root\n", "")
+
+	ctx = cmdtesting.Context(c)
+	result = cmd.Main(&TreeCommand{}, ctx, []string{"--help"})
+	c.Assert(result, gc.Equals, 0)
+	c.Assert(bufferString(ctx.Stdout), gc.Matches, `(?s).*--format \(= tree\)\n    Specify output format\s+\(csv\|.*\|tree\|tsv\|xml\|yaml\)\n.*`)
+
+	ctx = cmdtesting.Context(c)
+	result = cmd.Main(&TreeCommand{}, ctx, []string{"--format", "forest"})
+	c.Assert(result, gc.Equals, 2)
+	c.Assert(bufferString(ctx.Stderr), gc.Matches, `error: invalid value "forest" for flag --format: unknown format "forest", expected one of \(csv\|.*\|tree\|tsv\|xml\|yaml\)\n(?s).*`)
+
+	// The default formatters are not changed.
+	_, found := cmd.DefaultFormatters["tree"]
+	c.Assert(found, gc.Equals, false)
+}
+
+// failingOutputCommand is an OutputCommand that fails with err.
+type failingOutputCommand struct {
+	OutputCommand
+	err error
+}
+
+func (c *failingOutputCommand) Run(ctx *cmd.Context) error {
+	return c.err
+}
+
+func (s *CmdSuite) TestStructuredErrors(c *gc.C) {
+	for _, test := range []struct {
+		args   []string
+		err    error
+		code   int
+		stderr string
+	}{{
+		args:   []string{"--format", "json"},
+		err:    errors.New("BAM!"),
+		code:   1,
+		stderr: `{"error":"BAM!","code":1}` + "\n",
+	}, {
+		args:   []string{"--format", "yaml"},
+		err:    errors.New("BAM!"),
+		code:   1,
+		stderr: "error: BAM!\ncode: 1\n",
+	}, {
+		args:   []string{"--format", "json"},
+		err:    cmd.NewRcError(3, errors.New("not found")),
+		code:   3,
+		stderr: `{"error":"not found","code":3}` + "\n",
+	}, {
+		args:   []string{"--format", "json", "extra"},
+		code:   2,
+		stderr: `{"error":"unrecognized args: [\"extra\"]; usage: output [options] <something>","code":2}` + "\n",
+	}, {
+		args:   []string{"--format", "smart"},
+		err:    errors.New("BAM!"),
+		code:   1,
+		stderr: "error: BAM!\n",
+	}, {
+		args:   []string{},
+		err:    errors.New("BAM!"),
+		code:   1,
+		stderr: "error: BAM!\n",
+	}} {
+		c.Logf("args %q", test.args)
+		ctx := cmdtesting.Context(c)
+		code := cmd.Main(&failingOutputCommand{err: test.err}, ctx, test.args)
+		c.Check(code, gc.Equals, test.code)
+		cmdtesting.CheckOutput(c, ctx, "", test.stderr)
+	}
+}
+
+// failingReplacedJsonCommand is a replacedJsonCommand that fails with
+// err.
+type failingReplacedJsonCommand struct {
+	replacedJsonCommand
+	err error
+}
+
+func (c *failingReplacedJsonCommand) Run(ctx *cmd.Context) error {
+	return c.err
+}
+
+func (s *CmdSuite) TestStructuredErrorsByFormatter(c *gc.C) {
+	for i, test := range []struct {
+		format string
+		stderr string
+	}{
+		{"json", "error: BAM!\n"},
+		{"plain-json", `{"error":"BAM!","code":1}` + "\n"},
+	} {
+		c.Logf("test %d: %s", i, test.format)
+		ctx := cmdtesting.Context(c)
+		command := &failingReplacedJsonCommand{err: errors.New("BAM!")}
+		code := cmd.Main(command, ctx, []string{"--format", test.format})
+		c.Check(code, gc.Equals, 1)
+		cmdtesting.CheckOutput(c, ctx, "", test.stderr)
+	}
+}
+
+func (s *CmdSuite) TestStructuredErrorsSuperCommand(c *gc.C) {
+	defer loggo.ResetWriters()
+	sc := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name: "jujutest",
+		Log:  &cmd.Log{},
+	})
+	sc.Register(&failingOutputCommand{err: errors.New("BAM!")})
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(sc, ctx, []string{"output", "--format", "json"})
+	c.Check(code, gc.Equals, 1)
+	cmdtesting.CheckOutput(c, ctx, "", `{"error":"BAM!","code":1}`+"\n")
+}
@@ -0,0 +1,121 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// spillThreshold is the number of bytes that an outputBuffer holds in
+// memory before moving them to a temporary file. It is a variable so that
+// tests can change it.
+var spillThreshold = 1 << 20
+
+// outputBuffer is an io.Writer that holds what is written to it until it
+// is flushed to w or discarded. Once it holds more than spillThreshold
+// bytes, it keeps them in a temporary file instead of in memory.
+type outputBuffer struct {
+	w    io.Writer
+	mem  bytes.Buffer
+	file *os.File
+	// streaming is set once the buffer has been flushed by
+	// StreamOutput, after which writes go straight to w.
+	streaming bool
+}
+
+func (b *outputBuffer) Write(p []byte) (int, error) {
+	if b.streaming {
+		return b.w.Write(p)
+	}
+	if b.file == nil && b.mem.Len()+len(p) > spillThreshold {
+		if err := b.spill(); err != nil {
+			return 0, err
+		}
+	}
+	if b.file != nil {
+		return b.file.Write(p)
+	}
+	return b.mem.Write(p)
+}
+
+// spill moves what is held in memory to a new temporary file.
+func (b *outputBuffer) spill() error {
+	f, err := ioutil.TempFile("", "cmd-output-")
+	if err != nil {
+		return fmt.Errorf("cannot buffer output: %v", err)
+	}
+	if _, err := b.mem.WriteTo(f); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return fmt.Errorf("cannot buffer output: %v", err)
+	}
+	b.file = f
+	return nil
+}
+
+// flush writes everything held to w.
+func (b *outputBuffer) flush() error {
+	defer b.discard()
+	if b.file == nil {
+		_, err := b.mem.WriteTo(b.w)
+		return err
+	}
+	if _, err := b.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("cannot read buffered output: %v", err)
+	}
+	_, err := io.Copy(b.w, b.file)
+	return err
+}
+
+// discard throws away everything held, removing any temporary file.
+func (b *outputBuffer) discard() {
+	b.mem.Reset()
+	if b.file != nil {
+		b.file.Close()
+		os.Remove(b.file.Name())
+		b.file = nil
+	}
+}
+
+// StreamOutput writes anything held back from Stdout by a SuperCommand
+// created with AtomicOutput, and stops holding back what is written to
+// Stdout from then on. Commands that stream more output than can be held
+// until they finish call it before they start writing; Output.Stream
+// calls it for them. It does nothing if Stdout is not being held back.
+func (ctx *Context) StreamOutput() error {
+	if ctx.outputBuffer == nil || ctx.outputBuffer.streaming {
+		return nil
+	}
+	ctx.outputBuffer.streaming = true
+	return ctx.outputBuffer.flush()
+}
+
+// runBuffered runs the selected subcommand like runHooked. If the
+// SuperCommand was created with AtomicOutput and a machine readable
+// format has been chosen, what the subcommand writes to Stdout is held
+// until it has finished, then written if it succeeded or thrown away if
+// it failed.
+func (c *SuperCommand) runBuffered(ctx *Context) error {
+	if !c.atomicOutput || ctx.errorFormatter == nil || ctx.outputBuffer != nil {
+		return c.runHooked(ctx)
+	}
+	stdout := ctx.Stdout
+	buf := &outputBuffer{w: stdout}
+	ctx.Stdout, ctx.outputBuffer = buf, buf
+	defer func() {
+		ctx.Stdout, ctx.outputBuffer = stdout, nil
+	}()
+	if err := c.runHooked(ctx); err != nil {
+		buf.discard()
+		return err
+	}
+	if buf.streaming {
+		return nil
+	}
+	return buf.flush()
+}
@@ -0,0 +1,138 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+
+	gitjujutesting "github.com/juju/testing"
+	gc "gopkg.in/check.v1"
+	"launchpad.net/gnuflag"
+)
+
+type OutputBufferSuite struct {
+	gitjujutesting.IsolationSuite
+}
+
+var _ = gc.Suite(&OutputBufferSuite{})
+
+// reportCommand writes a number of reports, failing after the given
+// number of them if fail is set.
+type reportCommand struct {
+	CommandBase
+	out     Output
+	reports int
+	fail    bool
+	stream  bool
+}
+
+func (c *reportCommand) Info() *Info {
+	return &Info{Name: "report"}
+}
+
+func (c *reportCommand) SetFlags(f *gnuflag.FlagSet) {
+	c.out.AddFlags(f, "smart", DefaultFormatters)
+}
+
+func (c *reportCommand) Run(ctx *Context) error {
+	if c.stream {
+		s, err := c.out.Stream(ctx)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < c.reports; i++ {
+			if err := s.Write(i); err != nil {
+				return err
+			}
+		}
+		if c.fail {
+			return errors.New("report failed")
+		}
+		return s.Close()
+	}
+	for i := 0; i < c.reports; i++ {
+		if err := c.out.Write(ctx, i); err != nil {
+			return err
+		}
+	}
+	if c.fail {
+		return errors.New("report failed")
+	}
+	return nil
+}
+
+func (s *OutputBufferSuite) run(c *gc.C, atomic bool, report *reportCommand, args ...string) (int, string) {
+	jc := NewSuperCommand(SuperCommandParams{
+		Name:         "jujutest",
+		AtomicOutput: atomic,
+	})
+	jc.Register(report)
+	var stdout bytes.Buffer
+	ctx := &Context{
+		Stdin:  &bytes.Buffer{},
+		Stdout: &stdout,
+		Stderr: &bytes.Buffer{},
+	}
+	code := Main(jc, ctx, args)
+	c.Check(ctx.Stdout, gc.Equals, &stdout)
+	return code, stdout.String()
+}
+
+func (s *OutputBufferSuite) TestAtomicOutput(c *gc.C) {
+	for i, test := range []struct {
+		atomic bool
+		fail   bool
+		args   []string
+		stdout string
+	}{
+		{atomic: true, args: []string{"report", "--format", "json"}, stdout: "0\n1\n"},
+		{atomic: true, fail: true, args: []string{"report", "--format", "json"}, stdout: ""},
+		{atomic: false, fail: true, args: []string{"report", "--format", "json"}, stdout: "0\n1\n"},
+		// Output for people is not held back.
+		{atomic: true, fail: true, args: []string{"report"}, stdout: "0\n1\n"},
+	} {
+		c.Logf("test %d: atomic %v, fail %v, %q", i, test.atomic, test.fail, test.args)
+		code, stdout := s.run(c, test.atomic, &reportCommand{reports: 2, fail: test.fail}, test.args...)
+		if test.fail {
+			c.Check(code, gc.Equals, 1)
+		} else {
+			c.Check(code, gc.Equals, 0)
+		}
+		c.Check(stdout, gc.Equals, test.stdout)
+	}
+}
+
+func (s *OutputBufferSuite) TestAtomicOutputSpills(c *gc.C) {
+	s.PatchValue(&spillThreshold, 4)
+	code, stdout := s.run(c, true, &reportCommand{reports: 5}, "report", "--format", "json")
+	c.Check(code, gc.Equals, 0)
+	c.Check(stdout, gc.Equals, "0\n1\n2\n3\n4\n")
+
+	code, stdout = s.run(c, true, &reportCommand{reports: 5, fail: true}, "report", "--format", "json")
+	c.Check(code, gc.Equals, 1)
+	c.Check(stdout, gc.Equals, "")
+}
+
+func (s *OutputBufferSuite) TestStreamNotHeldBack(c *gc.C) {
+	code, stdout := s.run(c, true, &reportCommand{reports: 2, fail: true, stream: true}, "report", "--format", "json")
+	c.Check(code, gc.Equals, 1)
+	c.Check(stdout, gc.Equals, "[0,1")
+}
+
+func (s *OutputBufferSuite) TestOutputBufferDiscard(c *gc.C) {
+	s.PatchValue(&spillThreshold, 4)
+	var target bytes.Buffer
+	buf := &outputBuffer{w: &target}
+	_, err := buf.Write([]byte(strings.Repeat("x", 10)))
+	c.Assert(err, gc.IsNil)
+	c.Assert(buf.file, gc.NotNil)
+	name := buf.file.Name()
+	buf.discard()
+	c.Check(target.String(), gc.Equals, "")
+	_, err = os.Stat(name)
+	c.Check(os.IsNotExist(err), gc.Equals, true)
+}
@@ -0,0 +1,75 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// pagerCommand returns the command line of the pager that long output
+// written to Stdout should be piped through, or nil if it should not be
+// paged. Output is only paged when Stdout is a terminal, using $PAGER if
+// it is set, or else less or more. Setting $PAGER to "cat" or to an
+// empty string disables paging.
+func (ctx *Context) pagerCommand() []string {
+	if ctx.noPager || !isTerminalWriter(ctx.Stdout) {
+		return nil
+	}
+	if pager, ok := ctx.lookupEnv("PAGER"); ok {
+		if args := strings.Fields(pager); len(args) > 0 && args[0] != "cat" {
+			return args
+		}
+		return nil
+	}
+	for _, args := range [][]string{{"less", "-R"}, {"more"}} {
+		if _, err := lookPath(args[0]); err == nil {
+			return args
+		}
+	}
+	return nil
+}
+
+// lookPath is used to find the default pagers. It is a variable so that
+// tests can pretend that they are not installed.
+var lookPath = exec.LookPath
+
+// writePaged writes data to Stdout, through a pager if one is chosen by
+// pagerCommand. The user may quit the pager before reading all of the
+// output, so errors writing to it are ignored; if the pager cannot be
+// started at all, data is written to Stdout directly.
+func (ctx *Context) writePaged(data []byte) {
+	args := ctx.pagerCommand()
+	if args == nil {
+		ctx.Stdout.Write(data)
+		return
+	}
+	pager := exec.Command(args[0], args[1:]...)
+	pager.Dir = ctx.Dir
+	pager.Stdout = ctx.Stdout
+	pager.Stderr = ctx.Stderr
+	pager.Env = os.Environ()
+	if _, ok := ctx.lookupEnv("LESS"); !ok {
+		// Like git, have less quit if the output fits on one screen
+		// and pass colors through.
+		pager.Env = append(pager.Env, "LESS=FRX")
+	}
+	for key, value := range ctx.Env {
+		pager.Env = append(pager.Env, key+"="+value)
+	}
+	stdin, err := pager.StdinPipe()
+	if err != nil {
+		ctx.Stdout.Write(data)
+		return
+	}
+	if err := pager.Start(); err != nil {
+		logger.Debugf("cannot start pager %q: %v", args[0], err)
+		ctx.Stdout.Write(data)
+		return
+	}
+	stdin.Write(data)
+	stdin.Close()
+	pager.Wait()
+}
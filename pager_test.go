@@ -0,0 +1,138 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	gitjujutesting "github.com/juju/testing"
+	gc "gopkg.in/check.v1"
+)
+
+type PagerSuite struct {
+	gitjujutesting.IsolationSuite
+}
+
+var _ = gc.Suite(&PagerSuite{})
+
+func (s *PagerSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	if runtime.GOOS == "windows" {
+		c.Skip("pagers are shell scripts")
+	}
+	s.PatchValue(&isTerminalWriter, func(io.Writer) bool { return true })
+	dir := c.MkDir()
+	s.PatchEnvironment("PATH", dir)
+	s.writePager(c, dir, "prefix", `while read line; do echo "$1$line"; done`)
+	s.writePager(c, dir, "quit", "exit 0")
+}
+
+func (s *PagerSuite) writePager(c *gc.C, dir, name, script string) {
+	err := ioutil.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script+"\n"), 0755)
+	c.Assert(err, gc.IsNil)
+}
+
+func (s *PagerSuite) context(c *gc.C, pager string) (*Context, *bytes.Buffer) {
+	var stdout bytes.Buffer
+	return &Context{
+		Dir:    c.MkDir(),
+		Env:    map[string]string{"PAGER": pager},
+		Stdout: &stdout,
+		Stderr: &bytes.Buffer{},
+	}, &stdout
+}
+
+func (s *PagerSuite) TestWritePaged(c *gc.C) {
+	ctx, stdout := s.context(c, "prefix paged:")
+	ctx.writePaged([]byte("one\ntwo\n"))
+	c.Assert(stdout.String(), gc.Equals, "paged:one\npaged:two\n")
+}
+
+func (s *PagerSuite) TestWritePagedNotTerminal(c *gc.C) {
+	s.PatchValue(&isTerminalWriter, func(io.Writer) bool { return false })
+	ctx, stdout := s.context(c, "prefix paged:")
+	ctx.writePaged([]byte("one\n"))
+	c.Assert(stdout.String(), gc.Equals, "one\n")
+}
+
+func (s *PagerSuite) TestWritePagedDisabled(c *gc.C) {
+	for _, pager := range []string{"", "cat", "  "} {
+		ctx, stdout := s.context(c, pager)
+		ctx.writePaged([]byte("one\n"))
+		c.Check(stdout.String(), gc.Equals, "one\n")
+	}
+}
+
+func (s *PagerSuite) TestWritePagedNoDefaultPager(c *gc.C) {
+	var looked []string
+	s.PatchValue(&lookPath, func(name string) (string, error) {
+		looked = append(looked, name)
+		return "", errors.New("not found")
+	})
+	ctx, stdout := s.context(c, "")
+	delete(ctx.Env, "PAGER")
+	ctx.writePaged([]byte("one\n"))
+	c.Assert(stdout.String(), gc.Equals, "one\n")
+	c.Assert(looked, gc.DeepEquals, []string{"less", "more"})
+}
+
+func (s *PagerSuite) TestWritePagedProcessPagerIgnored(c *gc.C) {
+	s.PatchEnvironment("PAGER", "prefix paged:")
+	ctx, stdout := s.context(c, "")
+	delete(ctx.Env, "PAGER")
+	s.PatchValue(&lookPath, func(name string) (string, error) {
+		return "", errors.New("not found")
+	})
+	ctx.writePaged([]byte("one\n"))
+	c.Assert(stdout.String(), gc.Equals, "one\n")
+}
+
+func (s *PagerSuite) TestWritePagedPagerNotFound(c *gc.C) {
+	ctx, stdout := s.context(c, "no-such-pager-command")
+	ctx.writePaged([]byte("one\n"))
+	c.Assert(stdout.String(), gc.Equals, "one\n")
+}
+
+func (s *PagerSuite) TestWritePagedPagerQuits(c *gc.C) {
+	// The pager exits without reading its input, as it would if the
+	// user quit it early.
+	ctx, stdout := s.context(c, "quit")
+	ctx.writePaged([]byte(strings.Repeat("line\n", 100000)))
+	c.Assert(stdout.String(), gc.Equals, "")
+}
+
+func (s *PagerSuite) TestHelpPaged(c *gc.C) {
+	super := NewSuperCommand(SuperCommandParams{Name: "jujutest", Purpose: "to be purposeful"})
+	ctx, stdout := s.context(c, "prefix paged:")
+	code := Main(super, ctx, []string{"help"})
+	c.Assert(code, gc.Equals, 0)
+	c.Assert(stdout.String(), gc.Matches, "paged:Usage: jujutest .*\n(paged:.*\n)*")
+}
+
+func (s *PagerSuite) TestHelpAllPaged(c *gc.C) {
+	super := NewSuperCommand(SuperCommandParams{Name: "jujutest"})
+	ctx, stdout := s.context(c, "prefix paged:")
+	code := Main(super, ctx, []string{"--help-all"})
+	c.Assert(code, gc.Equals, 0)
+	c.Assert(stdout.String(), gc.Matches, "paged:=== jujutest ===\n(paged:.*\n)*")
+}
+
+func (s *PagerSuite) TestNoPager(c *gc.C) {
+	for _, args := range [][]string{
+		{"--no-pager", "help"},
+		{"--no-pager", "--help-all"},
+	} {
+		super := NewSuperCommand(SuperCommandParams{Name: "jujutest"})
+		ctx, stdout := s.context(c, "prefix paged:")
+		code := Main(super, ctx, args)
+		c.Check(code, gc.Equals, 0)
+		c.Check(stdout.String(), gc.Not(gc.Matches), "(?s).*paged:.*")
+	}
+}
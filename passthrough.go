@@ -0,0 +1,36 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+// PassthroughCommand is implemented by Commands that take the arguments
+// following a bare "--" verbatim, for instance to pass them on to another
+// program, as in "mytool exec -- ls -la". Such commands should say so in
+// their Info's Args, for example "[--] <command> [<args>...]".
+type PassthroughCommand interface {
+	Command
+
+	// SetPassthroughArgs is called before Init with the arguments that
+	// followed the first bare "--", none of which are parsed as flags.
+	// The arguments before it are parsed as usual and passed to Init.
+	// It is called with nil if there was no "--".
+	SetPassthroughArgs(args []string)
+}
+
+// splitPassthroughArgs returns args split at the first bare "--" if c is
+// a PassthroughCommand, giving it the arguments that follow. Otherwise
+// args is returned unchanged.
+func splitPassthroughArgs(c Command, args []string) []string {
+	pc, ok := c.(PassthroughCommand)
+	if !ok {
+		return args
+	}
+	for i, arg := range args {
+		if arg == "--" {
+			pc.SetPassthroughArgs(append([]string(nil), args[i+1:]...))
+			return args[:i]
+		}
+	}
+	pc.SetPassthroughArgs(nil)
+	return args
+}
@@ -0,0 +1,98 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd_test
+
+import (
+	"fmt"
+
+	gc "gopkg.in/check.v1"
+	"launchpad.net/gnuflag"
+
+	"github.com/juju/cmd"
+	"github.com/juju/cmd/cmdtesting"
+)
+
+type PassthroughSuite struct{}
+
+var _ = gc.Suite(&PassthroughSuite{})
+
+// execCommand is a PassthroughCommand that prints its positional and
+// passthrough arguments.
+type execCommand struct {
+	cmd.CommandBase
+	verbose     bool
+	args        []string
+	passthrough []string
+}
+
+func (c *execCommand) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "exec",
+		Args:    "<target> [--] <command> [<args>...]",
+		Purpose: "run a command on a target",
+	}
+}
+
+func (c *execCommand) SetFlags(f *gnuflag.FlagSet) {
+	f.BoolVar(&c.verbose, "v", false, "be verbose")
+}
+
+func (c *execCommand) SetPassthroughArgs(args []string) {
+	c.passthrough = args
+}
+
+func (c *execCommand) Init(args []string) error {
+	c.args = args
+	return nil
+}
+
+func (c *execCommand) Run(ctx *cmd.Context) error {
+	fmt.Fprintf(ctx.Stdout, "verbose=%v args=%q passthrough=%q\n", c.verbose, c.args, c.passthrough)
+	return nil
+}
+
+var passthroughTests = []struct {
+	args   []string
+	output string
+}{{
+	args:   []string{"-v", "target", "--", "ls", "-la", "--", "--help"},
+	output: `verbose=true args=["target"] passthrough=["ls" "-la" "--" "--help"]` + "\n",
+}, {
+	args:   []string{"target", "-v", "--"},
+	output: `verbose=true args=["target"] passthrough=[]` + "\n",
+}, {
+	args:   []string{"target", "-v"},
+	output: `verbose=true args=["target"] passthrough=[]` + "\n",
+}}
+
+func (s *PassthroughSuite) TestMain(c *gc.C) {
+	for i, t := range passthroughTests {
+		c.Logf("test %d: %q", i, t.args)
+		ctx := cmdtesting.Context(c)
+		code := cmd.Main(&execCommand{}, ctx, t.args)
+		c.Check(code, gc.Equals, 0)
+		c.Check(cmdtesting.Stdout(ctx), gc.Equals, t.output)
+	}
+}
+
+func (s *PassthroughSuite) TestSuperCommand(c *gc.C) {
+	for i, t := range passthroughTests {
+		c.Logf("test %d: %q", i, t.args)
+		super := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "mytool"})
+		super.Register(&execCommand{})
+		ctx := cmdtesting.Context(c)
+		code := cmd.Main(super, ctx, append([]string{"exec"}, t.args...))
+		c.Check(code, gc.Equals, 0)
+		c.Check(cmdtesting.Stdout(ctx), gc.Equals, t.output)
+	}
+}
+
+func (s *PassthroughSuite) TestFlagsBeforeSeparatorAreParsed(c *gc.C) {
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(&execCommand{}, ctx, []string{"--unknown", "--", "ls"})
+	c.Check(code, gc.Equals, 2)
+	c.Check(cmdtesting.Stderr(ctx), gc.Equals, ""+
+		"error: flag provided but not defined: --unknown\n"+
+		"Usage: exec [options] <target> [--] <command> [<args>...]\n")
+}
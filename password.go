@@ -0,0 +1,173 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"launchpad.net/gnuflag"
+)
+
+// ErrInterrupted is returned by ReadPassword when the process is
+// interrupted while it waits for the password to be typed.
+var ErrInterrupted = errors.New("interrupted")
+
+// disableEcho turns off the echoing of input on the terminal that r
+// refers to, returning a function that restores its previous state. It is
+// a variable so that tests can pretend to read from a terminal.
+var disableEcho = func(r io.Reader) (restore func(), err error) {
+	f, ok := underlyingReader(r).(*os.File)
+	if !ok {
+		return nil, errors.New("not a terminal")
+	}
+	return fileDisableEcho(f)
+}
+
+// ReadPassword writes prompt to Stderr and reads a line from Stdin
+// without echoing it, returning the line without its line ending. The
+// terminal is restored to its previous state before ReadPassword
+// returns, including when the process is interrupted or the context is
+// cancelled while it waits, in which case it returns ErrInterrupted or
+// the context's error. A line that is being read when ReadPassword stops
+// waiting for it is not lost: Stdin is replaced by a reader that returns
+// that line, once it has been typed, before reading any further, so that
+// it is not taken from later readers of Stdin.
+//
+// When Stdin is not a terminal, ReadPassword reads a line from it without
+// writing the prompt, so that secrets can be piped to commands.
+func (ctx *Context) ReadPassword(prompt string) (string, error) {
+	ctx.ClearProgress()
+	if !ctx.StdinIsTerminal() {
+		return readLine(ctx.Stdin)
+	}
+	fmt.Fprint(ctx.Stderr, prompt)
+	restore, err := disableEcho(ctx.Stdin)
+	if err != nil {
+		fmt.Fprintln(ctx.Stderr)
+		return "", fmt.Errorf("cannot disable echo: %v", err)
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer func() {
+		signal.Stop(signals)
+		restore()
+		// The line ending typed after the password was not echoed.
+		fmt.Fprintln(ctx.Stderr)
+	}()
+	stdin := ctx.Stdin
+	done := make(chan readResult, 1)
+	go func() {
+		data, err := readRawLine(stdin)
+		done <- readResult{data, err}
+	}()
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return "", r.err
+		}
+		return trimLineEnding(r.data), nil
+	case <-signals:
+		err = ErrInterrupted
+	case <-ctx.Context().Done():
+		err = ctx.Context().Err()
+	}
+	ctx.Stdin = &interruptedReader{pending: done, r: stdin}
+	return "", err
+}
+
+// readResult holds what was read by a read that may be abandoned.
+type readResult struct {
+	data []byte
+	err  error
+}
+
+// interruptedReader reads from r, first returning what is read by the
+// read of r that ReadPassword stopped waiting for when it was
+// interrupted, or its error.
+type interruptedReader struct {
+	pending <-chan readResult
+	data    []byte
+	err     error
+	r       io.Reader
+}
+
+func (r *interruptedReader) Read(buf []byte) (int, error) {
+	if r.pending != nil {
+		result := <-r.pending
+		r.pending = nil
+		r.data, r.err = result.data, result.err
+	}
+	if len(r.data) > 0 {
+		n := copy(buf, r.data)
+		r.data = r.data[n:]
+		return n, nil
+	}
+	if r.err != nil {
+		err := r.err
+		r.err = nil
+		return 0, err
+	}
+	return r.r.Read(buf)
+}
+
+// SecretValue implements gnuflag.Value for a sensitive string flag, such
+// as a password or token. If the flag is left empty on the command line
+// and Stdin is a terminal, Main prompts for its value before running the
+// command, without echoing what is typed.
+type SecretValue struct {
+	target *string
+	prompt string
+}
+
+var _ gnuflag.Value = (*SecretValue)(nil)
+
+// SecretVar defines a sensitive string flag with the specified name and
+// usage on f. The prompt is shown when asking for its value.
+func SecretVar(f *gnuflag.FlagSet, p *string, name, prompt, usage string) *SecretValue {
+	*p = ""
+	v := &SecretValue{
+		target: p,
+		prompt: prompt,
+	}
+	f.Var(v, name, usage)
+	return v
+}
+
+// Implements gnuflag.Value Set.
+func (v *SecretValue) Set(s string) error {
+	*v.target = s
+	return nil
+}
+
+// Implements gnuflag.Value String. The value itself is never shown.
+func (v *SecretValue) String() string {
+	if *v.target == "" {
+		return ""
+	}
+	return "********"
+}
+
+// promptSecrets asks for the value of each SecretValue flag in f that is
+// empty, when Stdin is a terminal.
+func promptSecrets(ctx *Context, f *gnuflag.FlagSet) error {
+	if f == nil || !ctx.StdinIsTerminal() {
+		return nil
+	}
+	var err error
+	seen := make(map[*SecretValue]bool)
+	f.VisitAll(func(flag *gnuflag.Flag) {
+		v, ok := flag.Value.(*SecretValue)
+		if !ok || seen[v] || *v.target != "" || err != nil {
+			return
+		}
+		seen[v] = true
+		*v.target, err = ctx.ReadPassword(v.prompt)
+	})
+	return err
+}
@@ -0,0 +1,155 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+
+	gitjujutesting "github.com/juju/testing"
+	gc "gopkg.in/check.v1"
+	"launchpad.net/gnuflag"
+)
+
+type PasswordSuite struct {
+	gitjujutesting.IsolationSuite
+	echo bool
+}
+
+var _ = gc.Suite(&PasswordSuite{})
+
+func (s *PasswordSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.PatchValue(&isTerminalReader, func(io.Reader) bool { return true })
+	s.echo = true
+	s.PatchValue(&disableEcho, func(io.Reader) (func(), error) {
+		s.echo = false
+		return func() { s.echo = true }, nil
+	})
+}
+
+func (s *PasswordSuite) context(input io.Reader) (*Context, *bytes.Buffer) {
+	var stderr bytes.Buffer
+	return &Context{
+		Stdin:  input,
+		Stdout: &bytes.Buffer{},
+		Stderr: &stderr,
+	}, &stderr
+}
+
+func (s *PasswordSuite) TestReadPassword(c *gc.C) {
+	ctx, stderr := s.context(&echoCheckReader{s: s, c: c, input: "s3cret\r\nrest"})
+	password, err := ctx.ReadPassword("Password: ")
+	c.Assert(err, gc.IsNil)
+	c.Check(password, gc.Equals, "s3cret")
+	c.Check(s.echo, gc.Equals, true)
+	c.Check(stderr.String(), gc.Equals, "Password: \n")
+}
+
+func (s *PasswordSuite) TestReadPasswordNotTerminal(c *gc.C) {
+	isTerminalReader = func(io.Reader) bool { return false }
+	ctx, stderr := s.context(bytes.NewBufferString("token\n"))
+	password, err := ctx.ReadPassword("Token: ")
+	c.Assert(err, gc.IsNil)
+	c.Check(password, gc.Equals, "token")
+	c.Check(stderr.String(), gc.Equals, "")
+}
+
+func (s *PasswordSuite) TestReadPasswordCannotDisableEcho(c *gc.C) {
+	disableEcho = func(io.Reader) (func(), error) {
+		return nil, errors.New("not supported on this platform")
+	}
+	ctx, stderr := s.context(bytes.NewBufferString("s3cret\n"))
+	_, err := ctx.ReadPassword("Password: ")
+	c.Assert(err, gc.ErrorMatches, "cannot disable echo: not supported on this platform")
+	c.Check(stderr.String(), gc.Equals, "Password: \n")
+}
+
+func (s *PasswordSuite) TestReadPasswordCancelled(c *gc.C) {
+	reader, writer := io.Pipe()
+	defer writer.Close()
+	ctx, stderr := s.context(reader)
+	cancelCtx, cancel := context.WithCancel(context.Background())
+	ctx.ctx = cancelCtx
+	cancel()
+	_, err := ctx.ReadPassword("Password: ")
+	c.Assert(err, gc.Equals, context.Canceled)
+	c.Check(s.echo, gc.Equals, true)
+	c.Check(stderr.String(), gc.Equals, "Password: \n")
+}
+
+func (s *PasswordSuite) TestReadPasswordCancelledKeepsInput(c *gc.C) {
+	reader, writer := io.Pipe()
+	defer writer.Close()
+	ctx, _ := s.context(reader)
+	cancelCtx, cancel := context.WithCancel(context.Background())
+	ctx.ctx = cancelCtx
+	cancel()
+	_, err := ctx.ReadPassword("Password: ")
+	c.Assert(err, gc.Equals, context.Canceled)
+
+	// The line typed after the read was interrupted is read from Stdin,
+	// along with what follows it.
+	go writer.Write([]byte("later\nmore\n"))
+	ctx.ctx = context.Background()
+	password, err := ctx.ReadPassword("Password: ")
+	c.Assert(err, gc.IsNil)
+	c.Check(password, gc.Equals, "later")
+	line, err := readLine(ctx.Stdin)
+	c.Assert(err, gc.IsNil)
+	c.Check(line, gc.Equals, "more")
+}
+
+func (s *PasswordSuite) TestPromptSecrets(c *gc.C) {
+	var password, token string
+	f := gnuflag.NewFlagSet("", gnuflag.ContinueOnError)
+	SecretVar(f, &password, "password", "Password: ", "")
+	SecretVar(f, &token, "token", "Token: ", "")
+	c.Assert(f.Parse(false, []string{"--token", "abc"}), gc.IsNil)
+	ctx, stderr := s.context(bytes.NewBufferString("s3cret\n"))
+	c.Assert(promptSecrets(ctx, f), gc.IsNil)
+	c.Check(password, gc.Equals, "s3cret")
+	c.Check(token, gc.Equals, "abc")
+	c.Check(stderr.String(), gc.Equals, "Password: \n")
+}
+
+func (s *PasswordSuite) TestPromptSecretsNotTerminal(c *gc.C) {
+	isTerminalReader = func(io.Reader) bool { return false }
+	var password string
+	f := gnuflag.NewFlagSet("", gnuflag.ContinueOnError)
+	SecretVar(f, &password, "password", "Password: ", "")
+	ctx, stderr := s.context(bytes.NewBufferString("s3cret\n"))
+	c.Assert(promptSecrets(ctx, f), gc.IsNil)
+	c.Check(password, gc.Equals, "")
+	c.Check(stderr.String(), gc.Equals, "")
+}
+
+func (s *PasswordSuite) TestSecretValueString(c *gc.C) {
+	var password string
+	f := gnuflag.NewFlagSet("", gnuflag.ContinueOnError)
+	v := SecretVar(f, &password, "password", "Password: ", "")
+	c.Check(v.String(), gc.Equals, "")
+	c.Assert(f.Parse(false, []string{"--password=s3cret"}), gc.IsNil)
+	c.Check(password, gc.Equals, "s3cret")
+	c.Check(v.String(), gc.Equals, "********")
+}
+
+// echoCheckReader checks that echo is disabled while its input is read.
+type echoCheckReader struct {
+	s     *PasswordSuite
+	c     *gc.C
+	input string
+}
+
+func (r *echoCheckReader) Read(buf []byte) (int, error) {
+	r.c.Check(r.s.echo, gc.Equals, false)
+	if r.input == "" {
+		return 0, io.EOF
+	}
+	n := copy(buf, r.input)
+	r.input = r.input[n:]
+	return n, nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// findPlugin returns the path of the executable on $PATH that provides
+// the named plugin for a SuperCommand with the given plugin prefix.
+func findPlugin(prefix, name string) (string, bool) {
+	if prefix == "" || name == "" || strings.ContainsAny(name, `/\`) {
+		return "", false
+	}
+	path, err := exec.LookPath(prefix + name)
+	if err != nil {
+		return "", false
+	}
+	return path, true
+}
+
+// findPlugins returns the paths of the executables on $PATH whose names
+// start with prefix, keyed by the name of the plugin they provide. When
+// a plugin is found in more than one directory, the first is used, as it
+// would be by findPlugin.
+func findPlugins(prefix string) map[string]string {
+	plugins := make(map[string]string)
+	if prefix == "" {
+		return plugins
+	}
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		if dir == "" {
+			dir = "."
+		}
+		infos, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, info := range infos {
+			if info.IsDir() || !strings.HasPrefix(info.Name(), prefix) {
+				continue
+			}
+			name := strings.TrimPrefix(info.Name(), prefix)
+			if runtime.GOOS == "windows" {
+				name = strings.TrimSuffix(name, filepath.Ext(name))
+			}
+			if _, found := plugins[name]; found || name == "" {
+				continue
+			}
+			path, err := exec.LookPath(filepath.Join(dir, info.Name()))
+			if err != nil {
+				continue
+			}
+			plugins[name] = path
+		}
+	}
+	return plugins
+}
+
+// pluginCommand is a Command that runs an external plugin executable,
+// passing it the arguments and the standard streams of the Context.
+type pluginCommand struct {
+	CommandBase
+	name string
+	path string
+	args []string
+}
+
+func (c *pluginCommand) Info() *Info {
+	return &Info{
+		Name:    c.name,
+		Purpose: pluginPurpose(c.path),
+	}
+}
+
+// pluginPurpose returns the purpose shown in help for the plugin provided
+// by the executable at path.
+func pluginPurpose(path string) string {
+	return fmt.Sprintf("plugin provided by %s", filepath.Base(path))
+}
+
+func (c *pluginCommand) Run(ctx *Context) error {
+	command := exec.Command(c.path, c.args...)
+	command.Dir = ctx.Dir
+	command.Stdin = ctx.Stdin
+	command.Stdout = ctx.Stdout
+	command.Stderr = ctx.Stderr
+	if len(ctx.Env) > 0 {
+		env := os.Environ()
+		for key, value := range ctx.Env {
+			env = append(env, key+"="+value)
+		}
+		command.Env = env
+	}
+	err := command.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(interface {
+			ExitStatus() int
+		}); ok {
+			return NewRcPassthroughError(status.ExitStatus())
+		}
+		return NewRcPassthroughError(ExitFailure)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot run plugin %q: %v", c.name, err)
+	}
+	return nil
+}
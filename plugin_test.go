@@ -0,0 +1,112 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+
+	gitjujutesting "github.com/juju/testing"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/cmd"
+	"github.com/juju/cmd/cmdtesting"
+)
+
+type PluginSuite struct {
+	gitjujutesting.IsolationSuite
+}
+
+var _ = gc.Suite(&PluginSuite{})
+
+func (s *PluginSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	if runtime.GOOS == "windows" {
+		c.Skip("plugins are shell scripts")
+	}
+	dir := c.MkDir()
+	s.PatchEnvironment("PATH", dir)
+	s.writePlugin(c, dir, "jujutest-foo", `echo "foo $*"; echo "stderr" >&2`)
+	s.writePlugin(c, dir, "jujutest-fail", "exit 3")
+	s.writePlugin(c, dir, "jujutest-defenestrate", "echo plugin")
+	err := ioutil.WriteFile(filepath.Join(dir, "jujutest-notexec"), nil, 0644)
+	c.Assert(err, gc.IsNil)
+}
+
+func (s *PluginSuite) writePlugin(c *gc.C, dir, name, script string) {
+	err := ioutil.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script+"\n"), 0755)
+	c.Assert(err, gc.IsNil)
+}
+
+func (s *PluginSuite) superCommand() *cmd.SuperCommand {
+	jc := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name:         "jujutest",
+		PluginPrefix: "jujutest-",
+	})
+	jc.Register(&TestCommand{Name: "defenestrate"})
+	return jc
+}
+
+func (s *PluginSuite) TestRunPlugin(c *gc.C) {
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(s.superCommand(), ctx, []string{"foo", "--bar", "baz"})
+	c.Check(code, gc.Equals, 0)
+	c.Check(cmdtesting.Stdout(ctx), gc.Equals, "foo --bar baz\n")
+	c.Check(cmdtesting.Stderr(ctx), gc.Equals, "stderr\n")
+}
+
+func (s *PluginSuite) TestPluginExitCode(c *gc.C) {
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(s.superCommand(), ctx, []string{"fail"})
+	c.Check(code, gc.Equals, 3)
+	c.Check(cmdtesting.Stderr(ctx), gc.Equals, "")
+}
+
+func (s *PluginSuite) TestRegisteredCommandWins(c *gc.C) {
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(s.superCommand(), ctx, []string{"defenestrate", "--option", "registered"})
+	c.Check(code, gc.Equals, 0)
+	c.Check(cmdtesting.Stdout(ctx), gc.Equals, "registered\n")
+}
+
+func (s *PluginSuite) TestNotExecutable(c *gc.C) {
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(s.superCommand(), ctx, []string{"notexec"})
+	c.Check(code, gc.Equals, 2)
+	c.Check(cmdtesting.Stderr(ctx), gc.Equals, "error: unrecognized command: jujutest notexec\n")
+}
+
+func (s *PluginSuite) TestPluginsDisabled(c *gc.C) {
+	jc := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "jujutest"})
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(jc, ctx, []string{"foo"})
+	c.Check(code, gc.Equals, 2)
+	c.Check(cmdtesting.Stderr(ctx), gc.Equals, "error: unrecognized command: jujutest foo\n")
+}
+
+func (s *PluginSuite) TestHelpListsPlugins(c *gc.C) {
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(s.superCommand(), ctx, []string{"help"})
+	c.Check(code, gc.Equals, 0)
+	c.Check(cmdtesting.Stdout(ctx), gc.Matches, `(?s).*commands:
+    defenestrate - defenestrate the juju
+    fail         - plugin provided by jujutest-fail
+    foo          - plugin provided by jujutest-foo
+    help         - show help on a command or other topic
+`)
+}
+
+func (s *PluginSuite) TestPluginHelpIsForwarded(c *gc.C) {
+	for i, args := range [][]string{
+		{"help", "foo"},
+		{"foo", "--help"},
+	} {
+		c.Logf("test %d: %q", i, args)
+		ctx := cmdtesting.Context(c)
+		code := cmd.Main(s.superCommand(), ctx, args)
+		c.Check(code, gc.Equals, 0)
+		c.Check(cmdtesting.Stdout(ctx), gc.Equals, "foo --help\n")
+	}
+}
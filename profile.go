@@ -0,0 +1,111 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"strings"
+)
+
+// profileFlags holds the files named with the --cpuprofile and
+// --memprofile flags, which Main accepts for every command so that the
+// performance of a command can be investigated without rebuilding it.
+// The flags are not listed in help, as they are only of use to the
+// developers of the command.
+type profileFlags struct {
+	cpu string
+	mem string
+}
+
+// splitProfileFlags removes the --cpuprofile and --memprofile flags from
+// args, wherever they appear before any bare "--", and returns the files
+// they name along with the remaining args. The flags may be given as
+// "--cpuprofile file" or "--cpuprofile=file".
+func splitProfileFlags(args []string) (profileFlags, []string, error) {
+	var p profileFlags
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		var target *string
+		name, value, hasValue := arg, "", false
+		if j := strings.Index(arg, "="); j >= 0 {
+			name, value, hasValue = arg[:j], arg[j+1:], true
+		}
+		switch name {
+		case "--cpuprofile":
+			target = &p.cpu
+		case "--memprofile":
+			target = &p.mem
+		default:
+			rest = append(rest, arg)
+			continue
+		}
+		if !hasValue {
+			if i+1 == len(args) {
+				return profileFlags{}, nil, fmt.Errorf("flag needs an argument: %s", name)
+			}
+			i++
+			value = args[i]
+		}
+		if value == "" {
+			return profileFlags{}, nil, fmt.Errorf("invalid value for flag %s: no file given", name)
+		}
+		*target = value
+	}
+	return p, rest, nil
+}
+
+// start starts any profiling asked for, writing the profiles to files
+// relative to ctx.Dir. It returns a function that stops the profiling
+// and writes the profiles, reporting any problems on ctx.Stderr.
+func (p profileFlags) start(ctx *Context) (stop func(), err error) {
+	var cpuFile *os.File
+	if p.cpu != "" {
+		cpuFile, err = os.Create(ctx.AbsPath(p.cpu))
+		if err != nil {
+			return nil, fmt.Errorf("cannot create CPU profile: %v", err)
+		}
+		if err := pprof.StartCPUProfile(cpuFile); err != nil {
+			cpuFile.Close()
+			return nil, fmt.Errorf("cannot start CPU profile: %v", err)
+		}
+	}
+	return func() {
+		if cpuFile != nil {
+			pprof.StopCPUProfile()
+			if err := cpuFile.Close(); err != nil {
+				fmt.Fprintf(ctx.Stderr, "error: cannot write CPU profile: %v\n", err)
+			}
+		}
+		if p.mem != "" {
+			if err := writeMemProfile(ctx.AbsPath(p.mem)); err != nil {
+				fmt.Fprintf(ctx.Stderr, "error: cannot write memory profile: %v\n", err)
+			}
+		}
+	}, nil
+}
+
+// writeMemProfile writes a profile of the memory in use to the file at
+// path.
+func writeMemProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	// Collect garbage first, so that the profile reflects the memory
+	// that is still in use.
+	runtime.GC()
+	err = pprof.WriteHeapProfile(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,94 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+
+	gitjujutesting "github.com/juju/testing"
+	gc "gopkg.in/check.v1"
+)
+
+type ProfileSuite struct {
+	gitjujutesting.IsolationSuite
+}
+
+var _ = gc.Suite(&ProfileSuite{})
+
+func (s *ProfileSuite) TestSplitProfileFlags(c *gc.C) {
+	for i, test := range []struct {
+		args    []string
+		profile profileFlags
+		rest    []string
+		err     string
+	}{{
+		args: []string{"status", "--format", "json"},
+		rest: []string{"status", "--format", "json"},
+	}, {
+		args:    []string{"--cpuprofile", "cpu.prof", "status"},
+		profile: profileFlags{cpu: "cpu.prof"},
+		rest:    []string{"status"},
+	}, {
+		args:    []string{"status", "--memprofile=mem.prof", "--cpuprofile=cpu.prof"},
+		profile: profileFlags{cpu: "cpu.prof", mem: "mem.prof"},
+		rest:    []string{"status"},
+	}, {
+		args:    []string{"exec", "--cpuprofile", "cpu.prof", "--", "--memprofile", "mem.prof"},
+		profile: profileFlags{cpu: "cpu.prof"},
+		rest:    []string{"exec", "--", "--memprofile", "mem.prof"},
+	}, {
+		args: []string{"status", "--cpuprofile"},
+		err:  "flag needs an argument: --cpuprofile",
+	}, {
+		args: []string{"--memprofile=", "status"},
+		err:  "invalid value for flag --memprofile: no file given",
+	}} {
+		c.Logf("test %d: %q", i, test.args)
+		profile, rest, err := splitProfileFlags(test.args)
+		if test.err != "" {
+			c.Check(err, gc.ErrorMatches, test.err)
+			continue
+		}
+		c.Assert(err, gc.IsNil)
+		c.Check(profile, gc.Equals, test.profile)
+		c.Check(rest, gc.DeepEquals, test.rest)
+	}
+}
+
+func (s *ProfileSuite) TestMainWritesProfiles(c *gc.C) {
+	dir := c.MkDir()
+	jc := NewSuperCommand(SuperCommandParams{Name: "jujutest"})
+	jc.Register(&destroyCommand{})
+	var stdout, stderr bytes.Buffer
+	ctx := &Context{
+		Dir:    dir,
+		Stdin:  &bytes.Buffer{},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	code := Main(jc, ctx, []string{"--cpuprofile", "cpu.prof", "destroy", "--memprofile", "mem.prof"})
+	c.Check(code, gc.Equals, 0)
+	c.Check(stderr.String(), gc.Equals, "")
+	c.Check(stdout.String(), gc.Equals, "dry run: false, assume yes: false\n")
+	for _, name := range []string{"cpu.prof", "mem.prof"} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		c.Assert(err, gc.IsNil)
+		c.Check(info.Size() > 0, gc.Equals, true)
+	}
+}
+
+func (s *ProfileSuite) TestMainCannotCreateProfile(c *gc.C) {
+	ctx := &Context{
+		Dir:    c.MkDir(),
+		Stdin:  &bytes.Buffer{},
+		Stdout: &bytes.Buffer{},
+		Stderr: &bytes.Buffer{},
+	}
+	code := Main(&destroyCommand{}, ctx, []string{"--cpuprofile", "missing/cpu.prof"})
+	c.Check(code, gc.Equals, 1)
+	c.Check(ctx.Stderr.(*bytes.Buffer).String(), gc.Matches, "error: cannot create CPU profile: .*\n")
+	c.Check(ctx.Stdout.(*bytes.Buffer).String(), gc.Equals, "")
+}
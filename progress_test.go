@@ -0,0 +1,76 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"bytes"
+	"io"
+
+	gc "gopkg.in/check.v1"
+)
+
+type ProgressSuite struct{}
+
+var _ = gc.Suite(&ProgressSuite{})
+
+func (s *ProgressSuite) patchTerminal(terminal bool) func() {
+	old := isTerminalWriter
+	isTerminalWriter = func(io.Writer) bool { return terminal }
+	return func() { isTerminalWriter = old }
+}
+
+func (s *ProgressSuite) context() (*Context, *bytes.Buffer) {
+	var stderr bytes.Buffer
+	return &Context{Stdout: &bytes.Buffer{}, Stderr: &stderr}, &stderr
+}
+
+func (s *ProgressSuite) TestProgressNotTerminal(c *gc.C) {
+	defer s.patchTerminal(false)()
+	ctx, stderr := s.context()
+	ctx.Progressf("step %d", 1)
+	ctx.Progressf("step %d\n", 2)
+	ctx.Infof("done")
+	c.Assert(stderr.String(), gc.Equals, "step 1\nstep 2\ndone\n")
+}
+
+func (s *ProgressSuite) TestProgressTerminal(c *gc.C) {
+	defer s.patchTerminal(true)()
+	ctx, stderr := s.context()
+	ctx.Progressf("step %d", 1)
+	ctx.Progressf("step %d\n", 2)
+	ctx.Infof("done")
+	c.Assert(stderr.String(), gc.Equals, "\rstep 1\x1b[K\rstep 2\x1b[K\r\x1b[Kdone\n")
+}
+
+func (s *ProgressSuite) TestProgressQuiet(c *gc.C) {
+	defer s.patchTerminal(true)()
+	ctx, stderr := s.context()
+	ctx.quiet = true
+	ctx.Progressf("step 1")
+	ctx.ClearProgress()
+	c.Assert(stderr.String(), gc.Equals, "")
+	c.Assert(ctx.Quiet(), gc.Equals, true)
+	c.Assert(ctx.Verbose(), gc.Equals, false)
+}
+
+type progressCommand struct {
+	CommandBase
+}
+
+func (c *progressCommand) Info() *Info {
+	return &Info{Name: "progress"}
+}
+
+func (c *progressCommand) Run(ctx *Context) error {
+	ctx.Progressf("working")
+	return nil
+}
+
+func (s *ProgressSuite) TestMainClearsProgress(c *gc.C) {
+	defer s.patchTerminal(true)()
+	ctx, stderr := s.context()
+	code := Main(&progressCommand{}, ctx, nil)
+	c.Assert(code, gc.Equals, 0)
+	c.Assert(stderr.String(), gc.Equals, "\rworking\x1b[K\r\x1b[K")
+}
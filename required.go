@@ -0,0 +1,100 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"launchpad.net/gnuflag"
+)
+
+// CheckRequiredFlags returns an error naming the first of the given flags
+// that was not set on the command line when f was parsed. A flag that
+// shares its value with another, such as a short and a long form of the
+// same option, counts as set if either of them was given. It should be
+// called from Init, on the FlagSet that was passed to SetFlags; Main shows
+// the command's usage along with the error.
+func CheckRequiredFlags(f *gnuflag.FlagSet, names ...string) error {
+	isSet, err := flagsSet(f, names)
+	if err != nil {
+		return err
+	}
+	for i, name := range names {
+		if !isSet[i] {
+			return newFlagError(fmt.Errorf("%s is required", flagName(name)))
+		}
+	}
+	return nil
+}
+
+// CheckExclusiveFlags returns an error naming the conflicting flags if
+// more than one of the given flags was set on the command line when f was
+// parsed. It is used like CheckRequiredFlags.
+func CheckExclusiveFlags(f *gnuflag.FlagSet, names ...string) error {
+	isSet, err := flagsSet(f, names)
+	if err != nil {
+		return err
+	}
+	var given []string
+	for i, name := range names {
+		if isSet[i] {
+			given = append(given, flagName(name))
+		}
+	}
+	if len(given) > 1 {
+		return newFlagError(fmt.Errorf("cannot specify %s together", joinFlagNames(given, "and")))
+	}
+	return nil
+}
+
+// CheckOneOfFlags returns an error if none of the given flags was set on
+// the command line when f was parsed. It is used like CheckRequiredFlags,
+// and may be combined with CheckExclusiveFlags to require exactly one of
+// the flags.
+func CheckOneOfFlags(f *gnuflag.FlagSet, names ...string) error {
+	isSet, err := flagsSet(f, names)
+	if err != nil {
+		return err
+	}
+	var all []string
+	for i, name := range names {
+		if isSet[i] {
+			return nil
+		}
+		all = append(all, flagName(name))
+	}
+	if len(all) == 1 {
+		return newFlagError(fmt.Errorf("%s is required", all[0]))
+	}
+	return newFlagError(fmt.Errorf("one of %s is required", joinFlagNames(all, "or")))
+}
+
+// flagsSet reports, for each of the named flags, whether it was set on the
+// command line when f was parsed, either by itself or through another flag
+// with the same value.
+func flagsSet(f *gnuflag.FlagSet, names []string) ([]bool, error) {
+	set := make(map[gnuflag.Value]bool)
+	f.Visit(func(flag *gnuflag.Flag) {
+		set[flag.Value] = true
+	})
+	isSet := make([]bool, len(names))
+	for i, name := range names {
+		flag := f.Lookup(name)
+		if flag == nil {
+			return nil, fmt.Errorf("flag %s not defined", flagName(name))
+		}
+		isSet[i] = set[flag.Value]
+	}
+	return isSet, nil
+}
+
+// joinFlagNames joins names into a list such as "--a, --b and --c",
+// using conjunction before the last name.
+func joinFlagNames(names []string, conjunction string) string {
+	if len(names) < 2 {
+		return strings.Join(names, "")
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " " + conjunction + " " + names[len(names)-1]
+}
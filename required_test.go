@@ -0,0 +1,167 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd_test
+
+import (
+	gitjujutesting "github.com/juju/testing"
+	gc "gopkg.in/check.v1"
+	"launchpad.net/gnuflag"
+
+	"github.com/juju/cmd"
+	"github.com/juju/cmd/cmdtesting"
+)
+
+type RequiredFlagsSuite struct {
+	gitjujutesting.IsolationSuite
+}
+
+var _ = gc.Suite(&RequiredFlagsSuite{})
+
+// bootstrapStateCommand requires its --instance-id and --env-config flags.
+type bootstrapStateCommand struct {
+	cmd.CommandBase
+	flags      *gnuflag.FlagSet
+	instanceId string
+	envConfig  string
+}
+
+func (c *bootstrapStateCommand) Info() *cmd.Info {
+	return &cmd.Info{Name: "bootstrap-state"}
+}
+
+func (c *bootstrapStateCommand) SetFlags(f *gnuflag.FlagSet) {
+	c.flags = f
+	f.StringVar(&c.instanceId, "i", "", "the instance id")
+	f.StringVar(&c.instanceId, "instance-id", "", "")
+	f.StringVar(&c.envConfig, "env-config", "", "the environment configuration")
+}
+
+func (c *bootstrapStateCommand) Init(args []string) error {
+	if err := cmd.CheckRequiredFlags(c.flags, "instance-id", "env-config"); err != nil {
+		return err
+	}
+	return cmd.CheckEmpty(args)
+}
+
+func (c *bootstrapStateCommand) Run(ctx *cmd.Context) error {
+	return nil
+}
+
+func (s *RequiredFlagsSuite) TestRequiredFlags(c *gc.C) {
+	for i, test := range []struct {
+		args []string
+		err  string
+	}{{
+		args: []string{"--instance-id", "i-1", "--env-config", "x"},
+	}, {
+		args: []string{"-i", "i-1", "--env-config", "x"},
+	}, {
+		args: []string{"--instance-id=", "--env-config", "x"},
+	}, {
+		args: []string{"--env-config", "x"},
+		err:  "--instance-id is required",
+	}, {
+		args: []string{"-i", "i-1"},
+		err:  "--env-config is required",
+	}, {
+		args: nil,
+		err:  "--instance-id is required",
+	}} {
+		c.Logf("test %d: %q", i, test.args)
+		err := cmdtesting.InitCommand(&bootstrapStateCommand{}, test.args)
+		if test.err == "" {
+			c.Check(err, gc.IsNil)
+		} else {
+			c.Check(err, gc.ErrorMatches, test.err)
+		}
+	}
+}
+
+func (s *RequiredFlagsSuite) TestRequiredFlagNotDefined(c *gc.C) {
+	f := cmdtesting.NewFlagSet()
+	err := f.Parse(true, nil)
+	c.Assert(err, gc.IsNil)
+	err = cmd.CheckRequiredFlags(f, "missing")
+	c.Assert(err, gc.ErrorMatches, "flag --missing not defined")
+}
+
+func (s *RequiredFlagsSuite) TestMainShowsUsage(c *gc.C) {
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(&bootstrapStateCommand{}, ctx, []string{"-i", "i-1"})
+	c.Check(code, gc.Equals, 2)
+	cmdtesting.CheckOutput(c, ctx, "", ""+
+		"error: --env-config is required\n"+
+		"Usage: bootstrap-state [options]\n")
+}
+
+// contentCommand takes its content from exactly one of --file, --content
+// and --url.
+type contentCommand struct {
+	cmd.CommandBase
+	flags   *gnuflag.FlagSet
+	file    string
+	content string
+	url     string
+}
+
+func (c *contentCommand) Info() *cmd.Info {
+	return &cmd.Info{Name: "content"}
+}
+
+func (c *contentCommand) SetFlags(f *gnuflag.FlagSet) {
+	c.flags = f
+	f.StringVar(&c.file, "file", "", "read the content from a file")
+	f.StringVar(&c.content, "content", "", "the content")
+	f.StringVar(&c.url, "url", "", "download the content")
+}
+
+func (c *contentCommand) Init(args []string) error {
+	if err := cmd.CheckExclusiveFlags(c.flags, "file", "content", "url"); err != nil {
+		return err
+	}
+	return cmd.CheckOneOfFlags(c.flags, "file", "content", "url")
+}
+
+func (c *contentCommand) Run(ctx *cmd.Context) error {
+	return nil
+}
+
+func (s *RequiredFlagsSuite) TestExclusiveFlags(c *gc.C) {
+	for i, test := range []struct {
+		args []string
+		err  string
+	}{{
+		args: []string{"--file", "f"},
+	}, {
+		args: []string{"--content="},
+	}, {
+		args: []string{"--content", "c", "--file", "f"},
+		err:  "cannot specify --file and --content together",
+	}, {
+		args: []string{"--url", "u", "--content", "c", "--file", "f"},
+		err:  "cannot specify --file, --content and --url together",
+	}, {
+		args: nil,
+		err:  "one of --file, --content or --url is required",
+	}} {
+		c.Logf("test %d: %q", i, test.args)
+		err := cmdtesting.InitCommand(&contentCommand{}, test.args)
+		if test.err == "" {
+			c.Check(err, gc.IsNil)
+		} else {
+			c.Check(err, gc.ErrorMatches, test.err)
+		}
+	}
+}
+
+func (s *RequiredFlagsSuite) TestOneOfSingleFlag(c *gc.C) {
+	f := cmdtesting.NewFlagSet()
+	f.String("file", "", "")
+	err := f.Parse(true, nil)
+	c.Assert(err, gc.IsNil)
+	err = cmd.CheckOneOfFlags(f, "file")
+	c.Assert(err, gc.ErrorMatches, "--file is required")
+	err = cmd.CheckExclusiveFlags(f, "file", "missing")
+	c.Assert(err, gc.ErrorMatches, "flag --missing not defined")
+}
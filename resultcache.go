@@ -0,0 +1,194 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// CachedCommand is implemented by commands whose output can be reused
+// for a while, such as commands that list things by querying a slow API.
+// When a SuperCommand created with CacheResults runs one, it writes the
+// output of an earlier successful run with the same cache key to Stdout
+// instead of running the command again, as long as that output is
+// younger than the command's TTL. Only what the command writes to Stdout
+// is cached, and errors are never cached.
+type CachedCommand interface {
+	Command
+
+	// CacheKey returns a string identifying the result of the command,
+	// made from the arguments and flags it was initialized with that
+	// affect what it writes. If it is empty, the result is not cached.
+	CacheKey() string
+
+	// CacheTTL returns how long a result may be reused for. If it is
+	// not positive, the result is not cached.
+	CacheTTL() time.Duration
+}
+
+// resultCache holds the settings for caching command output, shared by
+// a SuperCommand created with CacheResults and any SuperCommands nested
+// in it, so that they all keep their output in the same place.
+type resultCache struct {
+	// name is the name of the outermost SuperCommand, used to find the
+	// cache directory.
+	name    string
+	noCache bool
+}
+
+// runCached runs the selected subcommand, or writes its cached output if
+// it is a CachedCommand that has been run recently enough. Dry runs are
+// never cached.
+func (c *SuperCommand) runCached(ctx *Context) error {
+	cached, ok := c.action.command.(CachedCommand)
+	if c.cache == nil || !ok || ctx.DryRun {
+		return c.runAction(ctx)
+	}
+	path, err := c.resultCachePath(ctx, cached)
+	if err != nil {
+		logger.Debugf("not caching result: %v", err)
+		return c.runAction(ctx)
+	}
+	if path == "" {
+		return c.runAction(ctx)
+	}
+	if !c.cache.noCache {
+		if data, ok := readFreshFile(path, cached.CacheTTL()); ok {
+			logger.Debugf("using cached result %s", path)
+			_, err := ctx.Stdout.Write(data)
+			return err
+		}
+	}
+	stdout := ctx.Stdout
+	tee := &teeWriter{w: stdout}
+	ctx.Stdout = tee
+	err = c.runAction(ctx)
+	ctx.Stdout = stdout
+	if err == nil {
+		if err := writeFileAtomic(path, tee.buf.Bytes()); err != nil {
+			logger.Debugf("cannot cache result: %v", err)
+		}
+	}
+	return err
+}
+
+// resultCachePath returns the path of the file holding the cached output
+// of the selected subcommand, or "" if its output is not to be cached.
+// Output for a terminal may be laid out differently, so it is cached
+// separately.
+func (c *SuperCommand) resultCachePath(ctx *Context, cached CachedCommand) (string, error) {
+	key := cached.CacheKey()
+	if key == "" || cached.CacheTTL() <= 0 {
+		return "", nil
+	}
+	dir, err := c.cache.dir(ctx)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\x00%s\x00%s\x00%v", c.fullName(), c.action.name, key, isTerminalWriter(ctx.Stdout))
+	return filepath.Join(dir, hex.EncodeToString(hash.Sum(nil))), nil
+}
+
+// dir returns the directory in which cached output is kept.
+func (r *resultCache) dir(ctx *Context) (string, error) {
+	dir, err := ctx.CacheDir(r.name)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "results"), nil
+}
+
+// readFreshFile returns the contents of the file at path, as long as it
+// was written less than ttl ago.
+func readFreshFile(path string, ttl time.Duration) ([]byte, bool) {
+	info, err := os.Stat(path)
+	if err != nil || time.Since(info.ModTime()) >= ttl {
+		return nil, false
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// writeFileAtomic writes data to the file at path, creating its
+// directory if necessary, so that readers never see a partial file.
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, ".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// teeWriter writes to w and keeps a copy of what it writes.
+type teeWriter struct {
+	w   io.Writer
+	buf bytes.Buffer
+}
+
+func (t *teeWriter) Write(p []byte) (int, error) {
+	n, err := t.w.Write(p)
+	t.buf.Write(p[:n])
+	return n, err
+}
+
+// clearCacheCommand is a cmd.Command that removes the cached output of
+// the SuperCommand's subcommands.
+type clearCacheCommand struct {
+	CommandBase
+	cache *resultCache
+}
+
+func (c *clearCacheCommand) Info() *Info {
+	return &Info{
+		Name:    "clear-cache",
+		Purpose: "remove cached command results",
+		Doc: `
+Some commands keep their results for a while, so that they can be shown
+again without waiting. clear-cache removes those results, so that the
+commands are run afresh. To ignore cached results for a single run, use
+the --no-cache flag instead.
+`,
+	}
+}
+
+func (c *clearCacheCommand) Init(args []string) error {
+	return CheckEmpty(args)
+}
+
+func (c *clearCacheCommand) Run(ctx *Context) error {
+	dir, err := c.cache.dir(ctx)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("cannot clear cache: %v", err)
+	}
+	return nil
+}
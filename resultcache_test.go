@@ -0,0 +1,166 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+
+	gc "gopkg.in/check.v1"
+	"launchpad.net/gnuflag"
+
+	"github.com/juju/cmd"
+)
+
+type ResultCacheSuite struct{}
+
+var _ = gc.Suite(&ResultCacheSuite{})
+
+// listCommand is a CachedCommand that lists things of the kind given
+// with --kind, counting how often it is run.
+type listCommand struct {
+	cmd.CommandBase
+	kind string
+	ttl  time.Duration
+	runs int
+	fail bool
+}
+
+func (c *listCommand) Info() *cmd.Info {
+	return &cmd.Info{Name: "list"}
+}
+
+func (c *listCommand) SetFlags(f *gnuflag.FlagSet) {
+	f.StringVar(&c.kind, "kind", "machine", "the kind of thing to list")
+}
+
+func (c *listCommand) CacheKey() string {
+	return c.kind
+}
+
+func (c *listCommand) CacheTTL() time.Duration {
+	return c.ttl
+}
+
+func (c *listCommand) Run(ctx *cmd.Context) error {
+	c.runs++
+	if c.fail {
+		return errors.New("api unavailable")
+	}
+	fmt.Fprintf(ctx.Stdout, "%s %d\n", c.kind, c.runs)
+	return nil
+}
+
+// run runs jc with args in a context whose cache directory is dir, and
+// returns what was written to Stdout.
+func (s *ResultCacheSuite) run(c *gc.C, jc *cmd.SuperCommand, dir string, args ...string) (int, string) {
+	stdout := &bytes.Buffer{}
+	ctx := &cmd.Context{
+		Stdin:  &bytes.Buffer{},
+		Stdout: stdout,
+		Stderr: &bytes.Buffer{},
+		Env:    map[string]string{"XDG_CACHE_HOME": dir, "HOME": dir},
+	}
+	return cmd.Main(jc, ctx, args), stdout.String()
+}
+
+func (s *ResultCacheSuite) newSuper(list *listCommand) *cmd.SuperCommand {
+	jc := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name:         "jujutest",
+		CacheResults: true,
+	})
+	jc.Register(list)
+	return jc
+}
+
+func (s *ResultCacheSuite) TestCached(c *gc.C) {
+	dir := c.MkDir()
+	list := &listCommand{ttl: time.Hour}
+	for i, test := range []struct {
+		args   []string
+		stdout string
+	}{
+		{[]string{"list"}, "machine 1\n"},
+		{[]string{"list"}, "machine 1\n"},
+		{[]string{"list", "--kind", "unit"}, "unit 2\n"},
+		{[]string{"list", "--kind", "machine"}, "machine 1\n"},
+		{[]string{"list", "--no-cache"}, "machine 3\n"},
+		{[]string{"--no-cache", "list", "--kind", "unit"}, "unit 4\n"},
+		{[]string{"list"}, "machine 3\n"},
+		{[]string{"clear-cache"}, ""},
+		{[]string{"list"}, "machine 5\n"},
+	} {
+		c.Logf("test %d: %q", i, test.args)
+		code, stdout := s.run(c, s.newSuper(list), dir, test.args...)
+		c.Check(code, gc.Equals, 0)
+		c.Check(stdout, gc.Equals, test.stdout)
+	}
+}
+
+func (s *ResultCacheSuite) TestErrorsNotCached(c *gc.C) {
+	dir := c.MkDir()
+	list := &listCommand{ttl: time.Hour, fail: true}
+	code, _ := s.run(c, s.newSuper(list), dir, "list")
+	c.Check(code, gc.Equals, 1)
+	list.fail = false
+	code, stdout := s.run(c, s.newSuper(list), dir, "list")
+	c.Check(code, gc.Equals, 0)
+	c.Check(stdout, gc.Equals, "machine 2\n")
+}
+
+func (s *ResultCacheSuite) TestNotCacheable(c *gc.C) {
+	dir := c.MkDir()
+	// A command without a TTL is always run.
+	list := &listCommand{}
+	for i := 1; i <= 2; i++ {
+		code, stdout := s.run(c, s.newSuper(list), dir, "list")
+		c.Check(code, gc.Equals, 0)
+		c.Check(stdout, gc.Equals, fmt.Sprintf("machine %d\n", i))
+	}
+
+	// Nor is anything cached when CacheResults is not set.
+	list = &listCommand{ttl: time.Hour}
+	for i := 1; i <= 2; i++ {
+		jc := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "jujutest"})
+		jc.Register(list)
+		code, stdout := s.run(c, jc, dir, "list")
+		c.Check(code, gc.Equals, 0)
+		c.Check(stdout, gc.Equals, fmt.Sprintf("machine %d\n", i))
+	}
+}
+
+func (s *ResultCacheSuite) TestNested(c *gc.C) {
+	dir := c.MkDir()
+	list := &listCommand{ttl: time.Hour}
+	newSuper := func() *cmd.SuperCommand {
+		jc := cmd.NewSuperCommand(cmd.SuperCommandParams{
+			Name:         "jujutest",
+			CacheResults: true,
+		})
+		nested := cmd.NewSuperCommand(cmd.SuperCommandParams{
+			Name:        "nested",
+			UsagePrefix: "jujutest",
+		})
+		nested.Register(list)
+		jc.Register(nested)
+		return jc
+	}
+	for i, test := range []struct {
+		args   []string
+		stdout string
+	}{
+		{[]string{"nested", "list"}, "machine 1\n"},
+		{[]string{"nested", "list"}, "machine 1\n"},
+		{[]string{"nested", "list", "--no-cache"}, "machine 2\n"},
+		{[]string{"clear-cache"}, ""},
+		{[]string{"nested", "list"}, "machine 3\n"},
+	} {
+		c.Logf("test %d: %q", i, test.args)
+		code, stdout := s.run(c, newSuper(), dir, test.args...)
+		c.Check(code, gc.Equals, 0)
+		c.Check(stdout, gc.Equals, test.stdout)
+	}
+}
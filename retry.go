@@ -0,0 +1,120 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// Backoff returns how long Retry waits after the given failed attempt,
+// counting from 1, before making the next one.
+type Backoff func(attempt int) time.Duration
+
+// ConstantBackoff returns a Backoff that always waits for delay.
+func ConstantBackoff(delay time.Duration) Backoff {
+	return func(int) time.Duration {
+		return delay
+	}
+}
+
+// ExponentialBackoff returns a Backoff that waits for initial after the
+// first attempt, and twice as long after each attempt after that, up to
+// max if it is not zero.
+func ExponentialBackoff(initial, max time.Duration) Backoff {
+	return func(attempt int) time.Duration {
+		delay := initial
+		for i := 1; i < attempt; i++ {
+			if max > 0 && delay >= max || delay > math.MaxInt64/2 {
+				break
+			}
+			delay *= 2
+		}
+		if max > 0 && delay > max {
+			return max
+		}
+		return delay
+	}
+}
+
+// RetryParams holds the parameters for Retry.
+type RetryParams struct {
+	// Attempts holds the most times the function is tried. If it is
+	// zero, the number of attempts is limited only by MaxDuration.
+	Attempts int
+
+	// MaxDuration holds the most time spent retrying. No attempt is
+	// started once it has passed, or when waiting for the next one
+	// would take longer. If it is zero, only Attempts limits retrying.
+	MaxDuration time.Duration
+
+	// Backoff returns the time to wait between attempts. If it is nil,
+	// attempts are made one after another without waiting.
+	Backoff Backoff
+
+	// Description, if set, describes what is being tried, for instance
+	// "connect to the controller". Each failed attempt that is retried
+	// is then reported with Context.Verbosef, and the attempts are timed
+	// as a phase of that name with Context.StartPhase.
+	Description string
+}
+
+// Retry calls attempt until it succeeds or the limits given in params are
+// reached, in which case it returns the error from the last attempt. When
+// neither Attempts nor MaxDuration is set, attempt is only called once.
+//
+// Retry stops waiting as soon as the context returned by ctx.Context is
+// cancelled, for instance because the process was interrupted, and then
+// returns the context's error.
+func Retry(ctx *Context, params RetryParams, attempt func() error) error {
+	if params.Attempts < 0 || params.MaxDuration < 0 {
+		return errors.New("retry limits must not be negative")
+	}
+	if params.Attempts == 0 && params.MaxDuration == 0 {
+		params.Attempts = 1
+	}
+	var deadline time.Time
+	if params.MaxDuration > 0 {
+		deadline = time.Now().Add(params.MaxDuration)
+	}
+	done := ctx.Context().Done()
+	for i := 1; ; i++ {
+		if err := ctx.Context().Err(); err != nil {
+			return err
+		}
+		end := noPhase
+		if params.Description != "" {
+			end = ctx.StartPhase(params.Description)
+		}
+		err := attempt()
+		end()
+		if err == nil {
+			return nil
+		}
+		if params.Attempts > 0 && i >= params.Attempts {
+			return err
+		}
+		var delay time.Duration
+		if params.Backoff != nil {
+			delay = params.Backoff(i)
+		}
+		if !deadline.IsZero() && time.Now().Add(delay).After(deadline) {
+			return err
+		}
+		if params.Description != "" {
+			ctx.Verbosef("cannot %s (attempt %d): %v; retrying in %v", params.Description, i, err, delay)
+		}
+		if delay <= 0 {
+			continue
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-done:
+			timer.Stop()
+			return ctx.Context().Err()
+		}
+	}
+}
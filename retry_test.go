@@ -0,0 +1,145 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	gitjujutesting "github.com/juju/testing"
+	gc "gopkg.in/check.v1"
+)
+
+type RetrySuite struct {
+	gitjujutesting.IsolationSuite
+}
+
+var _ = gc.Suite(&RetrySuite{})
+
+func (s *RetrySuite) context() (*Context, *bytes.Buffer) {
+	var stderr bytes.Buffer
+	return &Context{
+		Stdin:  &bytes.Buffer{},
+		Stdout: &bytes.Buffer{},
+		Stderr: &stderr,
+	}, &stderr
+}
+
+// failTimes returns an attempt function that fails the first n times it
+// is called, and a pointer to the number of calls made.
+func failTimes(n int) (func() error, *int) {
+	calls := 0
+	return func() error {
+		calls++
+		if calls <= n {
+			return fmt.Errorf("failure %d", calls)
+		}
+		return nil
+	}, &calls
+}
+
+func (s *RetrySuite) TestSucceeds(c *gc.C) {
+	ctx, stderr := s.context()
+	attempt, calls := failTimes(2)
+	err := Retry(ctx, RetryParams{Attempts: 5}, attempt)
+	c.Assert(err, gc.IsNil)
+	c.Check(*calls, gc.Equals, 3)
+	c.Check(stderr.String(), gc.Equals, "")
+}
+
+func (s *RetrySuite) TestAttemptsExhausted(c *gc.C) {
+	ctx, _ := s.context()
+	attempt, calls := failTimes(10)
+	err := Retry(ctx, RetryParams{Attempts: 3}, attempt)
+	c.Assert(err, gc.ErrorMatches, "failure 3")
+	c.Check(*calls, gc.Equals, 3)
+}
+
+func (s *RetrySuite) TestNoLimits(c *gc.C) {
+	ctx, _ := s.context()
+	attempt, calls := failTimes(10)
+	err := Retry(ctx, RetryParams{}, attempt)
+	c.Assert(err, gc.ErrorMatches, "failure 1")
+	c.Check(*calls, gc.Equals, 1)
+}
+
+func (s *RetrySuite) TestNegativeLimits(c *gc.C) {
+	ctx, _ := s.context()
+	attempt, calls := failTimes(0)
+	err := Retry(ctx, RetryParams{Attempts: -1}, attempt)
+	c.Assert(err, gc.ErrorMatches, "retry limits must not be negative")
+	c.Check(*calls, gc.Equals, 0)
+}
+
+func (s *RetrySuite) TestMaxDuration(c *gc.C) {
+	ctx, _ := s.context()
+	attempt, calls := failTimes(10)
+	err := Retry(ctx, RetryParams{
+		MaxDuration: 75 * time.Millisecond,
+		Backoff:     ConstantBackoff(50 * time.Millisecond),
+	}, attempt)
+	// Waiting after the second attempt would pass the deadline.
+	c.Assert(err, gc.ErrorMatches, "failure 2")
+	c.Check(*calls, gc.Equals, 2)
+}
+
+func (s *RetrySuite) TestCancelled(c *gc.C) {
+	ctx, _ := s.context()
+	cancelCtx, cancel := context.WithCancel(context.Background())
+	ctx.ctx = cancelCtx
+	calls := 0
+	start := time.Now()
+	err := Retry(ctx, RetryParams{
+		Attempts: 5,
+		Backoff:  ConstantBackoff(time.Hour),
+	}, func() error {
+		calls++
+		time.AfterFunc(10*time.Millisecond, cancel)
+		return fmt.Errorf("failure")
+	})
+	c.Assert(err, gc.Equals, context.Canceled)
+	c.Check(calls, gc.Equals, 1)
+	c.Check(time.Since(start) < time.Minute, gc.Equals, true)
+
+	// Nothing is attempted once the context has been cancelled.
+	err = Retry(ctx, RetryParams{Attempts: 5}, func() error {
+		calls++
+		return nil
+	})
+	c.Assert(err, gc.Equals, context.Canceled)
+	c.Check(calls, gc.Equals, 1)
+}
+
+func (s *RetrySuite) TestVerbose(c *gc.C) {
+	ctx, stderr := s.context()
+	ctx.verbose = true
+	attempt, _ := failTimes(2)
+	err := Retry(ctx, RetryParams{
+		Attempts:    3,
+		Backoff:     ConstantBackoff(time.Millisecond),
+		Description: "connect",
+	}, attempt)
+	c.Assert(err, gc.IsNil)
+	c.Check(stderr.String(), gc.Equals, ""+
+		"cannot connect (attempt 1): failure 1; retrying in 1ms\n"+
+		"cannot connect (attempt 2): failure 2; retrying in 1ms\n")
+}
+
+func (s *RetrySuite) TestExponentialBackoff(c *gc.C) {
+	backoff := ExponentialBackoff(time.Second, 10*time.Second)
+	var delays []time.Duration
+	for attempt := 1; attempt <= 6; attempt++ {
+		delays = append(delays, backoff(attempt))
+	}
+	c.Assert(delays, gc.DeepEquals, []time.Duration{
+		time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second,
+	})
+
+	// Without a maximum the delay keeps growing, without overflowing.
+	backoff = ExponentialBackoff(time.Second, 0)
+	c.Assert(backoff(4), gc.Equals, 8*time.Second)
+	c.Assert(backoff(1000) > 0, gc.Equals, true)
+}
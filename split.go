@@ -0,0 +1,77 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"unicode"
+)
+
+// SplitArgs splits s into arguments at white space, as a POSIX shell
+// would, but without expanding variables, globs or anything else. Single
+// quotes preserve everything they enclose. Double quotes preserve
+// everything but a backslash followed by one of $, `, ", \ or a newline,
+// which stands for that character. Outside quotes, a backslash preserves
+// the character that follows it. In both cases, a backslash followed by a
+// newline is removed altogether. Quotes that are not closed, and a final
+// backslash, are errors.
+//
+// For instance, `status --format "json pretty"` is split into "status",
+// "--format" and "json pretty".
+func SplitArgs(s string) ([]string, error) {
+	var args []string
+	var arg []rune
+	inArg := false
+	var quote rune
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+			if r == '\n' {
+				continue
+			}
+			if quote == '"' && !doubleQuoteEscapable(r) {
+				arg = append(arg, '\\')
+			}
+			arg, inArg = append(arg, r), true
+		case r == '\\' && quote != '\'':
+			escaped = true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			arg = append(arg, r)
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, string(arg))
+				arg, inArg = nil, false
+			}
+		default:
+			arg, inArg = append(arg, r), true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if escaped {
+		return nil, errors.New("trailing backslash")
+	}
+	if inArg {
+		args = append(args, string(arg))
+	}
+	return args, nil
+}
+
+// doubleQuoteEscapable reports whether a backslash before r within double
+// quotes stands for r alone.
+func doubleQuoteEscapable(r rune) bool {
+	switch r {
+	case '$', '`', '"', '\\':
+		return true
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd_test
+
+import (
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/cmd"
+)
+
+type SplitArgsSuite struct{}
+
+var _ = gc.Suite(&SplitArgsSuite{})
+
+func (s *SplitArgsSuite) TestSplitArgs(c *gc.C) {
+	for _, test := range []struct {
+		s    string
+		args []string
+		err  string
+	}{{
+		s: "",
+	}, {
+		s: " \t\n ",
+	}, {
+		s:    `status --format "json pretty"`,
+		args: []string{"status", "--format", "json pretty"},
+	}, {
+		s:    "  leading   and\ttrailing  ",
+		args: []string{"leading", "and", "trailing"},
+	}, {
+		s:    `'it''s' "" ''`,
+		args: []string{"its", "", ""},
+	}, {
+		s:    `'single $HOME \n "double"'`,
+		args: []string{`single $HOME \n "double"`},
+	}, {
+		s:    `"\$ \` + "`" + ` \" \\ \n"`,
+		args: []string{`$ ` + "`" + ` " \ \n`},
+	}, {
+		s:    `two\ words \'quoted\' \\`,
+		args: []string{"two words", "'quoted'", `\`},
+	}, {
+		s:    "con\\\ntinued \\\n next",
+		args: []string{"continued", "next"},
+	}, {
+		s:    `mixed"dou ble"'sin gle'`,
+		args: []string{"mixeddou blesin gle"},
+	}, {
+		s:   `status --format "json`,
+		err: `unterminated " quote`,
+	}, {
+		s:   `it's`,
+		err: `unterminated ' quote`,
+	}, {
+		s:   `trailing\`,
+		err: `trailing backslash`,
+	}} {
+		c.Logf("split %q", test.s)
+		args, err := cmd.SplitArgs(test.s)
+		if test.err != "" {
+			c.Check(err, gc.ErrorMatches, test.err)
+			c.Check(args, gc.IsNil)
+			continue
+		}
+		c.Assert(err, gc.IsNil)
+		c.Check(args, gc.DeepEquals, test.args)
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+
+	goyaml "gopkg.in/yaml.v2"
+)
+
+// OutputStream writes a list of items, one at a time, in the format and
+// to the destination chosen with the --format and --output flags. It lets
+// commands that produce many items write them as they go instead of
+// holding them all in memory. See Output.Stream.
+type OutputStream struct {
+	target  io.Writer
+	file    *os.File
+	encoder streamEncoder
+}
+
+// streamEncoder encodes the items written to an OutputStream.
+type streamEncoder interface {
+	// encode writes item to w.
+	encode(w io.Writer, item interface{}) error
+
+	// close writes anything needed to w after the last item.
+	close(w io.Writer) error
+}
+
+// Stream returns an OutputStream that writes items as directed by the
+// --format and --output command line flags. Items written with the
+// "json" and "json-indent" formatters of DefaultFormatters are written as
+// a single array, and with the "yaml" formatter as a stream of yaml
+// documents, each item being written as soon as it is given. Items
+// written in any other format, including one that a command registers
+// in place of those, are held until the stream is closed and then
+// formatted together as a slice, just as Write would.
+// The stream must be closed once all the items have been written. Any
+// output held back by a SuperCommand created with AtomicOutput is written
+// before the stream is returned, and the rest is written as it comes.
+func (c *Output) Stream(ctx *Context) (*OutputStream, error) {
+	target, f, err := c.target(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if f == nil {
+		if err := ctx.StreamOutput(); err != nil {
+			return nil, err
+		}
+	}
+	s := &OutputStream{target: target, file: f}
+	s.encoder = c.formatter.streamEncoder()
+	if s.encoder == nil {
+		s.encoder = &bufferedStreamEncoder{
+			formatter:  c.formatter,
+			isTerminal: f == nil && isTerminalWriter(target),
+		}
+	}
+	return s, nil
+}
+
+// streamEncoder returns an encoder that writes items as they are given
+// in the chosen format, or nil if they must be formatted together. Only
+// the formatters of DefaultFormatters that have such encoders are
+// streamed, whatever names they are given.
+func (v *formatterValue) streamEncoder() streamEncoder {
+	if v.compact || v.name == "template" && v.template != nil {
+		// Compact values are formatted together, like those of
+		// formats that cannot be streamed.
+		return nil
+	}
+	formatter := v.formatters[v.name]
+	switch {
+	case isFormatter(formatter, formatJson):
+		return &jsonStreamEncoder{}
+	case isFormatter(formatter, formatJsonIndent):
+		return &jsonStreamEncoder{indent: "  "}
+	case isFormatter(formatter, formatYaml):
+		return yamlStreamEncoder{}
+	}
+	return nil
+}
+
+// Write writes item to the stream.
+func (s *OutputStream) Write(item interface{}) error {
+	return s.encoder.encode(s.target, item)
+}
+
+// Close finishes the output, and closes the output file if there is one.
+func (s *OutputStream) Close() error {
+	err := s.encoder.close(s.target)
+	if s.file != nil {
+		if closeErr := s.file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// jsonStreamEncoder writes items as the elements of a json array,
+// indenting them with indent if it is not empty.
+type jsonStreamEncoder struct {
+	indent string
+	count  int
+}
+
+func (e *jsonStreamEncoder) encode(w io.Writer, item interface{}) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if e.indent != "" {
+		encoder.SetIndent(e.indent, e.indent)
+	}
+	if err := encoder.Encode(item); err != nil {
+		return err
+	}
+	separator := ","
+	if e.count == 0 {
+		separator = "["
+	}
+	if e.indent != "" {
+		separator += "\n" + e.indent
+	}
+	e.count++
+	_, err := io.WriteString(w, separator+string(bytes.TrimSuffix(buf.Bytes(), []byte("\n"))))
+	return err
+}
+
+func (e *jsonStreamEncoder) close(w io.Writer) error {
+	end := "]\n"
+	if e.count == 0 {
+		end = "[]\n"
+	} else if e.indent != "" {
+		end = "\n" + end
+	}
+	_, err := io.WriteString(w, end)
+	return err
+}
+
+// yamlStreamEncoder writes each item as a separate yaml document.
+type yamlStreamEncoder struct{}
+
+func (yamlStreamEncoder) encode(w io.Writer, item interface{}) error {
+	data, err := goyaml.Marshal(item)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append([]byte("---\n"), data...))
+	return err
+}
+
+func (yamlStreamEncoder) close(w io.Writer) error {
+	return nil
+}
+
+// bufferedStreamEncoder holds items until the stream is closed, and then
+// formats them as a slice.
+type bufferedStreamEncoder struct {
+	formatter  *formatterValue
+	isTerminal bool
+	items      []interface{}
+}
+
+func (e *bufferedStreamEncoder) encode(w io.Writer, item interface{}) error {
+	e.items = append(e.items, item)
+	return nil
+}
+
+func (e *bufferedStreamEncoder) close(w io.Writer) error {
+	items := e.items
+	if items == nil {
+		items = []interface{}{}
+	}
+	data, err := e.formatter.format(items, e.isTerminal)
+	if err != nil || len(data) == 0 {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
@@ -4,10 +4,13 @@
 package cmd
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"sort"
 	"strings"
+	"time"
+	"unicode"
 
 	"github.com/juju/errors"
 	"github.com/juju/loggo"
@@ -43,12 +46,32 @@ type SuperCommandParams struct {
 	// actually a subcommand of some other SuperCommand;
 	// if NotifyRun is called, it name will be prefixed accordingly,
 	// unless UsagePrefix is identical to Name.
+	//
+	// A SuperCommand that is registered with another one need not set
+	// UsagePrefix: its help, usage and errors then name it after the
+	// SuperCommand it is registered with, and the flags it defines,
+	// such as --version, may follow its name on the command line.
 	UsagePrefix string
 
 	// Notify, if not nil, is called when the SuperCommand
 	// is about to run a sub-command.
 	NotifyRun func(cmdName string)
 
+	// PreRun, if not nil, is called with the selected subcommand just
+	// before it is run. If it returns an error, the subcommand is not
+	// run and the error is returned instead.
+	PreRun func(command Command, ctx *Context) error
+
+	// PostRun, if not nil, is called with the selected subcommand and
+	// the error returned by its Run method after it has run. The error
+	// returned by PostRun is returned in place of that of the
+	// subcommand, so it may be transformed or discarded.
+	//
+	// PreRun and PostRun are passed on to any nested SuperCommands
+	// that do not have hooks of their own, so that they are called
+	// around the command that is finally run.
+	PostRun func(command Command, ctx *Context, err error) error
+
 	// NotifyHelp is called just before help is printed, with the
 	// arguments received by the help command. This can be
 	// used, for example, to load command information for external
@@ -67,8 +90,113 @@ type SuperCommandParams struct {
 	// UserAliasesFilename refers to the location of a file that contains
 	//   name = cmd [args...]
 	// values, that is used to change default behaviour of commands in order
-	// to add flags, or provide short cuts to longer commands.
+	// to add flags, or provide short cuts to longer commands. The
+	// values are split into arguments as a shell would, so they may
+	// be quoted. DefaultAliasFile returns the conventional location of
+	// such a file.
+	//
+	// An alias may expand to another alias, but an alias is not
+	// expanded again within its own expansion. Aliases with the same
+	// name as a registered command are ignored, unless
+	// AllowAliasOverride is set.
 	UserAliasesFilename string
+
+	// AllowAliasOverride, if true, allows the aliases in
+	// UserAliasesFilename to replace registered commands of the
+	// same name, as in "status = status --format yaml".
+	AllowAliasOverride bool
+
+	// ConfigFlag, if set, is the name of a flag, such as "config",
+	// that is accepted by all subcommands and names a YAML file of
+	// flag values to use when they are not given on the command line.
+	// A relative path is taken to be relative to the Context's Dir.
+	// See SetFlagsFromConfig.
+	ConfigFlag string
+
+	// DefaultCommand, if set, is the name of the subcommand that is run
+	// when no subcommand is given, instead of showing help. An explicit
+	// --help still shows the help for the SuperCommand.
+	DefaultCommand string
+
+	// PluginPrefix, if set, enables plugins: when a subcommand such as
+	// "foo" is not registered, the executable named PluginPrefix+"foo"
+	// (for instance "mytool-foo") is looked for on $PATH and run with
+	// the remaining arguments. Plugins are listed in the help output.
+	PluginPrefix string
+
+	// DryRunFlag, if true, adds a --dry-run flag accepted by all
+	// subcommands, which sets the DryRun field of the Context. Commands
+	// that are run with it are responsible for not making any changes.
+	DryRunFlag bool
+
+	// AssumeYesFlag, if true, adds the -y and --assume-yes flags
+	// accepted by all subcommands, which set the AssumeYes field of the
+	// Context so that Context.Confirm answers yes without asking. This
+	// lets scripts run commands that would otherwise stop to confirm a
+	// destructive operation, so it removes a safeguard against mistakes.
+	AssumeYesFlag bool
+
+	// TimeoutFlag, if true, adds a --timeout flag accepted by all
+	// subcommands, which takes a duration such as "30s" or "5m". When it
+	// is given, the command's context is cancelled once that time has
+	// passed, and Main exits with ExitTimeout. Commands that do not stop
+	// when their context is cancelled are given the same grace period as
+	// interrupted commands before the process exits.
+	TimeoutFlag bool
+
+	// TimingFlag, if true, adds a --timing flag accepted by all
+	// subcommands. When it is given, Main writes the time spent in each
+	// phase of the command timed with Context.StartPhase, and the total
+	// time taken, to Stderr once the command has finished.
+	TimingFlag bool
+
+	// GlobalFlags, if not nil, adds flags that are accepted by every
+	// subcommand in the command tree, including the subcommands of any
+	// nested SuperCommands, both before and after the subcommand name.
+	// The flags are usually bound to the fields of a struct shared with
+	// the subcommands, which read them in Run. They are listed under
+	// "Global options" in the help for each subcommand. It may be called
+	// more than once, so it should bind each flag to the same variable
+	// every time.
+	GlobalFlags func(f *gnuflag.FlagSet)
+
+	// PrefixMatching, if true, allows a subcommand to be given by any
+	// prefix of its name, or of one of its aliases, that does not match
+	// any other listed subcommand, so that "stat" runs "status". Note
+	// that registering a new subcommand can make a prefix ambiguous.
+	PrefixMatching bool
+
+	// CacheResults, if true, lets subcommands that implement
+	// CachedCommand reuse the output of earlier runs, which is kept in
+	// the "results" directory of the cache directory for Name. It adds
+	// a --no-cache flag accepted by all subcommands, which runs the
+	// command afresh and caches its new output, and a clear-cache
+	// subcommand that removes everything cached.
+	CacheResults bool
+
+	// AtomicOutput, if true, holds back what subcommands write to Stdout
+	// when a machine readable format such as json or yaml has been
+	// chosen with --format, and writes it only if the subcommand
+	// succeeds, so that a failure never leaves a truncated document on
+	// Stdout. Large output is held in a temporary file. Commands that
+	// stream their output can opt out by calling Context.StreamOutput,
+	// as Output.Stream does.
+	AtomicOutput bool
+
+	// QualifyErrors, if true, prefixes the errors returned by subcommands
+	// with the full name of the subcommand, as in "mytool storage add:
+	// no such pool", so that it is clear which command failed. It also
+	// applies to the subcommands of any nested SuperCommands. The
+	// original error can still be found with errors.Cause.
+	QualifyErrors bool
+
+	// InheritedValues, if not nil, adds a global flag for each of the
+	// values, which are resolved once, from the flag, the ConfigFlag
+	// file, the environment or their defaults, and given to each
+	// subcommand, or subcommand of a nested SuperCommand, that implements
+	// ValueInheritor. See InheritedValue for the order in which the
+	// sources are consulted.
+	InheritedValues []InheritedValue
 }
 
 // NewSuperCommand creates and initializes a new `SuperCommand`, and returns
@@ -84,8 +212,58 @@ func NewSuperCommand(params SuperCommandParams) *SuperCommand {
 		Aliases:             params.Aliases,
 		version:             params.Version,
 		notifyRun:           params.NotifyRun,
+		preRun:              params.PreRun,
+		postRun:             params.PostRun,
 		notifyHelp:          params.NotifyHelp,
 		userAliasesFilename: params.UserAliasesFilename,
+		allowAliasOverride:  params.AllowAliasOverride,
+		configFlag:          params.ConfigFlag,
+		defaultCommand:      params.DefaultCommand,
+		pluginPrefix:        params.PluginPrefix,
+		prefixMatching:      params.PrefixMatching,
+		qualifyErrors:       params.QualifyErrors,
+		atomicOutput:        params.AtomicOutput,
+	}
+	if params.DryRunFlag {
+		command.globalFlagAdders = append(command.globalFlagAdders, func(f *gnuflag.FlagSet) {
+			f.BoolVar(&command.dryRun, "dry-run", false, "show what would be done, without doing it")
+		})
+	}
+	if params.AssumeYesFlag {
+		command.assumeYesFlag = true
+		command.globalFlagAdders = append(command.globalFlagAdders, func(f *gnuflag.FlagSet) {
+			f.BoolVar(&command.assumeYes, "y", false, assumeYesUsage)
+			f.BoolVar(&command.assumeYes, "assume-yes", false, "")
+		})
+	}
+	if params.TimeoutFlag {
+		command.globalFlagAdders = append(command.globalFlagAdders, func(f *gnuflag.FlagSet) {
+			DurationVar(f, &command.timeout, "timeout", 0, "give up if the command has not finished after this long (e.g. 30s, 5m)")
+		})
+	}
+	if params.TimingFlag {
+		command.globalFlagAdders = append(command.globalFlagAdders, func(f *gnuflag.FlagSet) {
+			f.BoolVar(&command.timing, "timing", false, "show how long the command took")
+		})
+	}
+	if params.CacheResults {
+		command.cache = &resultCache{name: params.Name}
+		command.globalFlagAdders = append(command.globalFlagAdders, func(f *gnuflag.FlagSet) {
+			f.BoolVar(&command.cache.noCache, "no-cache", false, "ignore cached results of earlier runs")
+		})
+	}
+	for _, value := range params.InheritedValues {
+		command.inheritedValues = append(command.inheritedValues, &inheritedValue{InheritedValue: value})
+	}
+	if len(command.inheritedValues) > 0 {
+		command.globalFlagAdders = append(command.globalFlagAdders, func(f *gnuflag.FlagSet) {
+			for _, v := range command.inheritedValues {
+				v.addFlag(f)
+			}
+		})
+	}
+	if params.GlobalFlags != nil {
+		command.globalFlagAdders = append(command.globalFlagAdders, params.GlobalFlags)
 	}
 	command.init()
 	return command
@@ -110,6 +288,8 @@ type commandReference struct {
 	command Command
 	alias   string
 	check   DeprecationCheck
+	// Hidden commands can be run, but are not listed in help output.
+	hidden bool
 }
 
 // SuperCommand is a Command that selects a subcommand and assumes its
@@ -127,6 +307,7 @@ type SuperCommand struct {
 	usagePrefix         string
 	userAliasesFilename string
 	userAliases         map[string][]string
+	allowAliasOverride  bool
 	subcmds             map[string]commandReference
 	help                *helpCommand
 	commonflags         *gnuflag.FlagSet
@@ -138,7 +319,61 @@ type SuperCommand struct {
 	noAlias             bool
 	missingCallback     MissingCallback
 	notifyRun           func(string)
+	preRun              func(Command, *Context) error
+	postRun             func(Command, *Context, error) error
 	notifyHelp          func([]string)
+	color               ColorMode
+	configFlag          string
+	configPath          string
+	showHelpAll         bool
+	showCommands        bool
+	includeAliases      bool
+	noPager             bool
+	includeHidden       bool
+	showSubVersion      bool
+	defaultCommand      string
+	pluginPrefix        string
+	dryRun              bool
+	assumeYes           bool
+	assumeYesFlag       bool
+	timeout             time.Duration
+	timing              bool
+	cache               *resultCache
+	// globalFlagAdders add the global flags of this SuperCommand to a
+	// flag set; setGlobalFlags collects them, along with inheritedFlags,
+	// in globalflags.
+	globalFlagAdders []func(*gnuflag.FlagSet)
+	inheritedFlags   []*gnuflag.Flag
+	globalflags      *gnuflag.FlagSet
+	prefixMatching   bool
+	qualifyErrors    bool
+	atomicOutput     bool
+	// inheritedValues holds the values created with InheritedValues,
+	// and parentValues those of the SuperCommands above this one.
+	inheritedValues []*inheritedValue
+	parentValues    []*inheritedValue
+	// parentName holds the full name of the SuperCommand that this one
+	// is nested in, if any.
+	parentName string
+	// programName holds the ProgramName of the Context given to
+	// SetContext, if any, which is shown in place of its Name.
+	programName string
+	// initContext holds the Context given to SetContext, if any, from
+	// which Init reads @file arguments.
+	initContext *Context
+}
+
+// assumeYesUsage is the usage text of the --assume-yes flag.
+const assumeYesUsage = "answer yes to all confirmation prompts; take care, as this skips the checks that guard against destructive mistakes"
+
+// SetContext implements ContextSetter. Init reads @file arguments and the
+// defaults of flags from ctx, and the SuperCommand is shown by the
+// ProgramName of ctx, if that is set, rather than its Name. Main calls
+// SetContext itself; a SuperCommand initialized without a Context reads
+// from the process's working directory and environment.
+func (c *SuperCommand) SetContext(ctx *Context) {
+	c.programName = ctx.ProgramName
+	c.initContext = ctx
 }
 
 // IsSuperCommand implements Command.IsSuperCommand
@@ -156,12 +391,25 @@ func (c *SuperCommand) init() {
 	c.help.init()
 	c.subcmds = map[string]commandReference{
 		"help": commandReference{command: c.help},
+		"bash-completion": commandReference{
+			command: &bashCompletionCommand{super: c},
+			hidden:  true,
+		},
+		"zsh-completion": commandReference{
+			command: &zshCompletionCommand{super: c},
+			hidden:  true,
+		},
 	}
 	if c.version != "" {
 		c.subcmds["version"] = commandReference{
 			command: newVersionCommand(c.version),
 		}
 	}
+	if c.cache != nil {
+		c.subcmds["clear-cache"] = commandReference{
+			command: &clearCacheCommand{cache: c.cache},
+		}
+	}
 
 	c.userAliases = ParseAliasFile(c.userAliasesFilename)
 }
@@ -183,10 +431,27 @@ func (c *SuperCommand) AddHelpTopicCallback(name, short string, longCallback fun
 // Register makes a subcommand available for use on the command line. The
 // command will be available via its own name, and via any supplied aliases.
 func (c *SuperCommand) Register(subcmd Command) {
+	c.register(subcmd, false)
+}
+
+// RegisterHidden makes a subcommand available for use on the command line
+// in the same way as Register, but neither the command nor its aliases are
+// listed in help output.
+func (c *SuperCommand) RegisterHidden(subcmd Command) {
+	c.register(subcmd, true)
+}
+
+// register inserts subcmd under its name, its aliases and its deprecated
+// aliases, as described by its Info.
+func (c *SuperCommand) register(subcmd Command, hidden bool) {
 	info := subcmd.Info()
-	c.insert(commandReference{name: info.Name, command: subcmd})
+	check := deprecatedBy(info.Deprecated)
+	c.insert(commandReference{name: info.Name, command: subcmd, hidden: hidden, check: check})
 	for _, name := range info.Aliases {
-		c.insert(commandReference{name: name, command: subcmd, alias: info.Name})
+		c.insert(commandReference{name: name, command: subcmd, alias: info.Name, hidden: hidden, check: check})
+	}
+	for _, name := range info.DeprecatedAliases {
+		c.insert(commandReference{name: name, command: subcmd, alias: info.Name, hidden: hidden, check: deprecatedBy(info.Name)})
 	}
 }
 
@@ -260,14 +525,40 @@ func (c *SuperCommand) RegisterSuperAlias(name, super, forName string, check Dep
 	})
 }
 
+// insert adds value to the registered subcommands. Registering a name
+// that cannot be typed as a single argument, or one that is already
+// registered, is a programming error, so it panics rather than leaving
+// the mistake to be found by a user of the broken command.
 func (c *SuperCommand) insert(value commandReference) {
-	if _, found := c.subcmds[value.name]; found {
+	if err := checkCommandName(value.name); err != nil {
+		panic(err.Error())
+	}
+	if existing, found := c.subcmds[value.name]; found {
+		if existing.alias != "" {
+			panic(fmt.Sprintf("command already registered: %q, as an alias for %q", value.name, existing.alias))
+		}
 		panic(fmt.Sprintf("command already registered: %q", value.name))
 	}
 	c.subcmds[value.name] = value
 }
 
+// checkCommandName returns an error if name cannot be used as the name of
+// a subcommand.
+func checkCommandName(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("invalid command name: name is empty")
+	case strings.IndexFunc(name, unicode.IsSpace) >= 0:
+		return fmt.Errorf("invalid command name %q: name contains white space", name)
+	case strings.HasPrefix(name, "-"):
+		return fmt.Errorf("invalid command name %q: name starts with %q", name, "-")
+	}
+	return nil
+}
+
 // describeCommands returns a short description of each registered subcommand.
+// Aliases for a subcommand are listed in parentheses after its name. Hidden
+// and deprecated commands and aliases are not listed at all.
 func (c *SuperCommand) describeCommands(simple bool) string {
 	var lineFormat = "    %-*s - %s"
 	var outputFormat = "commands:\n%s"
@@ -275,39 +566,165 @@ func (c *SuperCommand) describeCommands(simple bool) string {
 		lineFormat = "%-*s  %s"
 		outputFormat = "%s"
 	}
-	cmds := make([]string, len(c.subcmds))
-	i := 0
+	labels := make(map[string]string)
 	longest := 0
-	for name := range c.subcmds {
+	plugins := findPlugins(c.pluginPrefix)
+	for name := range plugins {
+		if _, found := c.subcmds[name]; found {
+			delete(plugins, name)
+			continue
+		}
 		if len(name) > longest {
 			longest = len(name)
 		}
-		cmds[i] = name
-		i++
+		labels[name] = name
+	}
+	for name, action := range c.subcmds {
+		if !action.listed() {
+			continue
+		}
+		if _, found := c.subcmds[action.alias]; found {
+			// Listed alongside the command it is an alias for.
+			continue
+		}
+		label := name
+		if aliases := c.aliasesFor(name); len(aliases) > 0 {
+			label = fmt.Sprintf("%s (%s)", name, strings.Join(aliases, ", "))
+		}
+		if len(label) > longest {
+			longest = len(label)
+		}
+		labels[name] = label
+	}
+	cmds := make([]string, 0, len(labels))
+	for name := range labels {
+		cmds = append(cmds, name)
 	}
 	sort.Strings(cmds)
-	var result []string
+	// Commands are grouped by category, if any command has one.
+	categories := make(map[string][]string)
 	for _, name := range cmds {
-		action := c.subcmds[name]
-		if deprecated, _ := action.Deprecated(); deprecated {
-			continue
+		category := ""
+		if _, found := plugins[name]; !found {
+			category = c.subcmds[name].command.Info().Category
 		}
-		info := action.command.Info()
-		purpose := info.Purpose
-		if action.alias != "" {
-			purpose = "alias for '" + action.alias + "'"
+		categories[category] = append(categories[category], name)
+	}
+	var result []string
+	describe := func(names []string) {
+		for _, name := range names {
+			if path, found := plugins[name]; found {
+				result = append(result, fmt.Sprintf(lineFormat, longest, labels[name], pluginPurpose(path)))
+				continue
+			}
+			action := c.subcmds[name]
+			info := action.command.Info()
+			purpose := info.Purpose
+			if action.alias != "" {
+				purpose = "alias for '" + action.alias + "'"
+			}
+			result = append(result, fmt.Sprintf(lineFormat, longest, labels[name], purpose))
+		}
+	}
+	if _, found := categories[""]; found && len(categories) == 1 {
+		describe(cmds)
+		return fmt.Sprintf(outputFormat, strings.Join(result, "\n"))
+	}
+	var names []string
+	for category := range categories {
+		if category != "" {
+			names = append(names, category)
+		}
+	}
+	sort.Strings(names)
+	if _, found := categories[""]; found {
+		names = append(names, "")
+	}
+	for i, category := range names {
+		if i > 0 {
+			result = append(result, "")
+		}
+		heading := category
+		if heading == "" {
+			heading = otherCategory
 		}
-		result = append(result, fmt.Sprintf(lineFormat, longest, name, purpose))
+		result = append(result, heading+":")
+		describe(categories[category])
 	}
 	return fmt.Sprintf(outputFormat, strings.Join(result, "\n"))
 }
 
+// otherCategory is the heading under which commands without a category
+// are listed when other commands have one.
+const otherCategory = "Other"
+
+// aliasesFor returns the sorted names of the aliases registered for the
+// named subcommand, excluding any that are hidden or deprecated.
+func (c *SuperCommand) aliasesFor(name string) []string {
+	var aliases []string
+	for alias, action := range c.subcmds {
+		if action.alias != name || !action.listed() {
+			continue
+		}
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	return aliases
+}
+
+// expandUserAliases replaces the first of args, as long as it names a user
+// alias, with the alias' arguments. An alias that expands to itself,
+// directly or through other aliases, is an error.
+func (c *SuperCommand) expandUserAliases(args []string) ([]string, error) {
+	var expanded []string
+	for len(args) > 0 {
+		name := args[0]
+		userAlias, found := c.userAliases[name]
+		if !found {
+			return args, nil
+		}
+		if _, isCommand := c.subcmds[name]; isCommand && (!c.allowAliasOverride || len(expanded) > 0) {
+			if len(expanded) == 0 {
+				logger.Debugf("ignoring alias %q as it is the name of a command", name)
+			}
+			return args, nil
+		}
+		for _, previous := range expanded {
+			if previous == name {
+				return nil, fmt.Errorf("alias loop: %s -> %s", strings.Join(expanded, " -> "), name)
+			}
+		}
+		expanded = append(expanded, name)
+		logger.Debugf("using alias %q=%q", name, strings.Join(userAlias, " "))
+		args = append(append([]string(nil), userAlias...), args[1:]...)
+	}
+	return args, nil
+}
+
+// commandNames returns the sorted names of the listed subcommands, along
+// with those of their aliases if includeAliases is true, and those of
+// hidden and deprecated subcommands if includeHidden is true.
+func (c *SuperCommand) commandNames(includeAliases, includeHidden bool) []string {
+	var names []string
+	for name, action := range c.subcmds {
+		if action.alias != "" && !includeAliases {
+			continue
+		}
+		if !action.listed() && !includeHidden {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // Info returns a description of the currently selected subcommand, or of the
 // SuperCommand itself if no subcommand has been specified.
 func (c *SuperCommand) Info() *Info {
 	if c.action.command != nil {
 		info := *c.action.command.Info()
-		info.Name = fmt.Sprintf("%s %s", c.Name, info.Name)
+		info.Name = fmt.Sprintf("%s %s", c.name(), info.Name)
 		return &info
 	}
 	docParts := []string{}
@@ -318,7 +735,7 @@ func (c *SuperCommand) Info() *Info {
 		docParts = append(docParts, cmds)
 	}
 	return &Info{
-		Name:    c.Name,
+		Name:    c.name(),
 		Args:    "<command> ...",
 		Purpose: c.Purpose,
 		Doc:     strings.Join(docParts, "\n\n"),
@@ -328,6 +745,36 @@ func (c *SuperCommand) Info() *Info {
 
 const helpPurpose = "show help on a command or other topic"
 
+// setGlobalFlags adds the global flags of c to f, including those
+// inherited from the SuperCommands above it, and records them so that
+// they can be passed on to nested SuperCommands. Inherited flags are
+// added with their existing values, so that any values they were given
+// on the command line are kept.
+func (c *SuperCommand) setGlobalFlags(f *gnuflag.FlagSet) {
+	c.globalflags = gnuflag.NewFlagSet(c.Name, gnuflag.ContinueOnError)
+	for _, addFlags := range c.globalFlagAdders {
+		addFlags(c.globalflags)
+	}
+	for _, flag := range c.inheritedFlags {
+		c.globalflags.Var(flag.Value, flag.Name, flag.Usage)
+	}
+	c.globalflags.VisitAll(func(flag *gnuflag.Flag) {
+		f.Var(flag.Value, flag.Name, flag.Usage)
+	})
+}
+
+// inheritGlobalFlags makes the global flags of c accepted by the
+// subcommands of the nested SuperCommand sub.
+func (c *SuperCommand) inheritGlobalFlags(sub *SuperCommand) {
+	sub.inheritedFlags = nil
+	if c.globalflags == nil {
+		return
+	}
+	c.globalflags.VisitAll(func(flag *gnuflag.Flag) {
+		sub.inheritedFlags = append(sub.inheritedFlags, flag)
+	})
+}
+
 // SetCommonFlags creates a new "commonflags" flagset, whose
 // flags are shared with the argument f; this enables us to
 // add non-global flags to f, which do not carry into subcommands.
@@ -342,6 +789,11 @@ func (c *SuperCommand) SetCommonFlags(f *gnuflag.FlagSet) {
 	// The Purpose attribute will be printed (if defined), allowing
 	// plugins to provide a sensible line of text for 'juju help plugins'.
 	f.BoolVar(&c.showDescription, "description", false, "")
+	f.Var(&c.color, "color", "colorize error and warning output (auto|always|never)")
+	if c.configFlag != "" {
+		f.StringVar(&c.configPath, c.configFlag, "", "read flag values from this YAML file")
+	}
+	c.setGlobalFlags(f)
 	c.commonflags = gnuflag.NewFlagSet(c.Info().Name, gnuflag.ContinueOnError)
 	c.commonflags.SetOutput(ioutil.Discard)
 	f.VisitAll(func(flag *gnuflag.Flag) {
@@ -357,10 +809,16 @@ func (c *SuperCommand) SetFlags(f *gnuflag.FlagSet) {
 	// Any flags added below only take effect when no subcommand is
 	// specified (e.g. command --version).
 	if c.version != "" {
-		f.BoolVar(&c.showVersion, "version", false, "show the command's version and exit")
+		f.BoolVar(&c.showVersion, "version", false, versionFlagUsage)
 	}
+	f.BoolVar(&c.showHelpAll, "help-all", false, "show help for all commands and exit")
+	f.BoolVar(&c.showCommands, "commands", false, "list the names of the commands, one per line, and exit")
+	f.BoolVar(&c.includeAliases, "include-aliases", false, "include aliases in --commands output")
+	f.BoolVar(&c.includeHidden, "include-hidden", false, "include hidden commands in --help-all and --commands output")
+	f.BoolVar(&c.noPager, "no-pager", false, "do not pipe help output through a pager")
 	if c.userAliasesFilename != "" {
 		f.BoolVar(&c.noAlias, "no-alias", false, "do not process command aliases when running this command")
+		f.BoolVar(&c.noAlias, "no-aliases", false, "")
 	}
 	c.flags = f
 }
@@ -373,28 +831,70 @@ func (c *SuperCommand) AllowInterspersedFlags() bool {
 	return false
 }
 
+// subcommandVersion returns the version of the selected subcommand, which
+// is the SuperCommand's version unless the subcommand implements Versioner.
+func (c *SuperCommand) subcommandVersion() string {
+	if v, ok := c.action.command.(Versioner); ok {
+		return v.Version()
+	}
+	return c.version
+}
+
+// HandlesSignals implements SignalHandler by reporting whether the
+// selected subcommand handles SIGINT and SIGTERM itself.
+func (c *SuperCommand) HandlesSignals() bool {
+	return c.action.command != nil && handlesSignals(c.action.command)
+}
+
 // Init initializes the command for running.
 func (c *SuperCommand) Init(args []string) error {
-	if c.showDescription {
+	if c.showDescription || c.showHelpAll || c.showCommands {
 		return CheckEmpty(args)
 	}
+	if len(args) == 0 && c.defaultCommand != "" && !c.showHelp && !c.showVersion {
+		args = []string{c.defaultCommand}
+	}
 	if len(args) == 0 {
 		c.action = c.subcmds["help"]
 		return c.action.command.Init(args)
 	}
 
-	if userAlias, found := c.userAliases[args[0]]; found && !c.noAlias {
-		logger.Debugf("using alias %q=%q", args[0], strings.Join(userAlias, " "))
-		args = append(userAlias, args[1:]...)
+	if !c.noAlias {
+		var err error
+		if args, err = c.expandUserAliases(args); err != nil {
+			return err
+		}
 	}
 	found := false
+	if _, found = c.subcmds[args[0]]; !found && c.prefixMatching {
+		name, err := c.matchPrefix(args[0])
+		if err != nil {
+			return err
+		}
+		if name != "" {
+			logger.Debugf("using %q for %q", name, args[0])
+			args = append([]string{name}, args[1:]...)
+		}
+	}
 	// Look for the command.
 	if c.action, found = c.subcmds[args[0]]; !found {
+		if path, ok := findPlugin(c.pluginPrefix, args[0]); ok {
+			c.action = commandReference{
+				name: args[0],
+				command: &pluginCommand{
+					name: args[0],
+					path: path,
+					args: args[1:],
+				},
+			}
+			// The plugin parses its own arguments, so there is no Init.
+			return nil
+		}
 		if c.missingCallback != nil {
 			c.action = commandReference{
 				command: &missingCommand{
 					callback:  c.missingCallback,
-					superName: c.Name,
+					superName: c.name(),
 					name:      args[0],
 					args:      args[1:],
 				},
@@ -402,27 +902,82 @@ func (c *SuperCommand) Init(args []string) error {
 			// Yes return here, no Init called on missing Command.
 			return nil
 		}
-		return fmt.Errorf("unrecognized command: %s %s", c.Name, args[0])
+		if suggestion := c.suggestCommand(args[0]); suggestion != "" {
+			return fmt.Errorf("unrecognized command: %s %s\ndid you mean '%s'?", c.fullName(), args[0], suggestion)
+		}
+		return fmt.Errorf("unrecognized command: %s %s", c.fullName(), args[0])
 	}
 	args = args[1:]
 	subcmd := c.action.command
+	flags := c.commonflags
 	if subcmd.IsSuperCommand() {
+		if super, ok := subcmd.(*SuperCommand); ok {
+			c.adopt(super)
+		}
 		f := gnuflag.NewFlagSet(c.Info().Name, gnuflag.ContinueOnError)
 		f.SetOutput(ioutil.Discard)
 		subcmd.SetFlags(f)
+		if _, ok := subcmd.(*SuperCommand); ok {
+			// The flags of the nested SuperCommand, such as
+			// --version, may follow its name, along with any of
+			// our common flags that it does not define itself.
+			c.commonflags.VisitAll(func(flag *gnuflag.Flag) {
+				if f.Lookup(flag.Name) == nil {
+					f.Var(flag.Value, flag.Name, flag.Usage)
+				}
+			})
+			flags = f
+		}
 	} else {
 		subcmd.SetFlags(c.commonflags)
+		if c.subcommandVersion() != "" {
+			addVersionFlag(c.commonflags, &c.showSubVersion)
+		}
+	}
+	args = splitPassthroughArgs(subcmd, args)
+	if err := parseFlags(subcmd, flags, args); err != nil {
+		return newFlagError(err)
 	}
-	if err := c.commonflags.Parse(subcmd.AllowInterspersedFlags(), args); err != nil {
+	resolveEnvDefaults(c.initContext, flags)
+	if err := checkStdinFlags(c.initContext, flags); err != nil {
 		return err
 	}
-	args = c.commonflags.Args()
+	if c.showSubVersion {
+		return nil
+	}
+	if c.configPath != "" {
+		path := c.configPath
+		if c.initContext != nil {
+			path = c.initContext.AbsPath(path)
+		}
+		if err := SetFlagsFromConfig(c.commonflags, path); err != nil {
+			return err
+		}
+	}
+	if c.Log != nil {
+		// Log.Start would refuse these too, but only once the command
+		// is run, and without showing the usage.
+		if err := CheckExclusiveFlags(c.commonflags, "verbose", "quiet"); err != nil {
+			return err
+		}
+	}
+	args = flags.Args()
 	if c.showHelp {
 		// We want to treat help for the command the same way we would if we went "help foo".
 		args = []string{c.action.name}
 		c.action = c.subcmds["help"]
 	}
-	return c.action.command.Init(args)
+	if err := setInheritedValues(c.initContext, c.action.command, c.allInheritedValues()); err != nil {
+		return err
+	}
+	return initWithArgFiles(c.initContext, c.action.command, args)
+}
+
+// allInheritedValues returns the values that are given to the commands
+// below c that implement ValueInheritor.
+func (c *SuperCommand) allInheritedValues() []*inheritedValue {
+	values := append([]*inheritedValue(nil), c.parentValues...)
+	return append(values, c.inheritedValues...)
 }
 
 // Run executes the subcommand that was selected in Init.
@@ -435,30 +990,93 @@ func (c *SuperCommand) Run(ctx *Context) error {
 		}
 		return nil
 	}
+	if c.showSubVersion {
+		return printVersion(ctx, c.subcommandVersion())
+	}
+	if c.noPager {
+		ctx.noPager = true
+	}
+	if c.showHelpAll {
+		var buf bytes.Buffer
+		c.writeAllHelp(&buf, c.fullName(), c.includeHidden, ctx.TerminalWidth())
+		ctx.writePaged(buf.Bytes())
+		return nil
+	}
+	if c.showCommands {
+		for _, name := range c.commandNames(c.includeAliases, c.includeHidden) {
+			fmt.Fprintln(ctx.Stdout, name)
+		}
+		return nil
+	}
 	if c.action.command == nil {
 		panic("Run: missing subcommand; Init failed or not called")
 	}
+	// A nested SuperCommand keeps any color mode chosen by its parent
+	// unless one is given explicitly.
+	if c.color != ColorAuto {
+		ctx.color = c.color
+	}
+	if c.dryRun {
+		ctx.DryRun = true
+	}
+	if c.assumeYes {
+		ctx.AssumeYes = true
+	}
+	if c.assumeYesFlag {
+		ctx.assumeYesFlag = true
+	}
+	if c.timing && ctx.timings == nil {
+		ctx.timings = newTimings()
+	}
 	if c.Log != nil {
 		if err := c.Log.Start(ctx); err != nil {
 			return err
 		}
 	}
 	if c.notifyRun != nil {
-		name := c.Name
-		if c.usagePrefix != "" && c.usagePrefix != name {
-			name = c.usagePrefix + " " + name
-		}
-		c.notifyRun(name)
+		c.notifyRun(c.fullName())
 	}
 	if deprecated, replacement := c.action.Deprecated(); deprecated {
-		ctx.Infof("WARNING: %q is deprecated, please use %q", c.action.name, replacement)
+		ctx.Infof("%s %q is deprecated, please use %q", ctx.colorize(ansiYellow, "WARNING:"), c.action.name, replacement)
+	}
+	if err := checkExistingFiles(ctx, c.commonflags); err != nil {
+		return err
+	}
+	warnDeprecatedFlags(ctx, c.commonflags)
+	if err := promptSecrets(ctx, c.commonflags); err != nil {
+		return err
+	}
+	if formatter := machineFormatter(c.commonflags); formatter != nil {
+		ctx.errorFormatter = formatter
+	}
+	err := c.runBuffered(ctx)
+	if ctx.isBrokenStdout(err) {
+		logger.Debugf("stopped writing output: %v", err)
+		return nil
 	}
-	err := c.action.command.Run(ctx)
 	if err != nil && !IsErrSilent(err) {
-		logger.Errorf("%v", err)
+		if c.qualifyErrors {
+			err = c.qualifyError(err)
+		}
+		if ctx.errorFormatter != nil {
+			// Keep Stderr machine readable by reporting the
+			// error only in the chosen format.
+			if rcErr, report := causeRcError(err); rcErr != nil {
+				ctx.writeError(report, rcErr.Code)
+			} else {
+				ctx.writeError(err, ExitFailure)
+			}
+		} else {
+			logger.Errorf("%v", err)
+			if ctx.debug {
+				ctx.writeErrorDetails(err)
+			}
+		}
 		logger.Debugf("(error details: %v)", errors.Details(err))
 		// Now that this has been logged, don't log again in cmd.Main.
-		if !IsRcPassthroughError(err) {
+		if rcErr, _ := causeRcError(err); rcErr != nil {
+			err = NewRcPassthroughError(rcErr.Code)
+		} else if !IsRcPassthroughError(err) {
 			err = ErrSilent
 		}
 	} else {
@@ -467,6 +1085,191 @@ func (c *SuperCommand) Run(ctx *Context) error {
 	return err
 }
 
+// fullName returns the name of the SuperCommand as typed on the command
+// line, including the names of any SuperCommands it is nested in.
+func (c *SuperCommand) fullName() string {
+	name := c.name()
+	if prefix := c.namePrefix(); prefix != "" && prefix != name {
+		return prefix + " " + name
+	}
+	return name
+}
+
+// name returns the name of c as it was invoked: the ProgramName of the
+// Context that Main is running it in, if that is set, or else its Name.
+func (c *SuperCommand) name() string {
+	if c.programName != "" {
+		return c.programName
+	}
+	return c.Name
+}
+
+// namePrefix returns the name of the SuperCommand that this one is
+// registered with, when it is run or shown as one of its subcommands, or
+// else its UsagePrefix.
+func (c *SuperCommand) namePrefix() string {
+	if c.parentName != "" {
+		return c.parentName
+	}
+	return c.usagePrefix
+}
+
+// adopt prepares sub, one of the subcommands, to be run or shown as such.
+func (c *SuperCommand) adopt(sub *SuperCommand) {
+	c.inheritGlobalFlags(sub)
+	sub.parentName = c.fullName()
+	sub.initContext = c.initContext
+	sub.parentValues = c.allInheritedValues()
+	if c.qualifyErrors {
+		sub.qualifyErrors = true
+	}
+	if sub.preRun == nil && sub.postRun == nil {
+		sub.preRun, sub.postRun = c.preRun, c.postRun
+	}
+	if sub.cache == nil {
+		sub.cache = c.cache
+	}
+	if c.atomicOutput {
+		sub.atomicOutput = true
+	}
+}
+
+// qualifyError annotates err, returned by the selected subcommand, with
+// the subcommand's full name as it was invoked. An RcError, even one that
+// has itself been annotated, is rebuilt around the annotated error so that
+// its code is kept.
+func (c *SuperCommand) qualifyError(err error) error {
+	name := c.fullName() + " " + c.action.name
+	if rcErr, report := causeRcError(err); rcErr != nil {
+		return NewRcError(rcErr.Code, errors.Annotate(report, name))
+	}
+	return errors.Annotate(err, name)
+}
+
+// runHooked runs the selected subcommand between the PreRun and PostRun
+// hooks. The hooks of a nested SuperCommand have been passed on to it, so
+// are not called here.
+func (c *SuperCommand) runHooked(ctx *Context) error {
+	command := c.action.command
+	if _, ok := command.(*SuperCommand); ok {
+		return c.runAction(ctx)
+	}
+	if c.preRun != nil {
+		if err := c.preRun(command, ctx); err != nil {
+			return err
+		}
+	}
+	err := c.runCached(ctx)
+	if c.postRun != nil {
+		err = c.postRun(command, ctx, err)
+	}
+	return err
+}
+
+// runAction runs the selected subcommand, cancelling its context if it
+// outlives any timeout given with the --timeout flag.
+func (c *SuperCommand) runAction(ctx *Context) error {
+	if c.timeout <= 0 {
+		return c.action.command.Run(ctx)
+	}
+	stop := ctx.cancelAfter(c.timeout)
+	err := c.action.command.Run(ctx)
+	if stop() {
+		return NewRcError(ExitTimeout, fmt.Errorf("command timed out after %v", c.timeout))
+	}
+	return err
+}
+
+// maxSuggestionDistance is the largest edit distance between an
+// unrecognized command name and a registered one for which the registered
+// command is suggested instead.
+const maxSuggestionDistance = 2
+
+// suggestCommand returns the name of the listed subcommand or alias that is
+// closest to name, or the empty string if none is close enough. Ties are
+// resolved in favour of the alphabetically first name.
+func (c *SuperCommand) suggestCommand(name string) string {
+	var names []string
+	for candidate, action := range c.subcmds {
+		if action.listed() {
+			names = append(names, candidate)
+		}
+	}
+	sort.Strings(names)
+	best, bestDistance := "", maxSuggestionDistance+1
+	for _, candidate := range names {
+		distance := levenshtein(name, candidate)
+		if distance < bestDistance && distance < len(name) {
+			best, bestDistance = candidate, distance
+		}
+	}
+	return best
+}
+
+// matchPrefix returns the name of the listed subcommand or alias that
+// prefix is a prefix of, or "" if there is none. It is an error for the
+// names that prefix matches to refer to more than one subcommand. If they
+// all refer to the same subcommand, its own name is preferred.
+func (c *SuperCommand) matchPrefix(prefix string) (string, error) {
+	matches := make(map[string]string)
+	for name, action := range c.subcmds {
+		if !action.listed() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		target := name
+		if action.alias != "" {
+			target = action.alias
+		}
+		if matched, found := matches[target]; !found || name == target || (matched != target && name < matched) {
+			matches[target] = name
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", nil
+	case 1:
+		for _, name := range matches {
+			return name, nil
+		}
+	}
+	var candidates []string
+	for _, name := range matches {
+		candidates = append(candidates, name)
+	}
+	sort.Strings(candidates)
+	return "", fmt.Errorf("ambiguous command: %s %s\ncould be any of: %s", c.fullName(), prefix, strings.Join(candidates, ", "))
+}
+
+// levenshtein returns the number of single character insertions, deletions
+// and substitutions needed to turn a into b.
+func levenshtein(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	previous := make([]int, len(t)+1)
+	current := make([]int, len(t)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := range s {
+		current[0] = i + 1
+		for j := range t {
+			cost := 1
+			if s[i] == t[j] {
+				cost = 0
+			}
+			distance := previous[j] + cost
+			if d := previous[j+1] + 1; d < distance {
+				distance = d
+			}
+			if d := current[j] + 1; d < distance {
+				distance = d
+			}
+			current[j+1] = distance
+		}
+		previous, current = current, previous
+	}
+	return previous[len(t)]
+}
+
 type missingCommand struct {
 	CommandBase
 	callback  MissingCallback
@@ -498,3 +1301,12 @@ func (r commandReference) Deprecated() (bool, string) {
 	}
 	return r.check.Deprecated()
 }
+
+// listed returns whether the command should be listed in help output.
+func (r commandReference) listed() bool {
+	if r.hidden {
+		return false
+	}
+	deprecated, _ := r.Deprecated()
+	return !deprecated
+}
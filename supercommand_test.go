@@ -8,8 +8,11 @@ import (
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
+	"regexp"
 	"strings"
 
+	"github.com/juju/errors"
+	"github.com/juju/loggo"
 	gitjujutesting "github.com/juju/testing"
 	gc "gopkg.in/check.v1"
 	"launchpad.net/gnuflag"
@@ -32,6 +35,11 @@ func initDefenestrateWithAliases(c *gc.C, args []string) (*cmd.SuperCommand, *Te
 def = defenestrate
 be-firm = defenestrate --option firmly
 other = missing 
+quoted = defenestrate --option "very firmly"
+chained = be-firm
+loop = looped
+looped = loop
+defenestrate = defenestrate --option shadowed
 		`), 0644)
 	c.Assert(err, gc.IsNil)
 	jc := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "jujutest", UserAliasesFilename: filename})
@@ -115,6 +123,56 @@ func (s *SuperCommandSuite) TestUserAliasDispatch(c *gc.C) {
 	// Aliases to missing values are converted before lookup.
 	_, _, err = initDefenestrateWithAliases(c, []string{"other"})
 	c.Assert(err, gc.ErrorMatches, "unrecognized command: jujutest missing")
+
+	_, _, err = initDefenestrateWithAliases(c, []string{"--no-aliases", "def"})
+	c.Assert(err, gc.ErrorMatches, "unrecognized command: jujutest def")
+
+	_, tc, err = initDefenestrateWithAliases(c, []string{"quoted"})
+	c.Assert(err, gc.IsNil)
+	c.Assert(tc.Option, gc.Equals, "very firmly")
+
+	// Aliases may refer to other aliases.
+	_, tc, err = initDefenestrateWithAliases(c, []string{"chained"})
+	c.Assert(err, gc.IsNil)
+	c.Assert(tc.Option, gc.Equals, "firmly")
+
+	_, _, err = initDefenestrateWithAliases(c, []string{"loop"})
+	c.Assert(err, gc.ErrorMatches, "alias loop: loop -> looped -> loop")
+
+	// Aliases cannot replace commands by default.
+	_, tc, err = initDefenestrateWithAliases(c, []string{"defenestrate"})
+	c.Assert(err, gc.IsNil)
+	c.Assert(tc.Option, gc.Equals, "")
+}
+
+func (s *SuperCommandSuite) TestUserAliasOverride(c *gc.C) {
+	filename := filepath.Join(c.MkDir(), "aliases")
+	err := ioutil.WriteFile(filename, []byte(`
+defenestrate = defenestrate --option shadowed
+def = defenestrate
+`), 0644)
+	c.Assert(err, gc.IsNil)
+	// Only the alias named on the command line may shadow a command, so
+	// "def" runs the defenestrate command itself.
+	for _, test := range []struct {
+		args   []string
+		option string
+	}{
+		{[]string{"defenestrate"}, "shadowed"},
+		{[]string{"def"}, ""},
+	} {
+		c.Logf("args %q", test.args)
+		jc := cmd.NewSuperCommand(cmd.SuperCommandParams{
+			Name:                "jujutest",
+			UserAliasesFilename: filename,
+			AllowAliasOverride:  true,
+		})
+		tc := &TestCommand{Name: "defenestrate"}
+		jc.Register(tc)
+		err = cmdtesting.InitCommand(jc, test.args)
+		c.Assert(err, gc.IsNil)
+		c.Check(tc.Option, gc.Equals, test.option)
+	}
 }
 
 func (s *SuperCommandSuite) TestRegister(c *gc.C) {
@@ -125,16 +183,143 @@ func (s *SuperCommandSuite) TestRegister(c *gc.C) {
 	c.Assert(badCall, gc.PanicMatches, `command already registered: "flap"`)
 }
 
+func (s *SuperCommandSuite) TestRegisterAliasCollision(c *gc.C) {
+	jc := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "jujutest"})
+	jc.Register(&TestCommand{Name: "flip", Aliases: []string{"flop"}})
+	badCall := func() { jc.Register(&TestCommand{Name: "flop"}) }
+	c.Assert(badCall, gc.PanicMatches, `command already registered: "flop", as an alias for "flip"`)
+}
+
+func (s *SuperCommandSuite) TestRegisterInvalidName(c *gc.C) {
+	for _, test := range []struct {
+		name    string
+		aliases []string
+		err     string
+	}{{
+		name: "",
+		err:  `invalid command name: name is empty`,
+	}, {
+		name: "flip flop",
+		err:  `invalid command name "flip flop": name contains white space`,
+	}, {
+		name: "flip\t",
+		err:  `invalid command name "flip\\t": name contains white space`,
+	}, {
+		name: "--flip",
+		err:  `invalid command name "--flip": name starts with "-"`,
+	}, {
+		name:    "flip",
+		aliases: []string{"fl ip"},
+		err:     `invalid command name "fl ip": name contains white space`,
+	}} {
+		c.Logf("name %q, aliases %q", test.name, test.aliases)
+		jc := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "jujutest"})
+		badCall := func() { jc.Register(&TestCommand{Name: test.name, Aliases: test.aliases}) }
+		c.Check(badCall, gc.PanicMatches, test.err)
+	}
+}
+
 func (s *SuperCommandSuite) TestAliasesRegistered(c *gc.C) {
 	jc := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "jujutest"})
 	jc.Register(&TestCommand{Name: "flip", Aliases: []string{"flap", "flop"}})
 
 	info := jc.Info()
 	c.Assert(info.Doc, gc.Equals, `commands:
-    flap - alias for 'flip'
+    flip (flap, flop) - flip the juju
+    help              - show help on a command or other topic`)
+}
+
+func (s *SuperCommandSuite) TestCategories(c *gc.C) {
+	jc := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "jujutest"})
+	jc.Register(&TestCommand{Name: "status", Category: "Inspection"})
+	jc.Register(&TestCommand{Name: "deploy", Category: "Deployment"})
+	jc.Register(&TestCommand{Name: "remove", Category: "Deployment", Aliases: []string{"rm"}})
+	jc.Register(&TestCommand{Name: "flip"})
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(jc, ctx, []string{"help", "commands"})
+	c.Assert(code, gc.Equals, 0)
+	c.Assert(cmdtesting.Stdout(ctx), gc.Equals, `
+Deployment:
+deploy       deploy the juju
+remove (rm)  remove the juju
+
+Inspection:
+status       status the juju
+
+Other:
+flip         flip the juju
+help         show help on a command or other topic
+`[1:])
+}
+
+func (s *SuperCommandSuite) TestCategoriesInHelp(c *gc.C) {
+	jc := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "jujutest"})
+	jc.Register(&TestCommand{Name: "deploy", Category: "Deployment"})
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(jc, ctx, []string{"help"})
+	c.Assert(code, gc.Equals, 0)
+	c.Assert(cmdtesting.Stdout(ctx), gc.Matches, "(?s).*"+regexp.QuoteMeta(`
+commands:
+Deployment:
+    deploy - deploy the juju
+
+Other:
+    help   - show help on a command or other topic
+`)+".*")
+	// Categories do not affect how commands are run.
+	ctx = cmdtesting.Context(c)
+	code = cmd.Main(jc, ctx, []string{"deploy", "--option", "value"})
+	c.Assert(code, gc.Equals, 0)
+	c.Assert(cmdtesting.Stdout(ctx), gc.Equals, "value\n")
+}
+
+func (s *SuperCommandSuite) TestRegisterHidden(c *gc.C) {
+	jc := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "jujutest"})
+	jc.Register(&TestCommand{Name: "flip"})
+	jc.RegisterHidden(&TestCommand{Name: "debug-flip", Aliases: []string{"dflip"}})
+
+	info := jc.Info()
+	c.Assert(info.Doc, gc.Equals, `commands:
     flip - flip the juju
-    flop - alias for 'flip'
     help - show help on a command or other topic`)
+
+	for _, name := range []string{"debug-flip", "dflip"} {
+		ctx := cmdtesting.Context(c)
+		code := cmd.Main(jc, ctx, []string{name, "--option", "hidden"})
+		c.Check(code, gc.Equals, 0)
+		c.Check(cmdtesting.Stdout(ctx), gc.Equals, "hidden\n")
+	}
+}
+
+func (s *SuperCommandSuite) TestUnrecognizedCommandSuggestion(c *gc.C) {
+	jc := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "jujutest"})
+	jc.Register(&TestCommand{Name: "status", Aliases: []string{"stat"}})
+	jc.Register(&TestCommand{Name: "deploy"})
+	jc.Register(&TestCommand{Name: "deplot"})
+	jc.RegisterHidden(&TestCommand{Name: "debug-hooks"})
+	jc.RegisterAlias("stats", "status", deprecate{replacement: "status"})
+
+	for i, test := range []struct {
+		name       string
+		suggestion string
+	}{
+		{"statuss", "status"},
+		{"stta", "stat"},
+		// Ties go to the alphabetically first name.
+		{"statsu", "stat"},
+		{"deplo", "deplot"},
+		{"debug-hook", ""},
+		{"xyzzy", ""},
+		{"s", ""},
+	} {
+		c.Logf("test %d: %q", i, test.name)
+		err := cmdtesting.InitCommand(jc, []string{test.name})
+		expected := "unrecognized command: jujutest " + test.name
+		if test.suggestion != "" {
+			expected += "\ndid you mean '" + test.suggestion + "'\\?"
+		}
+		c.Check(err, gc.ErrorMatches, expected)
+	}
 }
 
 func (s *SuperCommandSuite) TestInfo(c *gc.C) {
@@ -223,6 +408,60 @@ func (s *SuperCommandSuite) TestVersionFlag(c *gc.C) {
 	c.Assert(testVersionFlagCommand.version, gc.Equals, "abc.123")
 }
 
+// versionedCommand is a TestCommand with its own version.
+type versionedCommand struct {
+	TestCommand
+}
+
+func (c *versionedCommand) Version() string {
+	return "4.5.6"
+}
+
+func (s *SuperCommandSuite) TestSubcommandVersion(c *gc.C) {
+	for _, test := range []struct {
+		superVersion string
+		args         []string
+		code         int
+		stdout       string
+		stderr       string
+	}{{
+		superVersion: "1.2.3",
+		args:         []string{"blah", "--version"},
+		stdout:       "1.2.3\n",
+	}, {
+		superVersion: "1.2.3",
+		args:         []string{"versioned", "--version"},
+		stdout:       "4.5.6\n",
+	}, {
+		args:   []string{"versioned", "--version", "extra"},
+		stdout: "4.5.6\n",
+	}, {
+		args:   []string{"blah", "--version"},
+		code:   2,
+		stderr: "error: flag provided but not defined: --version\nUsage: jujutest blah [options] <something>\n",
+	}} {
+		c.Logf("args: %q", test.args)
+		jc := cmd.NewSuperCommand(cmd.SuperCommandParams{
+			Name:    "jujutest",
+			Version: test.superVersion,
+		})
+		jc.Register(&TestCommand{Name: "blah"})
+		jc.Register(&versionedCommand{TestCommand{Name: "versioned"}})
+		ctx := cmdtesting.Context(c)
+		code := cmd.Main(jc, ctx, test.args)
+		c.Check(code, gc.Equals, test.code)
+		c.Check(cmdtesting.Stdout(ctx), gc.Equals, test.stdout)
+		c.Check(cmdtesting.Stderr(ctx), gc.Equals, test.stderr)
+	}
+}
+
+func (s *SuperCommandSuite) TestMainVersioner(c *gc.C) {
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(&versionedCommand{TestCommand{Name: "versioned"}}, ctx, []string{"--version"})
+	c.Check(code, gc.Equals, 0)
+	c.Check(cmdtesting.Stdout(ctx), gc.Equals, "4.5.6\n")
+}
+
 func (s *SuperCommandSuite) TestVersionNotProvided(c *gc.C) {
 	jc := cmd.NewSuperCommand(cmd.SuperCommandParams{
 		Name:    "jujutest",
@@ -245,7 +484,8 @@ func (s *SuperCommandSuite) TestVersionNotProvided(c *gc.C) {
 	// juju --version
 	code := cmd.Main(jc, ctx, []string{"--version"})
 	c.Check(code, gc.Equals, baselineCode)
-	c.Assert(stderr.String(), gc.Equals, "error: flag provided but not defined: --version\n")
+	c.Assert(stderr.String(), gc.Equals, "error: flag provided but not defined: --version\n"+
+		"Usage: jujutest [options] <command> ...\n")
 }
 
 func (s *SuperCommandSuite) TestLogging(c *gc.C) {
@@ -261,6 +501,113 @@ func (s *SuperCommandSuite) TestLogging(c *gc.C) {
 	c.Assert(bufferString(ctx.Stderr), gc.Matches, `^.* ERROR .* BAM!\n.* DEBUG .* \(error details.*\).*\n`)
 }
 
+func (s *SuperCommandSuite) TestDebugErrorDetails(c *gc.C) {
+	s.AddCleanup(func(*gc.C) { loggo.ResetWriters() })
+	traced := errors.Annotate(errors.Trace(errors.New("BAM!")), "cannot output")
+	for _, test := range []struct {
+		err    error
+		args   []string
+		stderr string
+	}{{
+		err:    traced,
+		args:   []string{"--debug"},
+		stderr: `(?s).* ERROR .* cannot output: BAM!\nerror details:\n  .*TestDebugErrorDetails:\d+: BAM!\n  .*TestDebugErrorDetails:\d+: \n  .*TestDebugErrorDetails:\d+: cannot output\n.*`,
+	}, {
+		err:    fmt.Errorf("cannot output: %w", fmt.Errorf("connecting: %w", fmt.Errorf("BAM!"))),
+		args:   []string{"--debug"},
+		stderr: `(?s).* ERROR .* cannot output: connecting: BAM!\nerror details:\n  caused by: connecting: BAM!\n  caused by: BAM!\n.*`,
+	}, {
+		err:    traced,
+		stderr: "ERROR cannot output: BAM!\n",
+	}, {
+		// Machine readable output is not cluttered with details.
+		err:    traced,
+		args:   []string{"--debug", "--format", "json"},
+		stderr: `(?s)\{"error":"cannot output: BAM!","code":1\}\n(.* DEBUG [^\n]*\n)*`,
+	}} {
+		c.Logf("args %q, error %v", test.args, test.err)
+		loggo.ResetWriters()
+		sc := cmd.NewSuperCommand(cmd.SuperCommandParams{
+			Name: "jujutest",
+			Log:  &cmd.Log{},
+		})
+		sc.Register(&failingOutputCommand{err: test.err})
+		ctx := cmdtesting.Context(c)
+		code := cmd.Main(sc, ctx, append([]string{"output"}, test.args...))
+		c.Check(code, gc.Equals, 1)
+		c.Check(bufferString(ctx.Stderr), gc.Matches, test.stderr)
+	}
+}
+
+func (s *SuperCommandSuite) TestQuiet(c *gc.C) {
+	s.AddCleanup(func(*gc.C) { loggo.ResetWriters() })
+	for _, test := range []struct {
+		args   []string
+		code   int
+		stdout string
+		stderr string
+	}{{
+		args:   []string{"blah", "-q", "--option", "success!"},
+		stdout: "success!\n",
+	}, {
+		args:   []string{"blah", "--quiet", "--option", "error"},
+		code:   1,
+		stderr: "ERROR BAM!\n",
+	}} {
+		c.Logf("args %q", test.args)
+		loggo.ResetWriters()
+		sc := cmd.NewSuperCommand(cmd.SuperCommandParams{
+			Name: "jujutest",
+			Log:  &cmd.Log{},
+		})
+		sc.RegisterDeprecated(&TestCommand{Name: "blah"}, deprecate{replacement: "bleh"})
+		ctx := cmdtesting.Context(c)
+		code := cmd.Main(sc, ctx, test.args)
+		c.Check(code, gc.Equals, test.code)
+		cmdtesting.CheckOutput(c, ctx, test.stdout, test.stderr)
+	}
+}
+
+func (s *SuperCommandSuite) TestQuietAndVerbose(c *gc.C) {
+	sc := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name: "jujutest",
+		Log:  &cmd.Log{},
+	})
+	sc.Register(&TestCommand{Name: "blah"})
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(sc, ctx, []string{"blah", "-q", "--verbose"})
+	c.Check(code, gc.Equals, 2)
+	cmdtesting.CheckOutput(c, ctx, "", ""+
+		"error: cannot specify --verbose and --quiet together\n"+
+		"Usage: jujutest blah [options] <something>\n")
+}
+
+func (s *SuperCommandSuite) TestRcError(c *gc.C) {
+	sc := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		UsagePrefix: "juju",
+		Name:        "command",
+		Log:         &cmd.Log{},
+	})
+	sc.Register(&TestCommand{Name: "blah"})
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(sc, ctx, []string{"blah", "--option", "rc-error"})
+	c.Assert(code, gc.Equals, 3)
+	c.Assert(bufferString(ctx.Stderr), gc.Equals, "ERROR not found\n")
+}
+
+func (s *SuperCommandSuite) TestAnnotatedRcError(c *gc.C) {
+	sc := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		UsagePrefix: "juju",
+		Name:        "command",
+		Log:         &cmd.Log{},
+	})
+	sc.Register(&TestCommand{Name: "blah"})
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(sc, ctx, []string{"blah", "--option", "annotated-rc-error"})
+	c.Assert(code, gc.Equals, 3)
+	c.Assert(bufferString(ctx.Stderr), gc.Equals, "ERROR lookup: not found\n")
+}
+
 func (s *SuperCommandSuite) TestNotifyRun(c *gc.C) {
 	notifyTests := []struct {
 		usagePrefix string
@@ -429,9 +776,8 @@ func (s *SuperCommandSuite) TestRegisterAlias(c *gc.C) {
 	info := jc.Info()
 	// NOTE: deprecated `bar` not shown in commands.
 	c.Assert(info.Doc, gc.Equals, `commands:
-    foo  - alias for 'test'
-    help - show help on a command or other topic
-    test - to be simple`)
+    help       - show help on a command or other topic
+    test (foo) - to be simple`)
 
 	for _, test := range []struct {
 		name   string
@@ -516,7 +862,7 @@ func (s *SuperCommandSuite) TestRegisterSuperAlias(c *gc.C) {
 			stderr: "WARNING: \"bar-dep\" is deprecated, please use \"bar foo\"\n",
 		}, {
 			args:   []string{"bar-ob", "arg"},
-			stderr: "error: unrecognized command: jujutest bar-ob\n",
+			stderr: "error: unrecognized command: jujutest bar-ob\ndid you mean 'bar-foo'?\n",
 			code:   2,
 		},
 	} {
@@ -592,3 +938,537 @@ func (s *SuperCommandSuite) TestRegisterDeprecated(c *gc.C) {
 		c.Check(cmdtesting.Stdout(ctx), gc.Equals, test.stdout)
 	}
 }
+
+func (s *SuperCommandSuite) TestDefaultCommand(c *gc.C) {
+	for i, test := range []struct {
+		args   []string
+		stdout string
+		stderr string
+		code   int
+	}{{
+		args:   nil,
+		stdout: "\n",
+	}, {
+		args:   []string{"--color", "never"},
+		stdout: "\n",
+	}, {
+		args:   []string{"status", "--option", "explicit"},
+		stdout: "explicit\n",
+	}, {
+		args:   []string{"--help"},
+		stdout: "(?s)Usage: jujutest \\[options\\] <command> \\.\\.\\..*",
+	}, {
+		args:   []string{"unknown"},
+		stderr: "error: unrecognized command: jujutest unknown\n",
+		code:   2,
+	}} {
+		c.Logf("test %d: %q", i, test.args)
+		jc := cmd.NewSuperCommand(cmd.SuperCommandParams{
+			Name:           "jujutest",
+			DefaultCommand: "status",
+		})
+		jc.Register(&TestCommand{Name: "status"})
+		ctx := cmdtesting.Context(c)
+		code := cmd.Main(jc, ctx, test.args)
+		c.Check(code, gc.Equals, test.code)
+		c.Check(cmdtesting.Stdout(ctx), gc.Matches, test.stdout)
+		c.Check(cmdtesting.Stderr(ctx), gc.Equals, test.stderr)
+	}
+}
+
+func (s *SuperCommandSuite) TestHelpToStdoutUsageToStderr(c *gc.C) {
+	jc := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "jujutest"})
+	jc.Register(&TestCommand{Name: "defenestrate"})
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(jc, ctx, []string{"defenestrate", "--help"})
+	c.Check(code, gc.Equals, 0)
+	c.Check(cmdtesting.Stdout(ctx), gc.Matches, "(?s)Usage: jujutest defenestrate \\[options\\] <something>\n\nSummary:\n.*")
+	c.Check(cmdtesting.Stderr(ctx), gc.Equals, "")
+
+	jc = cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "jujutest"})
+	jc.Register(&TestCommand{Name: "defenestrate"})
+	ctx = cmdtesting.Context(c)
+	code = cmd.Main(jc, ctx, []string{"defenestrate", "--unknown"})
+	c.Check(code, gc.Equals, 2)
+	c.Check(cmdtesting.Stdout(ctx), gc.Equals, "")
+	c.Check(cmdtesting.Stderr(ctx), gc.Equals, ""+
+		"error: flag provided but not defined: --unknown\n"+
+		"Usage: jujutest defenestrate [options] <something>\n")
+}
+
+func (s *SuperCommandSuite) TestQualifyErrors(c *gc.C) {
+	s.AddCleanup(func(*gc.C) { loggo.ResetWriters() })
+	for _, test := range []struct {
+		qualify bool
+		nested  bool
+		args    []string
+		stderr  string
+	}{{
+		args:   []string{"blah", "--option", "error"},
+		stderr: "ERROR BAM!\n",
+	}, {
+		qualify: true,
+		args:    []string{"blah", "--option", "error"},
+		stderr:  "ERROR jujutest blah: BAM!\n",
+	}, {
+		qualify: true,
+		args:    []string{"bleh", "--option", "error"},
+		stderr:  "ERROR jujutest bleh: BAM!\n",
+	}, {
+		qualify: true,
+		nested:  true,
+		args:    []string{"storage", "blah", "--option", "error"},
+		stderr:  "ERROR jujutest storage blah: BAM!\n",
+	}} {
+		c.Logf("args %q", test.args)
+		loggo.ResetWriters()
+		sc := cmd.NewSuperCommand(cmd.SuperCommandParams{
+			Name:          "jujutest",
+			Log:           &cmd.Log{},
+			QualifyErrors: test.qualify,
+		})
+		if test.nested {
+			sub := cmd.NewSuperCommand(cmd.SuperCommandParams{
+				Name:    "storage",
+				Purpose: "manage storage",
+			})
+			sub.Register(&TestCommand{Name: "blah"})
+			sc.Register(sub)
+		} else {
+			sc.Register(&TestCommand{Name: "blah"})
+			sc.RegisterAlias("bleh", "blah", nil)
+		}
+		ctx := cmdtesting.Context(c)
+		code := cmd.Main(sc, ctx, test.args)
+		c.Check(code, gc.Equals, 1)
+		cmdtesting.CheckOutput(c, ctx, "", test.stderr)
+	}
+}
+
+func (s *SuperCommandSuite) TestQualifyErrorsRcError(c *gc.C) {
+	s.AddCleanup(func(*gc.C) { loggo.ResetWriters() })
+	sc := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name:          "jujutest",
+		Log:           &cmd.Log{},
+		QualifyErrors: true,
+	})
+	sc.Register(&TestCommand{Name: "blah"})
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(sc, ctx, []string{"blah", "--option", "rc-error"})
+	c.Check(code, gc.Equals, 3)
+	cmdtesting.CheckOutput(c, ctx, "", "ERROR jujutest blah: not found\n")
+}
+
+func (s *SuperCommandSuite) TestQualifyErrorsAnnotatedRcErrorNested(c *gc.C) {
+	s.AddCleanup(func(*gc.C) { loggo.ResetWriters() })
+	sc := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name:          "jujutest",
+		Log:           &cmd.Log{},
+		QualifyErrors: true,
+	})
+	sub := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name:    "storage",
+		Purpose: "manage storage",
+	})
+	sub.Register(&TestCommand{Name: "blah"})
+	sc.Register(sub)
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(sc, ctx, []string{"storage", "blah", "--option", "annotated-rc-error"})
+	c.Check(code, gc.Equals, 3)
+	cmdtesting.CheckOutput(c, ctx, "", "ERROR jujutest storage blah: lookup: not found\n")
+}
+
+func (s *SuperCommandSuite) TestRunHooks(c *gc.C) {
+	s.AddCleanup(func(*gc.C) { loggo.ResetWriters() })
+	var calls []string
+	sc := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name: "jujutest",
+		Log:  &cmd.Log{},
+		PreRun: func(command cmd.Command, ctx *cmd.Context) error {
+			calls = append(calls, "pre "+command.Info().Name)
+			return nil
+		},
+		PostRun: func(command cmd.Command, ctx *cmd.Context, err error) error {
+			calls = append(calls, fmt.Sprintf("post %s %v", command.Info().Name, err))
+			if err != nil {
+				return fmt.Errorf("hooked: %v", err)
+			}
+			return nil
+		},
+	})
+	sc.Register(&TestCommand{Name: "blah"})
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(sc, ctx, []string{"blah", "--option", "success!"})
+	c.Check(code, gc.Equals, 0)
+	c.Check(cmdtesting.Stdout(ctx), gc.Equals, "success!\n")
+	c.Check(calls, gc.DeepEquals, []string{"pre blah", "post blah <nil>"})
+
+	calls = nil
+	loggo.ResetWriters()
+	ctx = cmdtesting.Context(c)
+	code = cmd.Main(sc, ctx, []string{"blah", "--option", "error"})
+	c.Check(code, gc.Equals, 1)
+	c.Check(cmdtesting.Stderr(ctx), gc.Equals, "ERROR hooked: BAM!\n")
+	c.Check(calls, gc.DeepEquals, []string{"pre blah", "post blah BAM!"})
+}
+
+func (s *SuperCommandSuite) TestPreRunError(c *gc.C) {
+	s.AddCleanup(func(*gc.C) { loggo.ResetWriters() })
+	postRun := false
+	sc := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name: "jujutest",
+		Log:  &cmd.Log{},
+		PreRun: func(command cmd.Command, ctx *cmd.Context) error {
+			return fmt.Errorf("not logged in")
+		},
+		PostRun: func(command cmd.Command, ctx *cmd.Context, err error) error {
+			postRun = true
+			return err
+		},
+	})
+	sc.Register(&TestCommand{Name: "blah"})
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(sc, ctx, []string{"blah", "--option", "success!"})
+	c.Check(code, gc.Equals, 1)
+	cmdtesting.CheckOutput(c, ctx, "", "ERROR not logged in\n")
+	c.Check(postRun, gc.Equals, false)
+}
+
+func (s *SuperCommandSuite) TestRunHooksNested(c *gc.C) {
+	var calls []string
+	sc := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name: "jujutest",
+		PreRun: func(command cmd.Command, ctx *cmd.Context) error {
+			calls = append(calls, "pre "+command.Info().Name)
+			return nil
+		},
+		PostRun: func(command cmd.Command, ctx *cmd.Context, err error) error {
+			calls = append(calls, "post "+command.Info().Name)
+			return err
+		},
+	})
+	sub := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name:    "storage",
+		Purpose: "manage storage",
+	})
+	sub.Register(&TestCommand{Name: "blah"})
+	sc.Register(sub)
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(sc, ctx, []string{"storage", "blah", "--option", "success!"})
+	c.Check(code, gc.Equals, 0)
+	c.Check(calls, gc.DeepEquals, []string{"pre blah", "post blah"})
+}
+
+func (s *SuperCommandSuite) TestCommands(c *gc.C) {
+	for _, test := range []struct {
+		args   []string
+		stdout string
+	}{{
+		args:   []string{"--commands"},
+		stdout: "blah\nhelp\nmerge\n",
+	}, {
+		args:   []string{"--commands", "--include-aliases"},
+		stdout: "bl\nblah\nhelp\nmerge\nmrg\n",
+	}, {
+		args:   []string{"--commands", "--include-hidden"},
+		stdout: "bash-completion\nblah\nbleh\nhelp\nmerge\nsecret\nzsh-completion\n",
+	}, {
+		args:   []string{"--commands", "--include-aliases", "--include-hidden"},
+		stdout: "bash-completion\nbl\nblah\nbleh\nhelp\nmerge\nmrg\nsecret\nzsh-completion\n",
+	}} {
+		c.Logf("args %q", test.args)
+		sc := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "jujutest"})
+		sc.Register(&TestCommand{Name: "blah", Aliases: []string{"bl"}})
+		sc.Register(&TestCommand{Name: "merge"})
+		sc.RegisterAlias("mrg", "merge", nil)
+		sc.RegisterHidden(&TestCommand{Name: "secret"})
+		sc.RegisterDeprecated(&TestCommand{Name: "bleh"}, deprecate{replacement: "blah"})
+		ctx := cmdtesting.Context(c)
+		code := cmd.Main(sc, ctx, test.args)
+		c.Check(code, gc.Equals, 0)
+		cmdtesting.CheckOutput(c, ctx, test.stdout, "")
+	}
+}
+
+func (s *SuperCommandSuite) TestCommandsWithArgs(c *gc.C) {
+	sc := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "jujutest"})
+	sc.Register(&TestCommand{Name: "blah"})
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(sc, ctx, []string{"--commands", "blah"})
+	c.Check(code, gc.Equals, 2)
+	c.Check(cmdtesting.Stderr(ctx), gc.Equals, "error: unrecognized args: [\"blah\"]; usage: jujutest [options] <command> ...\n")
+}
+
+// newEmbeddedSuper returns a SuperCommand with another SuperCommand, which
+// has its own version, registered as one of its subcommands.
+func newEmbeddedSuper() *cmd.SuperCommand {
+	sc := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name:    "corp",
+		Version: "1.0",
+		Log:     &cmd.Log{},
+	})
+	sub := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name:    "storage",
+		Purpose: "manage storage",
+		Version: "2.0",
+	})
+	sub.Register(&TestCommand{Name: "blah"})
+	sc.Register(sub)
+	return sc
+}
+
+func (s *SuperCommandSuite) TestEmbedded(c *gc.C) {
+	s.AddCleanup(func(*gc.C) { loggo.ResetWriters() })
+	for _, test := range []struct {
+		args   []string
+		code   int
+		stdout string
+		stderr string
+	}{{
+		args:   []string{"storage", "blah", "--option", "success!"},
+		stdout: "success!\n",
+	}, {
+		args:   []string{"storage", "--version"},
+		stdout: "2.0\n",
+	}, {
+		args:   []string{"--version"},
+		stdout: "1.0\n",
+	}, {
+		args:   []string{"storage", "--commands"},
+		stdout: "blah\nhelp\nversion\n",
+	}, {
+		args:   []string{"storage", "--quiet", "blah", "--option", "success!"},
+		stdout: "success!\n",
+	}, {
+		args:   []string{"storage", "bad"},
+		code:   2,
+		stderr: "error: unrecognized command: corp storage bad\ndid you mean 'blah'?\n",
+	}, {
+		args:   []string{"storage", "blah", "--bad"},
+		code:   2,
+		stderr: "error: flag provided but not defined: --bad\nUsage: corp storage blah [options] <something>\n",
+	}} {
+		c.Logf("args %q", test.args)
+		loggo.ResetWriters()
+		ctx := cmdtesting.Context(c)
+		code := cmd.Main(newEmbeddedSuper(), ctx, test.args)
+		c.Check(code, gc.Equals, test.code)
+		cmdtesting.CheckOutput(c, ctx, test.stdout, test.stderr)
+	}
+}
+
+func (s *SuperCommandSuite) TestEmbeddedHelp(c *gc.C) {
+	s.AddCleanup(func(*gc.C) { loggo.ResetWriters() })
+	for _, args := range [][]string{
+		{"storage", "--help"},
+		{"storage", "help"},
+		{"help", "storage"},
+	} {
+		c.Logf("args %q", args)
+		loggo.ResetWriters()
+		ctx := cmdtesting.Context(c)
+		code := cmd.Main(newEmbeddedSuper(), ctx, args)
+		c.Check(code, gc.Equals, 0)
+		c.Check(cmdtesting.Stdout(ctx), gc.Matches, "Usage: corp storage \\[options\\] <command> ...\n(?s).*")
+	}
+	for _, args := range [][]string{
+		{"storage", "blah", "--help"},
+		{"storage", "help", "blah"},
+		{"help", "storage", "blah"},
+	} {
+		c.Logf("args %q", args)
+		loggo.ResetWriters()
+		ctx := cmdtesting.Context(c)
+		code := cmd.Main(newEmbeddedSuper(), ctx, args)
+		c.Check(code, gc.Equals, 0)
+		c.Check(cmdtesting.Stdout(ctx), gc.Matches, "Usage: corp storage blah \\[options\\] <something>\n(?s).*")
+	}
+}
+
+func (s *SuperCommandSuite) TestProgramName(c *gc.C) {
+	jc := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "jujutest"})
+	jc.Register(&TestCommand{Name: "defenestrate"})
+	ctx := cmdtesting.Context(c)
+	ctx.ProgramName = "jt"
+	code := cmd.Main(jc, ctx, []string{"defenestrate", "--unknown"})
+	c.Check(code, gc.Equals, 2)
+	c.Check(cmdtesting.Stderr(ctx), gc.Equals, ""+
+		"error: flag provided but not defined: --unknown\n"+
+		"Usage: jt defenestrate [options] <something>\n")
+
+	jc = cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "jujutest"})
+	jc.Register(&TestCommand{Name: "defenestrate"})
+	ctx = cmdtesting.Context(c)
+	ctx.ProgramName = "jt"
+	code = cmd.Main(jc, ctx, []string{"--help"})
+	c.Check(code, gc.Equals, 0)
+	c.Check(cmdtesting.Stdout(ctx), gc.Matches, "Usage: jt \\[options\\] <command> ...\n(?s).*")
+}
+
+func (s *SuperCommandSuite) TestProgramNameNotKept(c *gc.C) {
+	jc := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "jujutest"})
+	jc.Register(&TestCommand{Name: "defenestrate"})
+	for i, test := range []struct {
+		programName string
+		usage       string
+	}{
+		{"jt", "Usage: jt defenestrate [options] <something>\n"},
+		{"", "Usage: jujutest defenestrate [options] <something>\n"},
+		{"juju-test", "Usage: juju-test defenestrate [options] <something>\n"},
+	} {
+		c.Logf("test %d: %q", i, test.programName)
+		ctx := cmdtesting.Context(c)
+		ctx.ProgramName = test.programName
+		code := cmd.Main(jc, ctx, []string{"defenestrate", "--unknown"})
+		c.Check(code, gc.Equals, 2)
+		c.Check(cmdtesting.Stderr(ctx), gc.Equals, "error: flag provided but not defined: --unknown\n"+test.usage)
+		c.Check(jc.Name, gc.Equals, "jujutest")
+	}
+}
+
+// wrappedSuperCommand wraps a SuperCommand in another Command, passing on
+// the Context it is given.
+type wrappedSuperCommand struct {
+	cmd.Command
+	super *cmd.SuperCommand
+}
+
+func (c *wrappedSuperCommand) SetContext(ctx *cmd.Context) {
+	c.super.SetContext(ctx)
+}
+
+func (s *SuperCommandSuite) TestProgramNameWrapped(c *gc.C) {
+	jc := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "jujutest"})
+	jc.Register(&TestCommand{Name: "defenestrate"})
+	ctx := cmdtesting.Context(c)
+	ctx.ProgramName = "jt"
+	code := cmd.Main(&wrappedSuperCommand{Command: jc, super: jc}, ctx, []string{"defenestrate", "--unknown"})
+	c.Check(code, gc.Equals, 2)
+	c.Check(cmdtesting.Stderr(ctx), gc.Equals, ""+
+		"error: flag provided but not defined: --unknown\n"+
+		"Usage: jt defenestrate [options] <something>\n")
+}
+
+// globalOptions holds the values of the global flags in
+// TestGlobalFlags.
+type globalOptions struct {
+	verbose bool
+	model   string
+}
+
+// globalOptionsCommand prints the global options it shares with its
+// SuperCommand.
+type globalOptionsCommand struct {
+	cmd.CommandBase
+	options *globalOptions
+}
+
+func (c *globalOptionsCommand) Info() *cmd.Info {
+	return &cmd.Info{Name: "status", Purpose: "show the status"}
+}
+
+func (c *globalOptionsCommand) Run(ctx *cmd.Context) error {
+	fmt.Fprintf(ctx.Stdout, "verbose=%v model=%q\n", c.options.verbose, c.options.model)
+	return nil
+}
+
+func newGlobalOptionsSuper() *cmd.SuperCommand {
+	options := &globalOptions{}
+	jc := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name: "jujutest",
+		GlobalFlags: func(f *gnuflag.FlagSet) {
+			f.BoolVar(&options.verbose, "v", false, "show more output")
+			f.StringVar(&options.model, "m", "", "the model to use")
+		},
+	})
+	jc.Register(&globalOptionsCommand{options: options})
+	return jc
+}
+
+func (s *SuperCommandSuite) TestGlobalFlags(c *gc.C) {
+	for i, args := range [][]string{
+		{"-v", "-m", "foo", "status"},
+		{"status", "-v", "-m", "foo"},
+		{"-v", "status", "-m", "foo"},
+	} {
+		c.Logf("test %d: %q", i, args)
+		ctx := cmdtesting.Context(c)
+		code := cmd.Main(newGlobalOptionsSuper(), ctx, args)
+		c.Check(code, gc.Equals, 0)
+		c.Check(cmdtesting.Stdout(ctx), gc.Equals, `verbose=true model="foo"`+"\n")
+	}
+}
+
+func (s *SuperCommandSuite) TestGlobalFlagsHelp(c *gc.C) {
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(newGlobalOptionsSuper(), ctx, []string{"help", "status"})
+	c.Check(code, gc.Equals, 0)
+	c.Check(cmdtesting.Stdout(ctx), gc.Equals, `Usage: jujutest status
+
+Summary:
+show the status
+
+Global options:
+-m (= "")
+    the model to use
+-v (= false)
+    show more output
+`)
+}
+
+func (s *SuperCommandSuite) TestPrefixMatching(c *gc.C) {
+	for i, test := range []struct {
+		args   []string
+		stdout string
+		stderr string
+		code   int
+	}{{
+		args:   []string{"stat", "--option", "status"},
+		stdout: "status\n",
+	}, {
+		args:   []string{"stop", "--option", "stop"},
+		stdout: "stop\n",
+	}, {
+		args:   []string{"stopi", "--option", "stop"},
+		stdout: "stop\n",
+	}, {
+		args:   []string{"stopp", "--option", "stopper"},
+		stdout: "stopper\n",
+	}, {
+		args:   []string{"ha", "--option", "halt"},
+		stdout: "halt\n",
+	}, {
+		args:   []string{"st"},
+		stderr: "error: ambiguous command: jujutest st\ncould be any of: start, status, stop, stopper\n",
+		code:   2,
+	}, {
+		args:   []string{"sec"},
+		stderr: "error: unrecognized command: jujutest sec\n",
+		code:   2,
+	}} {
+		c.Logf("test %d: %q", i, test.args)
+		jc := cmd.NewSuperCommand(cmd.SuperCommandParams{
+			Name:           "jujutest",
+			PrefixMatching: true,
+		})
+		jc.Register(&TestCommand{Name: "status"})
+		jc.Register(&TestCommand{Name: "start"})
+		jc.Register(&TestCommand{Name: "stop", Aliases: []string{"halt", "stopit"}})
+		jc.Register(&TestCommand{Name: "stopper"})
+		jc.RegisterHidden(&TestCommand{Name: "secret"})
+		ctx := cmdtesting.Context(c)
+		code := cmd.Main(jc, ctx, test.args)
+		c.Check(code, gc.Equals, test.code)
+		c.Check(cmdtesting.Stdout(ctx), gc.Equals, test.stdout)
+		c.Check(cmdtesting.Stderr(ctx), gc.Equals, test.stderr)
+	}
+}
+
+func (s *SuperCommandSuite) TestPrefixMatchingDisabled(c *gc.C) {
+	jc := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "jujutest"})
+	jc.Register(&TestCommand{Name: "status"})
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(jc, ctx, []string{"stat"})
+	c.Check(code, gc.Equals, 2)
+	c.Check(cmdtesting.Stderr(ctx), gc.Equals, "error: unrecognized command: jujutest stat\ndid you mean 'status'?\n")
+}
@@ -0,0 +1,19 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package cmd
+
+import (
+	"errors"
+
+	"github.com/juju/loggo"
+)
+
+// newSyslogWriter reports that logging to syslog is not available on
+// platforms without a syslog daemon.
+func newSyslogWriter(facility, tag string) (loggo.Writer, error) {
+	return nil, errors.New("logging to syslog is not supported on this platform")
+}
@@ -0,0 +1,110 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"log/syslog"
+
+	"github.com/juju/loggo"
+	gitjujutesting "github.com/juju/testing"
+	gc "gopkg.in/check.v1"
+)
+
+type SyslogSuite struct {
+	gitjujutesting.IsolationSuite
+	sink     *fakeSyslog
+	facility syslog.Priority
+	tag      string
+}
+
+var _ = gc.Suite(&SyslogSuite{})
+
+func (s *SyslogSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.sink = &fakeSyslog{}
+	s.PatchValue(&dialSyslog, func(facility syslog.Priority, tag string) (syslogSink, error) {
+		s.facility, s.tag = facility, tag
+		return s.sink, nil
+	})
+	s.AddCleanup(func(*gc.C) {
+		loggo.ResetLoggers()
+		loggo.ResetWriters()
+	})
+}
+
+// fakeSyslog records the entries sent to it, prefixed by their severity.
+type fakeSyslog struct {
+	entries []string
+}
+
+func (f *fakeSyslog) Debug(m string) error   { return f.add("debug", m) }
+func (f *fakeSyslog) Info(m string) error    { return f.add("info", m) }
+func (f *fakeSyslog) Warning(m string) error { return f.add("warning", m) }
+func (f *fakeSyslog) Err(m string) error     { return f.add("err", m) }
+func (f *fakeSyslog) Crit(m string) error    { return f.add("crit", m) }
+
+func (f *fakeSyslog) add(severity, m string) error {
+	f.entries = append(f.entries, severity+": "+m)
+	return nil
+}
+
+func (s *SyslogSuite) context() *Context {
+	return &Context{
+		Stdin:  &bytes.Buffer{},
+		Stdout: &bytes.Buffer{},
+		Stderr: &bytes.Buffer{},
+	}
+}
+
+func (s *SyslogSuite) TestSyslog(c *gc.C) {
+	l := &Log{Syslog: true, SyslogFacility: "local3", SyslogTag: "mytool", Config: "<root>=DEBUG"}
+	ctx := s.context()
+	err := l.Start(ctx)
+	c.Assert(err, gc.IsNil)
+	c.Check(s.facility, gc.Equals, syslog.LOG_LOCAL3)
+	c.Check(s.tag, gc.Equals, "mytool")
+	log := loggo.GetLogger("juju.test")
+	log.Debugf("one")
+	log.Infof("two")
+	log.Warningf("three")
+	log.Errorf("four")
+	log.Criticalf("five")
+	c.Check(s.sink.entries, gc.DeepEquals, []string{
+		"debug: juju.test one",
+		"info: juju.test two",
+		"warning: juju.test three",
+		"err: juju.test four",
+		"crit: juju.test five",
+	})
+	// Warnings are still written to Stderr.
+	c.Check(ctx.Stderr.(*bytes.Buffer).String(), gc.Equals, "WARNING three\nERROR four\nCRITICAL five\n")
+}
+
+func (s *SyslogSuite) TestSyslogDefaultFacility(c *gc.C) {
+	l := &Log{Syslog: true}
+	err := l.Start(s.context())
+	c.Assert(err, gc.IsNil)
+	c.Check(s.facility, gc.Equals, syslog.LOG_USER)
+	c.Check(s.tag, gc.Equals, "")
+}
+
+func (s *SyslogSuite) TestSyslogUnknownFacility(c *gc.C) {
+	l := &Log{Syslog: true, SyslogFacility: "kitchen"}
+	err := l.Start(s.context())
+	c.Assert(err, gc.ErrorMatches, `unknown syslog facility "kitchen", expected one of \(auth\|authpriv\|cron\|.*\|uucp\)`)
+}
+
+func (s *SyslogSuite) TestSyslogUnavailable(c *gc.C) {
+	s.PatchValue(&dialSyslog, func(syslog.Priority, string) (syslogSink, error) {
+		return nil, errors.New("no daemon")
+	})
+	l := &Log{Syslog: true}
+	err := l.Start(s.context())
+	c.Assert(err, gc.ErrorMatches, "cannot connect to syslog: no daemon")
+}
@@ -0,0 +1,98 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package cmd
+
+import (
+	"fmt"
+	"log/syslog"
+	"sort"
+	"time"
+
+	"github.com/juju/loggo"
+)
+
+// syslogFacilities maps the facility names accepted by --syslog-facility
+// to their syslog priorities.
+var syslogFacilities = map[string]syslog.Priority{
+	"kern":     syslog.LOG_KERN,
+	"user":     syslog.LOG_USER,
+	"mail":     syslog.LOG_MAIL,
+	"daemon":   syslog.LOG_DAEMON,
+	"auth":     syslog.LOG_AUTH,
+	"syslog":   syslog.LOG_SYSLOG,
+	"lpr":      syslog.LOG_LPR,
+	"news":     syslog.LOG_NEWS,
+	"uucp":     syslog.LOG_UUCP,
+	"cron":     syslog.LOG_CRON,
+	"authpriv": syslog.LOG_AUTHPRIV,
+	"ftp":      syslog.LOG_FTP,
+	"local0":   syslog.LOG_LOCAL0,
+	"local1":   syslog.LOG_LOCAL1,
+	"local2":   syslog.LOG_LOCAL2,
+	"local3":   syslog.LOG_LOCAL3,
+	"local4":   syslog.LOG_LOCAL4,
+	"local5":   syslog.LOG_LOCAL5,
+	"local6":   syslog.LOG_LOCAL6,
+	"local7":   syslog.LOG_LOCAL7,
+}
+
+// syslogSink is the part of *syslog.Writer used by syslogWriter.
+type syslogSink interface {
+	Debug(m string) error
+	Info(m string) error
+	Warning(m string) error
+	Err(m string) error
+	Crit(m string) error
+}
+
+// dialSyslog connects to the local syslog daemon. It is a variable so
+// that tests can do without one.
+var dialSyslog = func(facility syslog.Priority, tag string) (syslogSink, error) {
+	return syslog.New(facility|syslog.LOG_INFO, tag)
+}
+
+// newSyslogWriter returns a loggo writer that sends log entries to the
+// local syslog daemon with the named facility and the given tag.
+func newSyslogWriter(facility, tag string) (loggo.Writer, error) {
+	priority, ok := syslogFacilities[facility]
+	if !ok {
+		var names []string
+		for name := range syslogFacilities {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown syslog facility %q, expected one of %s", facility, enumChoices(names))
+	}
+	sink, err := dialSyslog(priority, tag)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to syslog: %v", err)
+	}
+	return &syslogWriter{sink}, nil
+}
+
+// syslogWriter is a loggo writer that sends each entry to syslog with the
+// severity matching its level. Syslog adds its own timestamp.
+type syslogWriter struct {
+	sink syslogSink
+}
+
+// Write implements loggo's Writer interface.
+func (w *syslogWriter) Write(level loggo.Level, module, _ string, _ int, _ time.Time, message string) {
+	message = module + " " + message
+	switch {
+	case level >= loggo.CRITICAL:
+		w.sink.Crit(message)
+	case level >= loggo.ERROR:
+		w.sink.Err(message)
+	case level >= loggo.WARNING:
+		w.sink.Warning(message)
+	case level >= loggo.INFO:
+		w.sink.Info(message)
+	default:
+		w.sink.Debug(message)
+	}
+}
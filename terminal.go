@@ -0,0 +1,127 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// defaultTerminalWidth is the width that help text is wrapped to when the
+// width of the terminal cannot be determined.
+const defaultTerminalWidth = 80
+
+// terminalWidthOf returns the width in columns of the terminal that w
+// refers to, and whether w refers to a terminal at all. It is a variable
+// so that tests can pretend to write to a terminal.
+var terminalWidthOf = func(w io.Writer) (int, bool) {
+	f, ok := underlyingWriter(w).(*os.File)
+	if !ok {
+		return 0, false
+	}
+	return fileTerminalWidth(f)
+}
+
+// underlyingWriter returns the writer that w writes through, if it is
+// one of the writers the framework puts in place of Stdout, so that its
+// terminal can be found.
+func underlyingWriter(w io.Writer) io.Writer {
+	for {
+		switch u := w.(type) {
+		case *teeWriter:
+			w = u.w
+		case *outputBuffer:
+			w = u.w
+		default:
+			return w
+		}
+	}
+}
+
+// underlyingReader returns the reader that r reads through, if it is the
+// reader that ReadPassword puts in place of Stdin after it is
+// interrupted, so that its terminal can be found.
+func underlyingReader(r io.Reader) io.Reader {
+	for {
+		u, ok := r.(*interruptedReader)
+		if !ok {
+			return r
+		}
+		r = u.r
+	}
+}
+
+// TerminalWidth returns the width in columns of the terminal that Stdout
+// refers to, or 80 if Stdout is not a terminal.
+func (ctx *Context) TerminalWidth() int {
+	if width, ok := terminalWidthOf(ctx.Stdout); ok && width > 0 {
+		return width
+	}
+	return defaultTerminalWidth
+}
+
+// wrapText wraps the lines of s that do not fit in width columns. The
+// line breaks in s are kept, and lines that start with white space, such
+// as code blocks, are left as they are. The lines continuing a list item
+// starting with "-", "*" or "+" are indented to line up with its text.
+func wrapText(s string, width int) string {
+	lines := strings.Split(s, "\n")
+	var wrapped []string
+	for _, line := range lines {
+		if line == "" || unicode.IsSpace(rune(line[0])) {
+			wrapped = append(wrapped, line)
+			continue
+		}
+		indent := ""
+		if len(line) > 1 && strings.ContainsRune("-*+", rune(line[0])) && line[1] == ' ' {
+			indent = "  "
+		}
+		wrapped = append(wrapped, wrapWords(line, indent, width)...)
+	}
+	return strings.Join(wrapped, "\n")
+}
+
+// wrapIndented wraps the lines of s that start with indent so that they
+// fit in width columns, indenting the lines they are continued on by the
+// same amount. Other lines are left as they are.
+func wrapIndented(s, indent string, width int) string {
+	lines := strings.Split(s, "\n")
+	var wrapped []string
+	for _, line := range lines {
+		if !strings.HasPrefix(line, indent) || strings.TrimSpace(line) == "" {
+			wrapped = append(wrapped, line)
+			continue
+		}
+		text := wrapWords(strings.TrimPrefix(line, indent), "", width-len(indent))
+		for _, l := range text {
+			wrapped = append(wrapped, indent+l)
+		}
+	}
+	return strings.Join(wrapped, "\n")
+}
+
+// wrapWords splits line at spaces into lines of at most width columns,
+// prefixing all but the first with indent. Words longer than a line are
+// not broken.
+func wrapWords(line, indent string, width int) []string {
+	if width <= 0 || len(line) <= width {
+		return []string{line}
+	}
+	var lines []string
+	current := ""
+	for _, word := range strings.Fields(line) {
+		switch {
+		case current == "":
+			current = word
+		case len(current)+1+len(word) > width:
+			lines = append(lines, current)
+			current = indent + word
+		default:
+			current += " " + word
+		}
+	}
+	return append(lines, current)
+}
@@ -0,0 +1,30 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package cmd
+
+import (
+	"errors"
+	"os"
+)
+
+// fileTerminalWidth reports that the width of the terminal is unknown on
+// platforms without the TIOCGWINSZ ioctl.
+func fileTerminalWidth(f *os.File) (int, bool) {
+	return 0, false
+}
+
+// isTerminal reports that f is not a terminal on platforms without
+// termios.
+func isTerminal(f *os.File) bool {
+	return false
+}
+
+// fileDisableEcho reports that echoing cannot be turned off on platforms
+// without termios.
+func fileDisableEcho(f *os.File) (restore func(), err error) {
+	return nil, errors.New("not supported on this platform")
+}
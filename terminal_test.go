@@ -0,0 +1,128 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"os"
+
+	gc "gopkg.in/check.v1"
+	"launchpad.net/gnuflag"
+)
+
+type TerminalSuite struct{}
+
+var _ = gc.Suite(&TerminalSuite{})
+
+func (s *TerminalSuite) patchTerminalWidth(width int) func() {
+	old := terminalWidthOf
+	terminalWidthOf = func(io.Writer) (int, bool) { return width, true }
+	return func() { terminalWidthOf = old }
+}
+
+func (s *TerminalSuite) TestTerminalWidthNotTerminal(c *gc.C) {
+	ctx := &Context{Stdout: &bytes.Buffer{}}
+	c.Assert(ctx.TerminalWidth(), gc.Equals, 80)
+
+	r, w, err := os.Pipe()
+	c.Assert(err, gc.IsNil)
+	defer r.Close()
+	defer w.Close()
+	ctx.Stdout = w
+	c.Assert(ctx.TerminalWidth(), gc.Equals, 80)
+}
+
+func (s *TerminalSuite) TestDevNullIsNotTerminal(c *gc.C) {
+	f, err := os.OpenFile(os.DevNull, os.O_RDWR, 0)
+	c.Assert(err, gc.IsNil)
+	defer f.Close()
+	c.Check(isTerminal(f), gc.Equals, false)
+	c.Check(isTerminalWriter(f), gc.Equals, false)
+	c.Check(isTerminalReader(f), gc.Equals, false)
+}
+
+func (s *TerminalSuite) TestTerminalWidth(c *gc.C) {
+	defer s.patchTerminalWidth(40)()
+	ctx := &Context{Stdout: &bytes.Buffer{}}
+	c.Assert(ctx.TerminalWidth(), gc.Equals, 40)
+}
+
+var wrapTextTests = []struct {
+	about  string
+	text   string
+	width  int
+	expect string
+}{{
+	about:  "short lines are unchanged",
+	text:   "one two\nthree",
+	width:  10,
+	expect: "one two\nthree",
+}, {
+	about:  "long lines are wrapped at spaces",
+	text:   "one two three four five",
+	width:  10,
+	expect: "one two\nthree four\nfive",
+}, {
+	about:  "words longer than a line are not broken",
+	text:   "a extraordinarily long",
+	width:  10,
+	expect: "a\nextraordinarily\nlong",
+}, {
+	about:  "indented lines are kept",
+	text:   "Example:\n\n    juju deploy mysql --to 0 --constraints mem=4G\n",
+	width:  20,
+	expect: "Example:\n\n    juju deploy mysql --to 0 --constraints mem=4G\n",
+}, {
+	about:  "list items are continued under their text",
+	text:   "- one two three four\n* five six",
+	width:  10,
+	expect: "- one two\n  three\n  four\n* five six",
+}}
+
+func (s *TerminalSuite) TestWrapText(c *gc.C) {
+	for i, t := range wrapTextTests {
+		c.Logf("test %d: %s", i, t.about)
+		c.Check(wrapText(t.text, t.width), gc.Equals, t.expect)
+	}
+}
+
+func (s *TerminalSuite) TestWrapIndented(c *gc.C) {
+	text := "--format (= json)\n    Specify output format (csv|json|smart|table)\n"
+	c.Assert(wrapIndented(text, "    ", 30), gc.Equals, ""+
+		"--format (= json)\n"+
+		"    Specify output format\n"+
+		"    (csv|json|smart|table)\n")
+}
+
+func (s *TerminalSuite) TestHelpWrapsToTerminalWidth(c *gc.C) {
+	defer s.patchTerminalWidth(30)()
+	info := &Info{
+		Name:    "verb",
+		Purpose: "do something to a number of things",
+		Doc:     "This paragraph is long enough to need wrapping.\n\n    verb --flag thing-that-is-long\n",
+	}
+	f := gnuflag.NewFlagSet("verb", gnuflag.ContinueOnError)
+	f.String("flag", "", "the flag that does something useful")
+	var stdout bytes.Buffer
+	ctx := &Context{Stdout: &stdout}
+	ctx.Stdout.Write(info.help(f, ctx.TerminalWidth()))
+	c.Assert(stdout.String(), gc.Equals, `Usage: verb [options]
+
+Summary:
+do something to a number of
+things
+
+Options:
+--flag (= "")
+    the flag that does
+    something useful
+
+Details:
+This paragraph is long enough
+to need wrapping.
+
+    verb --flag thing-that-is-long
+`)
+}
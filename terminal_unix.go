@@ -0,0 +1,71 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package cmd
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// fileTerminalWidth returns the width of the terminal that f refers to,
+// as reported by the TIOCGWINSZ ioctl.
+func fileTerminalWidth(f *os.File) (int, bool) {
+	var size struct {
+		rows, cols, xpixel, ypixel uint16
+	}
+	_, _, errno := syscall.Syscall(
+		syscall.SYS_IOCTL,
+		f.Fd(),
+		uintptr(syscall.TIOCGWINSZ),
+		uintptr(unsafe.Pointer(&size)),
+	)
+	if errno != 0 {
+		return 0, false
+	}
+	return int(size.cols), true
+}
+
+// isTerminal reports whether f refers to a terminal, which it does only
+// if the terminal state can be read from it. Other character devices,
+// such as /dev/null, are not terminals.
+func isTerminal(f *os.File) bool {
+	var state syscall.Termios
+	return termiosIoctl(f, ioctlGetTermios, &state) == nil
+}
+
+// fileDisableEcho turns off the echoing of input on the terminal that f
+// refers to, returning a function that restores its previous state.
+func fileDisableEcho(f *os.File) (restore func(), err error) {
+	var state syscall.Termios
+	if err := termiosIoctl(f, ioctlGetTermios, &state); err != nil {
+		return nil, err
+	}
+	noEcho := state
+	noEcho.Lflag &^= syscall.ECHO
+	noEcho.Lflag |= syscall.ICANON | syscall.ISIG
+	if err := termiosIoctl(f, ioctlSetTermios, &noEcho); err != nil {
+		return nil, err
+	}
+	return func() {
+		termiosIoctl(f, ioctlSetTermios, &state)
+	}, nil
+}
+
+// termiosIoctl gets or sets the terminal state of f, depending on request.
+func termiosIoctl(f *os.File, request uintptr, state *syscall.Termios) error {
+	_, _, errno := syscall.Syscall(
+		syscall.SYS_IOCTL,
+		f.Fd(),
+		request,
+		uintptr(unsafe.Pointer(state)),
+	)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// timingNow returns the current time. It is a variable so that tests can
+// control the timings reported.
+var timingNow = time.Now
+
+// timings records how long the phases of a command took, for the
+// --timing flag. It is safe to use from several goroutines at once.
+type timings struct {
+	start time.Time
+
+	mu     sync.Mutex
+	phases []*phaseTiming
+	byName map[string]*phaseTiming
+}
+
+// phaseTiming holds the time spent in one named phase.
+type phaseTiming struct {
+	name  string
+	total time.Duration
+	count int
+}
+
+func newTimings() *timings {
+	return &timings{
+		start:  timingNow(),
+		byName: make(map[string]*phaseTiming),
+	}
+}
+
+// add records that the named phase took d.
+func (t *timings) add(name string, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	phase, ok := t.byName[name]
+	if !ok {
+		phase = &phaseTiming{name: name}
+		t.byName[name] = phase
+		t.phases = append(t.phases, phase)
+	}
+	phase.total += d
+	phase.count++
+}
+
+// noPhase ends a phase that is not being timed.
+func noPhase() {}
+
+// StartPhase starts timing the named phase of the command, and returns a
+// function that ends it, as in
+//
+//	defer ctx.StartPhase("connect")()
+//
+// When the --timing flag of a SuperCommand created with TimingFlag is
+// given, Main writes the time spent in each phase to Stderr once the
+// command has finished. Phases may overlap or be nested, and the times of
+// phases with the same name, such as the attempts of a Retry, are added
+// together. When the flag is not given, StartPhase does nothing.
+func (ctx *Context) StartPhase(name string) (end func()) {
+	t := ctx.timings
+	if t == nil {
+		return noPhase
+	}
+	start := timingNow()
+	return func() {
+		t.add(name, timingNow().Sub(start))
+	}
+}
+
+// writeTimings writes the time spent in each phase timed with
+// StartPhase, followed by the total time taken, to Stderr, if the
+// --timing flag was given.
+func (ctx *Context) writeTimings() {
+	t := ctx.timings
+	if t == nil {
+		return
+	}
+	ctx.timings = nil
+	total := timingNow().Sub(t.start)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	width := len("total")
+	for _, phase := range t.phases {
+		if len(phase.name) > width {
+			width = len(phase.name)
+		}
+	}
+	ctx.ClearProgress()
+	fmt.Fprintln(ctx.Stderr, "Timings:")
+	for _, phase := range t.phases {
+		fmt.Fprintf(ctx.Stderr, "  %-*s  %v", width, phase.name, roundDuration(phase.total))
+		if phase.count > 1 {
+			fmt.Fprintf(ctx.Stderr, " (%d times)", phase.count)
+		}
+		fmt.Fprintln(ctx.Stderr)
+	}
+	fmt.Fprintf(ctx.Stderr, "  %-*s  %v\n", width, "total", roundDuration(total))
+}
+
+// roundDuration rounds d to a precision that is easy to read.
+func roundDuration(d time.Duration) time.Duration {
+	if d < time.Millisecond {
+		return d.Round(time.Microsecond)
+	}
+	return d.Round(time.Millisecond)
+}
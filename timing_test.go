@@ -0,0 +1,96 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	gitjujutesting "github.com/juju/testing"
+	gc "gopkg.in/check.v1"
+)
+
+type TimingSuite struct {
+	gitjujutesting.IsolationSuite
+	now time.Time
+}
+
+var _ = gc.Suite(&TimingSuite{})
+
+func (s *TimingSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.now = time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.PatchValue(&timingNow, func() time.Time { return s.now })
+}
+
+// phasedCommand is a command whose phases take a known time, by moving
+// on the suite's clock.
+type phasedCommand struct {
+	CommandBase
+	suite *TimingSuite
+}
+
+func (c *phasedCommand) Info() *Info {
+	return &Info{Name: "phased"}
+}
+
+func (c *phasedCommand) Run(ctx *Context) error {
+	c.suite.now = c.suite.now.Add(5 * time.Millisecond)
+	end := ctx.StartPhase("connect")
+	c.suite.now = c.suite.now.Add(1500 * time.Millisecond)
+	end()
+	calls := 0
+	err := Retry(ctx, RetryParams{Attempts: 3, Description: "fetch the status"}, func() error {
+		c.suite.now = c.suite.now.Add(100 * time.Millisecond)
+		calls++
+		if calls < 3 {
+			return fmt.Errorf("not yet")
+		}
+		return nil
+	})
+	fmt.Fprintln(ctx.Stdout, "done")
+	return err
+}
+
+func (s *TimingSuite) run(c *gc.C, args ...string) (int, string, string) {
+	jc := NewSuperCommand(SuperCommandParams{
+		Name:       "jujutest",
+		TimingFlag: true,
+	})
+	jc.Register(&phasedCommand{suite: s})
+	var stdout, stderr bytes.Buffer
+	ctx := &Context{
+		Stdin:  &bytes.Buffer{},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	code := Main(jc, ctx, args)
+	return code, stdout.String(), stderr.String()
+}
+
+func (s *TimingSuite) TestTiming(c *gc.C) {
+	code, stdout, stderr := s.run(c, "phased", "--timing")
+	c.Check(code, gc.Equals, 0)
+	c.Check(stdout, gc.Equals, "done\n")
+	c.Check(stderr, gc.Equals, ""+
+		"Timings:\n"+
+		"  connect           1.5s\n"+
+		"  fetch the status  300ms (3 times)\n"+
+		"  total             1.805s\n")
+}
+
+func (s *TimingSuite) TestNoTiming(c *gc.C) {
+	code, stdout, stderr := s.run(c, "phased")
+	c.Check(code, gc.Equals, 0)
+	c.Check(stdout, gc.Equals, "done\n")
+	c.Check(stderr, gc.Equals, "")
+}
+
+func (s *TimingSuite) TestStartPhaseNotTiming(c *gc.C) {
+	ctx := &Context{}
+	end := ctx.StartPhase("connect")
+	end()
+	c.Check(ctx.timings, gc.IsNil)
+}
@@ -0,0 +1,153 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"launchpad.net/gnuflag"
+)
+
+// DurationValue implements gnuflag.Value for a time.Duration, given in the
+// form accepted by time.ParseDuration, such as "30s" or "1h30m".
+type DurationValue time.Duration
+
+var _ gnuflag.Value = (*DurationValue)(nil)
+
+// NewDurationValue is used to create the type passed into the gnuflag.FlagSet Var function.
+// f.Var(cmd.NewDurationValue(defaultValue, &someMember), "name", "help")
+func NewDurationValue(defaultValue time.Duration, target *time.Duration) *DurationValue {
+	value := (*DurationValue)(target)
+	*value = DurationValue(defaultValue)
+	return value
+}
+
+// DurationVar defines a duration flag with the specified name, default
+// value and usage on f.
+func DurationVar(f *gnuflag.FlagSet, p *time.Duration, name string, value time.Duration, usage string) {
+	f.Var(NewDurationValue(value, p), name, usage)
+}
+
+// Implements gnuflag.Value Set.
+func (v *DurationValue) Set(s string) error {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q, expected a number with a unit such as 30s, 5m or 1h", s)
+	}
+	if d < 0 {
+		return fmt.Errorf("invalid duration %q, must not be negative", s)
+	}
+	*v = DurationValue(d)
+	return nil
+}
+
+// Implements gnuflag.Value String.
+func (v *DurationValue) String() string {
+	return time.Duration(*v).String()
+}
+
+// Duration returns the parsed duration.
+func (v *DurationValue) Duration() time.Duration {
+	return time.Duration(*v)
+}
+
+// byteSizeUnits holds the suffixes understood by ByteSizeValue, along
+// with their sizes, largest first within each kind. The suffixes are
+// matched without regard to case.
+var byteSizeUnits = []struct {
+	suffix string
+	size   uint64
+}{
+	{"TiB", 1 << 40},
+	{"GiB", 1 << 30},
+	{"MiB", 1 << 20},
+	{"KiB", 1 << 10},
+	{"TB", 1e12},
+	{"GB", 1e9},
+	{"MB", 1e6},
+	{"KB", 1e3},
+	{"B", 1},
+}
+
+// ByteSizeValue implements gnuflag.Value for a count of bytes. Values are
+// a number with an optional suffix: KB, MB, GB and TB are powers of 1000,
+// and KiB, MiB, GiB and TiB are powers of 1024. A number with no suffix,
+// or the suffix B, is a count of bytes.
+type ByteSizeValue uint64
+
+var _ gnuflag.Value = (*ByteSizeValue)(nil)
+
+// NewByteSizeValue is used to create the type passed into the gnuflag.FlagSet Var function.
+// f.Var(cmd.NewByteSizeValue(defaultValue, &someMember), "name", "help")
+func NewByteSizeValue(defaultValue uint64, target *uint64) *ByteSizeValue {
+	value := (*ByteSizeValue)(target)
+	*value = ByteSizeValue(defaultValue)
+	return value
+}
+
+// ByteSizeVar defines a byte count flag with the specified name, default
+// value and usage on f.
+func ByteSizeVar(f *gnuflag.FlagSet, p *uint64, name string, value uint64, usage string) {
+	f.Var(NewByteSizeValue(value, p), name, usage)
+}
+
+// Implements gnuflag.Value Set.
+func (v *ByteSizeValue) Set(s string) error {
+	n, err := parseByteSize(s)
+	if err != nil {
+		return err
+	}
+	*v = ByteSizeValue(n)
+	return nil
+}
+
+// Implements gnuflag.Value String.
+func (v *ByteSizeValue) String() string {
+	n := uint64(*v)
+	if n == 0 {
+		return "0"
+	}
+	for _, unit := range byteSizeUnits {
+		if unit.size > 1 && n%unit.size == 0 {
+			return strconv.FormatUint(n/unit.size, 10) + unit.suffix
+		}
+	}
+	return strconv.FormatUint(n, 10)
+}
+
+// Bytes returns the parsed count of bytes.
+func (v *ByteSizeValue) Bytes() uint64 {
+	return uint64(*v)
+}
+
+// parseByteSize parses s as described by ByteSizeValue.
+func parseByteSize(s string) (uint64, error) {
+	number, size := strings.TrimSpace(s), uint64(1)
+	for _, unit := range byteSizeUnits {
+		n := len(number) - len(unit.suffix)
+		if n >= 0 && strings.EqualFold(number[n:], unit.suffix) {
+			number, size = strings.TrimSpace(number[:n]), unit.size
+			break
+		}
+	}
+	if n, err := strconv.ParseUint(number, 10, 64); err == nil {
+		if n > math.MaxUint64/size {
+			return 0, fmt.Errorf("invalid size %q, too large", s)
+		}
+		return n * size, nil
+	}
+	f, err := strconv.ParseFloat(number, 64)
+	if err != nil || f < 0 || math.IsInf(f, 0) || math.IsNaN(f) {
+		return 0, fmt.Errorf("invalid size %q, expected a number with an optional unit such as KB, MiB or GB", s)
+	}
+	bytes := f * float64(size)
+	if bytes >= math.MaxUint64 {
+		return 0, fmt.Errorf("invalid size %q, too large", s)
+	}
+	return uint64(math.Ceil(bytes)), nil
+}
@@ -0,0 +1,145 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd_test
+
+import (
+	"time"
+
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/cmd"
+	"github.com/juju/cmd/cmdtesting"
+)
+
+type UnitsSuite struct{}
+
+var _ = gc.Suite(&UnitsSuite{})
+
+func (s *UnitsSuite) TestDurationValue(c *gc.C) {
+	for _, test := range []struct {
+		arg      string
+		expected time.Duration
+		err      string
+	}{{
+		arg:      "30s",
+		expected: 30 * time.Second,
+	}, {
+		arg:      "1h30m",
+		expected: 90 * time.Minute,
+	}, {
+		arg:      "0",
+		expected: 0,
+	}, {
+		arg: "5",
+		err: `invalid value "5" for flag --timeout: invalid duration "5", expected a number with a unit such as 30s, 5m or 1h`,
+	}, {
+		arg: "soon",
+		err: `invalid value "soon" for flag --timeout: invalid duration "soon", .*`,
+	}, {
+		arg: "-5m",
+		err: `invalid value "-5m" for flag --timeout: invalid duration "-5m", must not be negative`,
+	}} {
+		c.Logf("arg %q", test.arg)
+		var timeout time.Duration
+		f := cmdtesting.NewFlagSet()
+		cmd.DurationVar(f, &timeout, "timeout", time.Minute, "")
+		c.Check(timeout, gc.Equals, time.Minute)
+		err := f.Parse(false, []string{"--timeout", test.arg})
+		if test.err != "" {
+			c.Check(err, gc.ErrorMatches, test.err)
+			continue
+		}
+		c.Assert(err, gc.IsNil)
+		c.Check(timeout, gc.Equals, test.expected)
+	}
+}
+
+func (s *UnitsSuite) TestDurationValueString(c *gc.C) {
+	var timeout time.Duration
+	v := cmd.NewDurationValue(90*time.Second, &timeout)
+	c.Check(v.String(), gc.Equals, "1m30s")
+	c.Check(v.Duration(), gc.Equals, 90*time.Second)
+}
+
+func (s *UnitsSuite) TestByteSizeValue(c *gc.C) {
+	for _, test := range []struct {
+		arg      string
+		expected uint64
+		err      string
+	}{{
+		arg:      "1024",
+		expected: 1024,
+	}, {
+		arg:      "10B",
+		expected: 10,
+	}, {
+		arg:      "2KB",
+		expected: 2000,
+	}, {
+		arg:      "2KiB",
+		expected: 2048,
+	}, {
+		arg:      "5MB",
+		expected: 5000000,
+	}, {
+		arg:      "5mib",
+		expected: 5 << 20,
+	}, {
+		arg:      "2GB",
+		expected: 2000000000,
+	}, {
+		arg:      "1.5GiB",
+		expected: 3 << 29,
+	}, {
+		arg:      "1 TiB",
+		expected: 1 << 40,
+	}, {
+		arg: "lots",
+		err: `invalid value "lots" for flag --max-size: invalid size "lots", expected a number with an optional unit such as KB, MiB or GB`,
+	}, {
+		arg: "GB",
+		err: `invalid value "GB" for flag --max-size: invalid size "GB", .*`,
+	}, {
+		arg: "-1MB",
+		err: `invalid value "-1MB" for flag --max-size: invalid size "-1MB", .*`,
+	}, {
+		arg: "5XB",
+		err: `invalid value "5XB" for flag --max-size: invalid size "5XB", .*`,
+	}, {
+		arg: "20000000TiB",
+		err: `invalid value "20000000TiB" for flag --max-size: invalid size "20000000TiB", too large`,
+	}} {
+		c.Logf("arg %q", test.arg)
+		var size uint64
+		f := cmdtesting.NewFlagSet()
+		cmd.ByteSizeVar(f, &size, "max-size", 100, "")
+		c.Check(size, gc.Equals, uint64(100))
+		err := f.Parse(false, []string{"--max-size", test.arg})
+		if test.err != "" {
+			c.Check(err, gc.ErrorMatches, test.err)
+			continue
+		}
+		c.Assert(err, gc.IsNil)
+		c.Check(size, gc.Equals, test.expected)
+	}
+}
+
+func (s *UnitsSuite) TestByteSizeValueString(c *gc.C) {
+	for _, test := range []struct {
+		size     uint64
+		expected string
+	}{
+		{0, "0"},
+		{10, "10"},
+		{2048, "2KiB"},
+		{3 << 30, "3GiB"},
+		{2000000, "2MB"},
+		{1000001, "1000001"},
+	} {
+		var size uint64
+		v := cmd.NewByteSizeValue(test.size, &size)
+		c.Check(v.String(), gc.Equals, test.expected)
+		c.Check(v.Bytes(), gc.Equals, test.size)
+	}
+}
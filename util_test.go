@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io"
 
+	jujuerrors "github.com/juju/errors"
 	"launchpad.net/gnuflag"
 
 	"github.com/juju/cmd"
@@ -21,10 +22,11 @@ func bufferString(stream io.Writer) string {
 // TestCommand is used by several different tests.
 type TestCommand struct {
 	cmd.CommandBase
-	Name    string
-	Option  string
-	Minimal bool
-	Aliases []string
+	Name     string
+	Option   string
+	Minimal  bool
+	Aliases  []string
+	Category string
 }
 
 func (c *TestCommand) Info() *cmd.Info {
@@ -32,11 +34,12 @@ func (c *TestCommand) Info() *cmd.Info {
 		return &cmd.Info{Name: c.Name}
 	}
 	return &cmd.Info{
-		Name:    c.Name,
-		Args:    "<something>",
-		Purpose: c.Name + " the juju",
-		Doc:     c.Name + "-doc",
-		Aliases: c.Aliases,
+		Name:     c.Name,
+		Args:     "<something>",
+		Purpose:  c.Name + " the juju",
+		Doc:      c.Name + "-doc",
+		Aliases:  c.Aliases,
+		Category: c.Category,
 	}
 }
 
@@ -56,6 +59,12 @@ func (c *TestCommand) Run(ctx *cmd.Context) error {
 		return errors.New("BAM!")
 	case "silent-error":
 		return cmd.ErrSilent
+	case "annotated-silent-error":
+		return jujuerrors.Annotate(cmd.ErrSilent, "already reported")
+	case "rc-error":
+		return cmd.NewRcError(3, errors.New("not found"))
+	case "annotated-rc-error":
+		return jujuerrors.Annotate(cmd.NewRcError(3, errors.New("not found")), "lookup")
 	case "echo":
 		_, err := io.Copy(ctx.Stdout, ctx.Stdin)
 		return err
@@ -4,9 +4,39 @@
 package cmd
 
 import (
+	"fmt"
+
 	"launchpad.net/gnuflag"
 )
 
+// Versioner may be implemented by a Command that has its own version. Such
+// a command accepts a --version flag, unless it defines one itself, that
+// prints the version and exits. Subcommands of a SuperCommand that has a
+// version accept the flag whether or not they implement Versioner, and
+// print the SuperCommand's version if they do not.
+type Versioner interface {
+	Version() string
+}
+
+// versionFlagUsage is the usage text of the --version flag.
+const versionFlagUsage = "show the command's version and exit"
+
+// addVersionFlag adds a --version flag that sets show to f, unless f
+// already has a version flag. It reports whether the flag was added.
+func addVersionFlag(f *gnuflag.FlagSet, show *bool) bool {
+	if f.Lookup("version") != nil {
+		return false
+	}
+	f.BoolVar(show, "version", false, versionFlagUsage)
+	return true
+}
+
+// printVersion writes version to the context's Stdout.
+func printVersion(ctx *Context, version string) error {
+	_, err := fmt.Fprintln(ctx.Stdout, version)
+	return err
+}
+
 // versionCommand is a cmd.Command that prints the current version.
 type versionCommand struct {
 	CommandBase
@@ -0,0 +1,189 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// FormatXml marshals value to an indented xml-formatted []byte, unless
+// value is nil. The value is written as a single <result> element:
+//   * structs: one child element for each exported field, named by its
+//              xml tag if it has one and by the field name otherwise;
+//              the "attr" and "omitempty" tag options are honoured
+//   * maps:    one <entry key="..."> child element for each key, sorted
+//   * slices:  one <item> child element for each item
+//   * others:  the value as text
+// XML has no notion of types, so unlike yaml and json the output cannot
+// tell numbers, booleans and strings apart, or an empty list from an
+// absent one. XML namespaces, the other xml tag options and the
+// xml.Marshaler interface are not supported. Use FormatXml only when the
+// consumer of the output cannot read anything else.
+func FormatXml(value interface{}) ([]byte, error) {
+	if value == nil {
+		return nil, nil
+	}
+	var buf bytes.Buffer
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	if err := encodeXml(enc, xml.StartElement{Name: xml.Name{Local: "result"}}, reflect.ValueOf(value)); err != nil {
+		return nil, err
+	}
+	if err := enc.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeXml writes v to enc as an element that starts with start.
+func encodeXml(enc *xml.Encoder, start xml.StartElement, v reflect.Value) error {
+	v = indirect(v)
+	if !v.IsValid() {
+		return encodeTokens(enc, start, start.End())
+	}
+	switch v.Kind() {
+	case reflect.Map:
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+		keys := v.MapKeys()
+		sort.Sort(valuesByString(keys))
+		for _, key := range keys {
+			entry := xml.StartElement{
+				Name: xml.Name{Local: "entry"},
+				Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: fmt.Sprint(key.Interface())}},
+			}
+			if err := encodeXml(enc, entry, v.MapIndex(key)); err != nil {
+				return err
+			}
+		}
+		return enc.EncodeToken(start.End())
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			break
+		}
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+		item := xml.StartElement{Name: xml.Name{Local: "item"}}
+		for i := 0; i < v.Len(); i++ {
+			if err := encodeXml(enc, item, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return enc.EncodeToken(start.End())
+	case reflect.Struct:
+		return encodeXmlStruct(enc, start, v)
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer, reflect.Complex64, reflect.Complex128:
+		return fmt.Errorf("cannot format %s as xml", v.Type())
+	}
+	return encodeTokens(enc, start, xml.CharData(xmlText(v)), start.End())
+}
+
+// encodeXmlStruct writes the struct v to enc as an element that starts
+// with start.
+func encodeXmlStruct(enc *xml.Encoder, start xml.StartElement, v reflect.Value) error {
+	t := v.Type()
+	type child struct {
+		name  string
+		value reflect.Value
+	}
+	var children []child
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" || field.Type == reflect.TypeOf(xml.Name{}) {
+			continue
+		}
+		tag := field.Tag.Get("xml")
+		if tag == "-" {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		name := parts[0]
+		if name == "" {
+			name = field.Name
+		}
+		var attr, omitEmpty bool
+		for _, option := range parts[1:] {
+			switch option {
+			case "attr":
+				attr = true
+			case "omitempty":
+				omitEmpty = true
+			}
+		}
+		value := v.Field(i)
+		if omitEmpty && isEmptyValue(value) {
+			continue
+		}
+		if attr {
+			start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: name}, Value: xmlText(indirect(value))})
+			continue
+		}
+		children = append(children, child{name, value})
+	}
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, child := range children {
+		if err := encodeXml(enc, xml.StartElement{Name: xml.Name{Local: child.name}}, child.value); err != nil {
+			return err
+		}
+	}
+	return enc.EncodeToken(start.End())
+}
+
+// encodeTokens writes tokens to enc.
+func encodeTokens(enc *xml.Encoder, tokens ...xml.Token) error {
+	for _, token := range tokens {
+		if err := enc.EncodeToken(token); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// xmlText returns the text used to write the scalar v in xml.
+func xmlText(v reflect.Value) string {
+	if !v.IsValid() {
+		return ""
+	}
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+		return string(v.Bytes())
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// isEmptyValue reports whether v is the zero value of its type, or an
+// empty map, slice or string, as for the omitempty tag option.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+type valuesByString []reflect.Value
+
+func (v valuesByString) Len() int      { return len(v) }
+func (v valuesByString) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v valuesByString) Less(i, j int) bool {
+	return fmt.Sprint(v[i].Interface()) < fmt.Sprint(v[j].Interface())
+}